@@ -19,6 +19,10 @@ import (
 	"github.com/atinylittleshell/gsh/internal/evaluate"
 	"github.com/atinylittleshell/gsh/internal/filesystem"
 	"github.com/atinylittleshell/gsh/internal/history"
+	"github.com/atinylittleshell/gsh/internal/hooks"
+	"github.com/atinylittleshell/gsh/internal/jobs"
+	"github.com/atinylittleshell/gsh/internal/signals"
+	"github.com/atinylittleshell/gsh/pkg/gline"
 	"go.uber.org/zap"
 	"golang.org/x/term"
 	"mvdan.cc/sh/v3/expand"
@@ -67,8 +71,16 @@ func main() {
 	// Initialize the completion manager
 	completionManager := initializeCompletionManager()
 
+	// Load key bindings before the configuration files, so bind commands in them take precedence
+	keyBindings, keyBindingErrors := initializeKeyBindings()
+
+	// Commands typed at the prompt run as jobs
+	jobManager := jobs.NewManager()
+	traps := signals.NewTraps()
+	hookManager := hooks.NewManager()
+
 	// Initialize the shell interpreter
-	runner, err := initializeRunner(analyticsManager, historyManager, completionManager)
+	runner, err := initializeRunner(analyticsManager, historyManager, completionManager, keyBindings, jobManager, traps)
 	if err != nil {
 		panic(err)
 	}
@@ -82,6 +94,10 @@ func main() {
 
 	analyticsManager.Logger = logger
 
+	for _, err := range keyBindingErrors {
+		logger.Debug("skipped unsupported inputrc line", zap.Error(err))
+	}
+
 	logger.Info("-------- new gsh session --------", zap.Any("args", os.Args))
 
 	appupdate.HandleSelfUpdate(
@@ -93,7 +109,7 @@ func main() {
 	)
 
 	// Start running
-	err = run(runner, historyManager, analyticsManager, completionManager, logger)
+	err = run(runner, historyManager, analyticsManager, completionManager, keyBindings, jobManager, traps, hookManager, logger)
 
 	// Handle exit status
 	if code, ok := interp.IsExitStatus(err); ok {
@@ -111,9 +127,23 @@ func run(
 	historyManager *history.HistoryManager,
 	analyticsManager *analytics.AnalyticsManager,
 	completionManager *completion.CompletionManager,
+	keyBindings *gline.KeyBindings,
+	jobManager *jobs.Manager,
+	traps *signals.Traps,
+	hookManager *hooks.Manager,
 	logger *zap.Logger,
-) error {
+) (err error) {
 	ctx := context.Background()
+	defer func() {
+		exitCode := 0
+		if status, ok := interp.IsExitStatus(err); ok {
+			exitCode = int(status)
+		} else if err != nil {
+			exitCode = 1
+		}
+		hookManager.Exit(ctx, runner, exitCode)
+		traps.Run(ctx, runner, signals.Exit)
+	}()
 
 	// gsh -c "echo hello"
 	if *command != "" {
@@ -123,7 +153,7 @@ func run(
 	// gsh
 	if flag.NArg() == 0 {
 		if term.IsTerminal(int(os.Stdin.Fd())) {
-			return core.RunInteractiveShell(ctx, runner, historyManager, analyticsManager, completionManager, logger)
+			return core.RunInteractiveShell(ctx, runner, historyManager, analyticsManager, completionManager, keyBindings, jobManager, traps, hookManager, logger)
 		}
 
 		return bash.RunBashScriptFromReader(ctx, runner, os.Stdin, "gsh")
@@ -139,6 +169,20 @@ func run(
 	return nil
 }
 
+// chainCallHandlers runs call handlers in order, each on the arguments the
+// previous one returned
+func chainCallHandlers(handlers ...interp.CallHandlerFunc) interp.CallHandlerFunc {
+	return func(ctx context.Context, args []string) ([]string, error) {
+		for _, handler := range handlers {
+			var err error
+			if args, err = handler(ctx, args); err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+}
+
 func initializeLogger(runner *interp.Runner) (*zap.Logger, error) {
 	logLevel := environment.GetLogLevel(runner)
 	if BUILD_VERSION == "dev" {
@@ -185,8 +229,33 @@ func initializeCompletionManager() *completion.CompletionManager {
 	return completion.NewCompletionManager()
 }
 
+// initializeKeyBindings loads the readline inputrc file, followed by gsh's own ~/.gsh_inputrc.
+// Readline features gsh doesn't support are common in inputrc files, so those errors
+// are returned for logging rather than shown.
+func initializeKeyBindings() (*gline.KeyBindings, []error) {
+	keyBindings := gline.NewKeyBindings()
+
+	inputrc := os.Getenv("INPUTRC")
+	if inputrc == "" {
+		inputrc = filepath.Join(core.HomeDir(), ".inputrc")
+	}
+	var errs []error
+	if _, err := os.Stat(inputrc); err == nil {
+		errs = keyBindings.LoadInputrc(inputrc)
+	}
+
+	gshInputrc := filepath.Join(core.HomeDir(), ".gsh_inputrc")
+	if _, err := os.Stat(gshInputrc); err == nil {
+		for _, err := range keyBindings.LoadInputrc(gshInputrc) {
+			fmt.Fprintf(os.Stderr, "Key binding file contains errors: %v\n", err)
+		}
+	}
+
+	return keyBindings, errs
+}
+
 // initializeRunner loads the shell configuration files and sets up the interpreter.
-func initializeRunner(analyticsManager *analytics.AnalyticsManager, historyManager *history.HistoryManager, completionManager *completion.CompletionManager) (*interp.Runner, error) {
+func initializeRunner(analyticsManager *analytics.AnalyticsManager, historyManager *history.HistoryManager, completionManager *completion.CompletionManager, keyBindings *gline.KeyBindings, jobManager *jobs.Manager, traps *signals.Traps) (*interp.Runner, error) {
 	shellPath, err := os.Executable()
 	if err != nil {
 		panic(err)
@@ -201,6 +270,7 @@ func initializeRunner(analyticsManager *analytics.AnalyticsManager, historyManag
 	env := expand.Environ(dynamicEnv)
 
 	var runner *interp.Runner
+	options := bash.NewOptions(keyBindings)
 
 	// Create interpreter with all necessary configuration in a single call
 	runner, err = interp.New(
@@ -209,17 +279,34 @@ func initializeRunner(analyticsManager *analytics.AnalyticsManager, historyManag
 		interp.StdIO(os.Stdin, os.Stdout, os.Stderr),
 		interp.ExecHandlers(
 			bash.NewTypesetCommandHandler(),
-			bash.SetBuiltinHandler(),
+			bash.NewOptionCommandHandler(options),
 			analytics.NewAnalyticsCommandHandler(analyticsManager),
 			evaluate.NewEvaluateCommandHandler(analyticsManager),
 			history.NewHistoryCommandHandler(historyManager),
 			completion.NewCompleteCommandHandler(completionManager),
+			bash.NewBindCommandHandler(keyBindings),
+			signals.NewTrapCommandHandler(traps),
+			hooks.NewAddHookCommandHandler(),
+			// Starts the processes of commands, so it comes last
+			jobs.NewJobCommandHandler(jobManager),
 		),
+		interp.CallHandler(chainCallHandlers(
+			bash.NewOptionCallHandler(options),
+			signals.NewTrapCallHandler(traps),
+			hooks.NewAddHookCallHandler(),
+			jobs.NewJobCallHandler(jobManager),
+		)),
+		interp.OpenHandler(bash.NewNoclobberOpenHandler(options)),
 	)
 	if err != nil {
 		panic(err)
 	}
 
+	// compgen runs completion functions in the runner, including in the config files
+	completionManager.SetRunner(runner)
+	// set -o and shopt list the interpreter's options, and autocd looks up commands
+	options.SetRunner(runner)
+
 	// load default vars
 	if err := bash.RunBashScriptFromReader(
 		context.Background(),
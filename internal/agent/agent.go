@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/signal"
 	"strings"
 
 	"github.com/atinylittleshell/gsh/internal/agent/tools"
 	"github.com/atinylittleshell/gsh/internal/environment"
 	"github.com/atinylittleshell/gsh/internal/history"
+	"github.com/atinylittleshell/gsh/internal/signals"
 	"github.com/atinylittleshell/gsh/internal/styles"
 	"github.com/atinylittleshell/gsh/internal/utils"
 	"github.com/atinylittleshell/gsh/pkg/gline"
@@ -145,22 +145,22 @@ func (agent *Agent) Chat(prompt string) (<-chan string, error) {
 
 	// Set up signal handling
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
+	signals.Notify(signalChan, os.Interrupt)
 
 	go func() {
 		select {
 		case <-signalChan:
 			cancel()
-			signal.Stop(signalChan)
+			signals.Stop(signalChan)
 		case <-ctx.Done():
-			signal.Stop(signalChan)
+			signals.Stop(signalChan)
 		}
 	}()
 
 	go func() {
 		defer close(responseChannel)
 		defer cancel()
-		defer signal.Stop(signalChan)
+		defer signals.Stop(signalChan)
 
 		continueSession := true
 
@@ -7,6 +7,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/atinylittleshell/gsh/internal/styles"
 	"github.com/atinylittleshell/gsh/internal/utils"
 	"go.uber.org/zap"
 	"mvdan.cc/sh/v3/interp"
@@ -14,7 +15,7 @@ import (
 )
 
 func getDiff(runner *interp.Runner, logger *zap.Logger, file1, file2 string) (string, error) {
-	command := fmt.Sprintf("git diff --color=always --no-index %s %s", file1, file2)
+	command := fmt.Sprintf("git diff --color=never --no-index %s %s", file1, file2)
 
 	var prog *syntax.Stmt
 	err := syntax.NewParser().Stmts(strings.NewReader(command), func(stmt *syntax.Stmt) bool {
@@ -54,6 +55,34 @@ func getDiff(runner *interp.Runner, logger *zap.Logger, file1, file2 string) (st
 	result = strings.ReplaceAll(result, " a"+file1, " "+utils.HideHomeDirPath(runner, file1))
 	result = strings.ReplaceAll(result, file1, " "+utils.HideHomeDirPath(runner, file1))
 
-	return result, nil
+	return colorizeDiff(result), nil
+}
+
+// colorizeDiff applies the diff styles of the theme to the lines of a diff
+func colorizeDiff(diff string) string {
+	lines := strings.Split(diff, "\n")
+	inHeader := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "diff ") {
+			inHeader = true
+		}
+
+		style := ""
+		switch {
+		case inHeader:
+			style = styles.DiffHeader
+			inHeader = !strings.HasPrefix(line, "+++ ")
+		case strings.HasPrefix(line, "@@"):
+			style = styles.DiffHunk
+		case strings.HasPrefix(line, "+"):
+			style = styles.DiffAdded
+		case strings.HasPrefix(line, "-"):
+			style = styles.DiffRemoved
+		}
+		if style != "" {
+			lines[i] = styles.Render(style, line)
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/atinylittleshell/gsh/internal/environment"
 	"github.com/atinylittleshell/gsh/internal/styles"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"go.uber.org/zap"
@@ -35,11 +36,11 @@ type PermissionsCompletionProvider struct {
 }
 
 // GetCompletions returns the permission atoms as completion suggestions
-func (p *PermissionsCompletionProvider) GetCompletions(line string, pos int) []string {
+func (p *PermissionsCompletionProvider) GetCompletions(line string, pos int) []shellinput.CompletionCandidate {
 	// Return the command prefixes as suggestions
-	suggestions := make([]string, len(p.state.atoms))
+	suggestions := make([]shellinput.CompletionCandidate, len(p.state.atoms))
 	for i, atom := range p.state.atoms {
-		suggestions[i] = atom.Command
+		suggestions[i] = shellinput.CompletionCandidate{Value: atom.Command, Kind: shellinput.CompletionCommand}
 	}
 	return suggestions
 }
@@ -324,7 +325,7 @@ func (m *simplePermissionsModel) View() string {
 	var content strings.Builder
 
 	// Header
-	content.WriteString(styles.AGENT_QUESTION(fmt.Sprintf("Managing permissions for: %s\n\n", m.state.originalCommand)))
+	content.WriteString(styles.Render(styles.PermissionTitle, fmt.Sprintf("Managing permissions for: %s\n\n", m.state.originalCommand)))
 	content.WriteString("Permission Management - Toggle permissions for command prefixes:\n\n")
 
 	// Show each option with clear formatting like the completion box
@@ -338,7 +339,7 @@ func (m *simplePermissionsModel) View() string {
 		// Checkbox
 		checkbox := "[ ]"
 		if atom.Enabled {
-			checkbox = "[✓]"
+			checkbox = styles.Render(styles.PermissionEnabled, "[✓]")
 		}
 
 		// Command (truncate if needed)
@@ -346,13 +347,17 @@ func (m *simplePermissionsModel) View() string {
 		if len(command) > 60 {
 			command = command[:57] + "..."
 		}
+		if i == m.state.selectedIndex {
+			indicator = styles.Render(styles.PermissionSelected, indicator)
+			command = styles.Render(styles.PermissionSelected, command)
+		}
 
 		content.WriteString(fmt.Sprintf("%s%s %s\n", indicator, checkbox, command))
 	}
 
 	content.WriteString("\n")
-	content.WriteString("Controls: j/k=navigate, space=toggle, enter=apply, esc=cancel\n")
-	content.WriteString("Direct: y=yes (one-time), n=no (deny)\n")
+	content.WriteString(styles.Render(styles.PermissionHint, "Controls: j/k=navigate, space=toggle, enter=apply, esc=cancel\n"))
+	content.WriteString(styles.Render(styles.PermissionHint, "Direct: y=yes (one-time), n=no (deny)\n"))
 
 	// Current state
 	currentCmd := m.state.atoms[m.state.selectedIndex].Command
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	tea "github.com/charmbracelet/bubbletea"
@@ -334,7 +335,7 @@ func TestPermissionsCompletionProvider(t *testing.T) {
 	// Test GetCompletions
 	completions := provider.GetCompletions("test", 4)
 	expected := []string{"ls", "ls -la", "git status"}
-	assert.Equal(t, expected, completions)
+	assert.Equal(t, expected, shellinput.CompletionValues(completions))
 
 	// Test GetHelpInfo
 	helpInfo := provider.GetHelpInfo("test", 4)
@@ -23,7 +23,9 @@ var defaultUserConfirmation = func(logger *zap.Logger, question string, explanat
 	prompt :=
 		styles.AGENT_QUESTION(question + " (y/N/manage/freeform) ")
 
-	line, err := gline.Gline(prompt, []string{}, explanation, nil, nil, nil, logger, gline.NewOptions())
+	options := gline.NewOptions()
+	options.Styles = styles.GlineStyles()
+	line, err := gline.Gline(prompt, []string{}, explanation, nil, nil, nil, logger, options)
 	if err != nil {
 		// Check if the error is specifically from Ctrl+C interruption
 		if err == gline.ErrInterrupted {
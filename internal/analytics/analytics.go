@@ -27,6 +27,38 @@ type AnalyticsEntry struct {
 	Actual     string
 }
 
+// PredictionMetric records how a single prediction was served
+type PredictionMetric struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+
+	Source    string `gorm:"index"`
+	HasPrefix bool
+	LatencyMs int64
+}
+
+// PredictionSourceStats summarizes the predictions served from one source
+type PredictionSourceStats struct {
+	Source       string
+	Count        int64
+	AvgLatencyMs float64
+}
+
+// PredictionStats summarizes prediction latency and cache effectiveness
+type PredictionStats struct {
+	Total   int64
+	Hits    int64 // Predictions served from the cache or a prefetch
+	Sources []PredictionSourceStats
+}
+
+// HitRate returns the fraction of predictions served from the cache or a prefetch
+func (s PredictionStats) HitRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Total)
+}
+
 func NewAnalyticsManager(dbFilePath string) (*AnalyticsManager, error) {
 	db, err := gorm.Open(sqlite.Open(dbFilePath), &gorm.Config{})
 	if err != nil {
@@ -34,7 +66,7 @@ func NewAnalyticsManager(dbFilePath string) (*AnalyticsManager, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&AnalyticsEntry{})
+	db.AutoMigrate(&AnalyticsEntry{}, &PredictionMetric{})
 
 	return &AnalyticsManager{
 		db: db,
@@ -67,9 +99,47 @@ func (analyticsManager *AnalyticsManager) GetRecentEntries(limit int) ([]Analyti
 
 func (analyticsManager *AnalyticsManager) ResetAnalytics() error {
 	result := analyticsManager.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&AnalyticsEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	result = analyticsManager.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&PredictionMetric{})
+	return result.Error
+}
+
+// RecordPrediction stores the source and latency of a served prediction
+func (analyticsManager *AnalyticsManager) RecordPrediction(source string, hasPrefix bool, latency time.Duration) error {
+	metric := PredictionMetric{
+		Source:    source,
+		HasPrefix: hasPrefix,
+		LatencyMs: latency.Milliseconds(),
+	}
+
+	result := analyticsManager.db.Create(&metric)
 	return result.Error
 }
 
+// GetPredictionStats aggregates all recorded prediction metrics by source
+func (analyticsManager *AnalyticsManager) GetPredictionStats() (PredictionStats, error) {
+	var sources []PredictionSourceStats
+	result := analyticsManager.db.Model(&PredictionMetric{}).
+		Select("source, count(*) as count, avg(latency_ms) as avg_latency_ms").
+		Group("source").
+		Order("source").
+		Scan(&sources)
+	if result.Error != nil {
+		return PredictionStats{}, result.Error
+	}
+
+	stats := PredictionStats{Sources: sources}
+	for _, source := range sources {
+		stats.Total += source.Count
+		if source.Source == "cache" || source.Source == "prefetch" {
+			stats.Hits += source.Count
+		}
+	}
+	return stats, nil
+}
+
 func (analyticsManager *AnalyticsManager) DeleteEntry(id uint) error {
 	result := analyticsManager.db.Delete(&AnalyticsEntry{}, id)
 	if result.Error != nil {
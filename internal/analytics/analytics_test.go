@@ -175,3 +175,38 @@ func TestResetAnalytics(t *testing.T) {
 	assert.Len(t, entries, 1)
 }
 
+
+func TestPredictionStats(t *testing.T) {
+	analyticsManager, err := NewAnalyticsManager(":memory:")
+	assert.NoError(t, err, "Failed to create analytics manager")
+
+	stats, err := analyticsManager.GetPredictionStats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Total)
+	assert.Equal(t, 0.0, stats.HitRate())
+
+	assert.NoError(t, analyticsManager.RecordPrediction("llm", true, 400*time.Millisecond))
+	assert.NoError(t, analyticsManager.RecordPrediction("llm", false, 600*time.Millisecond))
+	assert.NoError(t, analyticsManager.RecordPrediction("cache", true, 0))
+	assert.NoError(t, analyticsManager.RecordPrediction("prefetch", false, 100*time.Millisecond))
+	assert.NoError(t, analyticsManager.RecordPrediction("local", true, 2*time.Second))
+
+	stats, err = analyticsManager.GetPredictionStats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stats.Total)
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, 0.4, stats.HitRate())
+
+	assert.Len(t, stats.Sources, 4)
+	assert.Equal(t, "cache", stats.Sources[0].Source)
+	assert.Equal(t, "llm", stats.Sources[1].Source)
+	assert.Equal(t, int64(2), stats.Sources[1].Count)
+	assert.Equal(t, 500.0, stats.Sources[1].AvgLatencyMs)
+	assert.Equal(t, "local", stats.Sources[2].Source)
+
+	// Resetting analytics also clears prediction metrics
+	assert.NoError(t, analyticsManager.ResetAnalytics())
+	stats, err = analyticsManager.GetPredictionStats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Total)
+}
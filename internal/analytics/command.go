@@ -46,6 +46,15 @@ func NewAnalyticsCommandHandler(analyticsManager *AnalyticsManager) func(next in
 					printAnalyticsHelp()
 					return nil
 
+				case "-s", "--stats":
+					// Show prediction latency and cache hit rate
+					stats, err := analyticsManager.GetPredictionStats()
+					if err != nil {
+						return fmt.Errorf("failed to get prediction stats: %v", err)
+					}
+					printPredictionStats(stats)
+					return nil
+
 				case "-n", "--count":
 					// Show total count of entries
 					count, err := analyticsManager.GetTotalCount()
@@ -97,9 +106,23 @@ func printAnalyticsHelp() {
 		"  -d, --delete   delete analytics entry at offset",
 		"  -h, --help     display this help message",
 		"  -n, --count    display total number of entries",
+		"  -s, --stats    display prediction latency and cache hit rate",
 		"",
 		"If n is given, display only the last n entries.",
 		"If no options are given, display the analytics list with line numbers.",
 	}
 	fmt.Println(strings.Join(help, "\n"))
 }
+
+func printPredictionStats(stats PredictionStats) {
+	if stats.Total == 0 {
+		fmt.Println("No predictions recorded yet.")
+		return
+	}
+
+	fmt.Printf("Total predictions: %d\n", stats.Total)
+	fmt.Printf("Cache hit rate: %.1f%%\n", stats.HitRate()*100)
+	for _, source := range stats.Sources {
+		fmt.Printf("  %-10s %6d predictions, avg latency %.0fms\n", source.Source, source.Count, source.AvgLatencyMs)
+	}
+}
@@ -11,42 +11,6 @@ import (
 	"mvdan.cc/sh/v3/syntax"
 )
 
-// Global variable to track if exit-on-error is enabled (like bash 'set -e')
-var exitOnError bool = false
-
-// SetBuiltinHandler handles the 'set' builtin command, supporting '-e' option
-func SetBuiltinHandler() func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
-	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
-		return func(ctx context.Context, args []string) error {
-			if len(args) == 0 {
-				return next(ctx, args)
-			}
-
-			// Check if this is the 'set' command
-			if args[0] != "set" {
-				return next(ctx, args)
-			}
-
-			// Handle 'set -e' and 'set +e'
-			for i := 1; i < len(args); i++ {
-				switch args[i] {
-				case "-e":
-					exitOnError = true
-				case "+e":
-					exitOnError = false
-				}
-			}
-
-			return nil
-		}
-	}
-}
-
-// ShouldExitOnError returns true if exit-on-error is currently enabled
-func ShouldExitOnError() bool {
-	return exitOnError
-}
-
 func PreprocessTypesetCommands(input string) string {
 	// Handle edge cases
 	if input == "" {
@@ -403,9 +367,23 @@ func RunBashScriptFromReader(ctx context.Context, runner *interp.Runner, reader
 	if err != nil {
 		return err
 	}
+	AllowClobber(prog)
 	return runner.Run(ctx, prog)
 }
 
+// RunStatements runs the statements of file one by one, as running the whole
+// file would also run the interpreter's own exit handling, and reports whether
+// they exited the shell
+func RunStatements(ctx context.Context, runner *interp.Runner, file *syntax.File) bool {
+	for _, stmt := range file.Stmts {
+		_ = runner.Run(ctx, stmt)
+		if runner.Exited() {
+			return true
+		}
+	}
+	return false
+}
+
 func RunBashScriptFromFile(ctx context.Context, runner *interp.Runner, filePath string) error {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -0,0 +1,202 @@
+package bash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// NewBindCommandHandler handles the 'bind' builtin, which lists and changes the key bindings of the line editor
+func NewBindCommandHandler(keyBindings *gline.KeyBindings) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			if len(args) == 0 || args[0] != "bind" {
+				return next(ctx, args)
+			}
+
+			hc := interp.HandlerCtx(ctx)
+			if err := handleBindCommand(keyBindings, hc.Stdout, args[1:]); err != nil {
+				fmt.Fprintf(hc.Stderr, "bind: %v\n", err)
+				return interp.NewExitStatus(1)
+			}
+			return nil
+		}
+	}
+}
+
+func handleBindCommand(keyBindings *gline.KeyBindings, out io.Writer, args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			// Remaining arguments are bindings in inputrc format
+			for _, line := range args[i:] {
+				if err := keyBindings.ParseBindingLine(line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// Options that take an argument
+		optionArgument := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s: option requires an argument", arg)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch arg {
+		case "-p":
+			printBindings(keyBindings, out, gline.BindingAction, true)
+		case "-P":
+			printBindings(keyBindings, out, gline.BindingAction, false)
+		case "-s":
+			printBindings(keyBindings, out, gline.BindingMacro, true)
+			printBindings(keyBindings, out, gline.BindingAgentMacro, true)
+		case "-S":
+			printBindings(keyBindings, out, gline.BindingMacro, false)
+			printBindings(keyBindings, out, gline.BindingAgentMacro, false)
+		case "-X":
+			printBindings(keyBindings, out, gline.BindingShellCommand, true)
+		case "-v":
+			printBindVariables(keyBindings, out)
+		case "-l":
+			for _, action := range gline.BindableActions() {
+				fmt.Fprintln(out, action)
+			}
+		case "-x":
+			value, err := optionArgument()
+			if err != nil {
+				return err
+			}
+			binding, err := gline.ParseShellCommandBinding(value)
+			if err != nil {
+				return err
+			}
+			if err := keyBindings.Bind(binding); err != nil {
+				return err
+			}
+		case "-q":
+			action, err := optionArgument()
+			if err != nil {
+				return err
+			}
+			if !gline.IsBindableAction(action) {
+				return fmt.Errorf("`%s': unknown function name", action)
+			}
+			printActionKeys(keyBindings, out, action)
+		case "-u":
+			action, err := optionArgument()
+			if err != nil {
+				return err
+			}
+			if !gline.IsBindableAction(action) {
+				return fmt.Errorf("`%s': unknown function name", action)
+			}
+			keyBindings.UnbindAction(action)
+		case "-r":
+			sequence, err := optionArgument()
+			if err != nil {
+				return err
+			}
+			keys, err := gline.ParseKeySequence(sequence)
+			if err != nil {
+				return err
+			}
+			keyBindings.Unbind(keys)
+		case "-f":
+			path, err := optionArgument()
+			if err != nil {
+				return err
+			}
+			if errs := keyBindings.LoadInputrc(path); len(errs) > 0 {
+				return errs[0]
+			}
+		case "-m":
+			// Only a single keymap is supported
+			if _, err := optionArgument(); err != nil {
+				return err
+			}
+		case "-h", "--help":
+			printBindHelp(out)
+		default:
+			return fmt.Errorf("%s: invalid option", arg)
+		}
+	}
+	return nil
+}
+
+// printBindings lists the bindings of one kind, either in inputrc format or for reading
+func printBindings(keyBindings *gline.KeyBindings, out io.Writer, kind gline.BindingKind, inputrc bool) {
+	for _, binding := range keyBindings.List() {
+		if binding.Kind != kind {
+			continue
+		}
+		if inputrc {
+			fmt.Fprintln(out, gline.FormatBinding(binding))
+			continue
+		}
+		keys := gline.FormatKeySequence(binding.Keys)
+		switch kind {
+		case gline.BindingAction:
+			fmt.Fprintf(out, "%s can be found on \"%s\".\n", binding.Value, keys)
+		default:
+			fmt.Fprintf(out, "%s outputs %s\n", keys, binding.Value)
+		}
+	}
+}
+
+func printActionKeys(keyBindings *gline.KeyBindings, out io.Writer, action string) {
+	var keys []string
+	for _, binding := range keyBindings.List() {
+		if binding.Kind == gline.BindingAction && binding.Value == action {
+			keys = append(keys, `"`+gline.FormatKeySequence(binding.Keys)+`"`)
+		}
+	}
+	if len(keys) == 0 {
+		fmt.Fprintf(out, "%s is not bound to any keys.\n", action)
+		return
+	}
+	fmt.Fprintf(out, "%s can be invoked via %s.\n", action, strings.Join(keys, ", "))
+}
+
+func printBindVariables(keyBindings *gline.KeyBindings, out io.Writer) {
+	variables := keyBindings.Variables()
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "set %s %s\n", name, variables[name])
+	}
+}
+
+func printBindHelp(out io.Writer) {
+	help := []string{
+		"Usage: bind [-lpPsSvX] [-m keymap] [-f filename] [-q name] [-u name] [-r keyseq] [-x keyseq:shell-command] [keyseq:function-name ...]",
+		"Set and display key bindings of the line editor.",
+		"",
+		"Options:",
+		"  -l                    list the names of all functions",
+		"  -p, -P                list functions and their bindings",
+		"  -s, -S                list key sequences that insert text and their values",
+		"  -v                    list variables and their values",
+		"  -X                    list key sequences bound with -x",
+		"  -q name               show which keys invoke the named function",
+		"  -u name               unbind all keys bound to the named function",
+		"  -r keyseq             remove the binding for keyseq",
+		"  -f filename           read key bindings from filename",
+		"  -x keyseq:command     run command when keyseq is entered",
+		"",
+		"Bindings use the inputrc format, e.g. bind '\"\\C-t\": forward-word'.",
+		"Commands run with -x can read and change the line through READLINE_LINE and READLINE_POINT.",
+	}
+	fmt.Fprintln(out, strings.Join(help, "\n"))
+}
@@ -0,0 +1,77 @@
+package bash
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runBind(t *testing.T, keyBindings *gline.KeyBindings, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, handleBindCommand(keyBindings, &out, args))
+	return out.String()
+}
+
+func TestBindListsBindings(t *testing.T) {
+	keyBindings := gline.NewKeyBindings()
+
+	output := runBind(t, keyBindings, "-p")
+	assert.Contains(t, output, `"\C-a": beginning-of-line`)
+	assert.Contains(t, output, `"\C-m": accept-line`)
+
+	assert.Contains(t, runBind(t, keyBindings, "-l"), "forward-word\n")
+	assert.Contains(t, runBind(t, keyBindings, "-v"), "set editing-mode emacs\n")
+	assert.Equal(t, "beginning-of-line can be invoked via \"\\C-a\", \"\\e[H\".\n", runBind(t, keyBindings, "-q", "beginning-of-line"))
+}
+
+func TestBindChangesBindings(t *testing.T) {
+	keyBindings := gline.NewKeyBindings()
+
+	runBind(t, keyBindings, `"\C-t": forward-word`, `"\C-xg": "git status"`)
+	assert.Contains(t, runBind(t, keyBindings, "-P"), `forward-word can be found on "\C-t".`)
+	assert.Contains(t, runBind(t, keyBindings, "-s"), `"\C-xg": "git status"`)
+
+	runBind(t, keyBindings, "-x", `"\C-o": echo hi`)
+	assert.Equal(t, "\"\\C-o\": \"echo hi\"\n", runBind(t, keyBindings, "-X"))
+
+	runBind(t, keyBindings, "-r", `\C-o`)
+	assert.Empty(t, runBind(t, keyBindings, "-X"))
+
+	runBind(t, keyBindings, "-u", "forward-word")
+	assert.Equal(t, "forward-word is not bound to any keys.\n", runBind(t, keyBindings, "-q", "forward-word"))
+}
+
+func TestBindErrors(t *testing.T) {
+	keyBindings := gline.NewKeyBindings()
+	var out bytes.Buffer
+
+	assert.Error(t, handleBindCommand(keyBindings, &out, []string{"-q", "no-such-function"}))
+	assert.Error(t, handleBindCommand(keyBindings, &out, []string{`"\C-t": no-such-function`}))
+	assert.Error(t, handleBindCommand(keyBindings, &out, []string{"-x"}))
+	assert.Error(t, handleBindCommand(keyBindings, &out, []string{"-Z"}))
+}
+
+func TestSetEditingMode(t *testing.T) {
+	// set is a builtin of the interpreter, so it's run through a runner to
+	// check that the editing mode is set before the builtin runs
+	s := newOptionShell(t)
+	keyBindings := s.keyBindings
+
+	s.run("set -o vi")
+	assert.Equal(t, "vi", keyBindings.Variable("editing-mode"))
+
+	s.run("set +o vi")
+	assert.Equal(t, "emacs", keyBindings.Variable("editing-mode"))
+
+	s.run("set -o vi -o emacs")
+	assert.Equal(t, "emacs", keyBindings.Variable("editing-mode"))
+
+	// The bind builtin sees the same setting
+	runBind(t, keyBindings, "set editing-mode vi")
+	assert.Contains(t, runBind(t, keyBindings, "-v"), "set editing-mode vi\n")
+	assert.Contains(t, s.run("set -o"), "vi             \ton\n")
+}
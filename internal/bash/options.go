@@ -0,0 +1,518 @@
+package bash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atinylittleshell/gsh/internal/completion"
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Options of set -o and shopt that gsh implements itself. The interpreter
+// handles the rest, such as errexit, nounset, xtrace, pipefail, globstar and
+// nullglob.
+var (
+	gshSetOptions   = []string{"emacs", "noclobber", "vi"}
+	gshShoptOptions = []string{"autocd", "cdspell", "extglob"}
+)
+
+// clobberMarker starts the target of a >| redirect, which overwrites files
+// even with noclobber set. The interpreter has no >| operator, so it is run as
+// > with the marker, which no real path starts with. NUL bytes would be
+// dropped when the word is expanded.
+const clobberMarker = "\x01clobber\x01"
+
+// Options holds the state of the shell options the interpreter doesn't know
+// about: the editing mode of the line editor, noclobber, and the shopt
+// options autocd, cdspell and extglob
+type Options struct {
+	keyBindings *gline.KeyBindings
+	runner      *interp.Runner
+	resolver    *completion.CommandResolver
+
+	mu        sync.Mutex
+	noclobber bool
+	shopt     map[string]bool
+}
+
+func NewOptions(keyBindings *gline.KeyBindings) *Options {
+	return &Options{keyBindings: keyBindings, shopt: make(map[string]bool)}
+}
+
+// SetRunner sets the runner whose options set -o and shopt list, and whose
+// commands autocd looks up
+func (o *Options) SetRunner(runner *interp.Runner) {
+	o.runner = runner
+	o.resolver = completion.NewCommandResolver(runner)
+}
+
+// Noclobber reports whether > refuses to overwrite existing files
+func (o *Options) Noclobber() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.noclobber
+}
+
+// Shopt reports whether the shopt option name, one of autocd, cdspell and
+// extglob, is set
+func (o *Options) Shopt(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.shopt[name]
+}
+
+// setOption sets an option of set -o, reporting false if gsh doesn't
+// implement it
+func (o *Options) setOption(name string, enabled bool) bool {
+	switch name {
+	case "vi", "emacs":
+		if o.keyBindings == nil {
+			return true
+		}
+		if enabled {
+			o.keyBindings.SetVariable("editing-mode", name)
+		} else if o.option(name) {
+			// Turning off the current mode goes back to the default
+			o.keyBindings.SetVariable("editing-mode", "emacs")
+		}
+	case "noclobber":
+		o.mu.Lock()
+		o.noclobber = enabled
+		o.mu.Unlock()
+	default:
+		return false
+	}
+	return true
+}
+
+// option reports whether an option of set -o that gsh implements is set
+func (o *Options) option(name string) bool {
+	switch name {
+	case "vi", "emacs":
+		mode := "emacs"
+		if o.keyBindings != nil && o.keyBindings.Variable("editing-mode") != "" {
+			mode = strings.ToLower(o.keyBindings.Variable("editing-mode"))
+		}
+		return mode == name
+	case "noclobber":
+		return o.Noclobber()
+	}
+	return false
+}
+
+// NewOptionCallHandler takes the options gsh implements out of the set and
+// shopt builtins, leaving the rest to the interpreter. Listing the options
+// goes to the gsh_set and gsh_shopt commands, which show both kinds. It also
+// turns a directory run as a command into cd with autocd, and corrects the
+// directory given to cd with cdspell.
+func NewOptionCallHandler(o *Options) interp.CallHandlerFunc {
+	return func(ctx context.Context, args []string) ([]string, error) {
+		if len(args) == 0 {
+			return args, nil
+		}
+
+		switch args[0] {
+		case "set":
+			return o.setArgs(args), nil
+		case "shopt":
+			return o.shoptArgs(args), nil
+		case "cd":
+			if o.Shopt("cdspell") {
+				return o.correctCd(interp.HandlerCtx(ctx), args), nil
+			}
+		default:
+			if len(args) == 1 && o.Shopt("autocd") && o.isDirectoryCommand(interp.HandlerCtx(ctx), args[0]) {
+				return []string{"cd", args[0]}, nil
+			}
+		}
+		return args, nil
+	}
+}
+
+// setArgs applies the options of set that gsh implements and returns the
+// command that runs the rest
+func (o *Options) setArgs(args []string) []string {
+	if len(args) == 2 && (args[1] == "-o" || args[1] == "+o") {
+		return []string{"gsh_set", args[1]}
+	}
+
+	rest := []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-" || arg == "--" || len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			// Positional parameters follow
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		enabled := arg[0] == '-'
+		if arg[1:] == "o" && i+1 < len(args) {
+			if o.setOption(args[i+1], enabled) {
+				i++
+				continue
+			}
+			rest = append(rest, arg, args[i+1])
+			i++
+			continue
+		}
+		// -C is noclobber, and may be grouped with other flags such as -eC
+		if strings.Contains(arg[1:], "C") {
+			o.setOption("noclobber", enabled)
+			arg = strings.ReplaceAll(arg, "C", "")
+			if len(arg) == 1 {
+				continue
+			}
+		}
+		rest = append(rest, arg)
+	}
+
+	if len(rest) == 1 && len(args) > 1 {
+		// Everything was handled here, and a bare set would list variables
+		return []string{"gsh_set"}
+	}
+	return rest
+}
+
+// shoptArgs applies the shopt options that gsh implements and returns the
+// command that sets the rest
+func (o *Options) shoptArgs(args []string) []string {
+	flags, names := splitShoptArgs(args[1:])
+	if strings.Contains(flags, "o") {
+		return args
+	}
+	if !strings.ContainsAny(flags, "su") {
+		// The interpreter can't print or query options
+		return append([]string{"gsh_shopt"}, args[1:]...)
+	}
+
+	enabled := strings.Contains(flags, "s")
+	rest := []string{"shopt", "-u"}
+	if enabled {
+		rest[1] = "-s"
+	}
+	for _, name := range names {
+		if slices.Contains(gshShoptOptions, name) {
+			o.mu.Lock()
+			o.shopt[name] = enabled
+			o.mu.Unlock()
+			continue
+		}
+		rest = append(rest, name)
+	}
+	if len(rest) == 2 {
+		return []string{"gsh_shopt", rest[1]}
+	}
+	return rest
+}
+
+// splitShoptArgs splits the flags of shopt from the option names
+func splitShoptArgs(args []string) (string, []string) {
+	flags := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			return flags, args[1:]
+		}
+		flags += args[0][1:]
+		args = args[1:]
+	}
+	return flags, args
+}
+
+// isDirectoryCommand reports whether name isn't a command but a directory
+func (o *Options) isDirectoryCommand(hc interp.HandlerContext, name string) bool {
+	if o.resolver == nil || o.resolver.ResolveCommand(name) != shellinput.CommandMissing {
+		return false
+	}
+	info, err := os.Stat(absPath(hc.Dir, name))
+	return err == nil && info.IsDir()
+}
+
+// correctCd corrects a misspelled directory given to cd, printing the
+// corrected path as bash does
+func (o *Options) correctCd(hc interp.HandlerContext, args []string) []string {
+	i := 1
+	for i < len(args) && strings.HasPrefix(args[i], "-") && args[i] != "-" {
+		i++
+		if args[i-1] == "--" {
+			break
+		}
+	}
+	if i >= len(args) || args[i] == "-" {
+		return args
+	}
+	if info, err := os.Stat(absPath(hc.Dir, args[i])); err == nil && info.IsDir() {
+		return args
+	}
+
+	corrected, ok := correctPath(hc.Dir, args[i])
+	if !ok {
+		return args
+	}
+	fmt.Fprintln(hc.Stdout, corrected)
+	args = slices.Clone(args)
+	args[i] = corrected
+	return args
+}
+
+// correctPath corrects each component of path that isn't a directory to a
+// directory whose name is one typo away
+func correctPath(dir string, path string) (string, bool) {
+	components := strings.Split(path, "/")
+	current := dir
+	if filepath.IsAbs(path) {
+		current = "/"
+	}
+	changed := false
+	for i, name := range components {
+		if name == "" || name == "." || name == ".." {
+			current = filepath.Join(current, name)
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(current, name)); err != nil || !info.IsDir() {
+			match, ok := similarDirectory(current, name)
+			if !ok {
+				return "", false
+			}
+			components[i], name, changed = match, match, true
+		}
+		current = filepath.Join(current, name)
+	}
+	return strings.Join(components, "/"), changed
+}
+
+// similarDirectory returns the directory in dir whose name is one typo away
+// from name: a character transposed, missing, extra or wrong
+func similarDirectory(dir string, name string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if isOneTypoAway(entry.Name(), name) {
+			if info, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil && info.IsDir() {
+				return entry.Name(), true
+			}
+		}
+	}
+	return "", false
+}
+
+func isOneTypoAway(a string, b string) bool {
+	if a == b || max(len(a), len(b))-min(len(a), len(b)) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	switch {
+	case len(a) == len(b):
+		if i+1 < len(a) && a[i] == b[i+1] && a[i+1] == b[i] && a[i+2:] == b[i+2:] {
+			return true
+		}
+		return a[i+1:] == b[i+1:]
+	case len(a) > len(b):
+		return a[i+1:] == b[i:]
+	default:
+		return a[i:] == b[i+1:]
+	}
+}
+
+func absPath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// NewOptionCommandHandler handles the gsh_set and gsh_shopt commands, which
+// list the options of both gsh and the interpreter and query shopt options
+func NewOptionCommandHandler(o *Options) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return next(ctx, args)
+			}
+
+			hc := interp.HandlerCtx(ctx)
+			switch args[0] {
+			case "gsh_set":
+				return o.setCommand(ctx, hc, args[1:])
+			case "gsh_shopt":
+				return o.shoptCommand(ctx, hc, args[1:])
+			}
+			return next(ctx, args)
+		}
+	}
+}
+
+// setCommand lists the options of set with -o, or as the commands that
+// restore them with +o. Other options were set by the call handler.
+func (o *Options) setCommand(ctx context.Context, hc interp.HandlerContext, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	options, err := o.interpOptions(ctx, "set -o")
+	if err != nil {
+		return err
+	}
+	for _, name := range gshSetOptions {
+		options[name] = o.option(name)
+	}
+	restore := ""
+	if args[0] == "+o" {
+		restore = "set"
+	}
+	printOptions(hc.Stdout, options, restore)
+	return nil
+}
+
+// shoptCommand prints or queries the shopt options. -p prints them as the
+// commands that restore them, and -q only sets the exit status.
+func (o *Options) shoptCommand(ctx context.Context, hc interp.HandlerContext, args []string) error {
+	flags, names := splitShoptArgs(args)
+	if invalid := strings.Trim(flags, "supq"); invalid != "" {
+		fmt.Fprintf(hc.Stderr, "shopt: -%c: invalid option\n", invalid[0])
+		return interp.NewExitStatus(2)
+	}
+	if strings.ContainsAny(flags, "su") {
+		// The options were set by the call handler
+		return nil
+	}
+
+	options, err := o.interpOptions(ctx, "shopt")
+	if err != nil {
+		return err
+	}
+	for _, name := range gshShoptOptions {
+		options[name] = o.Shopt(name)
+	}
+
+	out := hc.Stdout
+	if strings.Contains(flags, "q") {
+		out = io.Discard
+	}
+	restore := ""
+	if strings.Contains(flags, "p") {
+		restore = "shopt"
+	}
+	if len(names) == 0 {
+		printOptions(out, options, restore)
+		return nil
+	}
+
+	var status uint8
+	for _, name := range names {
+		enabled, ok := options[name]
+		if !ok {
+			fmt.Fprintf(hc.Stderr, "shopt: %s: invalid shell option name\n", name)
+			status = 1
+			continue
+		}
+		if !enabled {
+			status = 1
+		}
+		printOptions(out, map[string]bool{name: enabled}, restore)
+	}
+	return interp.NewExitStatus(status)
+}
+
+// printOptions prints options sorted by name, as a table or, for restore set
+// or shopt, as the commands that restore them
+func printOptions(out io.Writer, options map[string]bool, restore string) {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		enabled := options[name]
+		switch {
+		case restore == "set" && enabled:
+			fmt.Fprintf(out, "set -o %s\n", name)
+		case restore == "set":
+			fmt.Fprintf(out, "set +o %s\n", name)
+		case restore == "shopt" && enabled:
+			fmt.Fprintf(out, "shopt -s %s\n", name)
+		case restore == "shopt":
+			fmt.Fprintf(out, "shopt -u %s\n", name)
+		case enabled:
+			fmt.Fprintf(out, "%-15s\ton\n", name)
+		default:
+			fmt.Fprintf(out, "%-15s\toff\n", name)
+		}
+	}
+}
+
+// interpOptions returns the options the interpreter lists for command, set
+// -o or shopt
+func (o *Options) interpOptions(ctx context.Context, command string) (map[string]bool, error) {
+	options := make(map[string]bool)
+	if o.runner == nil {
+		return options, nil
+	}
+
+	prog, err := syntax.NewParser().Parse(strings.NewReader(command), "gsh")
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	subShell := o.runner.Subshell()
+	interp.StdIO(nil, &out, io.Discard)(subShell)
+	// Without the call handler, the interpreter's own builtin runs
+	interp.CallHandler(nil)(subShell)
+	if err := subShell.Run(ctx, prog); err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			options[fields[0]] = fields[1] == "on"
+		}
+	}
+	return options, nil
+}
+
+// NewNoclobberOpenHandler opens files as the interpreter does, except that
+// with noclobber set, > refuses to overwrite existing files. >| still does.
+func NewNoclobberOpenHandler(o *Options) interp.OpenHandlerFunc {
+	open := interp.DefaultOpenHandler()
+	return func(ctx context.Context, path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+		if clobber, ok := strings.CutPrefix(path, clobberMarker); ok {
+			return open(ctx, clobber, flag, perm)
+		}
+		if flag&os.O_TRUNC != 0 && o.Noclobber() {
+			info, err := os.Stat(absPath(interp.HandlerCtx(ctx).Dir, path))
+			if err == nil && info.Mode().IsRegular() {
+				return nil, &os.PathError{Op: "open", Path: path, Err: errors.New("cannot overwrite existing file")}
+			}
+		}
+		return open(ctx, path, flag, perm)
+	}
+}
+
+// AllowClobber turns the >| redirects of node, which the interpreter doesn't
+// support, into > redirects that overwrite files even with noclobber set
+func AllowClobber(node syntax.Node) {
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if redirect, ok := node.(*syntax.Redirect); ok && redirect.Op == syntax.ClbOut {
+			redirect.Op = syntax.RdrOut
+			redirect.Word.Parts = append([]syntax.WordPart{&syntax.Lit{Value: clobberMarker}}, redirect.Word.Parts...)
+		}
+		return true
+	})
+}
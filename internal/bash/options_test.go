@@ -0,0 +1,174 @@
+package bash
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// optionShell runs scripts with the set and shopt handling of the shell
+type optionShell struct {
+	t           *testing.T
+	options     *Options
+	keyBindings *gline.KeyBindings
+	runner      *interp.Runner
+	out         bytes.Buffer
+}
+
+func newOptionShell(t *testing.T) *optionShell {
+	t.Helper()
+	s := &optionShell{t: t, keyBindings: gline.NewKeyBindings()}
+	s.options = NewOptions(s.keyBindings)
+	runner, err := interp.New(
+		interp.StdIO(nil, &s.out, &s.out),
+		interp.Dir(t.TempDir()),
+		interp.ExecHandlers(NewOptionCommandHandler(s.options)),
+		interp.CallHandler(NewOptionCallHandler(s.options)),
+		interp.OpenHandler(NewNoclobberOpenHandler(s.options)),
+	)
+	require.NoError(t, err)
+	s.runner = runner
+	s.options.SetRunner(runner)
+	return s
+}
+
+// run runs script and returns what it printed
+func (s *optionShell) run(script string) string {
+	s.t.Helper()
+	s.out.Reset()
+	err := RunBashScriptFromReader(context.Background(), s.runner, strings.NewReader(script), "test")
+	if _, ok := interp.IsExitStatus(err); !ok {
+		require.NoError(s.t, err)
+	}
+	return s.out.String()
+}
+
+func TestSetOptions(t *testing.T) {
+	s := newOptionShell(t)
+
+	t.Run("interpreter options", func(t *testing.T) {
+		assert.Equal(t, "+ echo hi\nhi\n", s.run("set -x; echo hi"))
+		s.run("set +x")
+		assert.Contains(t, s.run("set -u; echo $nope; echo reached"), "nope: unbound variable")
+		assert.NotContains(t, s.out.String(), "reached")
+		s.run("set +u")
+		assert.Equal(t, "1\n", s.run("set -o pipefail; false | true; echo $?; set +o pipefail"))
+	})
+
+	t.Run("positional parameters", func(t *testing.T) {
+		assert.Equal(t, "a b\n", s.run("set -- a b; echo $@"))
+		assert.Equal(t, "-C x\n", s.run("set -- -C x; echo $@"))
+		assert.False(t, s.options.Noclobber())
+	})
+
+	t.Run("editing mode", func(t *testing.T) {
+		assert.Empty(t, s.run("set -o vi"))
+		assert.Equal(t, "vi", s.keyBindings.Variable("editing-mode"))
+		s.run("set -o emacs")
+		assert.Equal(t, "emacs", s.keyBindings.Variable("editing-mode"))
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		s.run("set -o vi -o errexit")
+		list := s.run("set -o")
+		assert.Contains(t, list, "errexit        \ton\n")
+		assert.Contains(t, list, "vi             \ton\n")
+		assert.Contains(t, list, "emacs          \toff\n")
+		assert.Contains(t, list, "noclobber      \toff\n")
+		assert.Less(t, strings.Index(list, "allexport"), strings.Index(list, "xtrace"))
+
+		restore := s.run("set +o")
+		assert.Contains(t, restore, "set -o errexit\n")
+		assert.Contains(t, restore, "set +o pipefail\n")
+		assert.Contains(t, restore, "set -o vi\n")
+		s.run("set +e -o emacs")
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		assert.Contains(t, s.run("set -o nope"), `invalid option: "nope"`)
+	})
+}
+
+func TestNoclobber(t *testing.T) {
+	s := newOptionShell(t)
+	s.run("echo one > file")
+
+	s.run("set -C")
+	assert.True(t, s.options.Noclobber())
+	assert.Contains(t, s.run("echo two > file"), "cannot overwrite existing file")
+	assert.Empty(t, s.run("echo two >> file; echo three > new; echo x > /dev/null"))
+	assert.Equal(t, "one\ntwo\n", s.run("cat < file"))
+
+	// >| overwrites anyway
+	assert.Empty(t, s.run("echo four >| file"))
+	assert.Equal(t, "four\n", s.run("cat < file"))
+
+	s.run("set +o noclobber")
+	assert.Empty(t, s.run("echo five > file"))
+}
+
+func TestShopt(t *testing.T) {
+	s := newOptionShell(t)
+
+	t.Run("set and query", func(t *testing.T) {
+		assert.Empty(t, s.run("shopt -s globstar extglob"))
+		assert.True(t, s.options.Shopt("extglob"))
+		assert.Equal(t, "extglob        \ton\nglobstar       \ton\nnullglob       \toff\n", s.run("shopt extglob globstar nullglob"))
+		assert.Equal(t, "shopt -s extglob\n", s.run("shopt -p extglob"))
+		assert.Equal(t, "0\n1\n", s.run("shopt -q extglob globstar; echo $?; shopt -q extglob nullglob; echo $?"))
+		assert.Equal(t, "shopt: nope: invalid shell option name\n", s.run("shopt nope"))
+
+		list := s.run("shopt")
+		assert.Contains(t, list, "autocd         \toff\n")
+		assert.Contains(t, list, "globstar       \ton\n")
+	})
+
+	t.Run("nullglob", func(t *testing.T) {
+		assert.Equal(t, "*.nope\n", s.run("echo *.nope"))
+		assert.Equal(t, "\n", s.run("shopt -s nullglob; echo *.nope; shopt -u nullglob"))
+	})
+
+	t.Run("autocd", func(t *testing.T) {
+		require.NoError(t, os.Mkdir(filepath.Join(s.runner.Dir, "projects"), 0o755))
+		s.run("shopt -s autocd")
+		s.run("projects")
+		assert.Equal(t, "projects", filepath.Base(s.runner.Dir))
+		s.run("..")
+		assert.NotEqual(t, "projects", filepath.Base(s.runner.Dir))
+		s.run("shopt -u autocd")
+	})
+
+	t.Run("cdspell", func(t *testing.T) {
+		require.NoError(t, os.MkdirAll(filepath.Join(s.runner.Dir, "documents", "notes"), 0o755))
+		s.run("shopt -s cdspell")
+		assert.Equal(t, "documents/notes\n", s.run("cd dcouments/ntoes"))
+		assert.Equal(t, "notes", filepath.Base(s.runner.Dir))
+		assert.Equal(t, "1\n", s.run("cd unrelated; echo $?"))
+	})
+}
+
+func TestIsOneTypoAway(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"documents", "dcouments", true},
+		{"documents", "documnts", true},
+		{"documents", "documentss", true},
+		{"documents", "docunents", true},
+		{"documents", "documents", false},
+		{"documents", "dcumnts", false},
+		{"src", "bin", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, isOneTypoAway(tt.a, tt.b), "%s %s", tt.a, tt.b)
+	}
+}
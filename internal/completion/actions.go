@@ -0,0 +1,430 @@
+package completion
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// CompletionActions are the actions complete and compgen take with -A
+var CompletionActions = []string{
+	"alias", "arrayvar", "binding", "builtin", "command", "directory", "disabled", "enabled",
+	"export", "file", "function", "group", "helptopic", "hostname", "job", "keyword",
+	"running", "service", "setopt", "shopt", "signal", "stopped", "user", "variable",
+}
+
+// actionShorthands maps the options of complete and compgen that are
+// shorthand for an action to the action
+var actionShorthands = map[byte]string{
+	'a': "alias",
+	'b': "builtin",
+	'c': "command",
+	'd': "directory",
+	'e': "export",
+	'f': "file",
+	'g': "group",
+	'j': "job",
+	'k': "keyword",
+	's': "service",
+	'u': "user",
+	'v': "variable",
+}
+
+// Options of set -o and shopt, and signals, as bash completes them
+var (
+	setOptions = []string{
+		"allexport", "braceexpand", "emacs", "errexit", "errtrace", "functrace", "hashall",
+		"histexpand", "history", "ignoreeof", "interactive-comments", "keyword", "monitor",
+		"noclobber", "noexec", "noglob", "nolog", "notify", "nounset", "onecmd", "physical",
+		"pipefail", "posix", "privileged", "verbose", "vi", "xtrace",
+	}
+	shoptOptions = []string{
+		"autocd", "cdable_vars", "cdspell", "checkhash", "checkjobs", "checkwinsize", "cmdhist",
+		"dotglob", "execfail", "expand_aliases", "extglob", "extquote", "failglob", "globstar",
+		"histappend", "histreedit", "histverify", "hostcomplete", "huponexit", "lastpipe",
+		"lithist", "login_shell", "nocaseglob", "nocasematch", "nullglob", "progcomp",
+		"promptvars", "sourcepath", "xpg_echo",
+	}
+	signalNames = []string{
+		"SIGHUP", "SIGINT", "SIGQUIT", "SIGILL", "SIGTRAP", "SIGABRT", "SIGBUS", "SIGFPE",
+		"SIGKILL", "SIGUSR1", "SIGSEGV", "SIGUSR2", "SIGPIPE", "SIGALRM", "SIGTERM", "SIGCHLD",
+		"SIGCONT", "SIGSTOP", "SIGTSTP", "SIGTTIN", "SIGTTOU", "SIGURG", "SIGXCPU", "SIGXFSZ",
+		"SIGVTALRM", "SIGPROF", "SIGWINCH", "SIGIO", "SIGSYS",
+	}
+	shellKeywords = []string{
+		"!", "[[", "]]", "case", "do", "done", "elif", "else", "esac", "fi", "for", "function",
+		"if", "in", "select", "then", "time", "until", "while", "{", "}",
+	}
+)
+
+// Files read by the user, group and hostname actions
+var (
+	passwdFile = "/etc/passwd"
+	groupFile  = "/etc/group"
+	hostsFile  = "/etc/hosts"
+)
+
+// JobNames returns the command names of the shell's jobs, of all of them or
+// only the "running" or "stopped" ones
+var JobNames = func(state string) []string { return nil }
+
+// generateAction returns the names the action completes that start with cur
+func generateAction(runner *interp.Runner, action string, cur string) ([]string, error) {
+	pwd := ""
+	if runner != nil {
+		pwd = environment.GetPwd(runner)
+	}
+
+	var names []string
+	switch action {
+	case "file":
+		return actionFiles(cur, pwd, false), nil
+	case "directory":
+		return actionFiles(cur, pwd, true), nil
+	case "alias":
+		names = aliasNames(runner)
+	case "arrayvar":
+		for name, variable := range runnerVariables(runner) {
+			if variable.Kind == expand.Indexed || variable.Kind == expand.Associative {
+				names = append(names, name)
+			}
+		}
+	case "builtin", "enabled", "helptopic":
+		for name := range shellBuiltins {
+			names = append(names, name)
+		}
+	case "command":
+		names = append(names, aliasNames(runner)...)
+		names = append(names, functionNames(runner)...)
+		names = append(names, shellKeywords...)
+		for name := range shellBuiltins {
+			names = append(names, name)
+		}
+		names = append(names, executableNames(runner, cur)...)
+	case "export":
+		for name, variable := range runnerVariables(runner) {
+			if variable.Exported {
+				names = append(names, name)
+			}
+		}
+	case "function":
+		names = functionNames(runner)
+	case "variable":
+		for name := range runnerVariables(runner) {
+			names = append(names, name)
+		}
+	case "user":
+		names = readNames(passwdFile, ':', 0)
+	case "group":
+		names = readNames(groupFile, ':', 0)
+	case "hostname":
+		hosts := hostsFile
+		if runner != nil && runner.Vars["HOSTFILE"].String() != "" {
+			hosts = runner.Vars["HOSTFILE"].String()
+		}
+		names = readNames(hosts, ' ', -1)
+	case "service":
+		if entries, err := osReadDir("/etc/init.d"); err == nil {
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+		}
+	case "setopt":
+		names = setOptions
+	case "shopt":
+		names = shoptOptions
+	case "signal":
+		names = signalNames
+	case "keyword":
+		names = shellKeywords
+	case "job":
+		names = JobNames("")
+	case "running", "stopped":
+		names = JobNames(action)
+	case "binding", "disabled":
+		// gsh has no readline function names and no way to disable
+		// builtins, so there's nothing to complete
+	default:
+		return nil, fmt.Errorf("%s: invalid action name", action)
+	}
+
+	return matchingNames(names, cur), nil
+}
+
+// matchingNames returns the sorted, unique names that start with prefix
+func matchingNames(names []string, prefix string) []string {
+	seen := make(map[string]bool)
+	matches := make([]string, 0)
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// actionFiles returns the files, or only the directories, whose path starts
+// with cur, without the trailing slash of directories
+func actionFiles(cur string, pwd string, directoriesOnly bool) []string {
+	var files []string
+	for _, file := range getFileCompletions(cur, pwd) {
+		isDir := strings.HasSuffix(file, "/")
+		if directoriesOnly && !isDir {
+			continue
+		}
+		files = append(files, strings.TrimSuffix(file, "/"))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// globFiles returns the files matching a -G pattern, relative to pwd when the
+// pattern is
+func globFiles(pattern string, pwd string) []string {
+	absolute := pattern
+	if !filepath.IsAbs(pattern) {
+		absolute = filepath.Join(pwd, pattern)
+	}
+	matches, err := filepath.Glob(absolute)
+	if err != nil {
+		return nil
+	}
+	if !filepath.IsAbs(pattern) {
+		for i, match := range matches {
+			if rel, err := filepath.Rel(pwd, match); err == nil {
+				matches[i] = rel
+			}
+		}
+	}
+	return matches
+}
+
+// filterCompletions applies the -X filter of a spec: completions matching the
+// pattern are removed, or those not matching it when it starts with !. An &
+// in the pattern stands for the word being completed.
+func filterCompletions(completions []string, filter string, cur string) []string {
+	negate := strings.HasPrefix(filter, "!")
+	filter = strings.TrimPrefix(filter, "!")
+
+	var pat strings.Builder
+	for i := 0; i < len(filter); i++ {
+		switch {
+		case filter[i] == '\\' && i+1 < len(filter) && filter[i+1] == '&':
+			pat.WriteByte('&')
+			i++
+		case filter[i] == '&':
+			pat.WriteString(quoteGlob(cur))
+		default:
+			pat.WriteByte(filter[i])
+		}
+	}
+	re, err := patternRegexp(pat.String())
+	if err != nil {
+		return completions
+	}
+
+	kept := make([]string, 0, len(completions))
+	for _, completion := range completions {
+		if re.MatchString(completion) == negate {
+			kept = append(kept, completion)
+		}
+	}
+	return kept
+}
+
+// markFilenames treats completions as file names, like readline does for
+// -o filenames: directories get a trailing slash, and names with spaces are
+// quoted unless quote is false
+func markFilenames(completions []string, pwd string, quote bool) []string {
+	home, _ := os.UserHomeDir()
+	for i, completion := range completions {
+		path := completion
+		if strings.HasPrefix(path, "~/") && home != "" {
+			path = filepath.Join(home, path[2:])
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(pwd, path)
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() && !strings.HasSuffix(completion, "/") {
+			completion += "/"
+		}
+		if quote && strings.Contains(completion, " ") {
+			completion = "\"" + completion + "\""
+		}
+		completions[i] = completion
+	}
+	return completions
+}
+
+// runnerVariables returns the variables of the shell and its environment
+func runnerVariables(runner *interp.Runner) map[string]expand.Variable {
+	variables := make(map[string]expand.Variable)
+	if runner == nil {
+		return variables
+	}
+	if runner.Env != nil {
+		runner.Env.Each(func(name string, variable expand.Variable) bool {
+			variables[name] = variable
+			return true
+		})
+	}
+	for name, variable := range runner.Vars {
+		variables[name] = variable
+	}
+	return variables
+}
+
+func functionNames(runner *interp.Runner) []string {
+	if runner == nil {
+		return nil
+	}
+	names := make([]string, 0, len(runner.Funcs))
+	for name := range runner.Funcs {
+		names = append(names, name)
+	}
+	return names
+}
+
+func aliasNames(runner *interp.Runner) []string {
+	provider := ShellCompletionProvider{Runner: runner}
+	return provider.getAliasCompletions("")
+}
+
+// executableNames returns the executables on the shell's PATH that start with prefix
+func executableNames(runner *interp.Runner, prefix string) []string {
+	path := os.Getenv("PATH")
+	if runner != nil && runner.Vars["PATH"].String() != "" {
+		path = runner.Vars["PATH"].String()
+	}
+	var names []string
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := osReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	return names
+}
+
+// readNames returns a field of each line of a file like /etc/passwd, skipping
+// comments. A negative field returns every field but the first.
+func readNames(path string, separator rune, field int) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == separator || (separator == ' ' && r == '\t')
+		})
+		if field < 0 && len(fields) > 1 {
+			names = append(names, fields[1:]...)
+		} else if field >= 0 && field < len(fields) {
+			names = append(names, fields[field])
+		}
+	}
+	return names
+}
+
+// quoteGlob escapes the pattern characters of s
+func quoteGlob(s string) string {
+	var quoted strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\()|!@+`, r) {
+			quoted.WriteByte('\\')
+		}
+		quoted.WriteRune(r)
+	}
+	return quoted.String()
+}
+
+// patternRegexp compiles a shell pattern, including the extended patterns
+// ?(…), *(…), +(…) and @(…) that bash-completion uses in its -X filters, to a
+// regular expression matching whole strings
+func patternRegexp(pat string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	var groups []byte // the operator of each open extended pattern
+	for i := 0; i < len(pat); i++ {
+		c := pat[i]
+		if strings.IndexByte("?*+@!", c) >= 0 && i+1 < len(pat) && pat[i+1] == '(' {
+			if c == '!' {
+				return nil, fmt.Errorf("unsupported pattern %q", pat)
+			}
+			groups = append(groups, c)
+			re.WriteString("(?:")
+			i++
+			continue
+		}
+		switch c {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		case '\\':
+			if i+1 < len(pat) {
+				i++
+				re.WriteString(regexp.QuoteMeta(pat[i : i+1]))
+			}
+		case '[':
+			end := strings.IndexByte(pat[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pat[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '|':
+			if len(groups) == 0 {
+				re.WriteString(`\|`)
+			} else {
+				re.WriteString("|")
+			}
+		case ')':
+			if len(groups) == 0 {
+				re.WriteString(`\)`)
+				continue
+			}
+			re.WriteString(")")
+			switch groups[len(groups)-1] {
+			case '?':
+				re.WriteString("?")
+			case '*':
+				re.WriteString("*")
+			case '+':
+				re.WriteString("+")
+			}
+			groups = groups[:len(groups)-1]
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if len(groups) > 0 {
+		return nil, fmt.Errorf("unbalanced pattern %q", pat)
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
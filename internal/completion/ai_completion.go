@@ -0,0 +1,346 @@
+package completion
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/internal/utils"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const (
+	// How long running a command for its --help or --version output may take
+	aiCommandTimeout = 2 * time.Second
+	// How long the model may take to suggest completions
+	aiCompletionTimeout = 15 * time.Second
+	// Maximum size of the help text given to the model
+	aiHelpMaxBytes = 16 * 1024
+	// Maximum length of a version kept from --version output
+	aiVersionMaxLength = 100
+	// Number of versions and of suggestions remembered, beyond which they're
+	// forgotten
+	aiCacheMaxEntries = 256
+)
+
+var ansiEscapePattern = regexp.MustCompile("\x1b\\[[0-9;]*[a-zA-Z]|.\x08")
+
+type aiSuggestion struct {
+	Value       string `json:"value" description:"A flag, subcommand or argument that can replace the word being completed" required:"true"`
+	Description string `json:"description" description:"A short description of the value, from the help text" required:"true"`
+}
+
+type aiSuggestions struct {
+	Suggestions []aiSuggestion `json:"suggestions" description:"Values for the word being completed, most likely first" required:"true"`
+}
+
+var aiSuggestionsSchema = utils.GenerateJsonSchema(aiSuggestions{})
+
+// AICompleter suggests the flags and arguments of commands gsh has no
+// completions for by asking the fast model, grounded in their --help output
+type AICompleter struct {
+	Runner *interp.Runner
+	Logger *zap.Logger
+	// HelpCacheDir keeps the --help output of commands, per binary and per version
+	HelpCacheDir string
+
+	mu          sync.Mutex
+	versions    map[string]string       // executable and its binary -> version
+	suggestions map[string][]Suggestion // executable, its binary and the line before the word -> suggestions
+
+	// ask returns the model's suggestions for the word being completed at
+	// the end of line; replaced in tests
+	ask func(ctx context.Context, help string, line string) ([]Suggestion, error)
+}
+
+func NewAICompleter(runner *interp.Runner, logger *zap.Logger, helpCacheDir string) *AICompleter {
+	c := &AICompleter{
+		Runner:       runner,
+		Logger:       logger,
+		HelpCacheDir: helpCacheDir,
+		versions:     make(map[string]string),
+		suggestions:  make(map[string][]Suggestion),
+	}
+	c.ask = c.askModel
+	return c
+}
+
+// Complete returns the suggestions for the word being completed after line, a
+// command line running executable. The model suggests all the values the
+// word can take, which the caller narrows down to what's typed, so they're
+// remembered for the rest of the line and the model isn't asked again as the
+// word is typed or erased.
+func (c *AICompleter) Complete(executable string, line string) []Suggestion {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return nil
+	}
+	// The binary is told apart from earlier ones by when it was modified and its size
+	binary := fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+	key := executable + "\x00" + binary + "\x00" + line
+
+	c.mu.Lock()
+	suggestions, ok := c.suggestions[key]
+	c.mu.Unlock()
+	if ok {
+		return suggestions
+	}
+
+	help := c.help(executable, binary)
+	if help == "" {
+		// Without documentation, the model would only be guessing
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), aiCompletionTimeout)
+	defer cancel()
+	suggestions, err = c.ask(ctx, help, line)
+	if err != nil {
+		c.Logger.Debug("error getting completions from the model", zap.String("line", line), zap.Error(err))
+		return nil
+	}
+
+	c.mu.Lock()
+	if len(c.suggestions) >= aiCacheMaxEntries {
+		clear(c.suggestions)
+	}
+	c.suggestions[key] = suggestions
+	c.mu.Unlock()
+	return suggestions
+}
+
+// version returns the first line of the --version output of executable, or
+// when it has none, binary
+func (c *AICompleter) version(executable string, binary string) string {
+	key := executable + "\x00" + binary
+
+	c.mu.Lock()
+	version, ok := c.versions[key]
+	c.mu.Unlock()
+	if ok {
+		return version
+	}
+
+	version = binary
+	for _, line := range strings.Split(runForOutput(executable, "--version"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			version = line[:min(len(line), aiVersionMaxLength)]
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.versions) >= aiCacheMaxEntries {
+		clear(c.versions)
+	}
+	c.versions[key] = version
+	c.mu.Unlock()
+	return version
+}
+
+// help returns the --help output of executable. It's cached for the binary
+// and for its version, so --version is only run once the binary changed, and
+// --help once its version did too.
+func (c *AICompleter) help(executable string, binary string) string {
+	binaryFile := c.helpCacheFile(executable, "binary", binary)
+	if help, err := os.ReadFile(binaryFile); err == nil {
+		return string(help)
+	}
+
+	versionFile := c.helpCacheFile(executable, "version", c.version(executable, binary))
+	help := ""
+	if cached, err := os.ReadFile(versionFile); err == nil {
+		help = string(cached)
+	} else {
+		help = runForOutput(executable, "--help")
+		if len(help) > aiHelpMaxBytes {
+			help = help[:aiHelpMaxBytes]
+		}
+		c.cacheHelp(versionFile, help)
+	}
+	c.cacheHelp(binaryFile, help)
+	return help
+}
+
+// helpCacheFile returns the file the help of executable is cached in for the
+// binary or version id, or "" without a cache directory
+func (c *AICompleter) helpCacheFile(executable string, kind string, id string) string {
+	if c.HelpCacheDir == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(executable + "\x00" + kind + "\x00" + id))
+	return filepath.Join(c.HelpCacheDir, filepath.Base(executable)+"-"+hex.EncodeToString(hash[:8])+".txt")
+}
+
+// cacheHelp writes help to cacheFile. Commands without help are remembered
+// too, so they aren't run again.
+func (c *AICompleter) cacheHelp(cacheFile string, help string) {
+	if cacheFile == "" {
+		return
+	}
+	err := os.MkdirAll(c.HelpCacheDir, 0755)
+	if err == nil {
+		err = os.WriteFile(cacheFile, []byte(help), 0644)
+	}
+	if err != nil {
+		c.Logger.Debug("error caching help output", zap.String("file", cacheFile), zap.Error(err))
+	}
+}
+
+// runForOutput runs executable with args and returns what it prints, without
+// terminal formatting
+func runForOutput(executable string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), aiCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, executable, args...)
+	cmd.Env = append(os.Environ(), "PAGER=cat", "NO_COLOR=1")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	// Many programs print their help to stderr
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil && output.Len() == 0 {
+		return ""
+	}
+	return ansiEscapePattern.ReplaceAllString(output.String(), "")
+}
+
+func (c *AICompleter) askModel(ctx context.Context, help string, line string) ([]Suggestion, error) {
+	schema, err := aiSuggestionsSchema.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	systemMessage := fmt.Sprintf(`You are gsh, an intelligent shell program.
+You will be given a bash command line I'm typing, enclosed in <command> tags.
+I want to complete the next word at its end.
+
+# Instructions
+* Suggest values for the next word: flags, subcommands or arguments of the command
+* Only suggest flags and subcommands the help text below documents
+* Don't suggest flags already on the command line unless they can be repeated
+* Describe each value in a few words
+
+# Help Text
+%s
+
+# Response JSON Schema
+%s`,
+		help,
+		string(schema),
+	)
+
+	userMessage := fmt.Sprintf("<command>%s</command>", line)
+
+	c.Logger.Debug(
+		"completing command line using LLM",
+		zap.String("system", systemMessage),
+		zap.String("user", userMessage),
+	)
+
+	llmClient, modelConfig := utils.GetLLMClient(c.Runner, utils.FastModel)
+	request := openai.ChatCompletionRequest{
+		Model: modelConfig.ModelId,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    "system",
+				Content: systemMessage,
+			},
+			{
+				Role:    "user",
+				Content: userMessage,
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	}
+	if modelConfig.Temperature != nil {
+		request.Temperature = float32(*modelConfig.Temperature)
+	}
+
+	chatCompletion, err := llmClient.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(chatCompletion.Choices) == 0 {
+		return nil, nil
+	}
+
+	var response aiSuggestions
+	if err := json.Unmarshal([]byte(chatCompletion.Choices[0].Message.Content), &response); err != nil {
+		return nil, err
+	}
+
+	var suggestions []Suggestion
+	for _, suggestion := range response.Suggestions {
+		value := strings.TrimSpace(suggestion.Value)
+		if value != "" && !strings.ContainsAny(value, "\n") {
+			suggestions = append(suggestions, Suggestion{Name: value, Description: suggestion.Description})
+		}
+	}
+	return suggestions, nil
+}
+
+// GetAsyncCompletions returns the fast model's suggestions for the arguments
+// of commands on PATH that gsh has no completions for, if GSH_AI_COMPLETION
+// is enabled
+func (p *ShellCompletionProvider) GetAsyncCompletions(line string, pos int) []shellinput.CompletionCandidate {
+	if p.AI == nil || p.Runner == nil || !environment.IsAICompletionEnabled(p.Runner) {
+		return nil
+	}
+
+	line = line[:pos]
+	words := splitPreservingQuotes(line)
+	if len(words) == 0 || len(words) == 1 && !strings.HasSuffix(line, " ") {
+		return nil
+	}
+	command := words[0]
+	if spec, ok := p.CompletionManager.GetSpec(command); ok && spec.Command != DefaultCompletionCommand {
+		return nil
+	}
+	if p.Specs != nil {
+		if _, ok := p.Specs.Lookup(command); ok {
+			return nil
+		}
+	}
+	executable := utils.LookPathExecutable(p.Runner, command)
+	if executable == "" {
+		return nil
+	}
+
+	word := ""
+	if !strings.HasSuffix(line, " ") {
+		word = words[len(words)-1]
+	}
+	suggestions := p.AI.Complete(executable, strings.TrimSuffix(line, word))
+
+	return p.completeFuzzily(word, func(prefix string) []shellinput.CompletionCandidate {
+		var candidates []shellinput.CompletionCandidate
+		for _, suggestion := range suggestions {
+			if strings.HasPrefix(suggestion.Name, prefix) {
+				candidates = append(candidates, shellinput.CompletionCandidate{
+					Value:       suggestion.Name,
+					Description: suggestion.Description,
+					Kind:        kindOfValue(suggestion.Name),
+					AI:          true,
+				})
+			}
+		}
+		return candidates
+	})
+}
@@ -0,0 +1,136 @@
+package completion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newAIProvider returns a provider completing with a fake model, and a PATH
+// directory with a tool that logs each time it's run to runs.log
+func newAIProvider(t *testing.T) (*ShellCompletionProvider, string, *[]string) {
+	t.Helper()
+	provider, _ := newSpecProvider(t, nil)
+
+	binDir := t.TempDir()
+	tool := `#!/bin/sh
+echo "$1" >> "$(dirname "$0")/runs.log"
+case "$1" in
+  --version) echo "mytool 1.2.3" ;;
+  --help) printf 'Usage: mytool [options]\n  --color  Colour the output\n  --count  Count things\n' ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "mytool"), []byte(tool), 0755))
+	require.NoError(t, runScript(context.Background(), provider.Runner, "PATH="+quote(binDir)+":$PATH; GSH_AI_COMPLETION=1"))
+
+	var asked []string
+	provider.AI = NewAICompleter(provider.Runner, zap.NewNop(), filepath.Join(t.TempDir(), "help"))
+	provider.AI.ask = func(ctx context.Context, help string, line string) ([]Suggestion, error) {
+		asked = append(asked, line)
+		if !strings.Contains(help, "--color") {
+			return nil, nil
+		}
+		return []Suggestion{
+			{Name: "--color", Description: "Colour the output"},
+			{Name: "--count", Description: "Count things"},
+		}, nil
+	}
+	return provider, binDir, &asked
+}
+
+func TestAICompletions(t *testing.T) {
+	provider, binDir, asked := newAIProvider(t)
+
+	completions := provider.GetAsyncCompletions("mytool --co", 11)
+	assert.Equal(t, []shellinput.CompletionCandidate{
+		{Value: "--color", Description: "Colour the output", Kind: shellinput.CompletionFlag, Score: prefixMatchScore, AI: true},
+		{Value: "--count", Description: "Count things", Kind: shellinput.CompletionFlag, Score: prefixMatchScore, AI: true},
+	}, completions)
+
+	// Completing the same word again uses the earlier suggestions, whether
+	// more of it is typed or it's erased
+	assert.Equal(t, []string{"--count"}, shellinput.CompletionValues(provider.GetAsyncCompletions("mytool --cou", 12)))
+	assert.Equal(t, []string{"--color", "--count"}, shellinput.CompletionValues(provider.GetAsyncCompletions("mytool -", 8)))
+	assert.Equal(t, []string{"mytool "}, *asked)
+
+	runs, err := os.ReadFile(filepath.Join(binDir, "runs.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "--version\n--help\n", string(runs))
+
+	t.Run("help is cached per binary and version", func(t *testing.T) {
+		// A new completer reads the help from the cache instead of running the tool
+		cached := NewAICompleter(provider.Runner, zap.NewNop(), provider.AI.HelpCacheDir)
+		cached.ask = provider.AI.ask
+		provider.AI = cached
+		provider.GetAsyncCompletions("mytool ", 7)
+
+		runs, err := os.ReadFile(filepath.Join(binDir, "runs.log"))
+		require.NoError(t, err)
+		assert.Equal(t, "--version\n--help\n", string(runs))
+
+		// A changed binary of the same version only runs --version
+		modified := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(binDir, "mytool"), modified, modified))
+		provider.GetAsyncCompletions("mytool ", 7)
+
+		runs, err = os.ReadFile(filepath.Join(binDir, "runs.log"))
+		require.NoError(t, err)
+		assert.Equal(t, "--version\n--help\n--version\n", string(runs))
+
+		entries, err := os.ReadDir(provider.AI.HelpCacheDir)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		for _, entry := range entries {
+			assert.True(t, strings.HasPrefix(entry.Name(), "mytool-"))
+		}
+	})
+
+	t.Run("suggestions remembered are bounded", func(t *testing.T) {
+		for i := 0; i < aiCacheMaxEntries; i++ {
+			provider.AI.suggestions[strconv.Itoa(i)] = nil
+		}
+		provider.GetAsyncCompletions("mytool --verbose --co", 21)
+		assert.Len(t, provider.AI.suggestions, 1)
+	})
+}
+
+func TestAICompletionsOnlyForUnknownCommands(t *testing.T) {
+	provider, _, asked := newAIProvider(t)
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"command name", "mytoo"},
+		{"command with a spec", "git --co"},
+		{"command not on PATH", "./mytool --co"},
+		{"missing command", "nosuchtool --co"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Empty(t, provider.GetAsyncCompletions(tt.line, len(tt.line)))
+		})
+	}
+
+	t.Run("command with a completion function", func(t *testing.T) {
+		provider.CompletionManager.(*CompletionManager).AddSpec(CompletionSpec{Command: "mytool", Type: WordListCompletion, Value: "a b"})
+		defer provider.CompletionManager.(*CompletionManager).RemoveSpec("mytool")
+		assert.Empty(t, provider.GetAsyncCompletions("mytool --co", 11))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, runScript(context.Background(), provider.Runner, "GSH_AI_COMPLETION=0"))
+		assert.Empty(t, provider.GetAsyncCompletions("mytool --co", 11))
+	})
+
+	assert.Empty(t, *asked)
+}
@@ -0,0 +1,259 @@
+package completion
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+)
+
+// Scores of candidates matching the word being completed. Prefix matches rank
+// above fuzzy ones, and history adds to both.
+const (
+	prefixMatchScore = 100
+	fuzzyMatchScore  = 50
+	historyScore     = 10
+)
+
+// SetHistory sets the commands run recently, most recent last, whose words
+// rank completions used more often higher
+func (p *ShellCompletionProvider) SetHistory(commands []string) {
+	frequencies := make(map[string]int)
+	for _, command := range commands {
+		for _, word := range strings.Fields(command) {
+			word = strings.Trim(word, `"'`)
+			frequencies[word]++
+			if trimmed := strings.TrimSuffix(word, "/"); trimmed != word {
+				frequencies[trimmed]++
+			}
+		}
+	}
+	p.historyMu.Lock()
+	p.historyFrequencies = frequencies
+	p.historyMu.Unlock()
+}
+
+// historyFrequency returns how many times value was used in recent commands
+func (p *ShellCompletionProvider) historyFrequency(value string) int {
+	p.historyMu.RLock()
+	defer p.historyMu.RUnlock()
+	if p.historyFrequencies == nil {
+		return 0
+	}
+	if frequency, ok := p.historyFrequencies[value]; ok {
+		return frequency
+	}
+	return p.historyFrequencies[strings.TrimSuffix(value, "/")]
+}
+
+// fuzzyScore scores how well pattern matches text, with the letters of pattern
+// appearing in order in text, or returns false if they don't. Matches at the
+// start of text or of its words, and runs of matching letters, score higher.
+func fuzzyScore(pattern string, text string) (float64, bool) {
+	if strings.HasPrefix(text, pattern) {
+		return prefixMatchScore, true
+	}
+
+	patternRunes := []rune(strings.ToLower(pattern))
+	textRunes := []rune(strings.ToLower(text))
+	score, matched, previous := 0, 0, -2
+	for i := 0; i < len(textRunes) && matched < len(patternRunes); i++ {
+		if textRunes[i] != patternRunes[matched] {
+			continue
+		}
+		switch {
+		case i == previous+1:
+			score += 3
+		case i == 0 || !unicode.IsLetter(textRunes[i-1]) && !unicode.IsDigit(textRunes[i-1]):
+			score += 2
+		default:
+			score++
+		}
+		previous = i
+		matched++
+	}
+	if matched < len(patternRunes) {
+		return 0, false
+	}
+	return fuzzyMatchScore * float64(score) / float64(3*len(patternRunes)+1), true
+}
+
+// matchName returns the part of a candidate the word being completed is
+// matched against: the name of a file, without the directory the word is in
+func matchName(value string, word string) string {
+	if i := strings.LastIndex(word, "/"); i >= 0 && strings.HasPrefix(value, word[:i+1]) {
+		return value[i+1:]
+	}
+	return value
+}
+
+// fuzzyCandidates returns the candidates that fuzzily match word
+func fuzzyCandidates(candidates []shellinput.CompletionCandidate, word string) []shellinput.CompletionCandidate {
+	pattern := matchName(word, word)
+	var matches []shellinput.CompletionCandidate
+	for _, candidate := range candidates {
+		if _, ok := fuzzyScore(pattern, matchName(candidate.Value, word)); ok {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// rankCandidates scores the candidates by how well they match word and how
+// often they were used recently, and sorts them best first. Candidates that
+// score the same keep their order.
+func (p *ShellCompletionProvider) rankCandidates(candidates []shellinput.CompletionCandidate, word string) []shellinput.CompletionCandidate {
+	pattern := matchName(word, word)
+	for i := range candidates {
+		score, _ := fuzzyScore(pattern, matchName(candidates[i].Value, word))
+		frequency := p.historyFrequency(strings.Trim(candidates[i].Value, `"`))
+		candidates[i].Score = score + historyScore*math.Log2(1+float64(frequency))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// completeFuzzily returns the candidates generate returns for word, or if there
+// are none, those it returns for the directory of word that fuzzily match it,
+// ranked either way
+func (p *ShellCompletionProvider) completeFuzzily(word string, generate func(prefix string) []shellinput.CompletionCandidate) []shellinput.CompletionCandidate {
+	candidates := generate(word)
+	if len(candidates) == 0 && word != "" {
+		prefix := word[:len(word)-len(matchName(word, word))]
+		if strings.HasPrefix(word, "-") {
+			prefix = "-"
+		}
+		candidates = fuzzyCandidates(generate(prefix), word)
+	}
+	return p.rankCandidates(candidates, word)
+}
+
+// kindOfValue guesses the kind of a completion produced by a completion
+// function from how it looks
+func kindOfValue(value string) shellinput.CompletionKind {
+	switch {
+	case strings.HasPrefix(value, "-"):
+		return shellinput.CompletionFlag
+	case strings.HasPrefix(value, "$"):
+		return shellinput.CompletionVariable
+	case strings.HasSuffix(value, "/"):
+		return shellinput.CompletionDirectory
+	default:
+		return shellinput.CompletionOther
+	}
+}
+
+// valueCandidates creates candidates from the completions of a completion spec
+func valueCandidates(values []string) []shellinput.CompletionCandidate {
+	candidates := make([]shellinput.CompletionCandidate, len(values))
+	for i, value := range values {
+		candidates[i] = shellinput.CompletionCandidate{Value: value, Kind: kindOfValue(value)}
+	}
+	return candidates
+}
+
+// fileCandidates creates candidates from file completions, put between
+// linePrefix and lineSuffix
+func fileCandidates(files []string, linePrefix string, lineSuffix string) []shellinput.CompletionCandidate {
+	candidates := make([]shellinput.CompletionCandidate, len(files))
+	for i, file := range files {
+		kind := shellinput.CompletionFile
+		if strings.HasSuffix(strings.Trim(file, `"`), "/") {
+			kind = shellinput.CompletionDirectory
+		}
+		candidates[i] = shellinput.CompletionCandidate{Value: linePrefix + file + lineSuffix, Kind: kind}
+		if linePrefix != "" || lineSuffix != "" {
+			candidates[i].Display = file
+		}
+	}
+	return candidates
+}
+
+// commandCandidates creates candidates from command names
+func commandCandidates(commands []string) []shellinput.CompletionCandidate {
+	candidates := make([]shellinput.CompletionCandidate, len(commands))
+	for i, command := range commands {
+		candidates[i] = shellinput.CompletionCandidate{Value: command, Kind: shellinput.CompletionCommand}
+	}
+	return candidates
+}
+
+// describeCommands describes command candidates by their completion specs
+func (p *ShellCompletionProvider) describeCommands(candidates []shellinput.CompletionCandidate) []shellinput.CompletionCandidate {
+	if p.Specs == nil {
+		return candidates
+	}
+	for i := range candidates {
+		if spec, ok := p.Specs.Lookup(candidates[i].Value); ok {
+			candidates[i].Description = spec.Description
+		}
+	}
+	return candidates
+}
+
+// Descriptions of the built-in agent commands
+var builtinCommandDescriptions = map[string]string{
+	"new":              "Start a new chat session",
+	"tokens":           "Show token usage statistics",
+	"copy":             "Copy a code block from the last response",
+	"subagents":        "List available subagents",
+	"reload-subagents": "Reload subagent configurations",
+	"subagent-info":    "Show subagent details",
+}
+
+// builtinCommandCandidates creates candidates from @! command completions
+func builtinCommandCandidates(completions []string) []shellinput.CompletionCandidate {
+	candidates := make([]shellinput.CompletionCandidate, len(completions))
+	for i, completion := range completions {
+		candidates[i] = shellinput.CompletionCandidate{
+			Value:       completion,
+			Description: builtinCommandDescriptions[strings.TrimPrefix(completion, "@!")],
+			Kind:        shellinput.CompletionCommand,
+		}
+	}
+	return candidates
+}
+
+// macroCandidates creates candidates from @/ macro completions, described by
+// the messages they expand to
+func (p *ShellCompletionProvider) macroCandidates(completions []string) []shellinput.CompletionCandidate {
+	var macrosStr string
+	if p.Runner != nil {
+		macrosStr = p.Runner.Vars["GSH_AGENT_MACROS"].String()
+	} else {
+		macrosStr = os.Getenv("GSH_AGENT_MACROS")
+	}
+	var macros map[string]interface{}
+	_ = json.Unmarshal([]byte(macrosStr), &macros)
+
+	candidates := make([]shellinput.CompletionCandidate, len(completions))
+	for i, completion := range completions {
+		candidates[i] = shellinput.CompletionCandidate{Value: completion, Kind: shellinput.CompletionMacro}
+		if message, ok := macros[strings.TrimPrefix(completion, "@/")].(string); ok {
+			candidates[i].Description = strings.Join(strings.Fields(message), " ")
+		}
+	}
+	return candidates
+}
+
+// subagentCandidates creates candidates from @ subagent completions, put
+// between linePrefix and lineSuffix
+func (p *ShellCompletionProvider) subagentCandidates(completions []string, linePrefix string, lineSuffix string) []shellinput.CompletionCandidate {
+	candidates := make([]shellinput.CompletionCandidate, len(completions))
+	for i, completion := range completions {
+		candidates[i] = shellinput.CompletionCandidate{Value: linePrefix + completion + lineSuffix, Kind: shellinput.CompletionSubagent}
+		if linePrefix != "" || lineSuffix != "" {
+			candidates[i].Display = completion
+		}
+		if subagent, ok := p.SubagentProvider.GetSubagent(strings.TrimPrefix(completion, "@")); ok {
+			candidates[i].Description = subagent.Description
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,115 @@
+package completion
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		matches bool
+	}{
+		{"gi", "git", true},
+		{"", "anything", true},
+		{"gco", "git-checkout", true},
+		{"GC", "git-checkout", true},
+		{"mian", "main.go", false},
+		{"xyz", "git", false},
+	}
+	for _, tt := range tests {
+		_, ok := fuzzyScore(tt.pattern, tt.text)
+		assert.Equal(t, tt.matches, ok, "%q in %q", tt.pattern, tt.text)
+	}
+
+	prefix, _ := fuzzyScore("st", "status")
+	consecutive, _ := fuzzyScore("sta", "git-status")
+	scattered, _ := fuzzyScore("sta", "sXtXa")
+	assert.Equal(t, float64(prefixMatchScore), prefix)
+	assert.Greater(t, prefix, consecutive)
+	assert.Greater(t, consecutive, scattered)
+}
+
+func TestRankCandidates(t *testing.T) {
+	provider := &ShellCompletionProvider{}
+	candidates := shellinput.NewCompletionCandidates([]string{"gist", "git", "give"})
+
+	// Without history, candidates keep their order
+	ranked := provider.rankCandidates(candidates, "gi")
+	assert.Equal(t, []string{"gist", "git", "give"}, shellinput.CompletionValues(ranked))
+
+	provider.SetHistory([]string{"git status", "give up", "git push", "cd src/"})
+	ranked = provider.rankCandidates(candidates, "gi")
+	assert.Equal(t, []string{"git", "give", "gist"}, shellinput.CompletionValues(ranked))
+	assert.Greater(t, ranked[0].Score, ranked[1].Score)
+
+	// Directories are counted with and without their trailing slash
+	assert.Equal(t, 1, provider.historyFrequency("src/"))
+	assert.Equal(t, 1, provider.historyFrequency("src"))
+}
+
+func TestFuzzyCompletions(t *testing.T) {
+	provider, dir := newSpecProvider(t, map[string]string{"tool.yaml": testSpec})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "parser_test.go"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "parser.go"), nil, 0644))
+
+	t.Run("files", func(t *testing.T) {
+		completions := provider.GetCompletions("cat src/prstest", 15)
+		assert.Equal(t, []string{"src/parser_test.go"}, shellinput.CompletionValues(completions))
+		assert.Equal(t, shellinput.CompletionFile, completions[0].Kind)
+	})
+
+	t.Run("spec options", func(t *testing.T) {
+		completions := provider.GetCompletions("tool --vrb", 10)
+		assert.Equal(t, []string{"--verbose"}, shellinput.CompletionValues(completions))
+		assert.Equal(t, "Print more", completions[0].Description)
+		assert.Equal(t, shellinput.CompletionFlag, completions[0].Kind)
+	})
+
+	t.Run("prefix matches come first", func(t *testing.T) {
+		completions := provider.GetCompletions("tool st", 7)
+		assert.Equal(t, []string{"status"}, shellinput.CompletionValues(completions))
+		assert.Equal(t, shellinput.CompletionCommand, completions[0].Kind)
+		assert.Equal(t, "Show the status", completions[0].Description)
+	})
+
+	t.Run("history ranks files", func(t *testing.T) {
+		provider.SetHistory([]string{"vim src/parser_test.go", "go test src/parser_test.go"})
+		completions := provider.GetCompletions("cat src/pa", 10)
+		assert.Equal(t, []string{"src/parser_test.go", "src/parser.go"}, shellinput.CompletionValues(completions))
+	})
+}
+
+func TestCompletionCandidateKinds(t *testing.T) {
+	provider, _ := newSpecProvider(t, nil)
+
+	completions := provider.GetCompletions("ls ", 3)
+	kinds := map[string]shellinput.CompletionKind{}
+	for _, completion := range completions {
+		kinds[completion.Value] = completion.Kind
+	}
+	assert.Equal(t, map[string]shellinput.CompletionKind{
+		"main.go": shellinput.CompletionFile,
+		"src/":    shellinput.CompletionDirectory,
+	}, kinds)
+
+	completions = provider.GetCompletions("@!tok", 5)
+	assert.Equal(t, []shellinput.CompletionCandidate{{
+		Value:       "@!tokens",
+		Description: "Show token usage statistics",
+		Kind:        shellinput.CompletionCommand,
+	}}, completions)
+
+	assert.Equal(t, []shellinput.CompletionCandidate{
+		{Value: "-f", Kind: shellinput.CompletionFlag},
+		{Value: "$HOME", Kind: shellinput.CompletionVariable},
+		{Value: "dir/", Kind: shellinput.CompletionDirectory},
+		{Value: "word", Kind: shellinput.CompletionOther},
+	}, valueCandidates([]string{"-f", "$HOME", "dir/", "word"}))
+}
@@ -3,127 +3,334 @@ package completion
 import (
 	"context"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 
 	"mvdan.cc/sh/v3/interp"
 )
 
-// For testing purposes
-var printf = fmt.Printf
-
-// NewCompleteCommandHandler creates a new ExecHandler for the complete command
+// NewCompleteCommandHandler creates a new ExecHandler for the complete,
+// compgen and compopt commands
 func NewCompleteCommandHandler(completionManager *CompletionManager) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
 	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
 		return func(ctx context.Context, args []string) error {
-			if len(args) == 0 || args[0] != "complete" {
+			if len(args) == 0 {
+				return next(ctx, args)
+			}
+
+			var handle func(ctx context.Context, manager *CompletionManager, out io.Writer, args []string) error
+			switch args[0] {
+			case "complete":
+				handle = handleCompleteCommand
+			case "compgen":
+				handle = handleCompgenCommand
+			case "compopt":
+				handle = handleCompoptCommand
+			default:
 				return next(ctx, args)
 			}
 
-			// Handle the complete command
-			return handleCompleteCommand(completionManager, args[1:])
+			hc := interp.HandlerCtx(ctx)
+			if err := handle(ctx, completionManager, hc.Stdout, args[1:]); err != nil {
+				if _, ok := interp.IsExitStatus(err); ok {
+					return err
+				}
+				fmt.Fprintf(hc.Stderr, "%s: %v\n", args[0], err)
+				return interp.NewExitStatus(2)
+			}
+			return nil
 		}
 	}
 }
 
-func handleCompleteCommand(manager *CompletionManager, args []string) error {
-	if len(args) == 0 {
-		// No arguments - print all completion specs
-		return printCompletionSpecs(manager, "")
-	}
+// completionArgs are the parsed arguments of complete, compgen and compopt
+type completionArgs struct {
+	spec    CompletionSpec
+	names   []string // command names, or the word of compgen
+	print   bool     // -p
+	remove  bool     // -r
+	dflt    bool     // -D
+	empty   bool     // -E
+	removed []string // options turned off with +o
+	any     bool     // whether any option generating completions was given
+}
 
-	// Parse options
-	var (
-		printMode   bool
-		removeMode  bool
-		wordList    string
-		function    string
-		command     string
-	)
+// parseCompletionArgs parses the options of complete, compgen and compopt,
+// which share those that make up a completion spec. Options can be combined
+// like -df, and -- ends them.
+func parseCompletionArgs(builtin string, args []string) (completionArgs, error) {
+	var parsed completionArgs
+	var function, command, wordList string
+	hasWordList := false
 
-	for i := 0; i < len(args); i++ {
+	i := 0
+	for ; i < len(args); i++ {
 		arg := args[i]
-		switch arg {
-		case "-p":
-			printMode = true
-		case "-r":
-			removeMode = true
-		case "-W":
-			if i+1 >= len(args) {
-				return fmt.Errorf("option -W requires a word list")
-			}
+		if arg == "--" {
 			i++
-			wordList = args[i]
-		case "-F":
-			if i+1 >= len(args) {
-				return fmt.Errorf("option -F requires a function name")
+			break
+		}
+		if len(arg) < 2 || (arg[0] != '-' && !(arg[0] == '+' && builtin == "compopt")) {
+			break
+		}
+
+		for j := 1; j < len(arg); j++ {
+			flag := arg[j]
+
+			// Options that take an argument, from the rest of this word or the next
+			argument := func(description string) (string, error) {
+				if j+1 < len(arg) {
+					value := arg[j+1:]
+					j = len(arg)
+					return value, nil
+				}
+				if i+1 >= len(args) {
+					return "", fmt.Errorf("option -%c requires %s", flag, description)
+				}
+				i++
+				return args[i], nil
 			}
-			i++
-			function = args[i]
-		default:
-			if !strings.HasPrefix(arg, "-") {
-				command = arg
-				break
+
+			if arg[0] == '+' {
+				if flag != 'o' {
+					return parsed, fmt.Errorf("unknown option: %s", arg)
+				}
+				option, err := argument("an option name")
+				if err != nil {
+					return parsed, err
+				}
+				if !slices.Contains(CompletionOptions, option) {
+					return parsed, fmt.Errorf("%s: invalid option name", option)
+				}
+				parsed.removed = append(parsed.removed, option)
+				continue
+			}
+
+			var err error
+			switch {
+			case flag == 'o':
+				var option string
+				if option, err = argument("an option name"); err == nil {
+					if !slices.Contains(CompletionOptions, option) {
+						return parsed, fmt.Errorf("%s: invalid option name", option)
+					}
+					parsed.spec.Options = append(parsed.spec.Options, option)
+				}
+			case flag == 'D' && builtin != "compgen":
+				parsed.dflt = true
+			case flag == 'E' && builtin != "compgen":
+				parsed.empty = true
+			case builtin == "compopt":
+				return parsed, fmt.Errorf("unknown option: %s", arg)
+			case flag == 'p' && builtin == "complete":
+				parsed.print = true
+			case flag == 'r' && builtin == "complete":
+				parsed.remove = true
+			case flag == 'A':
+				var action string
+				if action, err = argument("an action"); err == nil {
+					if !slices.Contains(CompletionActions, action) {
+						return parsed, fmt.Errorf("%s: invalid action name", action)
+					}
+					parsed.spec.Actions = append(parsed.spec.Actions, action)
+				}
+			case actionShorthands[flag] != "":
+				parsed.spec.Actions = append(parsed.spec.Actions, actionShorthands[flag])
+			case flag == 'W':
+				wordList, err = argument("a word list")
+				hasWordList = true
+			case flag == 'F':
+				function, err = argument("a function name")
+			case flag == 'C':
+				command, err = argument("a command")
+			case flag == 'G':
+				parsed.spec.GlobPattern, err = argument("a pattern")
+			case flag == 'X':
+				parsed.spec.Filter, err = argument("a pattern")
+			case flag == 'P':
+				parsed.spec.Prefix, err = argument("a prefix")
+			case flag == 'S':
+				parsed.spec.Suffix, err = argument("a suffix")
+			default:
+				return parsed, fmt.Errorf("unknown option: %s", arg)
+			}
+			if err != nil {
+				return parsed, err
 			}
-			return fmt.Errorf("unknown option: %s", arg)
 		}
 	}
+	parsed.names = args[i:]
 
-	if command == "" && !printMode {
-		return fmt.Errorf("no command specified")
+	if function != "" && command != "" {
+		return parsed, fmt.Errorf("-F and -C can't be used together")
 	}
-
-	// Handle different modes
-	if printMode {
-		return printCompletionSpecs(manager, command)
+	spec := &parsed.spec
+	switch {
+	case function != "":
+		spec.Type, spec.Value, spec.WordList = FunctionCompletion, function, wordList
+	case command != "":
+		spec.Type, spec.Value, spec.WordList = CommandCompletion, command, wordList
+	case hasWordList:
+		spec.Type, spec.Value = WordListCompletion, wordList
+	case len(spec.Actions) > 0 || spec.GlobPattern != "":
+		spec.Type = ActionCompletion
 	}
+	parsed.any = spec.Type != "" || len(spec.Options) > 0 || spec.Filter != "" || spec.Prefix != "" || spec.Suffix != ""
+	return parsed, nil
+}
 
-	if removeMode {
-		manager.RemoveSpec(command)
-		return nil
+// specNames returns the names the specs of parsed are stored under
+func (parsed completionArgs) specNames() []string {
+	names := slices.Clone(parsed.names)
+	if parsed.dflt {
+		names = append(names, DefaultCompletionCommand)
+	}
+	if parsed.empty {
+		names = append(names, EmptyCompletionCommand)
 	}
+	return names
+}
 
-	if wordList != "" {
-		manager.AddSpec(CompletionSpec{
-			Command: command,
-			Type:    WordListCompletion,
-			Value:   wordList,
-		})
-		return nil
+func handleCompleteCommand(ctx context.Context, manager *CompletionManager, out io.Writer, args []string) error {
+	parsed, err := parseCompletionArgs("complete", args)
+	if err != nil {
+		return err
 	}
+	names := parsed.specNames()
 
-	if function != "" {
-		manager.AddSpec(CompletionSpec{
-			Command: command,
-			Type:    FunctionCompletion,
-			Value:   function,
-		})
+	if len(args) == 0 || (parsed.print && len(names) == 0) {
+		// Print all completion specs
+		for _, spec := range manager.ListSpecs() {
+			fmt.Fprintln(out, formatCompletionSpec(spec))
+		}
 		return nil
 	}
 
-	return fmt.Errorf("invalid complete command usage")
-}
-
-func printCompletionSpecs(manager *CompletionManager, command string) error {
-	if command != "" {
-		// Print specific command
-		if spec, ok := manager.GetSpec(command); ok {
-			printCompletionSpec(spec)
+	if parsed.remove && len(names) == 0 {
+		for _, spec := range manager.ListSpecs() {
+			manager.RemoveSpec(spec.Command)
 		}
 		return nil
 	}
 
-	// Print all specs
-	for _, spec := range manager.ListSpecs() {
-		printCompletionSpec(spec)
+	if len(names) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	for _, name := range names {
+		switch {
+		case parsed.print:
+			// Like bash, only the command's own spec is printed
+			if spec, ok := manager.specs[name]; ok {
+				fmt.Fprintln(out, formatCompletionSpec(spec))
+			} else {
+				return fmt.Errorf("%s: no completion specification", name)
+			}
+		case parsed.remove:
+			manager.RemoveSpec(name)
+		default:
+			spec := parsed.spec
+			spec.Command = name
+			manager.AddSpec(spec)
+		}
 	}
 	return nil
 }
 
-func printCompletionSpec(spec CompletionSpec) {
+// formatCompletionSpec formats a spec as the complete command that defines it,
+// the way complete -p prints it
+func formatCompletionSpec(spec CompletionSpec) string {
+	parts := []string{"complete"}
+	for _, option := range spec.Options {
+		parts = append(parts, "-o", option)
+	}
+	for _, action := range spec.Actions {
+		shorthand := false
+		for flag, name := range actionShorthands {
+			if name == action {
+				parts = append(parts, "-"+string(flag))
+				shorthand = true
+				break
+			}
+		}
+		if !shorthand {
+			parts = append(parts, "-A", action)
+		}
+	}
+	if spec.GlobPattern != "" {
+		parts = append(parts, "-G", fmt.Sprintf("%q", spec.GlobPattern))
+	}
+	if wordList := spec.wordList(); wordList != "" {
+		parts = append(parts, "-W", fmt.Sprintf("%q", wordList))
+	}
+	if spec.Prefix != "" {
+		parts = append(parts, "-P", fmt.Sprintf("%q", spec.Prefix))
+	}
+	if spec.Suffix != "" {
+		parts = append(parts, "-S", fmt.Sprintf("%q", spec.Suffix))
+	}
+	if spec.Filter != "" {
+		parts = append(parts, "-X", fmt.Sprintf("%q", spec.Filter))
+	}
 	switch spec.Type {
-	case WordListCompletion:
-		printf("complete -W %q %s\n", spec.Value, spec.Command)
 	case FunctionCompletion:
-		printf("complete -F %s %s\n", spec.Value, spec.Command)
+		parts = append(parts, "-F", spec.Value)
+	case CommandCompletion:
+		parts = append(parts, "-C", fmt.Sprintf("%q", spec.Value))
+	}
+	return strings.Join(append(parts, spec.Command), " ")
+}
+
+// handleCompoptCommand changes the options of the specs of the given
+// commands, or of the completion being executed when there are none
+func handleCompoptCommand(ctx context.Context, manager *CompletionManager, out io.Writer, args []string) error {
+	parsed, err := parseCompletionArgs("compopt", args)
+	if err != nil {
+		return err
+	}
+
+	update := func(spec *CompletionSpec, name string) {
+		if len(parsed.spec.Options) == 0 && len(parsed.removed) == 0 {
+			// Without options, print the options of the spec
+			parts := []string{"compopt"}
+			for _, option := range CompletionOptions {
+				if spec.HasOption(option) {
+					parts = append(parts, "-o", option)
+				} else {
+					parts = append(parts, "+o", option)
+				}
+			}
+			if name != "" {
+				parts = append(parts, name)
+			}
+			fmt.Fprintln(out, strings.Join(parts, " "))
+			return
+		}
+		options := make([]string, 0, len(spec.Options))
+		for _, option := range spec.Options {
+			if !slices.Contains(parsed.removed, option) && !slices.Contains(parsed.spec.Options, option) {
+				options = append(options, option)
+			}
+		}
+		spec.Options = append(options, parsed.spec.Options...)
 	}
-}
\ No newline at end of file
+
+	names := parsed.specNames()
+	if len(names) == 0 {
+		if manager.current == nil {
+			return fmt.Errorf("not currently executing completion function")
+		}
+		update(manager.current, "")
+		return nil
+	}
+	for _, name := range names {
+		spec, ok := manager.specs[name]
+		if !ok {
+			return fmt.Errorf("%s: no completion specification", name)
+		}
+		update(&spec, name)
+		manager.AddSpec(spec)
+	}
+	return nil
+}
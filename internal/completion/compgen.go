@@ -3,98 +3,65 @@ package completion
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	"mvdan.cc/sh/v3/interp"
 )
 
 // NewCompgenCommandHandler creates a new ExecHandler for the compgen command
+// alone, for shells without a CompletionManager
 func NewCompgenCommandHandler(runner *interp.Runner) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	manager := NewCompletionManager()
+	manager.SetRunner(runner)
+	complete := NewCompleteCommandHandler(manager)
 	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		handler := complete(next)
 		return func(ctx context.Context, args []string) error {
 			if len(args) == 0 || args[0] != "compgen" {
 				return next(ctx, args)
 			}
-
-			// Handle the compgen command
-			return handleCompgenCommand(ctx, runner, args[1:])
+			return handler(ctx, args)
 		}
 	}
 }
 
-func handleCompgenCommand(ctx context.Context, runner *interp.Runner, args []string) error {
+// handleCompgenCommand prints the completions of the spec its options make up
+// for the word it's given, one per line. Like bash, it fails when there are
+// none.
+func handleCompgenCommand(ctx context.Context, manager *CompletionManager, out io.Writer, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("compgen: no options specified")
+		return fmt.Errorf("no options specified")
 	}
 
-	// Parse options
-	var (
-		wordList    string
-		functionName string
-		word        string // The word to generate completions for
-	)
-
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		switch arg {
-		case "-W":
-			if i+1 >= len(args) {
-				return fmt.Errorf("option -W requires a word list")
-			}
-			i++
-			wordList = args[i]
-		case "-F":
-			if i+1 >= len(args) {
-				return fmt.Errorf("option -F requires a function name")
-			}
-			i++
-			functionName = args[i]
-		default:
-			if !strings.HasPrefix(arg, "-") {
-				word = arg
-				break
-			}
-			return fmt.Errorf("unknown option: %s", arg)
-		}
+	parsed, err := parseCompletionArgs("compgen", args)
+	if err != nil {
+		return err
 	}
-
-	// Generate completions based on the options
-	if wordList != "" {
-		return generateWordListCompletions(word, wordList)
+	if !parsed.any {
+		return fmt.Errorf("no completion type specified")
 	}
-
-	if functionName != "" {
-		return generateFunctionCompletions(ctx, runner, functionName, word)
+	word := ""
+	if len(parsed.names) > 0 {
+		word = parsed.names[0]
 	}
 
-	return fmt.Errorf("compgen: no completion type specified")
-}
-
-func generateWordListCompletions(word string, wordList string) error {
-	words := strings.Fields(wordList)
-	for _, w := range words {
-		if word == "" || strings.HasPrefix(w, word) {
-			printf("%s\n", w)
-		}
-	}
-	return nil
-}
-
-func generateFunctionCompletions(ctx context.Context, runner *interp.Runner, functionName string, word string) error {
-	// Create a completion function
-	fn := NewCompletionFunction(functionName, runner)
-
-	// Execute the function with the word as argument
-	completions, err := fn.Execute(ctx, []string{word})
+	line := commandLine{text: word, point: len(word), single: true}
+	completions, err := manager.generate(ctx, manager.runner, parsed.spec, line)
 	if err != nil {
-		return fmt.Errorf("failed to execute completion function: %w", err)
+		return err
 	}
 
-	// Print the completions
+	matched := false
 	for _, completion := range completions {
-		if word == "" || strings.HasPrefix(completion, word) {
-			printf("%s\n", completion)
+		// Unlike those of complete, the results of functions are filtered too
+		if strings.HasPrefix(completion, word) || parsed.spec.Prefix != "" {
+			fmt.Fprintln(out, completion)
+			matched = true
 		}
 	}
+	if !matched {
+		return interp.NewExitStatus(1)
+	}
 	return nil
-}
\ No newline at end of file
+}
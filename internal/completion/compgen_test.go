@@ -1,8 +1,8 @@
 package completion
 
 import (
+	"bytes"
 	"context"
-	"fmt"
 	"strings"
 	"testing"
 
@@ -11,10 +11,6 @@ import (
 )
 
 func TestCompgenCommand(t *testing.T) {
-	// Save and restore printf
-	oldPrintf := printf
-	defer func() { printf = oldPrintf }()
-
 	tests := []struct {
 		name          string
 		args          []string
@@ -58,6 +54,35 @@ func TestCompgenCommand(t *testing.T) {
 			`,
 			want: []string{"bar", "baz"},
 		},
+		{
+			name: "options end at --",
+			args: []string{"compgen", "-W", "-a -b --long", "--", "-"},
+			want: []string{"-a", "-b", "--long"},
+		},
+		{
+			name: "word list is expanded",
+			args: []string{"compgen", "-W", "$(echo one two) \"$HOME\"", "o"},
+			want: []string{"one"},
+		},
+		{
+			name: "actions",
+			args: []string{"compgen", "-A", "function", "-k", "f"},
+			setupScript: `
+				foo() { :; }
+				bar() { :; }
+			`,
+			want: []string{"foo", "fi", "for", "function"},
+		},
+		{
+			name: "filter with an extended pattern, prefix and suffix",
+			args: []string{"compgen", "-W", "a.go a.md b.txt", "-X", "!*.@(go|md)", "-P", "<", "-S", ">"},
+			want: []string{"<a.go>", "<a.md>"},
+		},
+		{
+			name: "command output",
+			args: []string{"compgen", "-C", "printf '%s\\n' wa wb x #", "w"},
+			want: []string{"wa", "wb"},
+		},
 		{
 			name:          "missing -W argument",
 			args:          []string{"compgen", "-W"},
@@ -92,19 +117,15 @@ func TestCompgenCommand(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a buffer to capture output
-			var output []string
-			printf = func(format string, a ...interface{}) (n int, err error) {
-				output = append(output, strings.TrimSpace(fmt.Sprintf(format, a...)))
-				return 0, nil
-			}
-
-			// Create a new runner
+			// Create a new runner, with the handler and its output captured
 			parser := syntax.NewParser()
 			runner, err := interp.New()
 			if err != nil {
 				t.Fatalf("failed to create runner: %v", err)
 			}
+			var stdout, stderr bytes.Buffer
+			interp.StdIO(nil, &stdout, &stderr)(runner)
+			interp.ExecHandlers(NewCompgenCommandHandler(runner))(runner)
 
 			// Set up the completion function if needed
 			if tt.setupScript != "" {
@@ -117,12 +138,8 @@ func TestCompgenCommand(t *testing.T) {
 				}
 			}
 
-			// Create the handler
-			handler := NewCompgenCommandHandler(runner)
-			execHandler := handler(nil)
-
 			// Run the command
-			err = execHandler(context.Background(), tt.args)
+			err = runScript(context.Background(), runner, quoteArgs(tt.args))
 
 			// Check error
 			if tt.wantErr {
@@ -130,17 +147,18 @@ func TestCompgenCommand(t *testing.T) {
 					t.Errorf("expected error but got none")
 					return
 				}
-				if !strings.HasPrefix(err.Error(), tt.wantErrPrefix) {
-					t.Errorf("error = %v, wantPrefix %v", err, tt.wantErrPrefix)
+				if !strings.HasPrefix(stderr.String(), "compgen: "+strings.TrimPrefix(tt.wantErrPrefix, "compgen: ")) {
+					t.Errorf("error = %v, wantPrefix %v", stderr.String(), tt.wantErrPrefix)
 				}
 				return
 			}
-			if err != nil {
-				t.Errorf("unexpected error: %v", err)
+			if stderr.Len() > 0 {
+				t.Errorf("unexpected error: %v", stderr.String())
 				return
 			}
 
 			// Check output
+			output := strings.Fields(stdout.String())
 			if len(output) != len(tt.want) {
 				t.Errorf("got %d completions, want %d", len(output), len(tt.want))
 				return
@@ -154,3 +172,41 @@ func TestCompgenCommand(t *testing.T) {
 	}
 }
 
+func TestJobActions(t *testing.T) {
+	defer func(jobNames func(string) []string) { JobNames = jobNames }(JobNames)
+	JobNames = func(state string) []string {
+		if state == "stopped" {
+			return []string{"vim"}
+		}
+		return []string{"sleep", "vim"}
+	}
+
+	tests := []struct {
+		action string
+		want   []string
+	}{
+		{"job", []string{"sleep", "vim"}},
+		{"running", []string{"sleep", "vim"}},
+		{"stopped", []string{"vim"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			names, err := generateAction(nil, tt.action, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(names, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+// quoteArgs quotes args as a command line
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -1,12 +1,15 @@
 package completion
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
 )
@@ -163,29 +166,102 @@ func TestCompletionManager(t *testing.T) {
 	})
 }
 
-func TestCompleteCommandHandler(t *testing.T) {
-	t.Run("completion specifications", func(t *testing.T) {
-		manager := NewCompletionManager()
-		handler := NewCompleteCommandHandler(manager)
+// newCompletionShell returns a shell with the completion builtins, and a
+// function running a command in it that returns its output
+func newCompletionShell(t *testing.T) (*CompletionManager, *interp.Runner, func(args ...string) (string, string, error)) {
+	t.Helper()
+	manager := NewCompletionManager()
+	runner, err := interp.New(interp.ExecHandlers(NewCompleteCommandHandler(manager)))
+	require.NoError(t, err)
+	runner.Reset()
+	manager.SetRunner(runner)
+
+	run := func(args ...string) (string, string, error) {
+		var stdout, stderr bytes.Buffer
+		interp.StdIO(nil, &stdout, &stderr)(runner)
+		err := runScript(context.Background(), runner, quoteArgs(args))
+		return stdout.String(), stderr.String(), err
+	}
+	return manager, runner, run
+}
 
-		// Create a mock next handler that just returns nil
-		nextHandler := func(ctx context.Context, args []string) error {
-			return nil
+func TestBashCompletionScripts(t *testing.T) {
+	manager, runner, run := newCompletionShell(t)
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), nil, 0644))
+	_, _, err := run("cd", dir)
+	require.NoError(t, err)
+
+	// A loader like bash-completion's, which installs the spec of a command
+	// the first time it's completed
+	_, stderr, err := run("eval", `
+		_completion_loader() {
+			_mycmd() {
+				local cur=$2 prev=$3
+				if [[ $prev == = ]]; then
+					COMPREPLY=($(compgen -W "always auto never" -- "$cur"))
+					return
+				fi
+				if [[ $cur == -* ]]; then
+					compopt -o nospace
+					COMPREPLY=($(compgen -W "--color= --help" -- "$cur"))
+				fi
+			}
+			complete -o default -F _mycmd "$1" && return 124
 		}
+	`)
+	require.NoError(t, err, stderr)
+
+	complete := func(line string) []string {
+		t.Helper()
+		command := strings.Fields(line)[0]
+		spec, ok := manager.GetSpec(command)
+		require.True(t, ok)
+		ctx := withCommandLine(context.Background(), line, len(line))
+		completions, err := manager.ExecuteCompletion(ctx, runner, spec, strings.Fields(line))
+		require.NoError(t, err)
+		return completions
+	}
+
+	assert.Equal(t, []string{"--color="}, complete("mycmd --co"), "the loaded spec is used right away")
+	assert.True(t, manager.specs["mycmd"].HasOption("default"))
+	assert.False(t, manager.specs["mycmd"].HasOption("nospace"), "compopt without names only changes the running completion")
+	assert.Equal(t, []string{"--color=always", "--color=auto"}, complete("mycmd --color=a"), "completions keep the text before the word break")
+	assert.Equal(t, []string{"main.go", "src/"}, complete("mycmd "), "-o default falls back to file names")
+
+	// -X, -P and -S apply to the results of actions
+	_, _, err = run("complete", "-f", "-X", "*.go", "-P", "./", "cat")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./src"}, complete("cat "))
+}
 
-		wrappedHandler := handler(nextHandler)
-
-		// Test adding word list completion
-		var captured []string
-		oldPrintf := printf
-		printf = func(format string, a ...any) (int, error) {
-			captured = append(captured, fmt.Sprintf(format, a...))
-			return len(format), nil
+func TestPatternRegexp(t *testing.T) {
+	tests := map[string][]string{
+		"*.@(go|md)": {"a.go", "b.md"},
+		"?(x)y+(z)":  {"yz", "xyzz"},
+		"[!a]*":      {"b", "bcd"},
+		`\*`:         {"*"},
+	}
+	for pattern, matches := range tests {
+		re, err := patternRegexp(pattern)
+		require.NoError(t, err, pattern)
+		for _, match := range matches {
+			assert.True(t, re.MatchString(match), "%s should match %s", pattern, match)
 		}
-		defer func() { printf = oldPrintf }()
+	}
+	re, _ := patternRegexp("*.@(go|md)")
+	assert.False(t, re.MatchString("a.txt"))
+	re, _ = patternRegexp("[!a]*")
+	assert.False(t, re.MatchString("abc"))
+}
+
+func TestCompleteCommandHandler(t *testing.T) {
+	t.Run("completion specifications", func(t *testing.T) {
+		manager, _, run := newCompletionShell(t)
 
 		// Test word list completion
-		err := wrappedHandler(context.Background(), []string{"complete", "-W", "foo bar", "mycmd"})
+		_, _, err := run("complete", "-W", "foo bar", "mycmd")
 		assert.NoError(t, err)
 
 		// Verify the word list spec was added correctly
@@ -195,7 +271,7 @@ func TestCompleteCommandHandler(t *testing.T) {
 		assert.Equal(t, "foo bar", spec.Value)
 
 		// Test function completion
-		err = wrappedHandler(context.Background(), []string{"complete", "-F", "_mycmd_completion", "mycmd2"})
+		_, _, err = run("complete", "-F", "_mycmd_completion", "mycmd2")
 		assert.NoError(t, err)
 
 		// Verify the function spec was added correctly
@@ -205,32 +281,72 @@ func TestCompleteCommandHandler(t *testing.T) {
 		assert.Equal(t, "_mycmd_completion", spec.Value)
 
 		// Test complete -p
-		captured = []string{}
-		err = wrappedHandler(context.Background(), []string{"complete", "-p"})
+		captured, _, err := run("complete", "-p")
 		assert.NoError(t, err)
 		assert.Contains(t, captured, "complete -W \"foo bar\" mycmd\n")
 		assert.Contains(t, captured, "complete -F _mycmd_completion mycmd2\n")
 
 		// Test complete -p mycmd
-		captured = []string{}
-		err = wrappedHandler(context.Background(), []string{"complete", "-p", "mycmd"})
+		captured, _, err = run("complete", "-p", "mycmd")
 		assert.NoError(t, err)
-		assert.Equal(t, []string{"complete -W \"foo bar\" mycmd\n"}, captured)
+		assert.Equal(t, "complete -W \"foo bar\" mycmd\n", captured)
 
 		// Test complete -r mycmd
-		err = wrappedHandler(context.Background(), []string{"complete", "-r", "mycmd"})
+		_, _, err = run("complete", "-r", "mycmd")
 		assert.NoError(t, err)
 		_, exists = manager.GetSpec("mycmd")
 		assert.False(t, exists)
 	})
 
-	t.Run("error cases", func(t *testing.T) {
-		manager := NewCompletionManager()
-		handler := NewCompleteCommandHandler(manager)
-		nextHandler := func(ctx context.Context, args []string) error {
-			return nil
+	t.Run("full specifications", func(t *testing.T) {
+		manager, _, run := newCompletionShell(t)
+
+		_, stderr, err := run("complete", "-o", "nospace", "-o", "filenames", "-df", "-A", "signal", "-X", "!*.go", "-P", "./", "-F", "_go", "go", "gofmt")
+		require.NoError(t, err, stderr)
+		for _, command := range []string{"go", "gofmt"} {
+			spec, ok := manager.GetSpec(command)
+			require.True(t, ok, command)
+			assert.Equal(t, []string{"nospace", "filenames"}, spec.Options)
+			assert.Equal(t, []string{"directory", "file", "signal"}, spec.Actions)
+			assert.Equal(t, "!*.go", spec.Filter)
+			assert.Equal(t, "./", spec.Prefix)
+			assert.Equal(t, FunctionCompletion, spec.Type)
 		}
-		wrappedHandler := handler(nextHandler)
+
+		out, _, err := run("complete", "-p", "go")
+		require.NoError(t, err)
+		assert.Equal(t, "complete -o nospace -o filenames -d -f -A signal -P \"./\" -X \"!*.go\" -F _go go\n", out)
+
+		// Default and empty line specs
+		_, _, err = run("complete", "-D", "-o", "default", "-F", "_default")
+		require.NoError(t, err)
+		_, _, err = run("complete", "-E", "-W", "ls cd")
+		require.NoError(t, err)
+		spec, ok := manager.GetSpec("unknown")
+		require.True(t, ok, "commands without a spec use the default one")
+		assert.Equal(t, "_default", spec.Value)
+		spec, ok = manager.GetSpec(EmptyCompletionCommand)
+		require.True(t, ok)
+		assert.Equal(t, "ls cd", spec.Value)
+		out, _, _ = run("complete", "-p", "-D")
+		assert.Equal(t, "complete -o default -F _default -D\n", out)
+
+		// compopt changes the options of a spec
+		_, _, err = run("compopt", "+o", "nospace", "-o", "plusdirs", "go")
+		require.NoError(t, err)
+		spec, _ = manager.GetSpec("go")
+		assert.Equal(t, []string{"filenames", "plusdirs"}, spec.Options)
+		out, _, _ = run("compopt", "go")
+		assert.Equal(t, "compopt +o bashdefault +o default +o dirnames -o filenames +o noquote +o nosort +o nospace -o plusdirs go\n", out)
+
+		// complete -r without names removes every spec
+		_, _, err = run("complete", "-r")
+		require.NoError(t, err)
+		assert.Empty(t, manager.ListSpecs())
+	})
+
+	t.Run("error cases", func(t *testing.T) {
+		_, _, run := newCompletionShell(t)
 
 		testCases := []struct {
 			name    string
@@ -252,13 +368,28 @@ func TestCompleteCommandHandler(t *testing.T) {
 				args:    []string{"complete", "-W", "foo bar"},
 				wantErr: "no command specified",
 			},
+			{
+				name:    "invalid option name",
+				args:    []string{"complete", "-o", "nope", "mycmd"},
+				wantErr: "nope: invalid option name",
+			},
+			{
+				name:    "invalid action",
+				args:    []string{"complete", "-A", "nope", "mycmd"},
+				wantErr: "nope: invalid action name",
+			},
+			{
+				name:    "compopt outside of a completion function",
+				args:    []string{"compopt", "-o", "nospace"},
+				wantErr: "compopt: not currently executing completion function",
+			},
 		}
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				err := wrappedHandler(context.Background(), tc.args)
+				_, stderr, err := run(tc.args...)
 				assert.Error(t, err)
-				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Contains(t, stderr, tc.wantErr)
 			})
 		}
 	})
@@ -0,0 +1,218 @@
+package completion
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/pattern"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const (
+	// Number of directories a glob may read while completing, so one like
+	// /**/* doesn't hold up the input
+	globMaxDirectories = 1000
+	// Number of directories a glob may read for its preview, which is
+	// updated as you type
+	globPreviewMaxDirectories = 32
+	// Number of matches shown in the preview of a glob
+	globPreviewMaxMatches = 3
+)
+
+var errGlobTooLarge = errors.New("glob reads too many directories")
+
+// runnerEnviron is the environment of the shell, for expanding words
+type runnerEnviron struct {
+	variables map[string]expand.Variable
+}
+
+func newRunnerEnviron(runner *interp.Runner) runnerEnviron {
+	variables := runnerVariables(runner)
+	// Relative globs are matched in the directory the shell is in
+	variables["PWD"] = expand.Variable{Kind: expand.String, Str: environment.GetPwd(runner)}
+	return runnerEnviron{variables: variables}
+}
+
+func (e runnerEnviron) Get(name string) expand.Variable {
+	return e.variables[name]
+}
+
+func (e runnerEnviron) Each(fn func(name string, vr expand.Variable) bool) {
+	for name, variable := range e.variables {
+		if !fn(name, variable) {
+			return
+		}
+	}
+}
+
+// parseWord parses a single shell word, or returns nil if s isn't one
+func parseWord(s string) *syntax.Word {
+	file, err := syntax.NewParser().Parse(strings.NewReader(s), "")
+	if err != nil || len(file.Stmts) != 1 {
+		return nil
+	}
+	call, ok := file.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) != 1 || len(call.Assigns) > 0 {
+		return nil
+	}
+	return call.Args[0]
+}
+
+// isGlob reports whether word has pattern characters outside of quotes
+func isGlob(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		if lit, ok := part.(*syntax.Lit); ok && pattern.HasMeta(lit.Value, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandVariables expands the variables and ~ in s, a shell word. Commands
+// aren't run, so a word with a command substitution isn't expanded.
+func expandVariables(runner *interp.Runner, s string) (string, bool) {
+	if !strings.ContainsAny(s, "$~") {
+		return s, false
+	}
+	word := parseWord(s)
+	if word == nil {
+		return s, false
+	}
+	expanded, err := expand.Literal(&expand.Config{Env: newRunnerEnviron(runner)}, word)
+	if err != nil {
+		return s, false
+	}
+	return expanded, expanded != s
+}
+
+// expandedFileCompletions completes file names like getFileCompletions, after
+// expanding the variables in the directory part of prefix. The completions
+// keep the variables as they were typed.
+func expandedFileCompletions(runner *interp.Runner, prefix string, pwd string) []string {
+	slash := strings.LastIndex(prefix, "/")
+	if runner == nil || slash < 0 || !strings.Contains(prefix[:slash], "$") {
+		return getFileCompletions(prefix, pwd)
+	}
+	dir := prefix[:slash+1]
+	expandedDir, ok := expandVariables(runner, dir)
+	if !ok {
+		return getFileCompletions(prefix, pwd)
+	}
+	if !strings.HasSuffix(expandedDir, "/") {
+		expandedDir += "/"
+	}
+
+	completions := getFileCompletions(expandedDir+prefix[slash+1:], pwd)
+	for i, completion := range completions {
+		if rest, ok := strings.CutPrefix(completion, expandedDir); ok {
+			completions[i] = dir + rest
+		}
+	}
+	return completions
+}
+
+// expandGlob returns the files matching word, if it's a glob, reading at most
+// maxDirectories directories. Variables in it are expanded, and ** matches any
+// number of directories.
+func expandGlob(runner *interp.Runner, s string, maxDirectories int) ([]string, bool, error) {
+	if !strings.ContainsAny(s, "*?") && !(strings.Contains(s, "[") && strings.Contains(s, "]")) {
+		return nil, false, nil
+	}
+	word := parseWord(s)
+	if word == nil || !isGlob(word) {
+		return nil, false, nil
+	}
+
+	directories := 0
+	config := &expand.Config{
+		Env:      newRunnerEnviron(runner),
+		GlobStar: true,
+		NullGlob: true,
+		ReadDir2: func(dir string) ([]fs.DirEntry, error) {
+			directories++
+			if directories > maxDirectories {
+				return nil, errGlobTooLarge
+			}
+			return os.ReadDir(dir)
+		},
+	}
+	matches, err := expand.Fields(config, word)
+	if err == nil && directories > maxDirectories {
+		err = errGlobTooLarge
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return matches, true, nil
+}
+
+// getGlobExpansion replaces the glob being completed with the files it matches,
+// like zsh's expand-word. It returns nil if the word isn't a glob or matches
+// nothing.
+func (p *ShellCompletionProvider) getGlobExpansion(line string, pos int) []shellinput.CompletionCandidate {
+	start, _ := p.getCurrentWordBoundary(line, pos)
+	if start < 0 || p.Runner == nil {
+		return nil
+	}
+	matches, ok, err := expandGlob(p.Runner, line[start:pos], globMaxDirectories)
+	if !ok || err != nil || len(matches) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(matches))
+	for i, match := range matches {
+		quoted[i] = quoteFileName(match)
+	}
+	return []shellinput.CompletionCandidate{{
+		Value:       strings.Join(quoted, " "),
+		Description: pluralize(len(matches), "match", "matches"),
+		Kind:        shellinput.CompletionFile,
+	}}
+}
+
+// getGlobPreview describes how many files the glob being typed matches
+func (p *ShellCompletionProvider) getGlobPreview(line string) string {
+	start, _ := p.getCurrentWordBoundary(line, len(line))
+	if start < 0 || p.Runner == nil {
+		return ""
+	}
+	matches, ok, err := expandGlob(p.Runner, line[start:], globPreviewMaxDirectories)
+	switch {
+	case !ok:
+		return ""
+	case err != nil:
+		return "**Glob** - too many files to count"
+	case len(matches) == 0:
+		return "**Glob** - no matches"
+	}
+
+	shown := matches[:min(len(matches), globPreviewMaxMatches)]
+	preview := strings.Join(shown, ", ")
+	if len(matches) > len(shown) {
+		preview += ", …"
+	}
+	return fmt.Sprintf("**Glob** - %s, Tab expands: %s", pluralize(len(matches), "match", "matches"), preview)
+}
+
+// quoteFileName quotes a file name for the command line if it needs it
+func quoteFileName(name string) string {
+	quoted, err := syntax.Quote(name, syntax.LangBash)
+	if err != nil {
+		return name
+	}
+	return quoted
+}
+
+func pluralize(n int, singular string, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
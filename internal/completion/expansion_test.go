@@ -0,0 +1,126 @@
+package completion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newExpansionProvider returns a provider in a directory with a small source
+// tree, with PROJECT set to it
+func newExpansionProvider(t *testing.T) (*ShellCompletionProvider, string) {
+	t.Helper()
+	provider, dir := newSpecProvider(t, nil)
+	for _, file := range []string{"src/app.go", "src/lib/util.go", "src/lib/util_test.go", "src/README.md", "my notes.txt"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), nil, 0644))
+	}
+	require.NoError(t, runScript(context.Background(), provider.Runner, "PROJECT="+quote(dir)))
+	return provider, dir
+}
+
+func TestVariableExpansionInFileCompletion(t *testing.T) {
+	provider, _ := newExpansionProvider(t)
+
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"variable", "ls $PROJECT/sr", []string{"$PROJECT/src/"}},
+		{"braced variable", "ls ${PROJECT}/src/a", []string{"${PROJECT}/src/app.go"}},
+		{"nested directories", "ls $PROJECT/src/lib/", []string{"$PROJECT/src/lib/util.go", "$PROJECT/src/lib/util_test.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, shellinput.CompletionValues(provider.GetCompletions(tt.line, len(tt.line))))
+		})
+	}
+
+	t.Run("spec file arguments", func(t *testing.T) {
+		provider.Specs = NewSpecRegistry("")
+		assert.Equal(t, []string{"$PROJECT/src/"}, shellinput.CompletionValues(provider.GetCompletions("go build -o $PROJECT/sr", 23)))
+	})
+
+	t.Run("commands aren't run", func(t *testing.T) {
+		expanded, ok := expandVariables(provider.Runner, "$(touch x)/")
+		assert.False(t, ok)
+		assert.Equal(t, "$(touch x)/", expanded)
+	})
+}
+
+func TestGlobExpansion(t *testing.T) {
+	provider, dir := newExpansionProvider(t)
+
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"glob", "vim src/*.go", []string{"src/app.go"}},
+		{"globstar", "vim src/**/*.go", []string{"src/app.go src/lib/util.go src/lib/util_test.go"}},
+		{"quoted matches", "cat *.txt", []string{"'my notes.txt'"}},
+		{"variables", "ls $PROJECT/src/*.md", []string{filepath.Join(dir, "src/README.md")}},
+		// Globs that match nothing are completed as file names
+		{"no matches", "ls src/*.rs", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, shellinput.CompletionValues(provider.GetCompletions(tt.line, len(tt.line))))
+		})
+	}
+
+	t.Run("quoted globs aren't expanded", func(t *testing.T) {
+		_, ok, _ := expandGlob(provider.Runner, `"src/*.go"`, globMaxDirectories)
+		assert.False(t, ok)
+		_, ok, _ = expandGlob(provider.Runner, `src/\*.go`, globMaxDirectories)
+		assert.False(t, ok)
+	})
+
+	t.Run("too many directories", func(t *testing.T) {
+		for i := 0; i <= globMaxDirectories; i++ {
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "deep", strconv.Itoa(i)), 0755))
+		}
+		_, ok, err := expandGlob(provider.Runner, "deep/**/*.go", globMaxDirectories)
+		assert.True(t, ok)
+		assert.ErrorIs(t, err, errGlobTooLarge)
+		assert.Equal(t, "**Glob** - too many files to count", provider.GetHelpInfo("ls deep/**/*.go", 15))
+	})
+}
+
+func TestGlobPreview(t *testing.T) {
+	provider, _ := newExpansionProvider(t)
+
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"one match", "vim src/*.go", "**Glob** - 1 match, Tab expands: src/app.go"},
+		{"many matches", "vim src/**/*", "**Glob** - 5 matches, Tab expands: src/README.md, src/app.go, src/lib, …"},
+		{"no matches", "ls *.rs", "**Glob** - no matches"},
+		{"not a glob", "ls src", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, provider.GetHelpInfo(tt.line, len(tt.line)))
+		})
+	}
+
+	t.Run("reads fewer directories than Tab", func(t *testing.T) {
+		provider, dir := newExpansionProvider(t)
+		for i := 0; i <= globPreviewMaxDirectories; i++ {
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "wide", strconv.Itoa(i)), 0755))
+		}
+		assert.Equal(t, "**Glob** - too many files to count", provider.GetHelpInfo("ls wide/**/", 11))
+		completions := shellinput.CompletionValues(provider.GetCompletions("ls wide/**/", 11))
+		require.Len(t, completions, 1)
+		assert.Contains(t, completions[0], "wide/0/")
+	})
+}
@@ -2,7 +2,10 @@ package completion
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 
 	"mvdan.cc/sh/v3/expand"
@@ -10,6 +13,10 @@ import (
 	"mvdan.cc/sh/v3/syntax"
 )
 
+// errRetryCompletion is returned by a completion function that exited with
+// status 124, which tells bash to retry with the spec the function installed
+var errRetryCompletion = errors.New("completion function asked to retry")
+
 // CompletionFunction represents a bash completion function
 type CompletionFunction struct {
 	Name   string
@@ -26,48 +33,120 @@ func NewCompletionFunction(name string, runner *interp.Runner) *CompletionFuncti
 
 // Execute runs the completion function with the given arguments
 func (f *CompletionFunction) Execute(ctx context.Context, args []string) ([]string, error) {
+	line := strings.Join(args, " ")
+	return f.ExecuteLine(ctx, line, len(line))
+}
+
+// ExecuteLine runs the completion function for the word at point in line. Like
+// bash, it sets COMP_LINE, COMP_POINT, COMP_WORDS, COMP_CWORD, COMP_TYPE and
+// COMP_KEY, and calls the function with the command name, the word being
+// completed and the word before it.
+func (f *CompletionFunction) ExecuteLine(ctx context.Context, line string, point int) ([]string, error) {
+	words, cword := splitCompWords(line, point, compWordBreaks(f.Runner))
+	command, cur, prev := compArguments(words, cword, point)
+
+	quotedWords := make([]string, len(words))
+	for i, word := range words {
+		quotedWords[i] = quote(word.text)
+	}
 	script := fmt.Sprintf(`
 		# Set up completion environment
-		COMP_LINE=%q
+		COMP_LINE=%s
 		COMP_POINT=%d
 		COMP_WORDS=(%s)
 		COMP_CWORD=%d
+		COMP_TYPE=9
+		COMP_KEY=9
 
 		# Initialize empty COMPREPLY
 		COMPREPLY=()
 
 		# Call the completion function
-		%s
+		%s %s %s %s
 	`,
-		strings.Join(args, " "),
-		len(strings.Join(args, " ")),
-		strings.Join(args, " "),
-		len(args)-1,
-		f.Name,
+		quote(line),
+		point,
+		strings.Join(quotedWords, " "),
+		cword,
+		f.Name, quote(command), quote(cur), quote(prev),
 	)
 
-	// Parse and execute the script
-	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse completion script: %w", err)
-	}
-
-	if err := f.Runner.Run(ctx, file); err != nil {
+	err := runScript(ctx, f.Runner, script)
+	if status, ok := interp.IsExitStatus(err); ok {
+		// Like bash, the exit status of the function doesn't matter, except
+		// for the one asking to retry
+		err = nil
+		if status == retryCompletionStatus {
+			err = errRetryCompletion
+		}
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to execute completion function: %w", err)
 	}
 
 	// Get COMPREPLY from the runner's variables
 	compreply, ok := f.Runner.Vars["COMPREPLY"]
 	if !ok {
-		return []string{}, nil
+		return []string{}, err
 	}
 
 	if compreply.Kind != expand.Indexed {
-		return []string{}, nil
+		return []string{}, err
 	}
 
 	// Get all elements of the array
 	results := compreply.List
-	return results, nil
+	return results, err
+}
+
+// compArguments returns the arguments bash calls completion functions and
+// commands with: the command name, the word being completed up to point and
+// the word before it
+func compArguments(words []compWord, cword int, point int) (string, string, string) {
+	var command, cur, prev string
+	if len(words) > 0 {
+		command = words[0].text
+	}
+	if cword < len(words) {
+		cur = words[cword].text[:point-words[cword].start]
+	}
+	if cword > 0 {
+		prev = words[cword-1].text
+	}
+	return command, cur, prev
 }
 
+// runCompletionCommand runs the command of complete -C in a subshell, with
+// COMP_LINE and COMP_POINT in its environment, and returns the lines it prints
+func runCompletionCommand(runner *interp.Runner, command string, line commandLine, words []compWord, cword int) ([]string, error) {
+	name, cur, prev := compArguments(words, cword, line.point)
+	script := fmt.Sprintf("COMP_LINE=%s COMP_POINT=%d COMP_TYPE=9 COMP_KEY=9 %s %s %s %s",
+		quote(line.text), line.point, command, quote(name), quote(cur), quote(prev))
+
+	var out strings.Builder
+	subShell := runner.Subshell()
+	interp.StdIO(nil, &out, io.Discard)(subShell)
+	if err := runScript(context.Background(), subShell, script); err != nil {
+		if _, ok := interp.IsExitStatus(err); !ok {
+			return nil, fmt.Errorf("failed to execute completion command: %w", err)
+		}
+	}
+	return strings.FieldsFunc(out.String(), func(r rune) bool { return r == '\n' }), nil
+}
+
+// runScript parses and runs a script in runner
+func runScript(ctx context.Context, runner *interp.Runner, script string) error {
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		return fmt.Errorf("failed to parse completion script: %w", err)
+	}
+	return runner.Run(ctx, file)
+}
+
+// quote quotes s as a single shell word
+func quote(s string) string {
+	quoted, err := syntax.Quote(s, syntax.LangBash)
+	if err != nil {
+		return strconv.Quote(s)
+	}
+	return quoted
+}
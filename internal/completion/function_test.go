@@ -81,4 +81,28 @@ _test_completion() {
 		assert.NoError(t, err)
 		assert.Equal(t, []string{"foo", "bar", "baz"}, results)
 	})
-}
\ No newline at end of file
+}
+func TestCompletionFunctionCompVariables(t *testing.T) {
+	script := `
+_test_completion() {
+    COMPREPLY=("$1|$2|$3" "$COMP_CWORD" "${#COMP_WORDS[@]}" "${COMP_WORDS[COMP_CWORD]}" "$COMP_POINT" "$COMP_LINE")
+}
+`
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	assert.NoError(t, err)
+	runner, err := interp.New()
+	assert.NoError(t, err)
+	assert.NoError(t, runner.Run(context.Background(), file))
+
+	fn := NewCompletionFunction("_test_completion", runner)
+
+	// The words are split at COMP_WORDBREAKS, and the cursor is in the middle
+	results, err := fn.ExecuteLine(context.Background(), "ls --color=al foo", 13)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ls|al|=", "3", "5", "al", "13", "ls --color=al foo"}, results)
+
+	// A cursor between words completes an empty word inserted between them
+	results, err = fn.ExecuteLine(context.Background(), "git  'a b'", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"git||git", "1", "3", "", "4", "git  'a b'"}, results)
+}
@@ -0,0 +1,298 @@
+package completion
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long a generator can take before its values are given up on, so a slow
+// one doesn't hold up the input
+var generatorTimeout = 500 * time.Millisecond
+
+// generator returns the values of an argument, generated from the directory
+// the shell is in, the user's home directory and the system
+type generator func(ctx context.Context, dir string, home string) []Suggestion
+
+// The generators completion specs can name for their arguments
+var generators = map[string]generator{
+	"git-branches": gitRefs("Branch", "refs/heads"),
+	"git-tags":     gitRefs("Tag", "refs/tags"),
+	"git-refs":     gitRefs("Ref", "refs/heads", "refs/remotes", "refs/tags"),
+	"git-remotes":  gitRemotes,
+	"make-targets": makeTargets,
+	"just-targets": justTargets,
+	"npm-scripts":  npmScripts,
+	"ssh-hosts":    sshHosts,
+	"pids":         processIDs,
+	"users":        users,
+	"groups":       groups,
+}
+
+// Directory processes are listed in
+var procDir = "/proc"
+
+// runGenerator runs the named generator in dir, with the home directory home,
+// and returns its values, or nothing if it doesn't finish within generatorTimeout
+func runGenerator(name string, dir string, home string) []Suggestion {
+	generate, ok := generators[name]
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), generatorTimeout)
+	defer cancel()
+
+	results := make(chan []Suggestion, 1)
+	go func() {
+		results <- generate(ctx, dir, home)
+	}()
+	select {
+	case suggestions := <-results:
+		return suggestions
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// commandLines runs a command in dir and returns the lines it prints
+func commandLines(ctx context.Context, dir string, name string, args ...string) []string {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	return strings.FieldsFunc(string(out), func(r rune) bool { return r == '\n' })
+}
+
+// gitRefs returns a generator of the short names of the git refs under the
+// given prefixes, described as description
+func gitRefs(description string, prefixes ...string) generator {
+	return func(ctx context.Context, dir string, home string) []Suggestion {
+		args := append([]string{"for-each-ref", "--format=%(refname:short)"}, prefixes...)
+		var suggestions []Suggestion
+		for _, ref := range commandLines(ctx, dir, "git", args...) {
+			if !strings.HasSuffix(ref, "/HEAD") {
+				suggestions = append(suggestions, Suggestion{Name: ref, Description: description})
+			}
+		}
+		return suggestions
+	}
+}
+
+func gitRemotes(ctx context.Context, dir string, home string) []Suggestion {
+	var suggestions []Suggestion
+	for _, remote := range commandLines(ctx, dir, "git", "remote") {
+		suggestions = append(suggestions, Suggestion{Name: remote, Description: "Remote"})
+	}
+	return suggestions
+}
+
+// A rule of a makefile, with an optional "## description" after it
+var makeRulePattern = regexp.MustCompile(`^([^\s:#=][^:#=]*?)\s*:([^=].*)?$`)
+
+// makeTargets returns the targets of the rules in the makefile of dir, except
+// special targets and pattern rules
+func makeTargets(ctx context.Context, dir string, home string) []Suggestion {
+	var suggestions []Suggestion
+	for _, name := range []string{"GNUmakefile", "makefile", "Makefile"} {
+		lines, err := readLines(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, line := range lines {
+			match := makeRulePattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			description := ""
+			if _, comment, ok := strings.Cut(match[2], "##"); ok {
+				description = strings.TrimSpace(comment)
+			}
+			for _, target := range strings.Fields(match[1]) {
+				if strings.HasPrefix(target, ".") || strings.ContainsAny(target, "%$") || seen[target] {
+					continue
+				}
+				seen[target] = true
+				suggestions = append(suggestions, Suggestion{Name: target, Description: description})
+			}
+		}
+		break
+	}
+	return suggestions
+}
+
+// A recipe of a justfile, and its parameters
+var justRecipePattern = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)\s*([^:=]*):([^=]|$)`)
+
+// justTargets returns the recipes of the justfile of dir, described by the
+// comments above them
+func justTargets(ctx context.Context, dir string, home string) []Suggestion {
+	var suggestions []Suggestion
+	for _, name := range []string{"justfile", "Justfile", ".justfile"} {
+		lines, err := readLines(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		comment := ""
+		for _, line := range lines {
+			if strings.HasPrefix(line, "#") {
+				comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+				continue
+			}
+			if match := justRecipePattern.FindStringSubmatch(line); match != nil && !strings.HasPrefix(match[1], "_") {
+				suggestions = append(suggestions, Suggestion{Name: match[1], Description: comment})
+			}
+			comment = ""
+		}
+		break
+	}
+	return suggestions
+}
+
+// npmScripts returns the scripts of the package.json of dir, described by
+// their commands
+func npmScripts(ctx context.Context, dir string, home string) []Suggestion {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil
+	}
+
+	suggestions := make([]Suggestion, 0, len(manifest.Scripts))
+	for name, command := range manifest.Scripts {
+		suggestions = append(suggestions, Suggestion{Name: name, Description: command})
+	}
+	sort.Slice(suggestions, func(i, j int) bool { return suggestions[i].Name < suggestions[j].Name })
+	return suggestions
+}
+
+// sshHosts returns the hosts of the user's ssh config, and those in their
+// known_hosts that aren't hashed
+func sshHosts(ctx context.Context, dir string, home string) []Suggestion {
+	var suggestions []Suggestion
+	seen := make(map[string]bool)
+	add := func(host string, description string) {
+		if host != "" && !seen[host] && !strings.ContainsAny(host, "*?!") {
+			seen[host] = true
+			suggestions = append(suggestions, Suggestion{Name: host, Description: description})
+		}
+	}
+
+	if home == "" {
+		return nil
+	}
+	// The directory of ssh's per-user configuration and known hosts
+	sshDir := filepath.Join(home, ".ssh")
+
+	if lines, err := readLines(filepath.Join(sshDir, "config")); err == nil {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && strings.EqualFold(fields[0], "Host") {
+				for _, host := range fields[1:] {
+					add(host, "ssh config")
+				}
+			}
+		}
+	}
+
+	if lines, err := readLines(filepath.Join(sshDir, "known_hosts")); err == nil {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "|") || strings.HasPrefix(fields[0], "@") {
+				continue
+			}
+			for _, host := range strings.Split(fields[0], ",") {
+				// Hosts on other ports are written as [host]:port
+				if strings.HasPrefix(host, "[") {
+					host, _, _ = strings.Cut(host[1:], "]")
+				}
+				add(host, "Known host")
+			}
+		}
+	}
+	return suggestions
+}
+
+// processIDs returns the IDs of the running processes, described by their
+// command names
+func processIDs(ctx context.Context, dir string, home string) []Suggestion {
+	var suggestions []Suggestion
+	if entries, err := os.ReadDir(procDir); err == nil {
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err != nil {
+				continue
+			}
+			comm, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "comm"))
+			if err != nil {
+				continue
+			}
+			suggestions = append(suggestions, Suggestion{Name: entry.Name(), Description: strings.TrimSpace(string(comm))})
+		}
+		return suggestions
+	}
+
+	// Systems without /proc
+	for _, line := range commandLines(ctx, dir, "ps", "-A", "-o", "pid=,comm=") {
+		pid, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		suggestions = append(suggestions, Suggestion{Name: pid, Description: filepath.Base(strings.TrimSpace(command))})
+	}
+	return suggestions
+}
+
+// users returns the users in the passwd file, described by their full names
+func users(ctx context.Context, dir string, home string) []Suggestion {
+	lines, err := readLines(passwdFile)
+	if err != nil {
+		return nil
+	}
+	var suggestions []Suggestion
+	for _, line := range lines {
+		fields := strings.Split(line, ":")
+		if len(fields) < 5 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[4], ",")
+		suggestions = append(suggestions, Suggestion{Name: fields[0], Description: name})
+	}
+	return suggestions
+}
+
+func groups(ctx context.Context, dir string, home string) []Suggestion {
+	var suggestions []Suggestion
+	for _, name := range readNames(groupFile, ':', 0) {
+		suggestions = append(suggestions, Suggestion{Name: name, Description: "Group"})
+	}
+	return suggestions
+}
+
+// readLines returns the lines of a file
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,215 @@
+package completion
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileGenerators(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("make targets", func(t *testing.T) {
+		makefile := "" +
+			".PHONY: build test\n" +
+			"VERSION := 1.0\n" +
+			"build: deps ## Build the binary\n" +
+			"\tgo build ./...\n" +
+			"test lint:\n" +
+			"%.o: %.c\n" +
+			"$(OUT): build\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Makefile"), []byte(makefile), 0644))
+
+		assert.Equal(t, []Suggestion{
+			{Name: "build", Description: "Build the binary"},
+			{Name: "test"},
+			{Name: "lint"},
+		}, runGenerator("make-targets", dir, ""))
+	})
+
+	t.Run("just recipes", func(t *testing.T) {
+		justfile := "" +
+			"set shell := [\"bash\", \"-c\"]\n" +
+			"# Run the tests\n" +
+			"test *args:\n" +
+			"    go test {{args}}\n" +
+			"\n" +
+			"@fmt:\n" +
+			"_helper:\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "justfile"), []byte(justfile), 0644))
+
+		assert.Equal(t, []Suggestion{
+			{Name: "test", Description: "Run the tests"},
+			{Name: "fmt"},
+		}, runGenerator("just-targets", dir, ""))
+	})
+
+	t.Run("npm scripts", func(t *testing.T) {
+		manifest := `{"name": "app", "scripts": {"test": "jest", "build": "tsc -p ."}}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(manifest), 0644))
+
+		assert.Equal(t, []Suggestion{
+			{Name: "build", Description: "tsc -p ."},
+			{Name: "test", Description: "jest"},
+		}, runGenerator("npm-scripts", dir, ""))
+	})
+
+	t.Run("no files", func(t *testing.T) {
+		empty := t.TempDir()
+		assert.Empty(t, runGenerator("make-targets", empty, ""))
+		assert.Empty(t, runGenerator("just-targets", empty, ""))
+		assert.Empty(t, runGenerator("npm-scripts", empty, ""))
+		assert.Empty(t, runGenerator("no-such-generator", empty, ""))
+	})
+}
+
+func TestSystemGenerators(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("ssh hosts", func(t *testing.T) {
+		sshDir := filepath.Join(dir, ".ssh")
+		require.NoError(t, os.Mkdir(sshDir, 0755))
+		config := "Host web db\n  HostName 10.0.0.1\nhost *.internal\n"
+		knownHosts := "" +
+			"github.com,140.82.121.3 ssh-ed25519 AAAA\n" +
+			"[git.example.com]:2222 ssh-rsa AAAA\n" +
+			"|1|hashed= ssh-rsa AAAA\n" +
+			"web ssh-rsa AAAA\n"
+		require.NoError(t, os.WriteFile(filepath.Join(sshDir, "config"), []byte(config), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(knownHosts), 0644))
+
+		assert.Equal(t, []Suggestion{
+			{Name: "web", Description: "ssh config"},
+			{Name: "db", Description: "ssh config"},
+			{Name: "github.com", Description: "Known host"},
+			{Name: "140.82.121.3", Description: "Known host"},
+			{Name: "git.example.com", Description: "Known host"},
+		}, runGenerator("ssh-hosts", t.TempDir(), dir))
+	})
+
+	t.Run("pids", func(t *testing.T) {
+		defer func(old string) { procDir = old }(procDir)
+		procDir = dir
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "42"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "42", "comm"), []byte("vim\n"), 0644))
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "self"), 0755))
+
+		assert.Equal(t, []Suggestion{{Name: "42", Description: "vim"}}, runGenerator("pids", dir, ""))
+	})
+
+	t.Run("users and groups", func(t *testing.T) {
+		defer func(passwd string, group string) { passwdFile, groupFile = passwd, group }(passwdFile, groupFile)
+		passwdFile = filepath.Join(dir, "passwd")
+		groupFile = filepath.Join(dir, "group")
+		require.NoError(t, os.WriteFile(passwdFile, []byte("root:x:0:0:root:/root:/bin/bash\nalice:x:1000:1000:Alice Smith,,,:/home/alice:/bin/zsh\n"), 0644))
+		require.NoError(t, os.WriteFile(groupFile, []byte("wheel:x:10:alice\n"), 0644))
+
+		assert.Equal(t, []Suggestion{
+			{Name: "root", Description: "root"},
+			{Name: "alice", Description: "Alice Smith"},
+		}, runGenerator("users", dir, ""))
+		assert.Equal(t, []Suggestion{{Name: "wheel", Description: "Group"}}, runGenerator("groups", dir, ""))
+	})
+}
+
+func TestGitGenerators(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	git("branch", "feature")
+	git("tag", "v1.0")
+	git("remote", "add", "origin", "https://example.com/repo.git")
+
+	assert.Equal(t, []Suggestion{{Name: "feature", Description: "Branch"}, {Name: "main", Description: "Branch"}}, runGenerator("git-branches", dir, ""))
+	assert.Equal(t, []Suggestion{{Name: "v1.0", Description: "Tag"}}, runGenerator("git-tags", dir, ""))
+	assert.Equal(t, []Suggestion{{Name: "origin", Description: "Remote"}}, runGenerator("git-remotes", dir, ""))
+	assert.Len(t, runGenerator("git-refs", dir, ""), 3)
+
+	// Outside a repository there's nothing to complete
+	assert.Empty(t, runGenerator("git-branches", t.TempDir(), ""))
+}
+
+func TestGeneratorTimeout(t *testing.T) {
+	defer func(old time.Duration) { generatorTimeout = old }(generatorTimeout)
+	generatorTimeout = 10 * time.Millisecond
+
+	generators["slow"] = func(ctx context.Context, dir string, home string) []Suggestion {
+		time.Sleep(time.Second)
+		return []Suggestion{{Name: "late"}}
+	}
+	defer delete(generators, "slow")
+
+	started := time.Now()
+	assert.Empty(t, runGenerator("slow", t.TempDir(), ""))
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+}
+
+func TestGeneratorCompletions(t *testing.T) {
+	provider, dir := newSpecProvider(t, nil)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Makefile"), []byte("build: ## Build it\ntest:\n"), 0644))
+
+	completions := provider.GetCompletions("make b", 6)
+	assert.Equal(t, []shellinput.CompletionCandidate{{Value: "build", Description: "Build it", Kind: shellinput.CompletionOther, Score: prefixMatchScore}}, completions)
+
+	// Values without a description of their own are described by their argument
+	completions = provider.GetCompletions("make t", 6)
+	require.Len(t, completions, 1)
+	assert.Equal(t, "Target", completions[0].Description)
+
+	defer func(old string) { procDir = old }(procDir)
+	procDir = dir
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "1234"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1234", "comm"), []byte("sleep\n"), 0644))
+	completions = provider.GetCompletions("kill -9 12", 10)
+	require.Len(t, completions, 1)
+	assert.Equal(t, "1234", completions[0].Value)
+	assert.Equal(t, "sleep", completions[0].Description)
+}
+
+func TestVariableCompletions(t *testing.T) {
+	provider, _ := newSpecProvider(t, nil)
+	require.NoError(t, runScript(context.Background(), provider.Runner, "GSH_TEST_LOCAL=1; export GSH_TEST_EXPORTED=2"))
+
+	completions := provider.GetCompletions("echo $GSH_TEST_", 15)
+	assert.Equal(t, []string{"$GSH_TEST_EXPORTED", "$GSH_TEST_LOCAL"}, shellinput.CompletionValues(completions))
+	assert.Equal(t, "Environment variable", completions[0].Description)
+	assert.Equal(t, "Shell variable", completions[1].Description)
+	assert.Equal(t, shellinput.CompletionVariable, completions[0].Kind)
+
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"braced", "echo ${GSH_TEST_L", []string{"${GSH_TEST_LOCAL}"}},
+		{"inside a word", "cd src/$GSH_TEST_L", []string{"src/$GSH_TEST_LOCAL"}},
+		{"fuzzy", "echo $GSHTSTLCL", []string{"$GSH_TEST_LOCAL"}},
+		{"no matches", "echo $GSH_TEST_NONE", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, shellinput.CompletionValues(provider.GetCompletions(tt.line, len(tt.line))))
+		})
+	}
+
+	// A $ that isn't followed by a name doesn't complete variables
+	assert.Nil(t, provider.getVariableCompletions("echo $(ls", 9))
+}
@@ -3,8 +3,12 @@ package completion
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/atinylittleshell/gsh/internal/environment"
 	"mvdan.cc/sh/v3/interp"
 )
 
@@ -16,19 +20,70 @@ const (
 	WordListCompletion CompletionType = "W"
 	// FunctionCompletion represents function based completion (-F option)
 	FunctionCompletion CompletionType = "F"
+	// CommandCompletion represents completion by the output of a command (-C option)
+	CommandCompletion CompletionType = "C"
+	// ActionCompletion represents completion by actions, such as -A file, and
+	// glob patterns (-G option) only
+	ActionCompletion CompletionType = "A"
 )
 
+const (
+	// DefaultCompletionCommand is the name the spec of complete -D is stored
+	// under, used for commands without a spec of their own
+	DefaultCompletionCommand = "-D"
+	// EmptyCompletionCommand is the name the spec of complete -E is stored
+	// under, used on an empty line
+	EmptyCompletionCommand = "-E"
+
+	// completionLoader is the function bash-completion defines to load the
+	// spec of a command the first time it's completed
+	completionLoader = "_completion_loader"
+	// retryCompletionStatus is the exit status of a default completion that
+	// installed a new spec for the command
+	retryCompletionStatus = 124
+)
+
+// CompletionOptions are the options complete, compgen and compopt take with -o
+var CompletionOptions = []string{"bashdefault", "default", "dirnames", "filenames", "noquote", "nosort", "nospace", "plusdirs"}
+
 // CompletionSpec represents a completion specification for a command
 type CompletionSpec struct {
 	Command string
 	Type    CompletionType
-	Value   string   // function name or wordlist
+	Value   string   // function name, command or wordlist
 	Options []string // additional options like -o dirname
+
+	Actions     []string // actions like file and directory, given with -A or their shorthand
+	WordList    string   // word list given with -W when Type isn't WordListCompletion
+	GlobPattern string   // -G pattern of file names
+	Filter      string   // -X pattern of the completions to remove
+	Prefix      string   // -P prefix of every completion
+	Suffix      string   // -S suffix of every completion
+}
+
+// HasOption reports whether the spec has the given -o option
+func (s CompletionSpec) HasOption(option string) bool {
+	return slices.Contains(s.Options, option)
+}
+
+// wordList returns the -W word list of the spec
+func (s CompletionSpec) wordList() string {
+	if s.Type == WordListCompletion {
+		return s.Value
+	}
+	return s.WordList
 }
 
 // CompletionManager manages command completion specifications
 type CompletionManager struct {
 	specs map[string]CompletionSpec
+
+	// runner runs the completion functions of compgen, and defines the
+	// completion loader
+	runner *interp.Runner
+	// current is the spec of the completion being executed, which compopt
+	// changes when it's given no command names
+	current *CompletionSpec
 }
 
 // NewCompletionManager creates a new CompletionManager
@@ -38,6 +93,13 @@ func NewCompletionManager() *CompletionManager {
 	}
 }
 
+// SetRunner sets the shell that compgen runs completion functions in. It's set
+// after the runner is created, as the runner is created with the handlers
+// of the completion builtins.
+func (m *CompletionManager) SetRunner(runner *interp.Runner) {
+	m.runner = runner
+}
+
 // AddSpec adds or updates a completion specification
 func (m *CompletionManager) AddSpec(spec CompletionSpec) {
 	m.specs[spec.Command] = spec
@@ -48,44 +110,187 @@ func (m *CompletionManager) RemoveSpec(command string) {
 	delete(m.specs, command)
 }
 
-// GetSpec retrieves a completion specification
+// GetSpec retrieves the completion specification that applies to a command.
+// Like bash, a command without a spec of its own falls back to the spec of its
+// base name, then to the default spec set with complete -D, then to the
+// _completion_loader function when the shell defines one.
 func (m *CompletionManager) GetSpec(command string) (CompletionSpec, bool) {
-	spec, ok := m.specs[command]
-	return spec, ok
+	if spec, ok := m.specs[command]; ok {
+		return spec, true
+	}
+	if strings.Contains(command, "/") {
+		if spec, ok := m.specs[filepath.Base(command)]; ok {
+			return spec, true
+		}
+	}
+	if command == EmptyCompletionCommand {
+		return CompletionSpec{}, false
+	}
+	if spec, ok := m.specs[DefaultCompletionCommand]; ok {
+		return spec, true
+	}
+	if m.runner != nil && m.runner.Funcs[completionLoader] != nil {
+		return CompletionSpec{
+			Command: DefaultCompletionCommand,
+			Type:    FunctionCompletion,
+			Value:   completionLoader,
+		}, true
+	}
+	return CompletionSpec{}, false
 }
 
-// ListSpecs returns all completion specifications
+// ListSpecs returns all completion specifications, sorted by command
 func (m *CompletionManager) ListSpecs() []CompletionSpec {
 	specs := make([]CompletionSpec, 0, len(m.specs))
 	for _, spec := range m.specs {
 		specs = append(specs, spec)
 	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Command < specs[j].Command
+	})
 	return specs
 }
 
 // ExecuteCompletion executes a completion specification for a given command line
-// and returns the list of possible completions
+// and returns the list of possible completions. The completions replace the
+// whitespace separated word at the cursor.
 func (m *CompletionManager) ExecuteCompletion(ctx context.Context, runner *interp.Runner, spec CompletionSpec, args []string) ([]string, error) {
+	line, ok := lineFromContext(ctx)
+	if !ok {
+		text := strings.Join(args, " ")
+		line = commandLine{text: text, point: len(text)}
+	}
+
+	completions, err := m.generate(ctx, runner, spec, line)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like readline, completions replace the text after the last word break
+	// character, so the rest of the word is kept in front of them
+	if prefix := wordBreakPrefix(line.text[:line.point], compWordBreaks(runner)); prefix != "" {
+		for i, completion := range completions {
+			completions[i] = prefix + completion
+		}
+	}
+	return completions, nil
+}
+
+// generate returns the completions of spec for the word at the point of line
+func (m *CompletionManager) generate(ctx context.Context, runner *interp.Runner, spec CompletionSpec, line commandLine) ([]string, error) {
 	switch spec.Type {
-	case WordListCompletion:
-		words := strings.Fields(spec.Value)
-		completions := make([]string, 0)
-		word := ""
-		if len(args) > 0 {
-			word = args[len(args)-1]
+	case WordListCompletion, FunctionCompletion, CommandCompletion, ActionCompletion, "":
+	default:
+		return nil, fmt.Errorf("unsupported completion type: %s", spec.Type)
+	}
+
+	words, cword := splitCompWords(line.text, line.point, compWordBreaks(runner))
+	if line.single {
+		words, cword = []compWord{{text: line.text}}, 0
+	}
+	_, cur, _ := compArguments(words, cword, line.point)
+	pwd := ""
+	if runner != nil {
+		pwd = environment.GetPwd(runner)
+	}
+
+	var completions []string
+	for _, action := range spec.Actions {
+		generated, err := generateAction(runner, action, cur)
+		if err != nil {
+			return nil, err
 		}
-		for _, w := range words {
-			if word == "" || strings.HasPrefix(w, word) {
+		completions = append(completions, generated...)
+	}
+	if spec.GlobPattern != "" {
+		completions = append(completions, globFiles(spec.GlobPattern, pwd)...)
+	}
+	if wordList := spec.wordList(); wordList != "" {
+		for _, w := range splitWordList(runner, wordList) {
+			if strings.HasPrefix(w, cur) {
 				completions = append(completions, w)
 			}
 		}
-		return completions, nil
+	}
 
+	switch spec.Type {
 	case FunctionCompletion:
+		previous := m.current
+		m.current = &spec
 		fn := NewCompletionFunction(spec.Value, runner)
-		return fn.Execute(ctx, args)
+		results, err := fn.ExecuteLine(ctx, line.text, line.point)
+		m.current = previous
+		if err == errRetryCompletion && spec.Command == DefaultCompletionCommand {
+			// The default completion loaded a spec for the command, which is
+			// tried once in its place
+			if len(words) > 0 {
+				if loaded, ok := m.GetSpec(words[0].text); ok && loaded.Command != DefaultCompletionCommand {
+					return m.generate(ctx, runner, loaded, line)
+				}
+			}
+			err = nil
+		}
+		if err != nil && err != errRetryCompletion {
+			return nil, err
+		}
+		completions = append(completions, results...)
+	case CommandCompletion:
+		results, err := runCompletionCommand(runner, spec.Value, line, words, cword)
+		if err != nil {
+			return nil, err
+		}
+		completions = append(completions, results...)
+	}
 
-	default:
-		return nil, fmt.Errorf("unsupported completion type: %s", spec.Type)
+	if spec.Filter != "" {
+		completions = filterCompletions(completions, spec.Filter, cur)
+	}
+	if spec.Prefix != "" || spec.Suffix != "" {
+		for i, completion := range completions {
+			completions[i] = spec.Prefix + completion + spec.Suffix
+		}
 	}
+
+	// Fallbacks when nothing matched, and the directories plusdirs adds
+	filenames := spec.HasOption("filenames")
+	if len(completions) == 0 && spec.HasOption("dirnames") {
+		completions, filenames = actionFiles(cur, pwd, true), true
+	}
+	if len(completions) == 0 && (spec.HasOption("default") || spec.HasOption("bashdefault")) {
+		completions, filenames = actionFiles(cur, pwd, false), true
+	}
+	if spec.HasOption("plusdirs") {
+		completions, filenames = append(completions, actionFiles(cur, pwd, true)...), true
+	}
+
+	if filenames {
+		completions = markFilenames(completions, pwd, !spec.HasOption("noquote"))
+	}
+	if completions == nil {
+		completions = []string{}
+	}
+	return completions, nil
+}
+
+// commandLine is the line being completed and the position of the cursor in it
+type commandLine struct {
+	text  string
+	point int
+
+	// single is set for the word given to compgen, which isn't split at word
+	// break characters
+	single bool
+}
+
+type commandLineKey struct{}
+
+// withCommandLine returns a context that passes the whole line being completed
+// to ExecuteCompletion, which otherwise only gets its words
+func withCommandLine(ctx context.Context, text string, point int) context.Context {
+	return context.WithValue(ctx, commandLineKey{}, commandLine{text: text, point: point})
+}
+
+func lineFromContext(ctx context.Context) (commandLine, bool) {
+	line, ok := ctx.Value(commandLineKey{}).(commandLine)
+	return line, ok
 }
@@ -9,9 +9,11 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"mvdan.cc/sh/v3/interp"
 )
 
@@ -39,6 +41,11 @@ type ShellCompletionProvider struct {
 	CompletionManager CompletionManagerInterface
 	Runner            *interp.Runner
 	SubagentProvider  SubagentProvider // Optional, for @ completions
+	Specs             *SpecRegistry    // Declarative specs of common commands
+	AI                *AICompleter     // Optional, for suggestions of the fast model
+
+	historyMu          sync.RWMutex
+	historyFrequencies map[string]int // how often words were used in recent commands
 }
 
 // NewShellCompletionProvider creates a new ShellCompletionProvider
@@ -47,6 +54,16 @@ func NewShellCompletionProvider(manager CompletionManagerInterface, runner *inte
 		CompletionManager: manager,
 		Runner:            runner,
 		SubagentProvider:  nil, // Set later via SetSubagentProvider if needed
+		Specs:             NewSpecRegistry(userSpecsDir(runner)),
+	}
+}
+
+// UpdateSpecsDir looks up the directory of the user's completion specs again,
+// in case HOME changed. The runner's variables are read, so it must be called
+// while the runner isn't running, like before showing the prompt.
+func (p *ShellCompletionProvider) UpdateSpecsDir() {
+	if p.Specs != nil {
+		p.Specs.SetUserDir(userSpecsDir(p.Runner))
 	}
 }
 
@@ -55,18 +72,37 @@ func (p *ShellCompletionProvider) SetSubagentProvider(provider SubagentProvider)
 	p.SubagentProvider = provider
 }
 
-// GetCompletions returns completion suggestions for the current input line
-func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []string {
+// GetCompletions returns completion candidates for the current input line
+func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []shellinput.CompletionCandidate {
 	// First check for special prefixes (#/ and #!)
 	if completion := p.checkSpecialPrefixes(line, pos); completion != nil {
 		return completion
 	}
 
+	// Like readline, a word with a $ in it completes variable names
+	if completion := p.getVariableCompletions(line, pos); completion != nil {
+		return completion
+	}
+
+	// Like zsh, a glob is replaced with the files it matches
+	if completion := p.getGlobExpansion(line, pos); completion != nil {
+		return completion
+	}
+
+	// Completion functions see the whole line and where the cursor is in it
+	ctx := withCommandLine(context.Background(), line, pos)
+
 	// Split the line into words, preserving quotes
 	line = line[:pos]
 	words := splitPreservingQuotes(line)
 	if len(words) == 0 {
-		return make([]string, 0)
+		// An empty line is completed by the spec of complete -E, if any
+		if spec, ok := p.CompletionManager.GetSpec(EmptyCompletionCommand); ok {
+			if suggestions, err := p.CompletionManager.ExecuteCompletion(ctx, p.Runner, spec, words); err == nil && suggestions != nil {
+				return valueCandidates(suggestions)
+			}
+		}
+		return make([]shellinput.CompletionCandidate, 0)
 	}
 
 	// Get the command (first word)
@@ -74,6 +110,18 @@ func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []string
 
 	// Look up completion spec for this command
 	spec, ok := p.CompletionManager.GetSpec(command)
+	if ok && spec.Command == DefaultCompletionCommand && len(words) == 1 && !strings.HasSuffix(line, " ") {
+		// Like bash, the default completion is only for arguments, not the
+		// command name being typed
+		ok = false
+	}
+	if (!ok || spec.Command == DefaultCompletionCommand) && (len(words) > 1 || strings.HasSuffix(line, " ")) {
+		// Commands without a completion function of their own are completed
+		// by their declarative spec, if they have one
+		if completions := p.getSpecCompletions(line); len(completions) > 0 {
+			return completions
+		}
+	}
 	if !ok {
 		// No specific completion spec, check if we should complete command names
 		if len(words) == 1 && !strings.HasSuffix(line, " ") {
@@ -81,15 +129,19 @@ func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []string
 			// Check if this looks like a path-based command
 			if p.isPathBasedCommand(command) {
 				// For path-based commands, complete with executable files in that path
-				executableCompletions := p.getExecutableCompletions(command)
+				executableCompletions := p.completeFuzzily(command, func(prefix string) []shellinput.CompletionCandidate {
+					return commandCandidates(p.getExecutableCompletions(prefix))
+				})
 				if len(executableCompletions) > 0 {
 					return executableCompletions
 				}
 			} else {
 				// Regular command name completion
-				commandCompletions := p.getAvailableCommands(command)
+				commandCompletions := p.completeFuzzily(command, func(prefix string) []shellinput.CompletionCandidate {
+					return commandCandidates(p.getAvailableCommands(prefix))
+				})
 				if len(commandCompletions) > 0 {
-					return commandCompletions
+					return p.describeCommands(commandCompletions)
 				}
 			}
 		}
@@ -103,36 +155,38 @@ func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []string
 			// If line ends with space, use empty prefix to list all files
 			prefix = ""
 		} else {
-			return make([]string, 0)
+			return make([]shellinput.CompletionCandidate, 0)
 		}
 
-		completions := getFileCompletions(prefix, environment.GetPwd(p.Runner))
+		return p.completeFuzzily(prefix, func(prefix string) []shellinput.CompletionCandidate {
+			completions := expandedFileCompletions(p.Runner, prefix, environment.GetPwd(p.Runner))
 
-		// Quote completions that contain spaces, but don't add command prefix
-		// The completion handler will replace only the current word (file path)
-		for i, completion := range completions {
-			if strings.Contains(completion, " ") {
-				// Quote completions that contain spaces
-				completions[i] = "\"" + completion + "\""
+			// Quote completions that contain spaces, but don't add command prefix
+			// The completion handler will replace only the current word (file path)
+			for i, completion := range completions {
+				if strings.Contains(completion, " ") {
+					// Quote completions that contain spaces
+					completions[i] = "\"" + completion + "\""
+				}
 			}
-		}
-		return completions
+			return fileCandidates(completions, "", "")
+		})
 	}
 
 	// Execute the completion
-	suggestions, err := p.CompletionManager.ExecuteCompletion(context.Background(), p.Runner, spec, words)
+	suggestions, err := p.CompletionManager.ExecuteCompletion(ctx, p.Runner, spec, words)
 	if err != nil {
-		return make([]string, 0)
+		return make([]shellinput.CompletionCandidate, 0)
 	}
 
 	if suggestions == nil {
-		return make([]string, 0)
+		return make([]shellinput.CompletionCandidate, 0)
 	}
-	return suggestions
+	return valueCandidates(suggestions)
 }
 
 // checkSpecialPrefixes checks for #/, #!, and #@ prefixes and returns appropriate completions
-func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []string {
+func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []shellinput.CompletionCandidate {
 	// Get the current word being completed
 	start, end := p.getCurrentWordBoundary(line, pos)
 	if start < 0 || end < 0 {
@@ -156,12 +210,9 @@ func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []s
 			}
 
 			// Add completions with proper prefix
-			for i, completion := range completions {
-				completions[i] = linePrefix + completion
-			}
-			return completions
+			return fileCandidates(completions, linePrefix, "")
 		}
-		return completions
+		return p.macroCandidates(completions)
 	} else if strings.HasPrefix(currentWord, "@!") {
 		completions := p.getBuiltinCommandCompletions(currentWord)
 		if len(completions) == 0 {
@@ -176,12 +227,9 @@ func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []s
 			}
 
 			// Add completions with proper prefix
-			for i, completion := range completions {
-				completions[i] = linePrefix + completion
-			}
-			return completions
+			return fileCandidates(completions, linePrefix, "")
 		}
-		return completions
+		return builtinCommandCandidates(completions)
 	} else if strings.HasPrefix(currentWord, "@") && !strings.HasPrefix(currentWord, "@/") && !strings.HasPrefix(currentWord, "@!") {
 		// Subagent completions - allow anywhere in the line, not just at the start
 		completions := p.getSubagentCompletions(currentWord)
@@ -202,17 +250,11 @@ func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []s
 			completions := getFileCompletions(pathPrefix, environment.GetPwd(p.Runner))
 
 			// Add completions with proper prefix and suffix
-			for i, completion := range completions {
-				completions[i] = linePrefix + completion + lineSuffix
-			}
-			return completions
+			return fileCandidates(completions, linePrefix, lineSuffix)
 		}
 
 		// Add completions with proper prefix and suffix
-		for i, completion := range completions {
-			completions[i] = linePrefix + completion + lineSuffix
-		}
-		return completions
+		return p.subagentCandidates(completions, linePrefix, lineSuffix)
 	}
 
 	// Also check if we're at the beginning of a potential prefix
@@ -239,12 +281,9 @@ func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []s
 				}
 
 				// Add completions with proper prefix
-				for i, completion := range completions {
-					completions[i] = linePrefix + completion
-				}
-				return completions
+				return fileCandidates(completions, linePrefix, "")
 			}
-			return completions
+			return p.macroCandidates(completions)
 		} else if strings.HasPrefix(potentialWord, "@!") {
 			completions := p.getBuiltinCommandCompletions(potentialWord)
 			if len(completions) == 0 {
@@ -259,12 +298,9 @@ func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []s
 				}
 
 				// Add completions with proper prefix
-				for i, completion := range completions {
-					completions[i] = linePrefix + completion
-				}
-				return completions
+				return fileCandidates(completions, linePrefix, "")
 			}
-			return completions
+			return builtinCommandCandidates(completions)
 		} else if strings.HasPrefix(potentialWord, "@") && !strings.HasPrefix(potentialWord, "@/") && !strings.HasPrefix(potentialWord, "@!") {
 			// Subagent completions - only if this is the first non-whitespace on the line
 			if !p.isAtLineStart(line, wordStart) {
@@ -288,17 +324,11 @@ func (p *ShellCompletionProvider) checkSpecialPrefixes(line string, pos int) []s
 				completions := getFileCompletions(pathPrefix, environment.GetPwd(p.Runner))
 
 				// Add completions with proper prefix and suffix
-				for i, completion := range completions {
-					completions[i] = linePrefix + completion + lineSuffix
-				}
-				return completions
+				return fileCandidates(completions, linePrefix, lineSuffix)
 			}
 
 			// Add completions with proper prefix and suffix
-			for i, completion := range completions {
-				completions[i] = linePrefix + completion + lineSuffix
-			}
-			return completions
+			return p.subagentCandidates(completions, linePrefix, lineSuffix)
 		}
 	}
 
@@ -530,11 +560,70 @@ func (p *ShellCompletionProvider) getAliasCompletions(prefix string) []string {
 	return completions
 }
 
+// getVariableCompletions completes the name of the variable being expanded at
+// the end of the current word, as $NAME or ${NAME}. It returns nil if the
+// word doesn't end with a variable name.
+func (p *ShellCompletionProvider) getVariableCompletions(line string, pos int) []shellinput.CompletionCandidate {
+	start, _ := p.getCurrentWordBoundary(line, pos)
+	if start < 0 {
+		return nil
+	}
+	word := line[start:pos]
+	dollar := strings.LastIndex(word, "$")
+	if dollar < 0 {
+		return nil
+	}
+	name, braced := strings.CutPrefix(word[dollar+1:], "{")
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return nil
+		}
+	}
+
+	variables := runnerVariables(p.Runner)
+	names := make([]string, 0, len(variables))
+	for name, variable := range variables {
+		if variable.IsSet() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	candidates := p.completeFuzzily(word, func(prefix string) []shellinput.CompletionCandidate {
+		var candidates []shellinput.CompletionCandidate
+		for _, name := range names {
+			expansion := "$" + name
+			if braced {
+				expansion = "${" + name + "}"
+			}
+			if !strings.HasPrefix(word[:dollar]+expansion, prefix) {
+				continue
+			}
+			description := "Shell variable"
+			if variables[name].Exported {
+				description = "Environment variable"
+			}
+			candidates = append(candidates, shellinput.CompletionCandidate{
+				Value:       word[:dollar] + expansion,
+				Display:     expansion,
+				Description: description,
+				Kind:        shellinput.CompletionVariable,
+			})
+		}
+		return candidates
+	})
+	if candidates == nil {
+		return make([]shellinput.CompletionCandidate, 0)
+	}
+	return candidates
+}
+
 // getBuiltinCommandCompletions returns completions for built-in commands starting with @!
 func (p *ShellCompletionProvider) getBuiltinCommandCompletions(prefix string) []string {
 	builtinCommands := []string{
 		"new",
 		"tokens",
+		"copy",
 		"subagents",
 		"reload-subagents",
 		"subagent-info",
@@ -582,7 +671,8 @@ func (p *ShellCompletionProvider) getSubagentCompletions(prefix string) []string
 	return completions
 }
 
-// GetHelpInfo returns help information for special commands like @!, @/, and @
+// GetHelpInfo returns help information for special commands like @!, @/, and @,
+// and for the subcommands and options of commands with a completion spec
 func (p *ShellCompletionProvider) GetHelpInfo(line string, pos int) string {
 	// Get the current word being completed
 	start, end := p.getCurrentWordBoundary(line, pos)
@@ -631,7 +721,12 @@ func (p *ShellCompletionProvider) GetHelpInfo(line string, pos int) string {
 		}
 	}
 
-	return ""
+	// A glob shows the files it matches as it's typed
+	if preview := p.getGlobPreview(line[:pos]); preview != "" {
+		return preview
+	}
+
+	return p.getSpecHelp(line[:pos])
 }
 
 // getBuiltinCommandHelp returns help information for built-in commands
@@ -641,6 +736,8 @@ func (p *ShellCompletionProvider) getBuiltinCommandHelp(command string) string {
 		return "**@!new** - Start a new chat session with the agent\n\nThis command resets the conversation history and starts fresh."
 	case "tokens":
 		return "**@!tokens** - Display token usage statistics\n\nShows information about token consumption for the current chat session."
+	case "copy":
+		return "**@!copy [n]** - Copy a code block from the last response\n\nCopies code block n, as numbered above each code block, or the last one to the clipboard."
 	case "subagents":
 		return "**@!subagents** - List all available subagents and modes\n\nDisplays all configured Claude-style subagents and Roo Code-style modes with their descriptions and capabilities."
 	case "reload-subagents":
@@ -648,14 +745,14 @@ func (p *ShellCompletionProvider) getBuiltinCommandHelp(command string) string {
 	case "subagent-info":
 		return "**@!subagent-info <name>** - Show detailed information about a subagent\n\nDisplays comprehensive information about a specific subagent including tools, file restrictions, and configuration."
 	case "":
-		return "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details"
+		return "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!copy [n]** - Copy a code block from the last response\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details"
 	default:
 		// Check for partial matches
-		builtinCommands := []string{"new", "tokens", "subagents", "reload-subagents", "subagent-info"}
+		builtinCommands := []string{"new", "tokens", "copy", "subagents", "reload-subagents", "subagent-info"}
 		for _, cmd := range builtinCommands {
 			if strings.HasPrefix(cmd, command) {
 				// Partial match, show general help
-				return "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details"
+				return "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!copy [n]** - Copy a code block from the last response\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details"
 			}
 		}
 		return ""
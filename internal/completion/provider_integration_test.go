@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"mvdan.cc/sh/v3/expand"
@@ -125,7 +126,7 @@ func TestShellCompletionProvider_FileCompletion_Integration(t *testing.T) {
 			tt.setup()
 
 			// Get completions
-			completions := provider.GetCompletions(tt.line, tt.pos)
+			completions := shellinput.CompletionValues(provider.GetCompletions(tt.line, tt.pos))
 
 			// Verify we have at least the minimum expected completions
 			assert.GreaterOrEqual(t, len(completions), tt.expectedMin,
@@ -203,7 +204,7 @@ func TestShellCompletionProvider_MacroCompletion_Integration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			completions := provider.GetCompletions(tt.line, tt.pos)
+			completions := shellinput.CompletionValues(provider.GetCompletions(tt.line, tt.pos))
 
 			assert.Equal(t, tt.expectedCount, len(completions),
 				"Expected %d completions, got %d: %v",
@@ -241,8 +242,8 @@ func TestShellCompletionProvider_BuiltinCompletion_Integration(t *testing.T) {
 			name:          "builtin completion with @! prefix",
 			line:          "@!",
 			pos:           2,
-			expectedCount: 5,
-			shouldContain: []string{"@!new", "@!tokens", "@!subagents", "@!reload-subagents", "@!subagent-info"},
+			expectedCount: 6,
+			shouldContain: []string{"@!new", "@!tokens", "@!copy", "@!subagents", "@!reload-subagents", "@!subagent-info"},
 		},
 		{
 			name:             "builtin completion with 'n' prefix",
@@ -270,7 +271,7 @@ func TestShellCompletionProvider_BuiltinCompletion_Integration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			completions := provider.GetCompletions(tt.line, tt.pos)
+			completions := shellinput.CompletionValues(provider.GetCompletions(tt.line, tt.pos))
 
 			assert.Equal(t, tt.expectedCount, len(completions),
 				"Expected %d completions, got %d: %v",
@@ -363,7 +364,7 @@ func TestShellCompletionProvider_ExecutableCompletion_Integration(t *testing.T)
 			manager.Calls = nil
 			tt.setup()
 
-			completions := provider.GetCompletions(tt.line, tt.pos)
+			completions := shellinput.CompletionValues(provider.GetCompletions(tt.line, tt.pos))
 
 			assert.GreaterOrEqual(t, len(completions), tt.expectedMin,
 				"Should have at least %d completions, got %d: %v",
@@ -411,7 +412,7 @@ func TestShellCompletionProvider_HelpInfo_Integration(t *testing.T) {
 			name:     "help for @! prefix",
 			line:     "@!",
 			pos:      2,
-			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
+			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!copy [n]** - Copy a code block from the last response\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
 		},
 		{
 			name:     "help for @!new command",
@@ -496,7 +497,7 @@ func TestShellCompletionProvider_CompletionSpec_Integration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			completions := provider.GetCompletions(tt.line, tt.pos)
+			completions := shellinput.CompletionValues(provider.GetCompletions(tt.line, tt.pos))
 
 			assert.GreaterOrEqual(t, len(completions), tt.expectedMin,
 				"Should have at least %d completions, got %d: %v",
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"mvdan.cc/sh/v3/expand"
@@ -139,7 +140,7 @@ func TestGetCompletions(t *testing.T) {
 			line: "",
 			pos:  0,
 			setup: func() {
-				// no setup needed
+				manager.On("GetSpec", EmptyCompletionCommand).Return(CompletionSpec{}, false)
 			},
 			expected: []string{},
 		},
@@ -368,7 +369,7 @@ func TestGetCompletions(t *testing.T) {
 			manager.Calls = nil
 			tt.setup()
 
-			result := provider.GetCompletions(tt.line, tt.pos)
+			result := shellinput.CompletionValues(provider.GetCompletions(tt.line, tt.pos))
 			assert.Equal(t, tt.expected, result)
 			manager.AssertExpectations(t)
 		})
@@ -408,7 +409,7 @@ func TestGetHelpInfo(t *testing.T) {
 			name:     "help for @! empty",
 			line:     "@!",
 			pos:      2,
-			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
+			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!copy [n]** - Copy a code block from the last response\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
 		},
 		{
 			name:     "help for @!new",
@@ -432,13 +433,13 @@ func TestGetHelpInfo(t *testing.T) {
 			name:     "help for partial @!n (matches new)",
 			line:     "@!n",
 			pos:      3,
-			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
+			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!copy [n]** - Copy a code block from the last response\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
 		},
 		{
 			name:     "help for partial @!t (matches tokens)",
 			line:     "@!t",
 			pos:      3,
-			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
+			expected: "**Agent Controls** - Built-in commands for managing the agent\n\nAvailable commands:\n• **@!new** - Start a new chat session\n• **@!tokens** - Show token usage statistics\n• **@!copy [n]** - Copy a code block from the last response\n• **@!subagents** - List available subagents\n• **@!reload-subagents** - Reload subagent configurations\n• **@!subagent-info <name>** - Show subagent details",
 		},
 		{
 			name:     "help for @!subagents",
@@ -526,3 +527,13 @@ func TestGetHelpInfoWithMacros(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultCompletionIsOnlyForArguments(t *testing.T) {
+	manager, runner, run := newCompletionShell(t)
+	_, _, err := run("complete", "-D", "-W", "--default")
+	assert.NoError(t, err)
+
+	provider := NewShellCompletionProvider(manager, runner)
+	assert.Equal(t, []string{"--default"}, shellinput.CompletionValues(provider.GetCompletions("mycmd --d", 9)))
+	assert.NotContains(t, shellinput.CompletionValues(provider.GetCompletions("mycm", 4)), "--default")
+}
@@ -0,0 +1,123 @@
+package completion
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// How long executable lookups are cached, so newly installed programs are picked up
+const commandResolverCacheTTL = 10 * time.Second
+
+// Builtins of the interpreter, plus the commands gsh handles itself
+var shellBuiltins = map[string]bool{
+	"true": true, ":": true, "false": true, "exit": true, "set": true, "shift": true, "unset": true,
+	"echo": true, "printf": true, "break": true, "continue": true, "pwd": true, "cd": true,
+	"wait": true, "builtin": true, "trap": true, "type": true, "source": true, ".": true, "command": true,
+	"dirs": true, "pushd": true, "popd": true, "umask": true, "alias": true, "unalias": true,
+	"fg": true, "bg": true, "getopts": true, "eval": true, "test": true, "[": true, "exec": true,
+	"return": true, "read": true, "mapfile": true, "readarray": true, "shopt": true, "jobs": true, "disown": true, "kill": true,
+	"declare": true, "local": true, "export": true, "readonly": true, "typeset": true, "nameref": true, "let": true,
+	"history": true, "complete": true, "compgen": true, "compopt": true, "bind": true, "gsh_analytics": true, "gsh_evaluate": true, "gsh_typeset": true, "gsh_set": true, "gsh_shopt": true, "gsh_trap": true, "add-gsh-hook": true,
+}
+
+// CommandResolver resolves command names for syntax highlighting
+type CommandResolver struct {
+	Runner *interp.Runner
+
+	mu          sync.Mutex
+	executables map[string]bool // command name -> whether it is an executable
+	cachedPath  string
+	cachedAt    time.Time
+}
+
+func NewCommandResolver(runner *interp.Runner) *CommandResolver {
+	return &CommandResolver{
+		Runner:      runner,
+		executables: make(map[string]bool),
+	}
+}
+
+// ResolveCommand reports whether name is an alias, function, builtin or executable
+func (r *CommandResolver) ResolveCommand(name string) shellinput.CommandKind {
+	if name == "" {
+		return shellinput.CommandUnknown
+	}
+	if r.Runner != nil {
+		if hasAlias(r.Runner, name) {
+			return shellinput.CommandAlias
+		}
+		if _, ok := r.Runner.Funcs[name]; ok {
+			return shellinput.CommandFunction
+		}
+	}
+	if shellBuiltins[name] {
+		return shellinput.CommandBuiltin
+	}
+	if r.isExecutable(name) {
+		return shellinput.CommandExecutable
+	}
+	return shellinput.CommandMissing
+}
+
+func (r *CommandResolver) isExecutable(name string) bool {
+	path := os.Getenv("PATH")
+	dir := ""
+	if r.Runner != nil {
+		dir = r.Runner.Dir
+		if r.Runner.Vars != nil {
+			if runnerPath := r.Runner.Vars["PATH"].String(); runnerPath != "" {
+				path = runnerPath
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if path != r.cachedPath || time.Since(r.cachedAt) > commandResolverCacheTTL {
+		r.executables = make(map[string]bool)
+		r.cachedPath = path
+		r.cachedAt = time.Now()
+	}
+
+	// Paths depend on the working directory, so they are not cached
+	if filepath.Base(name) != name {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return isExecutableFile(name)
+	}
+
+	if found, ok := r.executables[name]; ok {
+		return found
+	}
+	found := false
+	for _, pathDir := range filepath.SplitList(path) {
+		if isExecutableFile(filepath.Join(pathDir, name)) {
+			found = true
+			break
+		}
+	}
+	r.executables[name] = found
+	return found
+}
+
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// hasAlias reports whether the runner has an alias named name
+func hasAlias(runner *interp.Runner, name string) bool {
+	// The alias field is unexported, see getAliasCompletions
+	aliasField := reflect.ValueOf(runner).Elem().FieldByName("alias")
+	if !aliasField.IsValid() || aliasField.IsNil() {
+		return false
+	}
+	return aliasField.MapIndex(reflect.ValueOf(name)).IsValid()
+}
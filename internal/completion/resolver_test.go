@@ -0,0 +1,42 @@
+package completion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func TestCommandResolver(t *testing.T) {
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "mytool"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "notes.txt"), []byte("not a program"), 0644))
+
+	runner, err := interp.New(interp.Env(expand.ListEnviron("PATH=" + binDir)))
+	require.NoError(t, err)
+	file, err := syntax.NewParser().Parse(strings.NewReader("alias ll='ls -l'\nmkcd() { :; }"), "")
+	require.NoError(t, err)
+	require.NoError(t, runner.Run(context.Background(), file))
+
+	resolver := NewCommandResolver(runner)
+	assert.Equal(t, shellinput.CommandAlias, resolver.ResolveCommand("ll"))
+	assert.Equal(t, shellinput.CommandFunction, resolver.ResolveCommand("mkcd"))
+	assert.Equal(t, shellinput.CommandBuiltin, resolver.ResolveCommand("cd"))
+	assert.Equal(t, shellinput.CommandBuiltin, resolver.ResolveCommand("gsh_analytics"))
+	assert.Equal(t, shellinput.CommandExecutable, resolver.ResolveCommand("mytool"))
+	assert.Equal(t, shellinput.CommandExecutable, resolver.ResolveCommand(filepath.Join(binDir, "mytool")))
+	assert.Equal(t, shellinput.CommandMissing, resolver.ResolveCommand("notes.txt"))
+	assert.Equal(t, shellinput.CommandMissing, resolver.ResolveCommand("nosuchcommand"))
+
+	// A changed PATH invalidates cached lookups
+	runner.Vars["PATH"] = expand.Variable{Kind: expand.String, Str: t.TempDir()}
+	assert.Equal(t, shellinput.CommandMissing, resolver.ResolveCommand("mytool"))
+}
@@ -0,0 +1,405 @@
+package completion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// How long the script of an argument can take to print its values
+const specScriptTimeout = 2 * time.Second
+
+// Most entries the help of a completion spec lists
+const specHelpMaxEntries = 10
+
+// specPosition is where the words before the cursor lead to in a command spec
+type specPosition struct {
+	path         []*CommandSpec // the command and the subcommands given
+	option       *OptionSpec    // option whose argument is at the cursor
+	arguments    int            // number of arguments given to the innermost subcommand
+	optionsEnded bool           // whether -- was given
+}
+
+// command returns the innermost subcommand
+func (p specPosition) command() *CommandSpec {
+	return p.path[len(p.path)-1]
+}
+
+// argument returns the spec of the next positional argument
+func (p specPosition) argument() *ArgSpec {
+	args := p.command().Args
+	if p.arguments < len(args) {
+		return &args[p.arguments]
+	}
+	if len(args) > 0 && args[len(args)-1].Variadic {
+		return &args[len(args)-1]
+	}
+	return nil
+}
+
+// findOption returns the option of the innermost subcommand with the given
+// name, or the persistent option of a command it's a subcommand of
+func (p specPosition) findOption(name string) *OptionSpec {
+	for i := len(p.path) - 1; i >= 0; i-- {
+		for j := range p.path[i].Options {
+			option := &p.path[i].Options[j]
+			if (i == len(p.path)-1 || option.Persistent) && option.Name.contains(name) {
+				return option
+			}
+		}
+	}
+	return nil
+}
+
+// options returns the options that apply to the innermost subcommand
+func (p specPosition) options() []*OptionSpec {
+	var options []*OptionSpec
+	for i := len(p.path) - 1; i >= 0; i-- {
+		for j := range p.path[i].Options {
+			if option := &p.path[i].Options[j]; i == len(p.path)-1 || option.Persistent {
+				options = append(options, option)
+			}
+		}
+	}
+	return options
+}
+
+func (n names) contains(name string) bool {
+	for _, candidate := range n {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSpecPosition follows the words after the command name through spec
+func resolveSpecPosition(spec *CommandSpec, words []string) specPosition {
+	position := specPosition{path: []*CommandSpec{spec}}
+	for _, word := range words {
+		if position.option != nil {
+			// The word is the argument of the option before it
+			position.option = nil
+			continue
+		}
+		if word == "--" && !position.optionsEnded {
+			position.optionsEnded = true
+			continue
+		}
+		if strings.HasPrefix(word, "-") && len(word) > 1 && !position.optionsEnded {
+			name, _, hasValue := strings.Cut(word, "=")
+			if option := position.findOption(name); option != nil && len(option.Args) > 0 && !hasValue {
+				position.option = option
+			}
+			continue
+		}
+		if position.arguments == 0 {
+			if subcommand := findSubcommand(position.command(), word); subcommand != nil {
+				position.path = append(position.path, subcommand)
+				continue
+			}
+		}
+		position.arguments++
+	}
+	return position
+}
+
+func findSubcommand(spec *CommandSpec, name string) *CommandSpec {
+	for i := range spec.Subcommands {
+		if spec.Subcommands[i].Name.contains(name) {
+			return &spec.Subcommands[i]
+		}
+	}
+	return nil
+}
+
+// specEntry is a completion of a spec and its description
+type specEntry struct {
+	value       string
+	description string
+	kind        shellinput.CompletionKind
+}
+
+// specEntries returns the completions of the word cur at position, with
+// their descriptions. Without a runner, only the values written in the spec
+// are returned, as scripts, generators and file templates need the shell.
+func specEntries(runner *interp.Runner, position specPosition, cur string) []specEntry {
+	if position.option != nil {
+		return argumentEntries(runner, &position.option.Args[0], cur, "")
+	}
+
+	if strings.HasPrefix(cur, "-") && !position.optionsEnded {
+		if name, value, ok := strings.Cut(cur, "="); ok {
+			if option := position.findOption(name); option != nil && len(option.Args) > 0 {
+				return argumentEntries(runner, &option.Args[0], value, name+"=")
+			}
+			return nil
+		}
+		var entries []specEntry
+		for _, option := range position.options() {
+			for _, name := range option.Name {
+				if strings.HasPrefix(name, cur) {
+					entries = append(entries, specEntry{value: name, description: option.Description, kind: shellinput.CompletionFlag})
+				}
+			}
+		}
+		return entries
+	}
+
+	var entries []specEntry
+	if position.arguments == 0 {
+		for _, subcommand := range position.command().Subcommands {
+			for _, name := range subcommand.Name {
+				if strings.HasPrefix(name, cur) {
+					entries = append(entries, specEntry{value: name, description: subcommand.Description, kind: shellinput.CompletionCommand})
+				}
+			}
+		}
+	}
+	if argument := position.argument(); argument != nil {
+		entries = append(entries, argumentEntries(runner, argument, cur, "")...)
+	}
+	return entries
+}
+
+// argumentEntries returns the values of an argument that start with cur,
+// with prefix in front of them
+func argumentEntries(runner *interp.Runner, argument *ArgSpec, cur string, prefix string) []specEntry {
+	var entries []specEntry
+	for _, suggestion := range argument.Suggestions {
+		if strings.HasPrefix(suggestion.Name, cur) {
+			entries = append(entries, specEntry{value: prefix + suggestion.Name, description: suggestion.Description})
+		}
+	}
+
+	if argument.Script != "" && runner != nil {
+		for _, value := range runSpecScript(runner, argument.Script) {
+			if strings.HasPrefix(value, cur) {
+				entries = append(entries, specEntry{value: prefix + value, description: argument.Description})
+			}
+		}
+	}
+
+	if argument.Generator != "" && runner != nil {
+		for _, suggestion := range runGenerator(argument.Generator, environment.GetPwd(runner), environment.GetHomeDir(runner)) {
+			if strings.HasPrefix(suggestion.Name, cur) {
+				description := suggestion.Description
+				if description == "" {
+					description = argument.Description
+				}
+				entries = append(entries, specEntry{value: prefix + suggestion.Name, description: description})
+			}
+		}
+	}
+
+	if (argument.Template == "filepaths" || argument.Template == "folders") && runner != nil {
+		for _, file := range expandedFileCompletions(runner, cur, environment.GetPwd(runner)) {
+			if argument.Template == "folders" && !strings.HasSuffix(file, "/") {
+				continue
+			}
+			kind := shellinput.CompletionFile
+			if strings.HasSuffix(file, "/") {
+				kind = shellinput.CompletionDirectory
+			}
+			if strings.Contains(file, " ") {
+				file = "\"" + file + "\""
+			}
+			entries = append(entries, specEntry{value: prefix + file, kind: kind})
+		}
+	}
+	return entries
+}
+
+// runSpecScript runs the script of an argument in a subshell and returns the
+// lines it prints, giving up after specScriptTimeout
+func runSpecScript(runner *interp.Runner, script string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), specScriptTimeout)
+	defer cancel()
+
+	var out strings.Builder
+	subShell := runner.Subshell()
+	interp.StdIO(nil, &out, io.Discard)(subShell)
+	if err := runScript(ctx, subShell, script); err != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	var values []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			values = append(values, line)
+		}
+	}
+	return values
+}
+
+// specArguments splits the line before the cursor into the words after the
+// command name and the word being completed
+func specArguments(line string) ([]string, string) {
+	words := splitPreservingQuotes(line)
+	if len(words) == 0 {
+		return nil, ""
+	}
+	if strings.HasSuffix(line, " ") {
+		return words[1:], ""
+	}
+	if len(words) == 1 {
+		return nil, ""
+	}
+	return words[1 : len(words)-1], words[len(words)-1]
+}
+
+// getSpecCompletions returns the completions of the declarative spec of the
+// command of the line, if it has one
+func (p *ShellCompletionProvider) getSpecCompletions(line string) []shellinput.CompletionCandidate {
+	if p.Specs == nil {
+		return nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || (len(fields) == 1 && !strings.HasSuffix(line, " ")) {
+		// The command name is completed by getAvailableCommands
+		return nil
+	}
+	words, cur := specArguments(line)
+	spec, ok := p.Specs.Lookup(fields[0])
+	if !ok {
+		return nil
+	}
+
+	position := resolveSpecPosition(spec, words)
+	return p.completeFuzzily(cur, func(prefix string) []shellinput.CompletionCandidate {
+		return specCandidates(specEntries(p.Runner, position, prefix))
+	})
+}
+
+// GetPredictionCompletions returns the completions of the line that need
+// nothing to run: the subcommands, options and values written in the
+// declarative spec of its command. Predictions are made in the background,
+// where the runner, busy with the prompt or a command, can't be used.
+func (p *ShellCompletionProvider) GetPredictionCompletions(line string) []shellinput.CompletionCandidate {
+	if p.Specs == nil {
+		return nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || (len(fields) == 1 && !strings.HasSuffix(line, " ")) {
+		return nil
+	}
+	spec, ok := p.Specs.Lookup(fields[0])
+	if !ok {
+		return nil
+	}
+	words, cur := specArguments(line)
+	return specCandidates(specEntries(nil, resolveSpecPosition(spec, words), cur))
+}
+
+// specCandidates turns the entries of a spec into candidates, without
+// duplicates
+func specCandidates(entries []specEntry) []shellinput.CompletionCandidate {
+	var candidates []shellinput.CompletionCandidate
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if !seen[entry.value] {
+			seen[entry.value] = true
+			candidates = append(candidates, shellinput.CompletionCandidate{
+				Value:       entry.value,
+				Description: entry.description,
+				Kind:        entry.kind,
+			})
+		}
+	}
+	return candidates
+}
+
+// getSpecHelp describes the subcommands, options or argument values the word
+// at the cursor can complete to, from the declarative spec of the command
+func (p *ShellCompletionProvider) getSpecHelp(line string) string {
+	if p.Specs == nil || strings.TrimSpace(line) == "" {
+		return ""
+	}
+	fields := strings.Fields(line)
+	spec, ok := p.Specs.Lookup(fields[0])
+	if !ok {
+		return ""
+	}
+	if len(fields) == 1 && !strings.HasSuffix(line, " ") {
+		// The command name itself
+		if spec.Description == "" || !spec.Name.contains(fields[0]) {
+			return ""
+		}
+		return fmt.Sprintf("**%s** - %s", fields[0], spec.Description)
+	}
+
+	words, cur := specArguments(line)
+	position := resolveSpecPosition(spec, words)
+	if position.option != nil {
+		return formatOptionHelp(position.option)
+	}
+
+	// Scripts and generators aren't run for help, as it's shown as you type
+	entries := specEntries(nil, position, cur)
+	var described []specEntry
+	for _, entry := range entries {
+		if entry.description != "" {
+			described = append(described, entry)
+		}
+	}
+
+	if len(described) == 1 || (len(described) > 0 && described[0].value == cur) {
+		entry := described[0]
+		if option := position.findOption(entry.value); option != nil {
+			return formatOptionHelp(option)
+		}
+		return fmt.Sprintf("**%s** - %s", entry.value, entry.description)
+	}
+
+	if len(described) == 0 {
+		if argument := position.argument(); argument != nil && argument.Name != "" && cur == "" {
+			help := fmt.Sprintf("**%s** <%s>", strings.Join(commandNames(position), " "), argument.Name)
+			if argument.Description != "" {
+				help += " - " + argument.Description
+			}
+			return help
+		}
+		return ""
+	}
+
+	help := fmt.Sprintf("**%s**", strings.Join(commandNames(position), " "))
+	if description := position.command().Description; description != "" {
+		help += " - " + description
+	}
+	help += "\n"
+	for i, entry := range described {
+		if i == specHelpMaxEntries {
+			help += fmt.Sprintf("\n…and %d more", len(described)-i)
+			break
+		}
+		help += fmt.Sprintf("\n• **%s** - %s", entry.value, entry.description)
+	}
+	return help
+}
+
+// commandNames returns the names of the command and subcommands at position
+func commandNames(position specPosition) []string {
+	names := make([]string, len(position.path))
+	for i, command := range position.path {
+		names[i] = command.Name[0]
+	}
+	return names
+}
+
+// formatOptionHelp describes an option like "**-m, --message** <msg> - Use the given message"
+func formatOptionHelp(option *OptionSpec) string {
+	help := "**" + strings.Join(option.Name, ", ") + "**"
+	if len(option.Args) > 0 && option.Args[0].Name != "" {
+		help += " <" + option.Args[0].Name + ">"
+	}
+	if option.Description != "" {
+		help += " - " + option.Description
+	}
+	return help
+}
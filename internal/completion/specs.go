@@ -0,0 +1,237 @@
+package completion
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"gopkg.in/yaml.v3"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// The completion specs gsh comes with, one per command
+//
+//go:embed specs/*.yaml
+var builtinSpecs embed.FS
+
+// userSpecsDir returns the directory users put their own completion specs in,
+// which take precedence over the built-in ones, in the shell's HOME, or ""
+// without one
+func userSpecsDir(runner *interp.Runner) string {
+	if runner == nil {
+		return ""
+	}
+	home := environment.GetHomeDir(runner)
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gsh", "completions")
+}
+
+// How often the user's directory of specs is checked for changes, which
+// make the commands found to have no spec be looked up again
+const userSpecsCheckInterval = time.Second
+
+// CommandSpec declares the subcommands, options and arguments of a command
+// for completion, like the specs of Fig and carapace. Specs are YAML or JSON
+// files named after the command they complete.
+type CommandSpec struct {
+	Name        names         `yaml:"name"`
+	Description string        `yaml:"description"`
+	Subcommands []CommandSpec `yaml:"subcommands"`
+	Options     []OptionSpec  `yaml:"options"`
+	Args        args          `yaml:"args"`
+}
+
+// OptionSpec declares an option of a command
+type OptionSpec struct {
+	Name        names  `yaml:"name"`
+	Description string `yaml:"description"`
+	Args        args   `yaml:"args"`
+	// Persistent options apply to the subcommands of the command too
+	Persistent bool `yaml:"persistent"`
+}
+
+// ArgSpec declares an argument of a command or option, and how to generate
+// its values
+type ArgSpec struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Suggestions []Suggestion `yaml:"suggestions"`
+	// Template is "filepaths" or "folders" to complete file or directory names
+	Template string `yaml:"template"`
+	// Script is a shell command printing the values, one per line
+	Script string `yaml:"script"`
+	// Generator names a built-in generator of the values, like git-branches
+	Generator string `yaml:"generator"`
+	// Variadic arguments can be repeated
+	Variadic bool `yaml:"variadic"`
+}
+
+// Suggestion is a value of an argument and its description. In specs it's
+// either a string or a name and a description.
+type Suggestion struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// names are the names of a subcommand or option, given as a string or a list
+type names []string
+
+// args are the arguments of a command or option, given as one or a list
+type args []ArgSpec
+
+func (n *names) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*n = names{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(n))
+}
+
+func (a *args) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var arg ArgSpec
+		if err := value.Decode(&arg); err != nil {
+			return err
+		}
+		*a = args{arg}
+		return nil
+	}
+	return value.Decode((*[]ArgSpec)(a))
+}
+
+func (s *Suggestion) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = Suggestion{Name: value.Value}
+		return nil
+	}
+	type suggestion Suggestion
+	return value.Decode((*suggestion)(s))
+}
+
+// ParseCommandSpec parses a completion spec in YAML or JSON, which is YAML too
+func ParseCommandSpec(data []byte) (*CommandSpec, error) {
+	var spec CommandSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Name) == 0 {
+		return nil, fmt.Errorf("completion spec has no name")
+	}
+	return &spec, nil
+}
+
+// SpecRegistry finds the completion specs of commands, loading them the first
+// time they're needed
+type SpecRegistry struct {
+	// UserDir is the directory of the user's own specs
+	UserDir string
+
+	mu    sync.Mutex
+	specs map[string]*CommandSpec
+	// missing are the commands found to have no spec, which are looked up
+	// for every command name completed
+	missing map[string]bool
+	// userDirModified is when UserDir was last modified, as of checked
+	userDirModified time.Time
+	checked         time.Time
+}
+
+// NewSpecRegistry creates a registry of the built-in specs and those in userDir
+func NewSpecRegistry(userDir string) *SpecRegistry {
+	return &SpecRegistry{
+		UserDir: userDir,
+		specs:   make(map[string]*CommandSpec),
+		missing: make(map[string]bool),
+	}
+}
+
+// Lookup returns the spec of a command
+func (r *SpecRegistry) Lookup(command string) (*CommandSpec, bool) {
+	command = filepath.Base(command)
+	if command == "." || command == "/" {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if spec, ok := r.specs[command]; ok {
+		return spec, true
+	}
+
+	r.checkUserDir()
+	if r.missing[command] {
+		return nil, false
+	}
+	spec := r.load(command)
+	if spec == nil {
+		r.missing[command] = true
+		return nil, false
+	}
+	r.specs[command] = spec
+	return spec, true
+}
+
+// SetUserDir changes the directory of the user's own specs, forgetting the
+// specs loaded so far if it's a different one
+func (r *SpecRegistry) SetUserDir(userDir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if userDir == r.UserDir {
+		return
+	}
+	r.UserDir = userDir
+	clear(r.specs)
+	clear(r.missing)
+	r.userDirModified, r.checked = time.Time{}, time.Time{}
+}
+
+// checkUserDir forgets the commands found to have no spec if the user's
+// directory changed since it was last checked, so specs users add are picked
+// up. The lock must be held.
+func (r *SpecRegistry) checkUserDir() {
+	if r.UserDir == "" || time.Since(r.checked) < userSpecsCheckInterval {
+		return
+	}
+	r.checked = time.Now()
+
+	var modified time.Time
+	if info, err := os.Stat(r.UserDir); err == nil {
+		modified = info.ModTime()
+	}
+	if !modified.Equal(r.userDirModified) {
+		r.userDirModified = modified
+		clear(r.missing)
+	}
+}
+
+// load reads the spec of a command from the user's directory, or else from the
+// built-in specs. A spec that fails to parse is treated as missing.
+func (r *SpecRegistry) load(command string) *CommandSpec {
+	if r.UserDir != "" {
+		for _, extension := range []string{".yaml", ".yml", ".json"} {
+			data, err := os.ReadFile(filepath.Join(r.UserDir, command+extension))
+			if err != nil {
+				continue
+			}
+			if spec, err := ParseCommandSpec(data); err == nil {
+				return spec
+			}
+		}
+	}
+
+	data, err := builtinSpecs.ReadFile("specs/" + command + ".yaml")
+	if err != nil {
+		return nil
+	}
+	spec, err := ParseCommandSpec(data)
+	if err != nil {
+		return nil
+	}
+	return spec
+}
@@ -0,0 +1,311 @@
+package completion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const testSpec = `
+name: tool
+description: A tool for testing
+options:
+  - name: [-v, --verbose]
+    description: Print more
+    persistent: true
+  - name: -C
+    description: Run in a directory
+    args: {name: dir, template: folders}
+subcommands:
+  - name: [deploy, d]
+    description: Deploy the app
+    options:
+      - name: [-e, --env]
+        description: Environment to deploy to
+        args:
+          name: env
+          suggestions:
+            - prod
+            - {name: staging, description: The staging environment}
+    args:
+      - name: service
+        description: Service
+        script: printf 'api\nweb\n'
+      - name: files
+        template: filepaths
+        variadic: true
+  - name: status
+    description: Show the status
+`
+
+func newSpecProvider(t *testing.T, specs map[string]string) (*ShellCompletionProvider, string) {
+	t.Helper()
+	userDir := t.TempDir()
+	for name, spec := range specs {
+		require.NoError(t, os.WriteFile(filepath.Join(userDir, name), []byte(spec), 0644))
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), nil, 0644))
+
+	runner, err := interp.New()
+	require.NoError(t, err)
+	require.NoError(t, runScript(context.Background(), runner, "cd "+quote(dir)))
+
+	provider := NewShellCompletionProvider(NewCompletionManager(), runner)
+	provider.Specs = NewSpecRegistry(userDir)
+	return provider, dir
+}
+
+func TestParseCommandSpec(t *testing.T) {
+	spec, err := ParseCommandSpec([]byte(testSpec))
+	require.NoError(t, err)
+
+	assert.Equal(t, names{"tool"}, spec.Name)
+	assert.Equal(t, names{"-v", "--verbose"}, spec.Options[0].Name)
+	assert.True(t, spec.Options[0].Persistent)
+	require.Len(t, spec.Options[1].Args, 1)
+	assert.Equal(t, "folders", spec.Options[1].Args[0].Template)
+
+	deploy := spec.Subcommands[0]
+	assert.Equal(t, names{"deploy", "d"}, deploy.Name)
+	assert.Equal(t, []Suggestion{{Name: "prod"}, {Name: "staging", Description: "The staging environment"}}, deploy.Options[0].Args[0].Suggestions)
+	require.Len(t, deploy.Args, 2)
+	assert.True(t, deploy.Args[1].Variadic)
+
+	t.Run("json", func(t *testing.T) {
+		spec, err := ParseCommandSpec([]byte(`{"name": "tool", "subcommands": [{"name": "run", "args": {"name": "x", "suggestions": ["a", "b"]}}]}`))
+		require.NoError(t, err)
+		assert.Equal(t, "run", spec.Subcommands[0].Name[0])
+		assert.Equal(t, []Suggestion{{Name: "a"}, {Name: "b"}}, spec.Subcommands[0].Args[0].Suggestions)
+	})
+
+	t.Run("no name", func(t *testing.T) {
+		_, err := ParseCommandSpec([]byte("description: nameless"))
+		assert.EqualError(t, err, "completion spec has no name")
+	})
+}
+
+func TestBuiltinSpecs(t *testing.T) {
+	entries, err := builtinSpecs.ReadDir("specs")
+	require.NoError(t, err)
+
+	registry := NewSpecRegistry("")
+	for _, command := range []string{"git", "docker", "kubectl", "go", "make", "npm", "systemctl", "ssh", "kill", "just", "chown", "chgrp", "su"} {
+		spec, ok := registry.Lookup(command)
+		if assert.True(t, ok, command) {
+			assert.Equal(t, command, spec.Name[0])
+			assert.NotEmpty(t, spec.Description, command)
+		}
+	}
+	for _, entry := range entries {
+		data, err := builtinSpecs.ReadFile("specs/" + entry.Name())
+		require.NoError(t, err)
+		spec, err := ParseCommandSpec(data)
+		require.NoError(t, err, entry.Name())
+		assert.Equal(t, strings.TrimSuffix(entry.Name(), ".yaml"), spec.Name[0])
+	}
+
+	_, ok := registry.Lookup("ls")
+	assert.False(t, ok)
+	spec, ok := registry.Lookup("/usr/bin/git")
+	assert.True(t, ok)
+	assert.Equal(t, "git", spec.Name[0])
+}
+
+func TestUserSpecsOverrideBuiltinSpecs(t *testing.T) {
+	userDir := t.TempDir()
+	registry := NewSpecRegistry(userDir)
+
+	spec, ok := registry.Lookup("git")
+	require.True(t, ok)
+	assert.NotEmpty(t, spec.Subcommands)
+
+	require.NoError(t, os.WriteFile(filepath.Join(userDir, "git.json"), []byte(`{"name": "git", "subcommands": [{"name": "mine"}]}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(userDir, "mytool.yml"), []byte("name: mytool"), 0644))
+
+	registry = NewSpecRegistry(userDir)
+	spec, ok = registry.Lookup("git")
+	require.True(t, ok)
+	assert.Equal(t, "mine", spec.Subcommands[0].Name[0])
+	_, ok = registry.Lookup("mytool")
+	assert.True(t, ok)
+
+	// A spec that doesn't parse falls back to the built-in one
+	require.NoError(t, os.WriteFile(filepath.Join(userDir, "docker.yaml"), []byte("name: [unclosed"), 0644))
+	spec, ok = registry.Lookup("docker")
+	require.True(t, ok)
+	assert.Equal(t, "A self-sufficient runtime for containers", spec.Description)
+}
+
+func TestSpecRegistryRemembersMissingSpecs(t *testing.T) {
+	userDir := t.TempDir()
+	registry := NewSpecRegistry(userDir)
+
+	_, ok := registry.Lookup("mytool")
+	assert.False(t, ok)
+
+	require.NoError(t, os.WriteFile(filepath.Join(userDir, "mytool.yaml"), []byte("name: mytool"), 0644))
+	_, ok = registry.Lookup("mytool")
+	assert.False(t, ok, "the directory isn't checked again right away")
+
+	// Once the directory is checked again, the spec added to it is found
+	registry.checked = time.Time{}
+	_, ok = registry.Lookup("mytool")
+	assert.True(t, ok)
+}
+
+func TestUserSpecsDirFollowsHome(t *testing.T) {
+	home := t.TempDir()
+	userDir := filepath.Join(home, ".config", "gsh", "completions")
+	require.NoError(t, os.MkdirAll(userDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(userDir, "mytool.yaml"), []byte("name: mytool"), 0644))
+
+	runner, err := interp.New()
+	require.NoError(t, err)
+	require.NoError(t, runScript(context.Background(), runner, "HOME="+quote(home)))
+
+	provider := NewShellCompletionProvider(NewCompletionManager(), runner)
+	_, ok := provider.Specs.Lookup("mytool")
+	assert.True(t, ok)
+
+	require.NoError(t, runScript(context.Background(), runner, "HOME="+quote(t.TempDir())))
+	provider.UpdateSpecsDir()
+	_, ok = provider.Specs.Lookup("mytool")
+	assert.False(t, ok, "specs are read from the new HOME")
+}
+
+func TestSpecCompletions(t *testing.T) {
+	provider, _ := newSpecProvider(t, map[string]string{"tool.yaml": testSpec})
+
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"subcommands", "tool ", []string{"deploy", "d", "status"}},
+		{"subcommand prefix", "tool st", []string{"status"}},
+		{"options", "tool -", []string{"-v", "--verbose", "-C"}},
+		{"option argument", "tool -C ", []string{"src/"}},
+		{"persistent options of subcommands", "tool deploy -", []string{"-e", "--env", "-v", "--verbose"}},
+		{"option argument suggestions", "tool deploy --env ", []string{"prod", "staging"}},
+		{"option argument after =", "tool deploy --env=st", []string{"--env=staging"}},
+		{"subcommand alias and script", "tool d ", []string{"api", "web"}},
+		{"options before subcommand", "tool -v -C src deploy a", []string{"api"}},
+		{"variadic file arguments", "tool deploy api src/ ", []string{"main.go", "src/"}},
+		{"end of options", "tool deploy api -- -", nil},
+		{"nothing after a subcommand without arguments", "tool status ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completions := shellinput.CompletionValues(provider.getSpecCompletions(tt.line))
+			assert.ElementsMatch(t, tt.expected, completions)
+		})
+	}
+
+	t.Run("through GetCompletions", func(t *testing.T) {
+		assert.Equal(t, []string{"status"}, shellinput.CompletionValues(provider.GetCompletions("tool st", 7)))
+		// Without completions from the spec, files are completed
+		assert.Equal(t, []string{"main.go"}, shellinput.CompletionValues(provider.GetCompletions("tool status m", 13)))
+	})
+
+	t.Run("completion functions take precedence", func(t *testing.T) {
+		manager := NewCompletionManager()
+		manager.AddSpec(CompletionSpec{Command: "tool", Type: WordListCompletion, Value: "mine"})
+		provider.CompletionManager = manager
+		defer func() { provider.CompletionManager = NewCompletionManager() }()
+		assert.Equal(t, []string{"mine"}, shellinput.CompletionValues(provider.GetCompletions("tool ", 5)))
+	})
+}
+
+func TestPredictionCompletions(t *testing.T) {
+	provider, _ := newSpecProvider(t, map[string]string{"tool.yaml": testSpec})
+
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"subcommands", "tool ", []string{"deploy", "d", "status"}},
+		{"options", "tool deploy --", []string{"--env", "--verbose"}},
+		{"option argument suggestions", "tool deploy --env st", []string{"staging"}},
+		{"scripts aren't run", "tool d ", nil},
+		{"files aren't listed", "tool -C ", nil},
+		{"command name", "too", nil},
+		{"no spec", "nope ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.expected, shellinput.CompletionValues(provider.GetPredictionCompletions(tt.line)))
+		})
+	}
+
+	t.Run("alongside completion", func(t *testing.T) {
+		// Predictions run in the background while Tab runs completion
+		// functions on the prompt, which go test -race checks
+		require.NoError(t, runScript(context.Background(), provider.Runner, "_other() { COMPREPLY=(one two); }"))
+		manager := NewCompletionManager()
+		manager.AddSpec(CompletionSpec{Command: "other", Type: FunctionCompletion, Value: "_other"})
+		provider.CompletionManager = manager
+		defer func() { provider.CompletionManager = NewCompletionManager() }()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 50; i++ {
+				provider.GetPredictionCompletions("tool d ")
+				provider.GetPredictionCompletions("tool deploy --env ")
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			provider.SetHistory([]string{"tool deploy api"})
+			assert.Equal(t, []string{"one", "two"}, shellinput.CompletionValues(provider.GetCompletions("other ", 6)))
+		}
+		<-done
+	})
+}
+
+func TestSpecHelp(t *testing.T) {
+	provider, _ := newSpecProvider(t, map[string]string{"tool.yaml": testSpec})
+
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"command", "tool", "**tool** - A tool for testing"},
+		{"subcommands", "tool ", "**tool** - A tool for testing\n\n• **deploy** - Deploy the app\n• **d** - Deploy the app\n• **status** - Show the status"},
+		{"one subcommand", "tool st", "**status** - Show the status"},
+		{"exact subcommand", "tool deploy", "**deploy** - Deploy the app"},
+		{"option", "tool deploy --e", "**-e, --env** <env> - Environment to deploy to"},
+		{"option argument", "tool deploy --env ", "**-e, --env** <env> - Environment to deploy to"},
+		{"argument", "tool deploy ", "**tool deploy** <service> - Service"},
+		{"no spec", "ls -la", ""},
+		{"no matches", "tool x", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, provider.GetHelpInfo(tt.line, len(tt.line)))
+		})
+	}
+
+	t.Run("long lists are cut short", func(t *testing.T) {
+		provider.Specs = NewSpecRegistry("")
+		help := provider.GetHelpInfo("git ", 4)
+		assert.True(t, strings.HasPrefix(help, "**git** - The stupid content tracker\n\n• **add** - Add file contents to the index\n"), help)
+		assert.Contains(t, help, "more")
+		assert.Equal(t, specHelpMaxEntries, strings.Count(help, "•"))
+	})
+}
@@ -3,6 +3,7 @@ package completion
 import (
 	"testing"
 
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"github.com/stretchr/testify/assert"
 	"mvdan.cc/sh/v3/interp"
 )
@@ -108,7 +109,7 @@ func TestSubagentCompletions(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := provider.GetCompletions(tc.line, tc.pos)
+			result := shellinput.CompletionValues(provider.GetCompletions(tc.line, tc.pos))
 			assert.Equal(t, tc.expected, result)
 		})
 	}
@@ -185,7 +186,7 @@ func TestSubagentCompletionWithoutProvider(t *testing.T) {
 	// Note: No subagent provider set
 
 	// Should return empty completions when no provider is set
-	result := provider.GetCompletions("@", 1)
+	result := shellinput.CompletionValues(provider.GetCompletions("@", 1))
 	assert.Equal(t, []string{}, result)
 
 	// Should return generic help when no provider is set
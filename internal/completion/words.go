@@ -1,8 +1,12 @@
 package completion
 
 import (
+	"context"
+	"slices"
 	"strings"
 	"unicode"
+
+	"mvdan.cc/sh/v3/interp"
 )
 
 // splitPreservingQuotes splits a command line into words while preserving quotes
@@ -54,3 +58,132 @@ func splitPreservingQuotes(line string) []string {
 	return words
 }
 
+// defaultCompWordBreaks is bash's default COMP_WORDBREAKS
+const defaultCompWordBreaks = " \t\n\"'><=;|&(:"
+
+// compWord is a word of the line being completed and its offset in the line
+type compWord struct {
+	text  string
+	start int
+}
+
+// compWordBreaks returns the characters that separate words for completion
+func compWordBreaks(runner *interp.Runner) string {
+	if runner != nil {
+		if breaks, ok := runner.Vars["COMP_WORDBREAKS"]; ok && breaks.IsSet() {
+			return breaks.String()
+		}
+	}
+	return defaultCompWordBreaks
+}
+
+// splitCompWords splits line into words the way bash sets COMP_WORDS: words
+// are separated by whitespace, and runs of the other characters of breaks
+// are words of their own. It also returns the index of the word at point,
+// which is an empty word inserted into the list when point is between words.
+func splitCompWords(line string, point int, breaks string) ([]compWord, int) {
+	var words []compWord
+	isBreak := func(c byte) bool {
+		return c != '"' && c != '\'' && strings.IndexByte(breaks, c) >= 0
+	}
+
+	start := -1
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(line) {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\\':
+			if start < 0 {
+				start = i
+			}
+			i++
+			continue
+		case c == '"' || c == '\'':
+			if start < 0 {
+				start = i
+			}
+			quote = c
+			continue
+		}
+
+		space := unicode.IsSpace(rune(c))
+		if !space && !isBreak(c) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, compWord{text: line[start:i], start: start})
+			start = -1
+		}
+		if !space {
+			end := i
+			for end < len(line) && isBreak(line[end]) && !unicode.IsSpace(rune(line[end])) {
+				end++
+			}
+			words = append(words, compWord{text: line[i:end], start: i})
+			i = end - 1
+		}
+	}
+	if start >= 0 {
+		words = append(words, compWord{text: line[start:], start: start})
+	}
+
+	for i, word := range words {
+		if point < word.start {
+			return slices.Insert(words, i, compWord{start: point}), i
+		}
+		if point <= word.start+len(word.text) {
+			return words, i
+		}
+	}
+	return append(words, compWord{start: point}), len(words)
+}
+
+// wordBreakPrefix returns the text of the last whitespace separated word of
+// line up to and including its last word break character, which readline
+// leaves in front of the completion it inserts
+func wordBreakPrefix(line string, breaks string) string {
+	start := strings.LastIndexFunc(line, unicode.IsSpace) + 1
+	word := line[start:]
+	last := -1
+	quote := byte(0)
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.IndexByte(breaks, c) >= 0:
+			last = i
+		}
+	}
+	return word[:last+1]
+}
+
+// splitWordList expands the -W word list of complete and compgen like bash
+// does, with parameter expansion, command substitution and word splitting
+func splitWordList(runner *interp.Runner, wordList string) []string {
+	if runner == nil {
+		return strings.Fields(wordList)
+	}
+	subShell := runner.Subshell()
+	script := "__gsh_completion_words=(" + wordList + "\n)"
+	if err := runScript(context.Background(), subShell, script); err != nil {
+		return strings.Fields(wordList)
+	}
+	return subShell.Vars["__gsh_completion_words"].List
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/internal/styles"
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/atinylittleshell/gsh/pkg/markdown"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/atotto/clipboard"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// agentOutput prints responses of the agent and subagents. Their markdown is
+// rendered for the terminal, unless GSH_AGENT_MARKDOWN is off or the output
+// isn't a terminal, and their code blocks are kept for @!copy.
+type agentOutput struct {
+	runner      *interp.Runner
+	out         io.Writer
+	highlighter *shellinput.SyntaxHighlighter
+	// copyToClipboard copies text to the system clipboard
+	copyToClipboard func(text string) error
+
+	// Code blocks of the last response
+	codeBlocks []markdown.CodeBlock
+}
+
+func newAgentOutput(runner *interp.Runner, highlighter *shellinput.SyntaxHighlighter) *agentOutput {
+	return &agentOutput{
+		runner:      runner,
+		out:         os.Stdout,
+		highlighter: highlighter,
+		copyToClipboard: func(text string) error {
+			if err := clipboard.WriteAll(text); err != nil {
+				// Without a local clipboard, e.g. over ssh, ask the terminal to copy
+				termenv.NewOutput(os.Stdout).Copy(text)
+			}
+			return nil
+		},
+	}
+}
+
+// startResponse forgets the code blocks of the previous response
+func (o *agentOutput) startResponse() {
+	o.codeBlocks = nil
+}
+
+// printMessage prints a message of the response, following prefix such as "gsh: "
+func (o *agentOutput) printMessage(prefix string, message string) {
+	offset := len(o.codeBlocks)
+	o.codeBlocks = append(o.codeBlocks, markdown.CodeBlocks(message)...)
+
+	width, ok := o.terminalWidth()
+	if !ok || !environment.IsAgentMarkdownEnabled(o.runner) {
+		fmt.Fprint(o.out, gline.RESET_CURSOR_COLUMN+styles.AGENT_MESSAGE(prefix+message+"\n")+gline.RESET_CURSOR_COLUMN)
+		return
+	}
+
+	renderer := markdown.NewRenderer(width)
+	renderer.Styles = styles.MarkdownStyles()
+	if o.highlighter != nil {
+		renderer.ShellHighlighter = o.highlighter
+	}
+	renderer.CodeBlockLabel = func(index int, block markdown.CodeBlock) string {
+		label := fmt.Sprintf("@!copy %d", offset+index)
+		if block.Language != "" {
+			label = block.Language + " · " + label
+		}
+		return label
+	}
+
+	rendered := renderer.Render(message)
+	separator := " "
+	if strings.Contains(rendered, "\n") {
+		separator = "\n"
+	}
+	fmt.Fprint(o.out, gline.RESET_CURSOR_COLUMN+styles.AGENT_MESSAGE(strings.TrimSpace(prefix))+separator+rendered+"\n"+gline.RESET_CURSOR_COLUMN)
+}
+
+// terminalWidth returns the width of the output, and false when it isn't a terminal
+func (o *agentOutput) terminalWidth() (int, bool) {
+	file, ok := o.out.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return 0, false
+	}
+	width, _, err := term.GetSize(int(file.Fd()))
+	if err != nil || width <= 0 {
+		return markdown.DefaultWidth, true
+	}
+	return width, true
+}
+
+// copyCodeBlock copies a code block of the last response to the clipboard,
+// given its number as shown above it, or the last one when arg is empty
+func (o *agentOutput) copyCodeBlock(arg string) error {
+	if len(o.codeBlocks) == 0 {
+		return fmt.Errorf("the last response has no code blocks")
+	}
+	index := len(o.codeBlocks)
+	if arg = strings.TrimSpace(arg); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(o.codeBlocks) {
+			return fmt.Errorf("no code block %s, the last response has %d", arg, len(o.codeBlocks))
+		}
+		index = n
+	}
+	if err := o.copyToClipboard(o.codeBlocks[index-1].Code); err != nil {
+		return err
+	}
+	fmt.Fprint(o.out, gline.RESET_CURSOR_COLUMN+styles.AGENT_MESSAGE(fmt.Sprintf("gsh: Copied code block %d to the clipboard.\n", index))+gline.RESET_CURSOR_COLUMN)
+	return nil
+}
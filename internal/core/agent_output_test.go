@@ -0,0 +1,58 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/interp"
+)
+
+func newTestAgentOutput(t *testing.T) (*agentOutput, *bytes.Buffer, *string) {
+	t.Helper()
+	runner, err := interp.New()
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	var copied string
+	output := newAgentOutput(runner, nil)
+	output.out = &out
+	output.copyToClipboard = func(text string) error {
+		copied = text
+		return nil
+	}
+	return output, &out, &copied
+}
+
+func TestAgentOutputIsRawWhenNotATerminal(t *testing.T) {
+	output, out, _ := newTestAgentOutput(t)
+
+	output.printMessage("gsh: ", "Run **this**:\n\n```bash\nmake build\n```")
+	assert.Contains(t, out.String(), "gsh: Run **this**:\n\n```bash\nmake build\n```\n", "piped output should be the markdown as it is")
+}
+
+func TestAgentOutputCopyCodeBlock(t *testing.T) {
+	output, out, copied := newTestAgentOutput(t)
+
+	assert.Error(t, output.copyCodeBlock(""), "there is nothing to copy before a response")
+
+	output.startResponse()
+	output.printMessage("gsh: ", "```bash\nmake build\n```")
+	output.printMessage("gsh: ", "Then:\n\n```\nmake test\n```\n\n```go\nfmt.Println()\n```")
+
+	require.NoError(t, output.copyCodeBlock(" 2"))
+	assert.Equal(t, "make test", *copied, "code blocks are numbered across the messages of a response")
+	assert.Contains(t, out.String(), "Copied code block 2")
+
+	require.NoError(t, output.copyCodeBlock(""))
+	assert.Equal(t, "fmt.Println()", *copied, "the last code block is copied by default")
+
+	assert.Error(t, output.copyCodeBlock("4"))
+	assert.Error(t, output.copyCodeBlock("first"))
+
+	// A new response replaces the code blocks
+	output.startResponse()
+	output.printMessage("gsh: ", "No code here.")
+	assert.Error(t, output.copyCodeBlock("1"))
+}
@@ -2,9 +2,11 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,12 +16,16 @@ import (
 	"github.com/atinylittleshell/gsh/internal/completion"
 	"github.com/atinylittleshell/gsh/internal/environment"
 	"github.com/atinylittleshell/gsh/internal/history"
+	"github.com/atinylittleshell/gsh/internal/hooks"
+	"github.com/atinylittleshell/gsh/internal/jobs"
 	"github.com/atinylittleshell/gsh/internal/predict"
 	"github.com/atinylittleshell/gsh/internal/rag"
 	"github.com/atinylittleshell/gsh/internal/rag/retrievers"
+	"github.com/atinylittleshell/gsh/internal/signals"
 	"github.com/atinylittleshell/gsh/internal/styles"
 	"github.com/atinylittleshell/gsh/internal/subagent"
 	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"go.uber.org/zap"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
@@ -31,6 +37,10 @@ func RunInteractiveShell(
 	historyManager *history.HistoryManager,
 	analyticsManager *analytics.AnalyticsManager,
 	completionManager *completion.CompletionManager,
+	keyBindings *gline.KeyBindings,
+	jobManager *jobs.Manager,
+	traps *signals.Traps,
+	hookManager *hooks.Manager,
 	logger *zap.Logger,
 ) error {
 	contextProvider := &rag.ContextProvider{
@@ -46,8 +56,14 @@ func RunInteractiveShell(
 	predictor := &predict.PredictRouter{
 		PrefixPredictor:    predict.NewLLMPrefixPredictor(runner, historyManager, logger),
 		NullStatePredictor: predict.NewLLMNullStatePredictor(runner, logger),
+		LocalPredictor:     predict.NewLocalPredictor(runner, historyManager, logger),
+		HistoryManager:     historyManager,
+		Cache:              predict.NewPredictionCache(predict.DEFAULT_PREDICTION_CACHE_SIZE),
+		Recorder:           analyticsManager,
+		Logger:             logger,
 	}
 	explainer := predict.NewLLMExplainer(runner, logger)
+	explainer.CommandDocs = retrievers.NewCommandDocsContextRetriever(runner, logger)
 	agent := agent.NewAgent(runner, historyManager, logger)
 
 	// Set up subagent integration
@@ -56,22 +72,70 @@ func RunInteractiveShell(
 	// Set up completion
 	completionProvider := completion.NewShellCompletionProvider(completionManager, runner)
 	completionProvider.SetSubagentProvider(subagentIntegration.GetCompletionProvider())
+	completionProvider.AI = completion.NewAICompleter(runner, logger, filepath.Join(DataDir(), "completion_help"))
+	predictor.CompletionProvider = completionProvider
+
+	highlighter := shellinput.NewSyntaxHighlighter(completion.NewCommandResolver(runner))
+	// Agent chat messages are not shell commands
+	highlighter.IgnorePrefixes = []string{"@"}
+	agentOutput := newAgentOutput(runner, highlighter)
+	environment.StylePromptSegment = styles.Render
+	environment.JobCount = jobManager.Count
+	completion.JobNames = jobManager.Names
+
+	// History is recorded and context gathered through the hooks, so that
+	// they see the command lines as shell hooks do
+	hookManager.Subscribe(historyManager)
+	hookManager.Subscribe(contextProvider)
+	hookManager.Subscribe(subagentIntegration.GetManager())
+
+	signalHandler := newSignalHandler(ctx, runner, traps, jobManager)
+	defer signalHandler.stop()
+
+	// exitCode is the exit code of the command line that ran last
+	exitCode := 0
+	defer func() { hookManager.Exit(ctx, runner, exitCode) }()
+	// hungUp is set when the shell exits because the terminal hung up
+	hungUp := false
+	jobs.IgnoreTerminalStop()
+
+	// GSH_EDITING_MODE takes effect when it changes, so that it doesn't undo `set -o vi`
+	editingMode := ""
+	// GSH_THEME is loaded when it changes, so that the terminal is asked for its
+	// background colour once
+	themeSetting, themeLoaded := "", false
 
-	chanSIGINT := make(chan os.Signal, 1)
-	signal.Notify(chanSIGINT, os.Interrupt)
+	for {
+		// Report the jobs that finished or stopped while the last command ran
+		jobManager.Notify()
+		signalHandler.watch()
 
-	go func() {
-		for {
-			// ignore SIGINT
-			<-chanSIGINT
+		if hookManager.UpdateDirectory(ctx, runner) || hookManager.Precmd(ctx, runner, exitCode) {
+			break
+		}
+
+		if mode := environment.GetEditingMode(runner); mode != editingMode {
+			editingMode = mode
+			if mode != "" {
+				keyBindings.SetVariable("editing-mode", mode)
+			}
+		}
+
+		if setting := environment.GetTheme(runner); setting != themeSetting || !themeLoaded {
+			themeSetting, themeLoaded = setting, true
+			theme, err := styles.LoadTheme(setting)
+			if err != nil {
+				fmt.Print(gline.RESET_CURSOR_COLUMN + styles.ERROR("gsh: failed to load theme: "+err.Error()+"\n") + gline.RESET_CURSOR_COLUMN)
+			} else {
+				styles.SetTheme(theme)
+				highlighter.Styles = styles.HighlightStyles()
+			}
 		}
-	}()
 
-	for {
 		prompt := environment.GetPrompt(runner, logger)
 		logger.Debug("prompt updated", zap.String("prompt", prompt))
 
-		ragContext := contextProvider.GetContext()
+		ragContext := contextProvider.Context()
 		logger.Debug("context updated", zap.Any("context", ragContext))
 
 		predictor.UpdateContext(ragContext)
@@ -88,20 +152,46 @@ func RunInteractiveShell(
 		for i := len(historyEntries) - 1; i >= 0; i-- {
 			historyCommands[len(historyEntries)-1-i] = historyEntries[i].Command
 		}
+		completionProvider.SetHistory(historyCommands)
+		completionProvider.UpdateSpecsDir()
 
 		// Read input
 		options := gline.NewOptions()
 		options.MinHeight = environment.GetMinimumLines(runner, logger)
 		options.CompletionProvider = completionProvider
-
+		options.ConfirmHighRisk = environment.ShouldConfirmHighRiskCommands(runner)
+		if environment.IsSyntaxHighlightingEnabled(runner) {
+			options.Highlighter = highlighter
+		}
+		options.KeyBindings = keyBindings
+		options.ShellCommandRunner = boundShellCommandRunner(ctx, runner, logger)
+		options.Editor = environment.GetEditor(runner)
+		options.Styles = styles.GlineStyles()
+		options.RightPrompt = environment.GetRightPrompt(runner, logger)
+
+		readingCtx, doneReading := signalHandler.reading(ctx)
+		options.Context = readingCtx
 		line, err := gline.Gline(prompt, historyCommands, "", predictor, explainer, analyticsManager, logger, options)
+		doneReading()
 
 		logger.Debug("received command", zap.String("line", line))
 
-		if err != nil {
+		if errors.Is(err, gline.ErrInterrupted) {
+			if signalHandler.interrupted() {
+				break
+			}
+			continue
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
 			logger.Error("error reading input through gline", zap.Error(err))
 			return err
 		}
+		// Reading is only cancelled when the terminal hangs up, which
+		// runTraps handles
+		var exit bool
+		if exit, hungUp = signalHandler.runTraps(); exit {
+			break
+		}
 
 		// Handle agent chat and macros
 		if strings.HasPrefix(line, "@") {
@@ -117,6 +207,12 @@ func RunInteractiveShell(
 				}
 
 				// Handle built-in agent controls
+				if arg, ok := strings.CutPrefix(control, "copy"); ok && (arg == "" || arg[0] == ' ') {
+					if err := agentOutput.copyCodeBlock(arg); err != nil {
+						fmt.Print(gline.RESET_CURSOR_COLUMN + styles.ERROR("gsh: "+err.Error()+"\n") + gline.RESET_CURSOR_COLUMN)
+					}
+					continue
+				}
 				switch control {
 				case "new":
 					agent.ResetChat()
@@ -154,23 +250,27 @@ func RunInteractiveShell(
 					continue
 				}
 
+				setActiveSubagent(ctx, runner, subagent.Name)
+
 				// Handle subagent response with subagent identification
+				agentOutput.startResponse()
 				for message := range chatChannel {
-					prefix := fmt.Sprintf("gsh [%s]: ", subagent.Name)
-					fmt.Print(gline.RESET_CURSOR_COLUMN + styles.AGENT_MESSAGE(prefix+message+"\n") + gline.RESET_CURSOR_COLUMN)
+					agentOutput.printMessage(fmt.Sprintf("gsh [%s]: ", subagent.Name), message)
 				}
 				continue
 			}
 
 			// Fall back to regular agent chat
+			setActiveSubagent(ctx, runner, "")
 			chatChannel, err = agent.Chat(chatMessage)
 			if err != nil {
 				logger.Error("error chatting with agent", zap.Error(err))
 				continue
 			}
 
+			agentOutput.startResponse()
 			for message := range chatChannel {
-				fmt.Print(gline.RESET_CURSOR_COLUMN + styles.AGENT_MESSAGE("gsh: "+message+"\n") + gline.RESET_CURSOR_COLUMN)
+				agentOutput.printMessage("gsh: ", message)
 			}
 
 			continue
@@ -181,10 +281,21 @@ func RunInteractiveShell(
 			continue
 		}
 
+		// Start predicting the next command while this one runs
+		if environment.IsPredictionPrefetchEnabled(runner) {
+			predictor.PrefetchNullState(line)
+		}
+
 		// Execute the command
-		shouldExit, err := executeCommand(ctx, line, historyManager, runner, logger)
+		if traps.Run(ctx, runner, signals.Debug) {
+			break
+		}
+		signalHandler.watch()
+		shouldExit, lineExitCode, err := executeCommand(ctx, line, runner, jobManager, hookManager, signalHandler, logger)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error executing command: %v\n", err)
+		} else {
+			exitCode = lineExitCode
 		}
 
 		// Sync any gsh variables that might have been changed during command execution
@@ -194,19 +305,58 @@ func RunInteractiveShell(
 			logger.Debug("exiting...")
 			break
 		}
+		if exit, hungUp = signalHandler.runTraps(); exit {
+			logger.Debug("exiting...")
+			break
+		}
 	}
 
+	if hungUp {
+		// The deferred calls here and in the caller run the zshexit hooks and the EXIT trap
+		exitCode = hangupStatus
+		return interp.NewExitStatus(hangupStatus)
+	}
 	return nil
 }
 
-func executeCommand(ctx context.Context, input string, historyManager *history.HistoryManager, runner *interp.Runner, logger *zap.Logger) (bool, error) {
+// boundShellCommandRunner runs shell commands bound to keys with bind -x. As in bash, the
+// command can read and change the line being edited through READLINE_LINE and READLINE_POINT.
+func boundShellCommandRunner(ctx context.Context, runner *interp.Runner, logger *zap.Logger) gline.ShellCommandRunner {
+	return func(command string, line string, point int) (string, int, error) {
+		quotedLine, err := syntax.Quote(line, syntax.LangBash)
+		if err != nil {
+			return line, point, err
+		}
+
+		script := fmt.Sprintf("READLINE_LINE=%s\nREADLINE_POINT=%d\n%s", quotedLine, point, command)
+		err = bash.RunBashScriptFromReader(ctx, runner, strings.NewReader(script), "gsh")
+		if err != nil {
+			logger.Debug("key bound shell command failed", zap.String("command", command), zap.Error(err))
+		}
+
+		newLine := runner.Vars["READLINE_LINE"].String()
+		newPoint, convErr := strconv.Atoi(runner.Vars["READLINE_POINT"].String())
+		if convErr != nil {
+			newPoint = point
+		}
+		newPoint = max(0, min(newPoint, len([]rune(newLine))))
+
+		_ = bash.RunBashScriptFromReader(ctx, runner, strings.NewReader("unset READLINE_LINE READLINE_POINT"), "gsh")
+		return newLine, newPoint, err
+	}
+}
+
+func executeCommand(ctx context.Context, input string, runner *interp.Runner, jobManager *jobs.Manager, hookManager *hooks.Manager, signalHandler *signalHandler, logger *zap.Logger) (bool, int, error) {
+	// Hooks get the command line as it was typed
+	commandLine := input
+
 	// Pre-process input to transform typeset/declare -f/-F/-p commands to gsh_typeset
 	logger.Debug("preprocessing input", zap.String("original_input", input), zap.Int("input_length", len(input)))
 
 	// Validate input before preprocessing
 	if input == "" {
 		logger.Warn("empty input received for preprocessing")
-		return false, nil
+		return false, 0, nil
 	}
 
 	// Add timeout protection for preprocessing
@@ -238,17 +388,22 @@ func executeCommand(ctx context.Context, input string, historyManager *history.H
 	})
 	if prog == nil {
 		logger.Error("invalid command", zap.String("command", input))
-		return false, nil
+		return false, 0, nil
 	}
 	if err != nil {
 		logger.Error("error parsing command", zap.String("command", input), zap.Error(err))
-		return false, err
+		return false, 0, err
 	}
+	bash.AllowClobber(prog)
 
-	historyEntry, _ := historyManager.StartCommand(input, environment.GetPwd(runner))
+	if hookManager.Preexec(ctx, runner, commandLine) {
+		return true, 0, nil
+	}
 
 	startTime := time.Now()
-	err = runner.Run(ctx, prog)
+	commandCtx, done := signalHandler.foreground(ctx)
+	err = jobManager.Run(commandCtx, runner, prog)
+	done()
 	exited := runner.Exited()
 	endTime := time.Now()
 
@@ -258,7 +413,11 @@ func executeCommand(ctx context.Context, input string, historyManager *history.H
 	var exitCode int
 	if err != nil {
 		status, ok := interp.IsExitStatus(err)
-		if !ok {
+		if errors.Is(err, context.Canceled) {
+			// Interrupted by Ctrl-C, which the terminal echoed as ^C
+			fmt.Fprintln(os.Stderr)
+			exitCode = 130
+		} else if !ok {
 			exitCode = -1
 		} else {
 			exitCode = int(status)
@@ -267,8 +426,17 @@ func executeCommand(ctx context.Context, input string, historyManager *history.H
 		exitCode = 0
 	}
 
-	historyManager.FinishCommand(historyEntry, exitCode)
 	bash.RunBashCommand(ctx, runner, fmt.Sprintf("GSH_LAST_COMMAND_EXIT_CODE=%d", exitCode))
 
-	return exited, nil
+	return exited, exitCode, nil
+}
+
+// setActiveSubagent records the subagent of the last chat in GSH_ACTIVE_SUBAGENT,
+// shown by the \(subagent) prompt segment
+func setActiveSubagent(ctx context.Context, runner *interp.Runner, name string) {
+	quoted, err := syntax.Quote(name, syntax.LangBash)
+	if err != nil {
+		quoted = "''"
+	}
+	bash.RunBashCommand(ctx, runner, "GSH_ACTIVE_SUBAGENT="+quoted)
 }
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/atinylittleshell/gsh/internal/jobs"
+	"github.com/atinylittleshell/gsh/internal/signals"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// hangupStatus is the exit status of the shell after the terminal hung up
+const hangupStatus = 128 + 1
+
+// shellSignals are handled by the interactive shell even when they aren't
+// trapped: Ctrl-C interrupts the command line, a hangup exits the shell, and
+// SIGTERM and SIGQUIT are ignored like in bash
+var shellSignals = []os.Signal{os.Interrupt, signals.Hangup, signals.Terminate, signals.Quit}
+
+// signalHandler receives the signals of the interactive shell. Traps don't
+// run as signals arrive, but once the command line running is done or at the
+// next prompt, where the runner is free. A hangup likewise interrupts the
+// prompt or the command line, and the shell hangs up after it.
+type signalHandler struct {
+	ctx        context.Context
+	runner     *interp.Runner
+	traps      *signals.Traps
+	jobManager *jobs.Manager
+	signals    chan os.Signal
+	watched    []os.Signal
+
+	mu sync.Mutex
+	// cancel interrupts the command line running, if any
+	cancel context.CancelFunc
+	// stopReading stops reading the command line at the prompt, if it's shown
+	stopReading context.CancelFunc
+	// pending are the traps of the signals received since traps last ran
+	pending []string
+	// hangup is set when the terminal hung up
+	hangup bool
+}
+
+func newSignalHandler(ctx context.Context, runner *interp.Runner, traps *signals.Traps, jobManager *jobs.Manager) *signalHandler {
+	h := &signalHandler{
+		ctx:        ctx,
+		runner:     runner,
+		traps:      traps,
+		jobManager: jobManager,
+		signals:    make(chan os.Signal, 8),
+	}
+	h.watch()
+	go h.handle()
+	return h
+}
+
+// watch receives the signals the shell handles, and those that are trapped
+// now. Signals no longer trapped get their default behaviour back.
+func (h *signalHandler) watch() {
+	sigs := append(slices.Clone(shellSignals), h.traps.Signals()...)
+	var released []os.Signal
+	for _, sig := range h.watched {
+		if !slices.Contains(sigs, sig) {
+			released = append(released, sig)
+		}
+	}
+	if len(released) > 0 {
+		signals.Stop(h.signals, released...)
+	}
+	signals.Notify(h.signals, sigs...)
+	h.watched = sigs
+}
+
+func (h *signalHandler) stop() {
+	signals.Stop(h.signals)
+}
+
+func (h *signalHandler) handle() {
+	for sig := range h.signals {
+		name := signals.Name(sig)
+		action, trapped := h.traps.Action(name)
+
+		h.mu.Lock()
+		busy := h.cancel != nil
+		switch {
+		case sig == signals.Hangup:
+			h.hangup = true
+			if busy {
+				h.cancel()
+			}
+			if h.stopReading != nil {
+				h.stopReading()
+			}
+		case sig == os.Interrupt && busy && !(trapped && action == ""):
+			h.cancel()
+		}
+		if trapped && action != "" && sig != signals.Hangup {
+			h.pending = append(h.pending, name)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// foreground returns the context to run a command line with, which is
+// cancelled by Ctrl-C, and the function to call when it's done
+func (h *signalHandler) foreground(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.mu.Lock()
+	h.cancel = cancel
+	h.mu.Unlock()
+	return ctx, func() {
+		h.mu.Lock()
+		h.cancel = nil
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// reading returns the context to read a command line at the prompt with,
+// which is cancelled when the terminal hangs up, and the function to call once
+// it's read
+func (h *signalHandler) reading(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.mu.Lock()
+	if h.hangup {
+		cancel()
+	} else {
+		h.stopReading = cancel
+	}
+	h.mu.Unlock()
+	return ctx, func() {
+		h.mu.Lock()
+		h.stopReading = nil
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// interrupted runs the INT trap for Ctrl-C pressed at the prompt, and
+// reports whether it exited the shell
+func (h *signalHandler) interrupted() bool {
+	return h.traps.Run(h.ctx, h.runner, "INT")
+}
+
+// runTraps runs the traps of the signals received since they last ran, and
+// reports whether the shell exits: when one of them exited it, or when the
+// terminal hung up. After a hangup, SIGHUP is passed on to the jobs and the
+// HUP trap runs, and hungUp is set so the shell exits with hangupStatus once
+// its zshexit hooks and EXIT trap ran.
+func (h *signalHandler) runTraps() (exit bool, hungUp bool) {
+	h.mu.Lock()
+	pending, hangup := h.pending, h.hangup
+	h.pending = nil
+	h.mu.Unlock()
+
+	if hangup {
+		h.jobManager.Hangup()
+		h.traps.Run(h.ctx, h.runner, "HUP")
+		return true, true
+	}
+	for _, name := range pending {
+		if h.traps.Run(h.ctx, h.runner, name) {
+			return true, false
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/jobs"
+	"github.com/atinylittleshell/gsh/internal/signals"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHangupStopsReading(t *testing.T) {
+	h := &signalHandler{traps: signals.NewTraps(), jobManager: jobs.NewManager(), signals: make(chan os.Signal, 1)}
+	go h.handle()
+	defer close(h.signals)
+
+	ctx, doneReading := h.reading(context.Background())
+	defer doneReading()
+	h.signals <- signals.Hangup
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("reading wasn't stopped by the hangup")
+	}
+
+	// The shell hangs up on the main goroutine, which doesn't read again
+	ctx, doneReading = h.reading(context.Background())
+	defer doneReading()
+	require.Error(t, ctx.Err())
+	assert.True(t, h.hangup)
+
+	// The main loop exits, leaving the zshexit hooks and EXIT trap to its deferred calls
+	exit, hungUp := h.runTraps()
+	assert.True(t, exit)
+	assert.True(t, hungUp)
+}
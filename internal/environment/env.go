@@ -89,7 +89,7 @@ func GetPrompt(runner *interp.Runner, logger *zap.Logger) string {
 		buildVersion = ""
 	}
 
-	prompt := buildVersion + runner.Vars["GSH_PROMPT"].String()
+	prompt := buildVersion + ExpandPrompt(runner, logger, runner.Vars["GSH_PROMPT"].String())
 	if prompt != "" {
 		return prompt
 	}
@@ -189,6 +189,124 @@ func GetAgentMacros(runner *interp.Runner, logger *zap.Logger) map[string]string
 	return macros
 }
 
+// IsPredictionPrefetchEnabled returns whether gsh should start predicting the next
+// command while the previous one is still running
+func IsPredictionPrefetchEnabled(runner *interp.Runner) bool {
+	prefetch := strings.ToLower(runner.Vars["GSH_PREDICTION_PREFETCH"].String())
+	return prefetch != "0" && prefetch != "false"
+}
+
+// IsAICompletionEnabled returns whether the fast model is asked for the
+// arguments of commands gsh has no completions for
+func IsAICompletionEnabled(runner *interp.Runner) bool {
+	enabled := strings.ToLower(runner.Vars["GSH_AI_COMPLETION"].String())
+	return enabled == "1" || enabled == "true"
+}
+
+// IsCommandDocsHelpEnabled returns whether explanations may run the programs
+// the user typed with --help when they have no man page
+func IsCommandDocsHelpEnabled(runner *interp.Runner) bool {
+	enabled := strings.ToLower(runner.Vars["GSH_COMMAND_DOCS_HELP"].String())
+	return enabled == "1" || enabled == "true"
+}
+
+// ShouldConfirmHighRiskCommands returns whether commands rated high risk need
+// enter to be pressed a second time before they run
+func ShouldConfirmHighRiskCommands(runner *interp.Runner) bool {
+	confirm := strings.ToLower(runner.Vars["GSH_CONFIRM_HIGH_RISK_COMMANDS"].String())
+	return confirm == "1" || confirm == "true"
+}
+
+// IsSyntaxHighlightingEnabled returns whether the command line is highlighted as it is typed
+func IsSyntaxHighlightingEnabled(runner *interp.Runner) bool {
+	highlight := strings.ToLower(runner.Vars["GSH_SYNTAX_HIGHLIGHTING"].String())
+	return highlight != "0" && highlight != "false"
+}
+
+// IsAgentMarkdownEnabled returns whether agent responses are rendered as markdown
+// rather than printed as they are
+func IsAgentMarkdownEnabled(runner *interp.Runner) bool {
+	render := strings.ToLower(runner.Vars["GSH_AGENT_MARKDOWN"].String())
+	return render != "0" && render != "false"
+}
+
+// GetEditingMode returns the editing mode chosen with GSH_EDITING_MODE, "vi" or
+// "emacs", or "" when it isn't set
+func GetEditingMode(runner *interp.Runner) string {
+	mode := strings.ToLower(strings.TrimSpace(runner.Vars["GSH_EDITING_MODE"].String()))
+	if mode != "vi" && mode != "emacs" {
+		return ""
+	}
+	return mode
+}
+
+// GetEditor returns the editor used to edit commands, from VISUAL or EDITOR
+// as in bash, or "" when neither is set
+func GetEditor(runner *interp.Runner) string {
+	if editor := strings.TrimSpace(runner.Vars["VISUAL"].String()); editor != "" {
+		return editor
+	}
+	return strings.TrimSpace(runner.Vars["EDITOR"].String())
+}
+
+// GetTheme returns GSH_THEME, a built-in theme name or a theme file path
+func GetTheme(runner *interp.Runner) string {
+	theme := strings.TrimSpace(runner.Vars["GSH_THEME"].String())
+	if strings.HasPrefix(theme, "~/") {
+		theme = filepath.Join(GetHomeDir(runner), theme[2:])
+	}
+	return theme
+}
+
+// GetPredictionLocalMode returns how the local history-based predictor is used:
+// "blend" shows local suggestions instantly until the LLM responds, "fallback" only
+// uses them when the LLM is unreachable, and "off" disables them
+func GetPredictionLocalMode(runner *interp.Runner, logger *zap.Logger) string {
+	mode := strings.ToLower(strings.TrimSpace(runner.Vars["GSH_PREDICTION_LOCAL"].String()))
+	switch mode {
+	case "blend", "fallback", "off":
+		return mode
+	case "":
+		return "blend"
+	default:
+		logger.Debug("invalid GSH_PREDICTION_LOCAL, using blend", zap.String("value", mode))
+		return "blend"
+	}
+}
+
+// GetSubagentSelector returns the strategy used to auto-select subagents:
+// "llm" asks the fast model, "offline" uses local keyword matching only
+func GetSubagentSelector(runner *interp.Runner, logger *zap.Logger) string {
+	selector := strings.ToLower(strings.TrimSpace(runner.Vars["GSH_SUBAGENT_SELECTOR"].String()))
+	switch selector {
+	case "llm", "offline":
+		return selector
+	case "":
+		return "llm"
+	default:
+		logger.Debug("unknown GSH_SUBAGENT_SELECTOR, using llm", zap.String("value", selector))
+		return "llm"
+	}
+}
+
+// GetSubagentMinConfidence returns the confidence (0-100) an automatic subagent selection
+// must reach before gsh routes the prompt to it instead of the main agent
+func GetSubagentMinConfidence(runner *interp.Runner, logger *zap.Logger) int {
+	minConfidence, err := strconv.ParseInt(
+		runner.Vars["GSH_SUBAGENT_MIN_CONFIDENCE"].String(), 10, 32)
+	if err != nil {
+		logger.Debug("error parsing GSH_SUBAGENT_MIN_CONFIDENCE", zap.Error(err))
+		minConfidence = 60
+	}
+	return int(max(0, min(100, minConfidence)))
+}
+
+// ShouldShowSubagentSelectionReason returns whether gsh should print why a subagent was auto-selected
+func ShouldShowSubagentSelectionReason(runner *interp.Runner) bool {
+	showReason := strings.ToLower(runner.Vars["GSH_SUBAGENT_SHOW_SELECTION_REASON"].String())
+	return showReason == "1" || showReason == "true"
+}
+
 // AppendToAuthorizedCommands appends a command regex to the authorized_commands file
 func AppendToAuthorizedCommands(commandRegex string) error {
 	// Create config directory if it doesn't exist with secure permissions (owner only)
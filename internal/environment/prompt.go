@@ -0,0 +1,240 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Commands that take at least this long show their duration in \(duration)
+const promptDurationThresholdMs = 2000
+
+// JobCount returns the number of jobs the shell manages, shown by \j
+var JobCount = func() int { return 0 }
+
+// StylePromptSegment applies the theme style of the given name to the text of
+// a prompt segment. The shell sets it, as importing the theme here would make
+// an import cycle.
+var StylePromptSegment = func(style string, text string) string { return text }
+
+// now returns the time shown by \t and the other time escapes
+var now = time.Now
+
+// How long git may take to report the repository status for the prompt
+var gitStatusTimeout = 500 * time.Millisecond
+
+// GetRightPrompt returns GSH_RPROMPT with its escapes expanded, shown at the
+// right of the first line of the prompt
+func GetRightPrompt(runner *interp.Runner, logger *zap.Logger) string {
+	return ExpandPrompt(runner, logger, runner.Vars["GSH_RPROMPT"].String())
+}
+
+// ExpandPrompt expands the backslash escapes of bash's PS1 in prompt, and the
+// segments gsh adds to them:
+//
+//	\(exit)      exit code of the last command, when it failed
+//	\(duration)  duration of the last command, when it took 2 seconds or more
+//	\(git)       git branch, followed by * when the working tree is dirty
+//	\(subagent)  subagent the last chat was with
+//
+// Segments with nothing to show are empty, the others end with a space.
+func ExpandPrompt(runner *interp.Runner, logger *zap.Logger, prompt string) string {
+	if !strings.Contains(prompt, `\`) {
+		return prompt
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(prompt); i++ {
+		if prompt[i] != '\\' || i+1 == len(prompt) {
+			result.WriteByte(prompt[i])
+			continue
+		}
+		i++
+		switch c := prompt[i]; c {
+		case 'u':
+			result.WriteString(promptUser(runner))
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if c == 'h' {
+				host, _, _ = strings.Cut(host, ".")
+			}
+			result.WriteString(host)
+		case 'w':
+			result.WriteString(promptWorkingDirectory(runner))
+		case 'W':
+			dir := promptWorkingDirectory(runner)
+			if dir != "~" && dir != "/" {
+				dir = filepath.Base(dir)
+			}
+			result.WriteString(dir)
+		case '$':
+			if os.Geteuid() == 0 {
+				result.WriteByte('#')
+			} else {
+				result.WriteByte('$')
+			}
+		case 't':
+			result.WriteString(now().Format("15:04:05"))
+		case 'T':
+			result.WriteString(now().Format("03:04:05"))
+		case '@':
+			result.WriteString(now().Format("03:04 PM"))
+		case 'A':
+			result.WriteString(now().Format("15:04"))
+		case 'd':
+			result.WriteString(now().Format("Mon Jan 02"))
+		case 'j':
+			result.WriteString(strconv.Itoa(JobCount()))
+		case 's':
+			result.WriteString("gsh")
+		case 'v', 'V':
+			result.WriteString(runner.Vars["GSH_BUILD_VERSION"].String())
+		case 'n':
+			result.WriteByte('\n')
+		case 'r':
+			result.WriteByte('\r')
+		case 'a':
+			result.WriteByte('\a')
+		case 'e':
+			result.WriteByte('\x1b')
+		case '\\':
+			result.WriteByte('\\')
+		case '[', ']':
+			// Markers of non-printing characters, which gsh doesn't need
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i
+			for end < len(prompt) && end < i+3 && prompt[end] >= '0' && prompt[end] <= '7' {
+				end++
+			}
+			n, _ := strconv.ParseUint(prompt[i:end], 8, 8)
+			result.WriteByte(byte(n))
+			i = end - 1
+		case '(':
+			end := strings.IndexByte(prompt[i:], ')')
+			if end < 0 {
+				result.WriteString(`\(`)
+				continue
+			}
+			name := prompt[i+1 : i+end]
+			if segment, ok := promptSegment(runner, logger, name); ok {
+				result.WriteString(segment)
+			} else {
+				result.WriteString(`\` + prompt[i:i+end+1])
+			}
+			i += end
+		default:
+			// Like bash, unknown escapes are left as they are
+			result.WriteByte('\\')
+			result.WriteByte(c)
+		}
+	}
+	return result.String()
+}
+
+func promptUser(runner *interp.Runner) string {
+	if name := runner.Vars["USER"].String(); name != "" {
+		return name
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return ""
+}
+
+// promptWorkingDirectory returns the working directory with the home
+// directory abbreviated as ~
+func promptWorkingDirectory(runner *interp.Runner) string {
+	pwd := GetPwd(runner)
+	home := GetHomeDir(runner)
+	if home != "" && (pwd == home || strings.HasPrefix(pwd, home+"/")) {
+		return "~" + pwd[len(home):]
+	}
+	return pwd
+}
+
+// promptSegment renders the named segment, and returns false for an unknown name
+func promptSegment(runner *interp.Runner, logger *zap.Logger, name string) (string, bool) {
+	segment := ""
+	switch name {
+	case "exit":
+		if code := runner.Vars["GSH_LAST_COMMAND_EXIT_CODE"].String(); code != "" && code != "0" {
+			segment = StylePromptSegment("prompt.exit", "✘ "+code)
+		}
+	case "duration":
+		ms, err := strconv.ParseInt(runner.Vars["GSH_LAST_COMMAND_DURATION_MS"].String(), 10, 64)
+		if err == nil && ms >= promptDurationThresholdMs {
+			segment = StylePromptSegment("prompt.duration", formatDuration(time.Duration(ms)*time.Millisecond))
+		}
+	case "git":
+		branch, dirty := gitStatus(runner, logger)
+		if branch != "" {
+			segment = StylePromptSegment("prompt.git", branch)
+			if dirty {
+				segment += StylePromptSegment("prompt.git.dirty", "*")
+			}
+		}
+	case "subagent":
+		if subagent := runner.Vars["GSH_ACTIVE_SUBAGENT"].String(); subagent != "" {
+			segment = StylePromptSegment("prompt.subagent", "["+subagent+"]")
+		}
+	default:
+		return "", false
+	}
+	if segment != "" {
+		segment += " "
+	}
+	return segment, true
+}
+
+// formatDuration formats a duration like 4.2s or 1m5s
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Truncate(time.Second).String()
+}
+
+// gitStatus returns the branch, or short commit hash when detached, of the
+// repository of the working directory and whether its working tree is dirty.
+// The tree is shown clean when git doesn't finish within gitStatusTimeout.
+func gitStatus(runner *interp.Runner, logger *zap.Logger) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitStatusTimeout)
+	defer cancel()
+
+	out, err := runInSubShell(ctx, runner, "git rev-parse --abbrev-ref HEAD")
+	if err != nil {
+		logger.Debug("not showing git branch in prompt", zap.Error(err))
+		return "", false
+	}
+	branch := strings.TrimSpace(out)
+	if branch == "HEAD" {
+		out, _ = runInSubShell(ctx, runner, "git rev-parse --short HEAD")
+		branch = strings.TrimSpace(out)
+	}
+
+	status, err := runInSubShell(ctx, runner, "git status --porcelain")
+	return branch, err == nil && strings.TrimSpace(status) != ""
+}
+
+// runInSubShell runs a command in a subshell of runner and returns its output
+func runInSubShell(ctx context.Context, runner *interp.Runner, command string) (string, error) {
+	prog, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	subShell := runner.Subshell()
+	interp.StdIO(nil, &out, io.Discard)(subShell)
+	err = subShell.Run(ctx, prog)
+	return out.String(), err
+}
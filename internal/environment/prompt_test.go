@@ -0,0 +1,129 @@
+package environment
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+func newPromptTestRunner(t *testing.T, dir string) *interp.Runner {
+	t.Helper()
+	runner, err := interp.New(interp.Env(expand.ListEnviron(os.Environ()...)), interp.Dir(dir))
+	require.NoError(t, err)
+	runner.Reset()
+	runner.Vars["HOME"] = expand.Variable{Kind: expand.String, Str: "/home/me"}
+	runner.Vars["USER"] = expand.Variable{Kind: expand.String, Str: "me"}
+	return runner
+}
+
+func TestExpandPromptEscapes(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2024, 5, 7, 15, 4, 5, 0, time.UTC) }
+
+	runner := newPromptTestRunner(t, "/tmp")
+	runner.Vars["PWD"] = expand.Variable{Kind: expand.String, Str: "/home/me/src/gsh"}
+	logger := zap.NewNop()
+
+	host, _ := os.Hostname()
+	shortHost, _, _ := strings.Cut(host, ".")
+	dollar := "$"
+	if os.Geteuid() == 0 {
+		dollar = "#"
+	}
+
+	tests := map[string]string{
+		`\u@\h:\w\$ `:        "me@" + shortHost + ":~/src/gsh" + dollar + " ",
+		`\H`:                 host,
+		`[\W]`:               "[gsh]",
+		`\t \A \T \@ \d`:     "15:04:05 15:04 03:04:05 03:04 PM Tue May 07",
+		`\[\e[1m\]bold\\ \j`: "\x1b[1mbold\\ 0",
+		`a\nb\101`:           "a\nbA",
+		`\s \q`:              `gsh \q`,
+		`no escapes`:         "no escapes",
+	}
+	for prompt, expected := range tests {
+		assert.Equal(t, expected, ExpandPrompt(runner, logger, prompt), prompt)
+	}
+
+	runner.Vars["PWD"] = expand.Variable{Kind: expand.String, Str: "/home/me"}
+	assert.Equal(t, "~ ~", ExpandPrompt(runner, logger, `\w \W`))
+	runner.Vars["PWD"] = expand.Variable{Kind: expand.String, Str: "/home/meow"}
+	assert.Equal(t, "/home/meow", ExpandPrompt(runner, logger, `\w`), "only the home directory itself is abbreviated")
+}
+
+func TestExpandPromptSegments(t *testing.T) {
+	runner := newPromptTestRunner(t, t.TempDir())
+	logger := zap.NewNop()
+	prompt := `\(exit)\(duration)\(subagent)\(git)\(nope)> `
+
+	assert.Equal(t, `\(nope)> `, ExpandPrompt(runner, logger, prompt), "segments with nothing to show are empty")
+
+	runner.Vars["GSH_LAST_COMMAND_EXIT_CODE"] = expand.Variable{Kind: expand.String, Str: "127"}
+	runner.Vars["GSH_LAST_COMMAND_DURATION_MS"] = expand.Variable{Kind: expand.String, Str: "65400"}
+	runner.Vars["GSH_ACTIVE_SUBAGENT"] = expand.Variable{Kind: expand.String, Str: "reviewer"}
+	assert.Equal(t, `✘ 127 1m5s [reviewer] \(nope)> `, ExpandPrompt(runner, logger, prompt))
+
+	runner.Vars["GSH_LAST_COMMAND_DURATION_MS"] = expand.Variable{Kind: expand.String, Str: "2500"}
+	assert.Equal(t, "2.5s ", ExpandPrompt(runner, logger, `\(duration)`))
+	runner.Vars["GSH_LAST_COMMAND_DURATION_MS"] = expand.Variable{Kind: expand.String, Str: "1999"}
+	assert.Equal(t, "", ExpandPrompt(runner, logger, `\(duration)`))
+}
+
+func TestExpandPromptGitSegment(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "first")
+
+	runner := newPromptTestRunner(t, dir)
+	logger := zap.NewNop()
+	assert.Equal(t, "main > ", ExpandPrompt(runner, logger, `\(git)> `))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("b"), 0644))
+	assert.Equal(t, "main* > ", ExpandPrompt(runner, logger, `\(git)> `))
+}
+
+func TestExpandPromptSlowGitStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as git")
+	}
+	defer func(d time.Duration) { gitStatusTimeout = d }(gitStatusTimeout)
+	gitStatusTimeout = 100 * time.Millisecond
+
+	bin := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nrev-parse) echo main ;;\nstatus) sleep 1; echo ' M a.txt' ;;\nesac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0755))
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	runner := newPromptTestRunner(t, t.TempDir())
+	assert.Equal(t, "main > ", ExpandPrompt(runner, zap.NewNop(), `\(git)> `), "the tree is shown clean when git status is too slow")
+}
+
+func TestGetRightPrompt(t *testing.T) {
+	runner := newPromptTestRunner(t, "/tmp")
+	assert.Equal(t, "", GetRightPrompt(runner, zap.NewNop()))
+
+	runner.Vars["GSH_RPROMPT"] = expand.Variable{Kind: expand.String, Str: `\s`}
+	assert.Equal(t, "gsh", GetRightPrompt(runner, zap.NewNop()))
+}
@@ -13,6 +13,9 @@ import (
 
 type HistoryManager struct {
 	db *gorm.DB
+	// running is the entry of the command line typed at the prompt that's
+	// running, recorded through the shell's hooks
+	running *HistoryEntry
 }
 
 type HistoryEntry struct {
@@ -64,6 +67,32 @@ func (historyManager *HistoryManager) FinishCommand(entry *HistoryEntry, exitCod
 	return entry, nil
 }
 
+// Preexec records a command line typed at the prompt as it starts
+func (historyManager *HistoryManager) Preexec(command string, directory string) {
+	historyManager.finishRunning(0)
+	entry, err := historyManager.StartCommand(command, directory)
+	if err == nil {
+		historyManager.running = entry
+	}
+}
+
+// Precmd records the exit code of the command line that ran last
+func (historyManager *HistoryManager) Precmd(exitCode int) {
+	historyManager.finishRunning(exitCode)
+}
+
+// Exit records the exit code of the command line that exited the shell
+func (historyManager *HistoryManager) Exit(exitCode int) {
+	historyManager.finishRunning(exitCode)
+}
+
+func (historyManager *HistoryManager) finishRunning(exitCode int) {
+	if historyManager.running != nil {
+		_, _ = historyManager.FinishCommand(historyManager.running, exitCode)
+		historyManager.running = nil
+	}
+}
+
 func (historyManager *HistoryManager) GetRecentEntries(directory string, limit int) ([]HistoryEntry, error) {
 	var entries []HistoryEntry
 	var db = historyManager.db
@@ -111,4 +140,18 @@ func (historyManager *HistoryManager) GetRecentEntriesByPrefix(prefix string, li
 	}
 
 	return entries, nil
-}
\ No newline at end of file
+}
+
+// GetEntriesAfter returns up to limit entries with an ID greater than id, oldest first
+func (historyManager *HistoryManager) GetEntriesAfter(id uint, limit int) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	result := historyManager.db.Where("id > ?", id).
+		Order("id asc").
+		Limit(limit).
+		Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return entries, nil
+}
@@ -49,6 +49,32 @@ func TestBasicOperations(t *testing.T) {
 	assert.Len(t, nonTargetEntries, 0, "Expected 0 entries")
 }
 
+func TestHooks(t *testing.T) {
+	historyManager, err := NewHistoryManager(":memory:")
+	assert.NoError(t, err, "Failed to create history manager")
+
+	// Nothing ran before the first prompt
+	historyManager.Precmd(0)
+
+	historyManager.Preexec("make test", "/src")
+	entries, err := historyManager.GetRecentEntries("/src", 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.False(t, entries[0].ExitCode.Valid, "Expected the running command to have no exit code")
+
+	historyManager.Precmd(2)
+	historyManager.Preexec("exit", "/src")
+	historyManager.Exit(0)
+
+	entries, err = historyManager.GetRecentEntries("/src", 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "make test", entries[0].Command)
+	assert.Equal(t, int32(2), entries[0].ExitCode.Int32)
+	assert.Equal(t, "exit", entries[1].Command)
+	assert.True(t, entries[1].ExitCode.Valid)
+}
+
 func TestDeleteEntry(t *testing.T) {
 	historyManager, err := NewHistoryManager(":memory:")
 	assert.NoError(t, err, "Failed to create history manager")
@@ -296,4 +322,30 @@ func TestGetRecentEntriesByPrefix(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, entries, 5)
 	})
-}
\ No newline at end of file
+}
+
+func TestGetEntriesAfter(t *testing.T) {
+	historyManager, err := NewHistoryManager(":memory:")
+	assert.NoError(t, err, "Failed to create history manager")
+
+	var ids []uint
+	for _, command := range []string{"ls", "cd /tmp", "git status"} {
+		entry, err := historyManager.StartCommand(command, "/")
+		assert.NoError(t, err)
+		ids = append(ids, entry.ID)
+	}
+
+	entries, err := historyManager.GetEntriesAfter(0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "ls", entries[0].Command)
+
+	entries, err = historyManager.GetEntriesAfter(ids[0], 1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "cd /tmp", entries[0].Command)
+
+	entries, err = historyManager.GetEntriesAfter(ids[2], 10)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
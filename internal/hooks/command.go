@@ -0,0 +1,147 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const addHookUsage = "usage: add-gsh-hook [-L | -dD] hook function"
+
+// addHookCommand is what a call to add-gsh-hook asks for
+type addHookCommand struct {
+	list bool
+	// remove removes the function, or the functions matching it as a
+	// pattern if removePattern is set
+	remove        bool
+	removePattern bool
+	hook          string
+	function      string
+}
+
+func parseAddHookArgs(args []string) (addHookCommand, error) {
+	var cmd addHookCommand
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'L':
+				cmd.list = true
+			case 'd':
+				cmd.remove = true
+			case 'D':
+				cmd.remove, cmd.removePattern = true, true
+			default:
+				return addHookCommand{}, fmt.Errorf("-%c: invalid option", flag)
+			}
+		}
+		args = args[1:]
+	}
+
+	if cmd.list {
+		if len(args) > 1 {
+			return addHookCommand{}, errors.New(addHookUsage)
+		}
+		if len(args) == 1 {
+			cmd.hook = args[0]
+		}
+	} else {
+		if len(args) != 2 {
+			return addHookCommand{}, errors.New(addHookUsage)
+		}
+		cmd.hook, cmd.function = args[0], args[1]
+	}
+	if cmd.hook != "" && !slices.Contains(names, cmd.hook) {
+		return addHookCommand{}, fmt.Errorf("%s: unknown hook", cmd.hook)
+	}
+	return cmd, nil
+}
+
+// NewAddHookCallHandler turns add-gsh-hook into the assignment of the hook's
+// array, such as preexec_functions, which the call can't make itself. Listing
+// and errors are left to the add-gsh-hook command handler.
+func NewAddHookCallHandler() interp.CallHandlerFunc {
+	return func(ctx context.Context, args []string) ([]string, error) {
+		if len(args) == 0 || args[0] != "add-gsh-hook" {
+			return args, nil
+		}
+		cmd, err := parseAddHookArgs(args[1:])
+		if err != nil || cmd.list {
+			return args, nil
+		}
+
+		array := cmd.hook + "_functions"
+		functions := hookArray(interp.HandlerCtx(ctx).Env.Get(array))
+		switch {
+		case cmd.removePattern:
+			functions = slices.DeleteFunc(slices.Clone(functions), func(function string) bool {
+				matched, _ := path.Match(cmd.function, function)
+				return matched
+			})
+		case cmd.remove:
+			functions = slices.DeleteFunc(slices.Clone(functions), func(function string) bool {
+				return function == cmd.function
+			})
+		case !slices.Contains(functions, cmd.function):
+			functions = append(functions, cmd.function)
+		}
+
+		quoted := make([]string, 0, len(functions))
+		for _, function := range functions {
+			q, err := syntax.Quote(function, syntax.LangBash)
+			if err != nil {
+				return args, nil
+			}
+			quoted = append(quoted, q)
+		}
+		return []string{"eval", array + "=(" + strings.Join(quoted, " ") + ")"}, nil
+	}
+}
+
+// NewAddHookCommandHandler handles add-gsh-hook -L, which lists the functions
+// added to the hooks as the commands that add them again, and reports invalid
+// calls of add-gsh-hook
+func NewAddHookCommandHandler() func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			if len(args) == 0 || args[0] != "add-gsh-hook" {
+				return next(ctx, args)
+			}
+
+			hc := interp.HandlerCtx(ctx)
+			cmd, err := parseAddHookArgs(args[1:])
+			if err != nil {
+				fmt.Fprintf(hc.Stderr, "add-gsh-hook: %v\n", err)
+				return interp.NewExitStatus(1)
+			}
+			if !cmd.list {
+				// The call handler assigns the hook's array
+				return interp.NewExitStatus(1)
+			}
+
+			hooks := names
+			if cmd.hook != "" {
+				hooks = []string{cmd.hook}
+			}
+			for _, hook := range hooks {
+				for _, function := range hookArray(hc.Env.Get(hook + "_functions")) {
+					quoted, err := syntax.Quote(function, syntax.LangBash)
+					if err != nil {
+						continue
+					}
+					fmt.Fprintf(hc.Stdout, "add-gsh-hook %s %s\n", hook, quoted)
+				}
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package hooks runs the shell functions and Go subscribers that hook into the
+// interactive loop, at the same points as zsh's preexec, precmd, chpwd and
+// zshexit hooks
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/atinylittleshell/gsh/internal/bash"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Names of the hooks. A shell function with the name of a hook runs along
+// with those in the hook's array, such as preexec_functions.
+const (
+	Preexec = "preexec"
+	Precmd  = "precmd"
+	Chpwd   = "chpwd"
+	Zshexit = "zshexit"
+)
+
+var names = []string{Preexec, Precmd, Chpwd, Zshexit}
+
+// PreexecHook is told of a command line typed at the prompt before it runs,
+// with the directory it runs in
+type PreexecHook interface {
+	Preexec(command string, directory string)
+}
+
+// PrecmdHook is told before each prompt of the exit code of the command line
+// that ran last
+type PrecmdHook interface {
+	Precmd(exitCode int)
+}
+
+// ChpwdHook is told when a command line changed the working directory
+type ChpwdHook interface {
+	Chpwd(oldDirectory string, newDirectory string)
+}
+
+// ExitHook is told when the shell exits, with the exit code of the command
+// line that ran last
+type ExitHook interface {
+	Exit(exitCode int)
+}
+
+// Manager runs the hooks. Its methods report whether a shell function they
+// ran exited the shell.
+type Manager struct {
+	subscribers []any
+	// directory is the working directory when the shell last checked it
+	directory string
+	// exit runs the zshexit hooks once, whichever way the shell exits
+	exit sync.Once
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Subscribe adds hook, which implements one or more of the hook interfaces.
+// Go hooks run in the order they subscribed, before the shell functions.
+func (m *Manager) Subscribe(hook any) {
+	m.subscribers = append(m.subscribers, hook)
+}
+
+// Preexec runs the preexec hooks for command, about to run
+func (m *Manager) Preexec(ctx context.Context, runner *interp.Runner, command string) bool {
+	for _, subscriber := range m.subscribers {
+		if hook, ok := subscriber.(PreexecHook); ok {
+			hook.Preexec(command, runner.Dir)
+		}
+	}
+	// zsh also passes the command line in a single line and as it runs
+	return runFunctions(ctx, runner, Preexec, 0, command, command, command)
+}
+
+// Precmd runs the precmd hooks and PROMPT_COMMAND before the prompt, with $?
+// set to exitCode
+func (m *Manager) Precmd(ctx context.Context, runner *interp.Runner, exitCode int) bool {
+	for _, subscriber := range m.subscribers {
+		if hook, ok := subscriber.(PrecmdHook); ok {
+			hook.Precmd(exitCode)
+		}
+	}
+	if runFunctions(ctx, runner, Precmd, exitCode) {
+		return true
+	}
+	return runPromptCommand(ctx, runner, exitCode)
+}
+
+// UpdateDirectory runs the chpwd hooks if the working directory changed since
+// it was last called
+func (m *Manager) UpdateDirectory(ctx context.Context, runner *interp.Runner) bool {
+	oldDirectory := m.directory
+	m.directory = runner.Dir
+	if oldDirectory == "" || oldDirectory == m.directory {
+		return false
+	}
+
+	for _, subscriber := range m.subscribers {
+		if hook, ok := subscriber.(ChpwdHook); ok {
+			hook.Chpwd(oldDirectory, m.directory)
+		}
+	}
+	return runFunctions(ctx, runner, Chpwd, 0)
+}
+
+// Exit runs the zshexit hooks, once, as the shell exits
+func (m *Manager) Exit(ctx context.Context, runner *interp.Runner, exitCode int) {
+	m.exit.Do(func() {
+		for _, subscriber := range m.subscribers {
+			if hook, ok := subscriber.(ExitHook); ok {
+				hook.Exit(exitCode)
+			}
+		}
+		runFunctions(ctx, runner, Zshexit, exitCode)
+	})
+}
+
+// Functions returns the shell functions of hook: the one named after it if
+// it's defined, then those in its array
+func Functions(runner *interp.Runner, hook string) []string {
+	var functions []string
+	if runner.Funcs[hook] != nil {
+		functions = append(functions, hook)
+	}
+	return append(functions, hookArray(runner.Vars[hook+"_functions"])...)
+}
+
+// hookArray returns the functions in the array of a hook, which can also be
+// set to a single function
+func hookArray(vr expand.Variable) []string {
+	switch {
+	case vr.Kind == expand.Indexed:
+		return vr.List
+	case vr.IsSet() && vr.Str != "":
+		return []string{vr.Str}
+	}
+	return nil
+}
+
+// runFunctions calls the shell functions of hook with args and $? set to
+// exitCode
+func runFunctions(ctx context.Context, runner *interp.Runner, hook string, exitCode int, args ...string) bool {
+	for _, function := range Functions(runner, hook) {
+		var words []string
+		for _, word := range append([]string{function}, args...) {
+			quoted, err := syntax.Quote(word, syntax.LangBash)
+			if err != nil {
+				quoted = "''"
+			}
+			words = append(words, quoted)
+		}
+		if run(ctx, runner, hook, exitCode, strings.Join(words, " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPromptCommand runs PROMPT_COMMAND, as bash does before the prompt. It
+// can be an array of commands.
+func runPromptCommand(ctx context.Context, runner *interp.Runner, exitCode int) bool {
+	vr := runner.Vars["PROMPT_COMMAND"]
+	commands := []string{vr.Str}
+	if vr.Kind == expand.Indexed {
+		commands = vr.List
+	}
+	for _, command := range commands {
+		if strings.TrimSpace(command) != "" && run(ctx, runner, "PROMPT_COMMAND", exitCode, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs script with $? set to exitCode
+func run(ctx context.Context, runner *interp.Runner, name string, exitCode int, script string) bool {
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gsh: %s: %v\n", name, err)
+		return false
+	}
+	if exitCode != 0 {
+		status, _ := syntax.NewParser().Parse(strings.NewReader("(exit "+strconv.Itoa(exitCode)+")"), name)
+		file.Stmts = append(status.Stmts, file.Stmts...)
+	}
+	return bash.RunStatements(ctx, runner, file)
+}
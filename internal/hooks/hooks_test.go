@@ -0,0 +1,173 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// hookShell runs scripts with add-gsh-hook, and the hooks of a manager
+type hookShell struct {
+	t       *testing.T
+	manager *Manager
+	runner  *interp.Runner
+	out     bytes.Buffer
+}
+
+func newHookShell(t *testing.T) *hookShell {
+	t.Helper()
+	s := &hookShell{t: t, manager: NewManager()}
+	runner, err := interp.New(
+		interp.StdIO(nil, &s.out, &s.out),
+		interp.Dir(t.TempDir()),
+		interp.ExecHandlers(NewAddHookCommandHandler()),
+		interp.CallHandler(NewAddHookCallHandler()),
+	)
+	require.NoError(t, err)
+	s.runner = runner
+	return s
+}
+
+// run runs script and returns what it printed
+func (s *hookShell) run(script string) string {
+	s.t.Helper()
+	s.out.Reset()
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "test")
+	require.NoError(s.t, err)
+	err = s.runner.Run(context.Background(), file)
+	if _, ok := interp.IsExitStatus(err); !ok {
+		require.NoError(s.t, err)
+	}
+	return s.out.String()
+}
+
+// taken returns and clears what was printed
+func (s *hookShell) taken() string {
+	defer s.out.Reset()
+	return s.out.String()
+}
+
+// recorder is a Go hook that records what it's told
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Preexec(command string, directory string) {
+	r.events = append(r.events, "preexec "+command+" in "+filepath.Base(directory))
+}
+
+func (r *recorder) Precmd(exitCode int) {
+	r.events = append(r.events, "precmd "+strconv.Itoa(exitCode))
+}
+
+func (r *recorder) Chpwd(oldDirectory string, newDirectory string) {
+	r.events = append(r.events, "chpwd "+filepath.Base(newDirectory))
+}
+
+func (r *recorder) Exit(exitCode int) {
+	r.events = append(r.events, "exit "+strconv.Itoa(exitCode))
+}
+
+func TestAddHook(t *testing.T) {
+	s := newHookShell(t)
+
+	assert.Empty(t, s.run("add-gsh-hook preexec one; add-gsh-hook preexec 'two words'; add-gsh-hook preexec one"))
+	assert.Equal(t, "one|two words\n", s.run(`IFS='|'; echo "${preexec_functions[*]}"`))
+
+	s.run("add-gsh-hook chpwd _direnv_hook; add-gsh-hook chpwd _z_hook")
+	assert.Equal(t, "add-gsh-hook preexec one\n"+
+		"add-gsh-hook preexec 'two words'\n"+
+		"add-gsh-hook chpwd _direnv_hook\n"+
+		"add-gsh-hook chpwd _z_hook\n", s.run("add-gsh-hook -L"))
+	assert.Equal(t, "add-gsh-hook preexec one\nadd-gsh-hook preexec 'two words'\n", s.run("add-gsh-hook -L preexec"))
+
+	t.Run("remove", func(t *testing.T) {
+		s.run("add-gsh-hook -d preexec one")
+		assert.Equal(t, []string{"two words"}, Functions(s.runner, Preexec))
+		s.run("add-gsh-hook -D chpwd '_*_hook'")
+		assert.Empty(t, Functions(s.runner, Chpwd))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.Equal(t, "add-gsh-hook: nope: unknown hook\n1\n", s.run("add-gsh-hook nope fn; echo $?"))
+		assert.Equal(t, "add-gsh-hook: "+addHookUsage+"\n", s.run("add-gsh-hook precmd"))
+		assert.Equal(t, "add-gsh-hook: -x: invalid option\n", s.run("add-gsh-hook -x precmd fn"))
+	})
+}
+
+func TestHooks(t *testing.T) {
+	s := newHookShell(t)
+	ctx := context.Background()
+	r := &recorder{}
+	s.manager.Subscribe(r)
+	require.NoError(t, os.Mkdir(filepath.Join(s.runner.Dir, "project"), 0o755))
+
+	s.run(`
+preexec() { echo "preexec $1"; }
+show_status() { echo "precmd $?"; }
+add-gsh-hook precmd show_status
+changed() { echo "chpwd $OLDPWD"; }
+add-gsh-hook chpwd changed
+zshexit_functions=(goodbye)
+goodbye() { echo "bye $?"; }
+PROMPT_COMMAND='echo prompt'
+`)
+
+	t.Run("precmd", func(t *testing.T) {
+		assert.False(t, s.manager.Precmd(ctx, s.runner, 3))
+		assert.Equal(t, "precmd 3\nprompt\n", s.taken())
+	})
+
+	t.Run("chpwd", func(t *testing.T) {
+		// The directory the shell started in isn't a change
+		assert.False(t, s.manager.UpdateDirectory(ctx, s.runner))
+		s.run("cd project")
+		assert.False(t, s.manager.UpdateDirectory(ctx, s.runner))
+		assert.Equal(t, "chpwd "+filepath.Dir(s.runner.Dir)+"\n", s.taken())
+		assert.False(t, s.manager.UpdateDirectory(ctx, s.runner))
+		assert.Empty(t, s.taken())
+	})
+
+	t.Run("preexec", func(t *testing.T) {
+		assert.False(t, s.manager.Preexec(ctx, s.runner, "ls 'my files'"))
+		assert.Equal(t, "preexec ls 'my files'\n", s.taken())
+	})
+
+	t.Run("exit", func(t *testing.T) {
+		s.manager.Exit(ctx, s.runner, 2)
+		s.manager.Exit(ctx, s.runner, 2)
+		assert.Equal(t, "bye 2\n", s.taken())
+	})
+
+	assert.Equal(t, []string{"precmd 3", "chpwd project", "preexec ls 'my files' in project", "exit 2"}, r.events)
+
+	t.Run("exit from two goroutines", func(t *testing.T) {
+		manager := NewManager()
+		r := &recorder{}
+		manager.Subscribe(r)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			manager.Exit(ctx, s.runner, 129)
+		}()
+		manager.Exit(ctx, s.runner, 129)
+		<-done
+		assert.Equal(t, []string{"exit 129"}, r.events)
+		s.taken()
+	})
+
+	t.Run("exiting hook", func(t *testing.T) {
+		s.run("PROMPT_COMMAND=(true 'exit 4' 'echo unreached')")
+		assert.True(t, s.manager.Precmd(ctx, s.runner, 0))
+		assert.NotContains(t, s.taken(), "unreached")
+	})
+}
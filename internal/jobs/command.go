@@ -0,0 +1,412 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// NewJobCallHandler passes the fg, bg and wait builtins of the interpreter,
+// which doesn't know about the job table, to the job command handler as
+// gsh_fg, gsh_bg and gsh_wait. A plain wait then also waits for the
+// background commands the interpreter started itself, such as those in loops.
+func NewJobCallHandler(m *Manager) interp.CallHandlerFunc {
+	return func(ctx context.Context, args []string) ([]string, error) {
+		if len(args) == 0 {
+			return args, nil
+		}
+
+		switch {
+		case args[0] == "fg" || args[0] == "bg" || args[0] == "wait" && len(args) > 1:
+			return append([]string{"gsh_" + args[0]}, args[1:]...), nil
+		case args[0] == "wait":
+			m.waitAll(ctx)
+		}
+		return args, nil
+	}
+}
+
+// NewJobCommandHandler handles the jobs, fg, bg, disown, wait and kill %n
+// builtins, and runs the commands typed at the prompt as processes of their
+// job. It must be the last exec handler, as it starts processes itself.
+func NewJobCommandHandler(m *Manager) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return next(ctx, args)
+			}
+
+			hc := interp.HandlerCtx(ctx)
+			switch args[0] {
+			case "jobs":
+				return m.jobsCommand(hc, args[1:])
+			case "gsh_fg":
+				return m.fgCommand(ctx, hc, args[1:])
+			case "gsh_bg":
+				return m.bgCommand(hc, args[1:])
+			case "disown":
+				return m.disownCommand(hc, args[1:])
+			case "gsh_wait":
+				return m.waitCommand(ctx, hc, args[1:])
+			case "kill":
+				if slices.ContainsFunc(args[1:], isJobSpec) {
+					return m.killCommand(hc, args[1:])
+				}
+			}
+
+			if job := m.jobFor(ctx); job != nil {
+				return m.runProcess(ctx, job, args)
+			}
+			return next(ctx, args)
+		}
+	}
+}
+
+func isJobSpec(arg string) bool {
+	return strings.HasPrefix(arg, "%")
+}
+
+// failure reports err of the builtin name and returns its exit status
+func failure(hc interp.HandlerContext, name string, err error, status uint8) error {
+	fmt.Fprintf(hc.Stderr, "%s: %v\n", name, err)
+	return interp.NewExitStatus(status)
+}
+
+// parseFlags splits the single letter flags, all of which must be in
+// allowed, from the rest of args
+func parseFlags(args []string, allowed string) (string, []string, error) {
+	flags := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			return flags, args[1:], nil
+		}
+		for _, flag := range args[0][1:] {
+			if !strings.ContainsRune(allowed, flag) {
+				return "", nil, fmt.Errorf("-%c: invalid option", flag)
+			}
+			flags += string(flag)
+		}
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+// jobsCommand lists the jobs, or those given as job specs. -l adds their
+// process group IDs, -p shows only those, and -r and -s show only the running
+// or stopped jobs.
+func (m *Manager) jobsCommand(hc interp.HandlerContext, args []string) error {
+	flags, specs, err := parseFlags(args, "lprs")
+	if err != nil {
+		return failure(hc, "jobs", err, 2)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var status uint8
+	list := slices.Clone(m.jobs)
+	if len(specs) > 0 {
+		list = nil
+		for _, spec := range specs {
+			job, err := m.findJob(spec)
+			if err != nil {
+				fmt.Fprintf(hc.Stderr, "jobs: %v\n", err)
+				status = 1
+				continue
+			}
+			list = append(list, job)
+		}
+	}
+
+	for _, job := range list {
+		state := job.state()
+		if strings.Contains(flags, "r") && state != Running || strings.Contains(flags, "s") && state != Stopped {
+			continue
+		}
+		if strings.Contains(flags, "p") {
+			fmt.Fprintln(hc.Stdout, job.pgid)
+		} else {
+			fmt.Fprintln(hc.Stdout, m.format(job, strings.Contains(flags, "l")))
+		}
+		// Finished jobs are shown once, as before the prompt
+		if state == Done {
+			m.remove(job)
+		} else {
+			job.reported = state
+		}
+	}
+	return interp.NewExitStatus(status)
+}
+
+// fgCommand continues a job in the foreground, giving it the terminal, and
+// waits until it finishes or is stopped again
+func (m *Manager) fgCommand(ctx context.Context, hc interp.HandlerContext, args []string) error {
+	spec := ""
+	if len(args) > 0 {
+		spec = args[0]
+	}
+
+	m.mu.Lock()
+	job, err := m.findJob(spec)
+	if err != nil {
+		m.mu.Unlock()
+		return failure(hc, "fg", err, 1)
+	}
+	job.foreground = true
+	pgid := job.pgid
+	m.mu.Unlock()
+
+	fmt.Fprintln(hc.Stdout, job.Command)
+	m.giveTerminal(pgid)
+	m.mu.Lock()
+	m.continueJob(job)
+	m.mu.Unlock()
+
+	state := m.waitJob(ctx, job, true)
+	m.takeTerminal()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.foreground = false
+	switch state {
+	case Stopped:
+		m.stopForeground(job, hc.Stderr)
+		return interp.NewExitStatus(uint8(stoppedStatus))
+	case Done:
+		m.remove(job)
+		return interp.NewExitStatus(uint8(job.exitCode))
+	default:
+		return ctx.Err()
+	}
+}
+
+// bgCommand continues stopped jobs in the background
+func (m *Manager) bgCommand(hc interp.HandlerContext, specs []string) error {
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var status uint8
+	for _, spec := range specs {
+		job, err := m.findJob(spec)
+		if err != nil {
+			fmt.Fprintf(hc.Stderr, "bg: %v\n", err)
+			status = 1
+			continue
+		}
+		if job.state() != Stopped {
+			fmt.Fprintf(hc.Stderr, "bg: job %d already in background\n", job.ID)
+			continue
+		}
+		job.foreground = false
+		m.continueJob(job)
+		fmt.Fprintf(hc.Stdout, "[%d]%s %s &\n", job.ID, m.mark(job), job.Command)
+	}
+	return interp.NewExitStatus(status)
+}
+
+// continueJob sends SIGCONT to job if it's stopped. The manager's lock must
+// be held.
+func (m *Manager) continueJob(job *Job) {
+	job.reported = Running
+	if job.state() != Stopped {
+		return
+	}
+	for _, p := range job.processes {
+		p.stopped = false
+	}
+	_ = signalProcess(-job.pgid, continueSignal)
+}
+
+// disownCommand removes jobs from the job table, so they're no longer
+// reported. -a disowns all jobs and -r all running jobs. With -h, jobs stay
+// in the table but aren't sent SIGHUP when the shell exits.
+func (m *Manager) disownCommand(hc interp.HandlerContext, args []string) error {
+	flags, specs, err := parseFlags(args, "ahr")
+	if err != nil {
+		return failure(hc, "disown", err, 2)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var status uint8
+	var list []*Job
+	switch {
+	case len(specs) > 0:
+		for _, spec := range specs {
+			job, err := m.findJob(spec)
+			if err != nil {
+				fmt.Fprintf(hc.Stderr, "disown: %v\n", err)
+				status = 1
+				continue
+			}
+			list = append(list, job)
+		}
+	case strings.ContainsAny(flags, "ar"):
+		for _, job := range m.jobs {
+			if !strings.Contains(flags, "r") || job.state() == Running {
+				list = append(list, job)
+			}
+		}
+	default:
+		job, err := m.findJob("")
+		if err != nil {
+			return failure(hc, "disown", err, 1)
+		}
+		list = append(list, job)
+	}
+
+	for _, job := range list {
+		if strings.Contains(flags, "h") {
+			job.noHangup = true
+		} else {
+			m.remove(job)
+		}
+	}
+	return interp.NewExitStatus(status)
+}
+
+// waitCommand waits for the jobs or process IDs given until they finish or
+// are stopped, and returns the exit status of the last one
+func (m *Manager) waitCommand(ctx context.Context, hc interp.HandlerContext, args []string) error {
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "--" {
+		return failure(hc, "wait", fmt.Errorf("%s: invalid option", args[0]), 2)
+	}
+
+	var status uint8
+	for _, target := range args {
+		if target == "--" {
+			continue
+		}
+		m.mu.Lock()
+		job, err := m.findTarget(target)
+		m.mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(hc.Stderr, "wait: %v\n", err)
+			status = 127
+			continue
+		}
+
+		state := m.waitJob(ctx, job, true)
+		m.mu.Lock()
+		switch state {
+		case Done:
+			status = uint8(job.exitCode)
+			m.remove(job)
+		case Stopped:
+			status = uint8(stoppedStatus)
+		}
+		m.mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return interp.NewExitStatus(status)
+}
+
+// waitAll waits until none of the jobs is running
+func (m *Manager) waitAll(ctx context.Context) {
+	m.mu.Lock()
+	list := slices.Clone(m.jobs)
+	m.mu.Unlock()
+
+	for _, job := range list {
+		if m.waitJob(ctx, job, true) == Done {
+			m.mu.Lock()
+			m.remove(job)
+			m.mu.Unlock()
+		}
+	}
+}
+
+// findTarget returns the job for a job spec, or the one with a process ID.
+// The manager's lock must be held.
+func (m *Manager) findTarget(target string) (*Job, error) {
+	if isJobSpec(target) {
+		return m.findJob(target)
+	}
+	pid, err := strconv.Atoi(target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a pid or valid job spec", target)
+	}
+	for _, job := range m.jobs {
+		for _, p := range job.processes {
+			if p.pid == pid {
+				return job, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+}
+
+// killCommand sends a signal, SIGTERM unless given with -s, -n or -NAME, to
+// the process groups of jobs and to process IDs
+func (m *Manager) killCommand(hc interp.HandlerContext, args []string) error {
+	sig := syscall.SIGTERM
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		name := args[0][1:]
+		args = args[1:]
+		if name == "-" {
+			break
+		}
+		if name == "s" || name == "n" {
+			if len(args) == 0 {
+				return failure(hc, "kill", fmt.Errorf("-%s: option requires an argument", name), 2)
+			}
+			name, args = args[0], args[1:]
+		}
+		parsed, ok := parseSignal(name)
+		if !ok {
+			return failure(hc, "kill", fmt.Errorf("%s: invalid signal specification", name), 1)
+		}
+		sig = parsed
+	}
+
+	var status uint8
+	for _, target := range args {
+		var err error
+		if isJobSpec(target) {
+			err = m.signalJob(target, sig)
+		} else if pid, convErr := strconv.Atoi(target); convErr != nil {
+			err = fmt.Errorf("%s: arguments must be process or job IDs", target)
+		} else if err = signalProcess(pid, sig); err != nil {
+			err = fmt.Errorf("(%d) - %w", pid, err)
+		}
+		if err != nil {
+			fmt.Fprintf(hc.Stderr, "kill: %v\n", err)
+			status = 1
+		}
+	}
+	return interp.NewExitStatus(status)
+}
+
+// signalJob sends sig to the process group of the job spec refers to.
+// Stopped jobs are continued, so that they can handle SIGTERM or SIGHUP.
+func (m *Manager) signalJob(spec string, sig syscall.Signal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.findJob(spec)
+	if err != nil {
+		return err
+	}
+	if job.liveProcesses() == 0 {
+		return fmt.Errorf("%s: no processes to signal", spec)
+	}
+	if err := signalProcess(-job.pgid, sig); err != nil {
+		return fmt.Errorf("%s: %w", spec, err)
+	}
+	if job.state() == Stopped && (sig == syscall.SIGTERM || sig == syscall.SIGHUP) {
+		m.continueJob(job)
+	}
+	return nil
+}
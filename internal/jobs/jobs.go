@@ -0,0 +1,684 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/signals"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const (
+	// How long a background job may take to start its first process before
+	// it's announced without a process ID
+	backgroundStartTimeout = 100 * time.Millisecond
+	// How long a process may take to exit after being interrupted when the
+	// command running it is cancelled, as in interp.DefaultExecHandler
+	killTimeout = 2 * time.Second
+	// How long the shell may take to cancel the command line after one of
+	// its processes was interrupted by Ctrl-C
+	interruptTimeout = 100 * time.Millisecond
+)
+
+// State is what a job is doing
+type State int
+
+const (
+	Running State = iota
+	Stopped
+	Done
+)
+
+func (s State) String() string {
+	switch s {
+	case Stopped:
+		return "Stopped"
+	case Done:
+		return "Done"
+	default:
+		return "Running"
+	}
+}
+
+// Job is a command the shell runs in the background, or that was stopped in
+// the foreground. Its processes share a process group, so that they can be
+// stopped, continued and given the terminal together.
+type Job struct {
+	// ID is the number of the job in the job table, or 0 until it's added
+	ID      int
+	Command string
+
+	pgid      int
+	processes []*process
+	// starting is held while a process of the job starts, so that the
+	// processes of a pipeline, started concurrently, join the process group
+	// of the first one
+	starting sync.Mutex
+	// subshell is set for jobs started with &, which run in a subshell
+	// until running is cleared
+	subshell   bool
+	running    bool
+	foreground bool
+	exitCode   int
+	signal     syscall.Signal
+	// noHangup is set by disown -h
+	noHangup bool
+	// sequence orders jobs by when they were started in the background or
+	// stopped, for the current (%+) and previous (%-) jobs
+	sequence int
+	// reported is the state the user last saw the job in
+	reported State
+	// started is closed once a background job starts its first process or
+	// finishes
+	started chan struct{}
+}
+
+type process struct {
+	cmd      *exec.Cmd
+	pid      int
+	stopped  bool
+	exited   bool
+	exitCode int
+	signal   syscall.Signal
+}
+
+// processEvent is a change in the state of a process
+type processEvent struct {
+	stopped  bool
+	exited   bool
+	exitCode int
+	signal   syscall.Signal
+}
+
+// state returns what the job is doing. The manager's lock must be held.
+func (j *Job) state() State {
+	live, stopped := 0, 0
+	for _, p := range j.processes {
+		if !p.exited {
+			live++
+			if p.stopped {
+				stopped++
+			}
+		}
+	}
+	switch {
+	case live == 0 && !j.running:
+		return Done
+	case live > 0 && stopped == live:
+		return Stopped
+	default:
+		return Running
+	}
+}
+
+// liveProcesses returns the number of processes of the job that haven't exited
+func (j *Job) liveProcesses() int {
+	live := 0
+	for _, p := range j.processes {
+		if !p.exited {
+			live++
+		}
+	}
+	return live
+}
+
+// status describes the state of the job as the jobs builtin shows it
+func (j *Job) status() string {
+	state := j.state()
+	if state != Done {
+		return state.String()
+	}
+	if j.signal != 0 && j.exitCode == 128+int(j.signal) {
+		description := j.signal.String()
+		return strings.ToUpper(description[:1]) + description[1:]
+	}
+	if j.exitCode != 0 {
+		return fmt.Sprintf("Exit %d", j.exitCode)
+	}
+	return "Done"
+}
+
+// Manager keeps the job table of the shell, and runs the processes of the
+// commands typed at the prompt in process groups, handing them the terminal
+// while they're in the foreground
+type Manager struct {
+	// Stderr is where jobs are announced and their changes reported
+	Stderr io.Writer
+
+	mu sync.Mutex
+	// changed is broadcast whenever a process or job changes state
+	changed  *sync.Cond
+	jobs     []*Job
+	sequence int
+	// terminal is the file descriptor of the terminal the shell runs in, or
+	// -1 when it doesn't run in one and can't hand it to jobs
+	terminal  int
+	shellPgid int
+}
+
+func NewManager() *Manager {
+	return newManager(controllingTerminal())
+}
+
+func newManager(terminal int) *Manager {
+	m := &Manager{
+		Stderr:   os.Stderr,
+		terminal: terminal,
+	}
+	m.changed = sync.NewCond(&m.mu)
+	if terminal >= 0 {
+		m.shellPgid = processGroup()
+	}
+	return m
+}
+
+type backgroundJobKey struct{}
+
+type foregroundCommandKey struct{}
+
+// foregroundCommand is a command line run in the foreground. Its processes
+// belong to job, until the job is stopped and a new one is started.
+type foregroundCommand struct {
+	command string
+	job     *Job
+}
+
+// Run runs stmt, a command typed at the prompt, in the foreground, or as a
+// background job if it ends with &
+func (m *Manager) Run(ctx context.Context, runner *interp.Runner, stmt *syntax.Stmt) error {
+	if stmt.Background {
+		m.startBackground(ctx, runner, stmt)
+		return nil
+	}
+
+	ctx = context.WithValue(ctx, foregroundCommandKey{}, &foregroundCommand{command: commandText(stmt)})
+	err := runner.Run(ctx, stmt)
+	m.takeTerminal()
+	return err
+}
+
+// startBackground runs stmt in a subshell as a new job, and announces its
+// number and process ID like bash
+func (m *Manager) startBackground(ctx context.Context, runner *interp.Runner, stmt *syntax.Stmt) *Job {
+	job := &Job{
+		Command:  commandText(stmt),
+		subshell: true,
+		running:  true,
+		started:  make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.add(job)
+	m.mu.Unlock()
+
+	foreground := *stmt
+	foreground.Background = false
+	subshell := runner.Subshell()
+	jobCtx := context.WithValue(context.WithoutCancel(ctx), backgroundJobKey{}, job)
+	go func() {
+		err := subshell.Run(jobCtx, &foreground)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		job.running = false
+		job.exitCode = exitCode(err)
+		m.markStarted(job)
+		m.changed.Broadcast()
+	}()
+
+	// Builtins running in the background never start a process
+	select {
+	case <-job.started:
+	case <-time.After(backgroundStartTimeout):
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(job.processes) > 0 {
+		fmt.Fprintf(m.Stderr, "[%d] %d\n", job.ID, job.processes[0].pid)
+	} else {
+		fmt.Fprintf(m.Stderr, "[%d]\n", job.ID)
+	}
+	return job
+}
+
+// jobFor returns the job the processes started with ctx belong to, or nil
+// for commands that aren't run from the prompt, such as the configuration
+// files, which don't have job control
+func (m *Manager) jobFor(ctx context.Context) *Job {
+	if job, ok := ctx.Value(backgroundJobKey{}).(*Job); ok {
+		return job
+	}
+	command, ok := ctx.Value(foregroundCommandKey{}).(*foregroundCommand)
+	if !ok {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if command.job == nil || command.job.ID != 0 {
+		command.job = &Job{Command: command.command, foreground: true}
+	}
+	return command.job
+}
+
+// runProcess runs args as a process of job, like interp.DefaultExecHandler.
+// A process in the foreground that's stopped from the terminal adds its job
+// to the job table, and the command line carries on as if it had exited.
+func (m *Manager) runProcess(ctx context.Context, job *Job, args []string) error {
+	hc := interp.HandlerCtx(ctx)
+	path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
+	if err != nil {
+		fmt.Fprintln(hc.Stderr, err)
+		return interp.NewExitStatus(127)
+	}
+	newCmd := func() *exec.Cmd {
+		return &exec.Cmd{
+			Path:   path,
+			Args:   args,
+			Env:    execEnv(hc.Env),
+			Dir:    hc.Dir,
+			Stdin:  hc.Stdin,
+			Stdout: hc.Stdout,
+			Stderr: hc.Stderr,
+		}
+	}
+
+	job.starting.Lock()
+	m.mu.Lock()
+	pgid := job.pgid
+	if job.liveProcesses() == 0 {
+		// The previous process group is gone
+		pgid = 0
+	}
+	foreground := job.foreground
+	m.mu.Unlock()
+
+	cmd, pgid, err := startProcess(newCmd, pgid, m.terminal, foreground)
+	if err != nil {
+		job.starting.Unlock()
+		fmt.Fprintf(hc.Stderr, "%v\n", err)
+		return interp.NewExitStatus(127)
+	}
+	p := &process{cmd: cmd, pid: cmd.Process.Pid}
+
+	m.mu.Lock()
+	job.pgid = pgid
+	job.processes = append(job.processes, p)
+	m.markStarted(job)
+	m.mu.Unlock()
+	job.starting.Unlock()
+	go m.monitor(job, p)
+
+	stop := context.AfterFunc(ctx, func() {
+		m.signalProcess(p, syscall.SIGINT)
+		time.AfterFunc(killTimeout, func() { m.signalProcess(p, syscall.SIGKILL) })
+	})
+	defer stop()
+
+	m.mu.Lock()
+	for !p.exited && !(p.stopped && !job.subshell) {
+		m.changed.Wait()
+	}
+	if !p.exited {
+		m.stopForeground(job, hc.Stderr)
+		m.mu.Unlock()
+		m.takeTerminal()
+		return interp.NewExitStatus(uint8(stoppedStatus))
+	}
+	reclaim := job.foreground && job.liveProcesses() == 0
+	m.mu.Unlock()
+	if reclaim {
+		m.takeTerminal()
+	}
+
+	if p.signal != 0 && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if p.signal == syscall.SIGINT && foreground {
+		// The process got Ctrl-C in place of the shell, which owns the
+		// terminal again now, and the rest of the command line doesn't run
+		// once the shell cancels it
+		signals.Deliver(os.Interrupt)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interruptTimeout):
+		}
+	}
+	return interp.NewExitStatus(uint8(p.exitCode))
+}
+
+// monitor follows the state of a process until it exits
+func (m *Manager) monitor(job *Job, p *process) {
+	for {
+		event := p.wait()
+
+		m.mu.Lock()
+		p.stopped = event.stopped
+		if event.exited {
+			p.exited = true
+			p.exitCode = event.exitCode
+			p.signal = event.signal
+			if p == job.processes[len(job.processes)-1] {
+				job.signal = event.signal
+				if !job.subshell {
+					job.exitCode = event.exitCode
+				}
+			}
+		}
+		m.changed.Broadcast()
+		m.mu.Unlock()
+
+		if event.exited {
+			return
+		}
+	}
+}
+
+// signalProcess sends sig to p, if it hasn't exited
+func (m *Manager) signalProcess(p *process, sig syscall.Signal) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !p.exited {
+		_ = signalProcess(p.pid, sig)
+	}
+}
+
+// stopForeground adds job, stopped in the foreground, to the job table. The
+// manager's lock must be held.
+func (m *Manager) stopForeground(job *Job, stderr io.Writer) {
+	job.foreground = false
+	if job.reported == Stopped && job.ID != 0 {
+		// Another process of the job already reported it
+		return
+	}
+	if job.ID == 0 {
+		m.add(job)
+	} else {
+		m.sequence++
+		job.sequence = m.sequence
+	}
+	job.reported = Stopped
+	fmt.Fprintf(stderr, "\n%s\n", m.format(job, false))
+}
+
+// Hangup sends SIGHUP to the jobs in the job table, as the shell exits,
+// except those disowned with -h. Stopped jobs are continued, so that they
+// can handle it.
+func (m *Manager) Hangup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.noHangup || job.liveProcesses() == 0 {
+			continue
+		}
+		_ = signalProcess(-job.pgid, syscall.SIGHUP)
+		m.continueJob(job)
+	}
+}
+
+// add adds job to the job table as the current job. The manager's lock must
+// be held.
+func (m *Manager) add(job *Job) {
+	job.ID = 1
+	for _, other := range m.jobs {
+		job.ID = max(job.ID, other.ID+1)
+	}
+	m.sequence++
+	job.sequence = m.sequence
+	m.jobs = append(m.jobs, job)
+}
+
+// remove removes job from the job table. The manager's lock must be held.
+func (m *Manager) remove(job *Job) {
+	for i, other := range m.jobs {
+		if other == job {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// markStarted records that a background job started. The manager's lock must
+// be held.
+func (m *Manager) markStarted(job *Job) {
+	if job.started == nil {
+		return
+	}
+	select {
+	case <-job.started:
+	default:
+		close(job.started)
+	}
+}
+
+// waitJob waits until job is no longer running, or only until it stops if
+// untilStopped is set, and returns its state
+func (m *Manager) waitJob(ctx context.Context, job *Job, untilStopped bool) State {
+	stop := context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.changed.Broadcast()
+	})
+	defer stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ctx.Err() == nil {
+		state := job.state()
+		if state == Done || state == Stopped && untilStopped {
+			return state
+		}
+		m.changed.Wait()
+	}
+	return job.state()
+}
+
+// giveTerminal makes pgid the foreground process group of the terminal
+func (m *Manager) giveTerminal(pgid int) {
+	if m.terminal >= 0 && pgid != 0 {
+		_ = setForeground(m.terminal, pgid)
+	}
+}
+
+// takeTerminal makes the shell the foreground process group of the terminal
+// again
+func (m *Manager) takeTerminal() {
+	if m.terminal >= 0 {
+		_ = setForeground(m.terminal, m.shellPgid)
+	}
+}
+
+// current returns the current (%+) and previous (%-) jobs. The manager's
+// lock must be held.
+func (m *Manager) current() (*Job, *Job) {
+	var current, previous *Job
+	for _, job := range m.jobs {
+		switch {
+		case current == nil || job.sequence > current.sequence:
+			current, previous = job, current
+		case previous == nil || job.sequence > previous.sequence:
+			previous = job
+		}
+	}
+	return current, previous
+}
+
+// findJob returns the job spec refers to: %n, %+ or %% for the current job,
+// %- for the previous one, %name for the job whose command starts with name,
+// or %?text for the one containing text. The manager's lock must be held.
+func (m *Manager) findJob(spec string) (*Job, error) {
+	current, previous := m.current()
+	switch spec {
+	case "", "%", "%%", "%+":
+		if current == nil {
+			return nil, fmt.Errorf("%s: no current job", specName(spec))
+		}
+		return current, nil
+	case "%-":
+		if previous == nil {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		return previous, nil
+	}
+
+	name, ok := strings.CutPrefix(spec, "%")
+	if !ok {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	var matches []*Job
+	for _, job := range m.jobs {
+		if fmt.Sprint(job.ID) == name {
+			return job, nil
+		}
+		if text, ok := strings.CutPrefix(name, "?"); ok && strings.Contains(job.Command, text) ||
+			!strings.HasPrefix(name, "?") && strings.HasPrefix(job.Command, name) {
+			matches = append(matches, job)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%s: no such job", spec)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+	}
+}
+
+func specName(spec string) string {
+	if spec == "" {
+		return "current"
+	}
+	return spec
+}
+
+// format returns the line the jobs builtin shows for job, with its process
+// group ID if long is set. The manager's lock must be held.
+func (m *Manager) format(job *Job, long bool) string {
+	command := job.Command
+	if job.state() == Running && !job.foreground {
+		command += " &"
+	}
+	if long {
+		return fmt.Sprintf("[%d]%s %d %-24s%s", job.ID, m.mark(job), job.pgid, job.status(), command)
+	}
+	return fmt.Sprintf("[%d]%s  %-24s%s", job.ID, m.mark(job), job.status(), command)
+}
+
+// mark returns + for the current job, - for the previous one, and a space
+// for the others. The manager's lock must be held.
+func (m *Manager) mark(job *Job) string {
+	current, previous := m.current()
+	switch job {
+	case current:
+		return "+"
+	case previous:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Notify reports the jobs that finished or were stopped since they were
+// last reported, and removes the finished ones from the job table. It's
+// called before the prompt is shown.
+func (m *Manager) Notify() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var done []*Job
+	for _, job := range m.jobs {
+		switch state := job.state(); {
+		case state == Done:
+			fmt.Fprintln(m.Stderr, m.format(job, false))
+			done = append(done, job)
+		case state != job.reported:
+			if state == Stopped {
+				fmt.Fprintln(m.Stderr, m.format(job, false))
+			}
+			job.reported = state
+		}
+	}
+	for _, job := range done {
+		m.remove(job)
+	}
+}
+
+// Count returns the number of jobs in the job table
+func (m *Manager) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.jobs)
+}
+
+// Names returns the command names of the jobs in the job table, or of only
+// the "running" or "stopped" ones
+func (m *Manager) Names(state string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for _, job := range m.jobs {
+		if state == "running" && job.state() != Running || state == "stopped" && job.state() != Stopped {
+			continue
+		}
+		if fields := strings.Fields(job.Command); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandText returns stmt as it's shown in the job table
+func commandText(stmt *syntax.Stmt) string {
+	foreground := *stmt
+	foreground.Background = false
+	foreground.Semicolon = syntax.Pos{}
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter(syntax.SingleLine(true)).Print(&buf, &foreground); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// execEnv returns the exported variables of env, for the environment of a
+// process, as the interpreter does
+func execEnv(env expand.Environ) []string {
+	var list []string
+	env.Each(func(name string, vr expand.Variable) bool {
+		if !vr.IsSet() {
+			// Variables unset in the shell replace those of its environment
+			list = slices.DeleteFunc(list, func(kv string) bool { return strings.HasPrefix(kv, name+"=") })
+		}
+		if vr.Exported && vr.Kind == expand.String {
+			list = append(list, name+"="+vr.String())
+		}
+		return true
+	})
+	return list
+}
+
+// exitCode returns the exit status of a command that returned err
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if status, ok := interp.IsExitStatus(err); ok {
+		return int(status)
+	}
+	return 1
+}
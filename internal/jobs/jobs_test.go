@@ -0,0 +1,309 @@
+//go:build unix
+
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/signals"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// syncBuffer is a buffer that background jobs can write to
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+// take returns and clears what was written
+func (b *syncBuffer) take() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	defer b.buffer.Reset()
+	return b.buffer.String()
+}
+
+// shell runs command lines as the interactive shell does, with the output of
+// the jobs builtins and job announcements in stdout and stderr
+type shell struct {
+	t       *testing.T
+	manager *Manager
+	runner  *interp.Runner
+	stdout  syncBuffer
+	stderr  syncBuffer
+}
+
+func newShell(t *testing.T) *shell {
+	t.Helper()
+	s := &shell{t: t, manager: newManager(-1)}
+	s.manager.Stderr = &s.stderr
+	runner, err := interp.New(
+		interp.StdIO(nil, &s.stdout, &s.stderr),
+		interp.ExecHandlers(NewJobCommandHandler(s.manager)),
+		interp.CallHandler(NewJobCallHandler(s.manager)),
+	)
+	require.NoError(t, err)
+	s.runner = runner
+	t.Cleanup(func() {
+		// Leave no processes behind
+		_ = s.run("kill -KILL %1 %2 %3")
+	})
+	return s
+}
+
+// run runs line and returns its exit status
+func (s *shell) run(line string) int {
+	s.t.Helper()
+	var stmt *syntax.Stmt
+	err := syntax.NewParser().Stmts(strings.NewReader(line), func(st *syntax.Stmt) bool {
+		stmt = st
+		return false
+	})
+	require.NoError(s.t, err)
+	return exitCode(s.manager.Run(context.Background(), s.runner, stmt))
+}
+
+// output returns and clears what was printed
+func (s *shell) output() string {
+	return s.stdout.take() + s.stderr.take()
+}
+
+// waitFor waits until the job has the state
+func (s *shell) waitFor(id int, state State) {
+	s.t.Helper()
+	assert.Eventually(s.t, func() bool {
+		s.manager.mu.Lock()
+		defer s.manager.mu.Unlock()
+		job, err := s.manager.findJob("%" + strconv.Itoa(id))
+		return err == nil && job.state() == state
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBackgroundJobs(t *testing.T) {
+	s := newShell(t)
+
+	assert.Equal(t, 0, s.run("sleep 0.2 &"))
+	assert.Regexp(t, `^\[1\] \d+\n$`, s.output())
+	assert.Equal(t, 1, s.manager.Count())
+	assert.Equal(t, []string{"sleep"}, s.manager.Names(""))
+	assert.Equal(t, []string{"sleep"}, s.manager.Names("running"))
+	assert.Empty(t, s.manager.Names("stopped"))
+
+	s.run("jobs")
+	assert.Equal(t, "[1]+  Running                 sleep 0.2 &\n", s.output())
+
+	s.waitFor(1, Done)
+	s.manager.Notify()
+	assert.Equal(t, "[1]+  Done                    sleep 0.2\n", s.output())
+	assert.Equal(t, 0, s.manager.Count())
+
+	t.Run("exit status", func(t *testing.T) {
+		s.run("sh -c 'exit 3' &")
+		s.output()
+		s.waitFor(1, Done)
+		s.manager.Notify()
+		assert.Equal(t, "[1]+  Exit 3                  sh -c 'exit 3'\n", s.output())
+	})
+
+	t.Run("builtins", func(t *testing.T) {
+		s.run("{ echo hello; } &")
+		s.waitFor(1, Done)
+		s.manager.Notify()
+		assert.Equal(t, "hello\n[1]\n[1]+  Done                    { echo hello; }\n", s.output())
+	})
+
+	t.Run("commands outside the prompt", func(t *testing.T) {
+		// Without job control, processes run as they would without a job table
+		file, err := syntax.NewParser().Parse(strings.NewReader("x=$(/bin/echo hi | tr a-z A-Z); echo $x"), "")
+		require.NoError(t, err)
+		require.NoError(t, s.runner.Run(context.Background(), file))
+		assert.Equal(t, "HI\n", s.output())
+		assert.Equal(t, 0, s.manager.Count())
+	})
+
+	t.Run("output of processes", func(t *testing.T) {
+		s.run("x=$(/bin/echo hi | tr a-z A-Z)")
+		s.run("echo $x")
+		assert.Equal(t, "HI\n", s.output())
+	})
+}
+
+func TestStoppedJobs(t *testing.T) {
+	s := newShell(t)
+
+	// The process stops itself, as Ctrl-Z would
+	assert.Equal(t, stoppedStatus, s.run("sh -c 'kill -STOP $$; exit 5'"))
+	assert.Equal(t, "\n[1]+  Stopped                 sh -c 'kill -STOP $$; exit 5'\n", s.output())
+	assert.Equal(t, []string{"sh"}, s.manager.Names("stopped"))
+
+	// It isn't reported again before the prompt
+	s.manager.Notify()
+	assert.Empty(t, s.output())
+
+	assert.Equal(t, 5, s.run("fg"))
+	assert.Equal(t, "sh -c 'kill -STOP $$; exit 5'\n", s.output())
+	assert.Equal(t, 0, s.manager.Count())
+
+	t.Run("bg", func(t *testing.T) {
+		s.run("sh -c 'kill -STOP $$; exit 0'")
+		s.output()
+		assert.Equal(t, 0, s.run("bg %1"))
+		assert.Equal(t, "[1]+ sh -c 'kill -STOP $$; exit 0' &\n", s.output())
+		s.waitFor(1, Done)
+
+		assert.Equal(t, 0, s.run("bg"))
+		assert.Equal(t, "bg: job 1 already in background\n", s.output())
+		s.manager.Notify()
+		s.output()
+	})
+
+	t.Run("rest of the command line", func(t *testing.T) {
+		s.run("sh -c 'kill -STOP $$' || echo $?")
+		assert.Contains(t, s.output(), "148\n")
+		assert.Equal(t, 0, s.run("kill %1"))
+		s.waitFor(1, Done)
+		s.manager.Notify()
+		assert.Equal(t, "[1]+  Terminated              sh -c 'kill -STOP $$' || echo $?\n", s.output())
+	})
+}
+
+func TestJobBuiltins(t *testing.T) {
+	s := newShell(t)
+	s.run("sleep 10 &")
+	s.run("sleep 20 &")
+	s.run("sh -c 'exit 7' &")
+	s.output()
+
+	t.Run("jobs", func(t *testing.T) {
+		s.run("jobs %1 %-")
+		assert.Equal(t, "[1]   Running                 sleep 10 &\n[2]-  Running                 sleep 20 &\n", s.output())
+		s.run("jobs -p %sleep\\ 2")
+		assert.Regexp(t, `^\d+\n$`, s.output())
+		assert.Equal(t, 1, s.run("jobs %4"))
+		assert.Equal(t, "jobs: %4: no such job\n", s.output())
+		assert.Equal(t, 2, s.run("jobs -x"))
+		assert.Equal(t, "jobs: -x: invalid option\n", s.output())
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		assert.Equal(t, 7, s.run("wait %3"))
+		assert.Equal(t, 2, s.manager.Count())
+		assert.Equal(t, 127, s.run("wait 1"))
+		assert.Equal(t, "wait: pid 1 is not a child of this shell\n", s.output())
+	})
+
+	t.Run("kill", func(t *testing.T) {
+		assert.Equal(t, 0, s.run("kill -s KILL %?20"))
+		assert.Equal(t, 128+9, s.run("wait %2"))
+		assert.Equal(t, 1, s.run("kill %sl %nope"))
+		assert.Equal(t, "kill: %nope: no such job\n", s.output())
+	})
+
+	t.Run("disown", func(t *testing.T) {
+		assert.Equal(t, 0, s.run("disown -h"))
+		assert.Equal(t, 1, s.manager.Count())
+		assert.Equal(t, 0, s.run("disown %1"))
+		assert.Equal(t, 0, s.manager.Count())
+		assert.Equal(t, 1, s.run("fg"))
+		assert.Equal(t, "fg: current: no current job\n", s.output())
+	})
+}
+
+func TestHangup(t *testing.T) {
+	s := newShell(t)
+	s.run("sleep 10 &")
+	s.run("sleep 10 &")
+	s.run("disown -h %2")
+	s.run("sh -c 'kill -STOP $$'")
+	s.output()
+
+	s.manager.Hangup()
+	assert.Equal(t, 128+1, s.run("wait %1"))
+	// Stopped jobs are continued to get the signal
+	assert.Equal(t, 128+1, s.run("wait %3"))
+	assert.Equal(t, []string{"sleep"}, s.manager.Names("running"))
+}
+
+func TestPipelineProcessGroup(t *testing.T) {
+	s := newShell(t)
+	// The processes of a pipeline start concurrently, and must all join the
+	// process group of the first
+	for i := 0; i < 30; i++ {
+		s.run("echo | sh -c 'ps -o pgid= -p $$; cat' | sh -c 'cat; ps -o pgid= -p $$'")
+		pgids := strings.Fields(s.output())
+		require.Len(t, pgids, 2)
+		assert.Equal(t, pgids[0], pgids[1])
+		assert.NotEqual(t, strconv.Itoa(processGroup()), pgids[0])
+	}
+}
+
+func TestInterruptedProcess(t *testing.T) {
+	s := newShell(t)
+	interrupts := make(chan os.Signal, 1)
+	signals.Notify(interrupts, os.Interrupt)
+	defer signals.Stop(interrupts)
+
+	// The shell hears of Ctrl-C sent to a process in the foreground
+	assert.Equal(t, 128+2, s.run("sh -c 'kill -INT $$'"))
+	select {
+	case sig := <-interrupts:
+		assert.Equal(t, os.Interrupt, sig)
+	case <-time.After(time.Second):
+		t.Fatal("the interrupt wasn't delivered")
+	}
+
+	s.run("sh -c 'kill -INT $$' &")
+	s.waitFor(1, Done)
+	assert.Empty(t, interrupts)
+}
+
+func TestFindJob(t *testing.T) {
+	m := newManager(-1)
+	for _, command := range []string{"sleep 10", "vim notes.txt", "sleep 20"} {
+		m.add(&Job{Command: command})
+	}
+
+	tests := []struct {
+		spec     string
+		expected int
+		err      string
+	}{
+		{"", 3, ""},
+		{"%%", 3, ""},
+		{"%+", 3, ""},
+		{"%-", 2, ""},
+		{"%1", 1, ""},
+		{"%vim", 2, ""},
+		{"%?notes", 2, ""},
+		{"%sleep", 0, "%sleep: ambiguous job spec"},
+		{"%4", 0, "%4: no such job"},
+		{"1", 0, "1: no such job"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			job, err := m.findJob(tt.spec)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, job.ID)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+//go:build !unix
+
+package jobs
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Processes can't be stopped, so there's no status for it, nor a signal to
+// continue them
+const (
+	stoppedStatus  = 128 + 20
+	continueSignal = syscall.Signal(0x12)
+)
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// controllingTerminal returns -1, as the shell can't hand the terminal to
+// processes
+func controllingTerminal() int {
+	return -1
+}
+
+func processGroup() int {
+	return 0
+}
+
+// IgnoreTerminalStop does nothing, as there's no Ctrl-Z
+func IgnoreTerminalStop() {}
+
+// startProcess starts the command made by newCmd. There are no process
+// groups, so the process is its own.
+func startProcess(newCmd func() *exec.Cmd, pgid int, terminal int, foreground bool) (*exec.Cmd, int, error) {
+	cmd := newCmd()
+	if err := cmd.Start(); err != nil {
+		return nil, 0, err
+	}
+	return cmd, cmd.Process.Pid, nil
+}
+
+// wait blocks until the process exits
+func (p *process) wait() processEvent {
+	_ = p.cmd.Wait()
+	if p.cmd.ProcessState == nil {
+		return processEvent{exited: true, exitCode: 1}
+	}
+	return processEvent{exited: true, exitCode: p.cmd.ProcessState.ExitCode()}
+}
+
+// signalProcess kills the process pid, the only signal that can be sent
+func signalProcess(pid int, sig syscall.Signal) error {
+	if sig != syscall.SIGKILL {
+		return errors.New("unsupported signal")
+	}
+	process, err := os.FindProcess(max(pid, -pid))
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+func setForeground(terminal int, pgid int) error {
+	return nil
+}
+
+// parseSignal parses a signal number, or a name such as TERM or SIGTERM
+func parseSignal(s string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return syscall.Signal(n), n >= 0
+	}
+	sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(s), "SIG")]
+	return sig, ok
+}
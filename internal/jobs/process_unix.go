@@ -0,0 +1,131 @@
+//go:build unix
+
+package jobs
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// stoppedStatus is the exit status of a command stopped from the terminal
+const stoppedStatus = 128 + int(syscall.SIGTSTP)
+
+const continueSignal = syscall.SIGCONT
+
+// controllingTerminal returns the terminal the shell reads commands from, or
+// -1 if it isn't run from one
+func controllingTerminal() int {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return -1
+	}
+	return fd
+}
+
+func processGroup() int {
+	return syscall.Getpgrp()
+}
+
+// IgnoreTerminalStop keeps the shell from being stopped by Ctrl-Z while it
+// runs builtins in the foreground. The processes it starts can still be
+// stopped.
+func IgnoreTerminalStop() {
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTSTP)
+}
+
+// startProcess starts the command made by newCmd in the process group pgid,
+// or in a new one if pgid is 0, and returns it with its process group. In the
+// foreground, the process group is given the terminal.
+func startProcess(newCmd func() *exec.Cmd, pgid int, terminal int, foreground bool) (*exec.Cmd, int, error) {
+	start := func(pgid int) (*exec.Cmd, error) {
+		cmd := newCmd()
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pgid}
+		if foreground && terminal >= 0 {
+			cmd.SysProcAttr.Foreground = true
+			cmd.SysProcAttr.Ctty = terminal
+		}
+		return cmd, cmd.Start()
+	}
+
+	cmd, err := start(pgid)
+	if errors.Is(err, syscall.EPERM) && pgid != 0 {
+		// The rest of the group exited while the process was started
+		pgid = 0
+		cmd, err = start(pgid)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if pgid == 0 {
+		pgid = cmd.Process.Pid
+	}
+	return cmd, pgid, nil
+}
+
+// wait blocks until the process stops, continues or exits
+func (p *process) wait() processEvent {
+	var status syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(p.pid, &status, syscall.WUNTRACED|syscall.WCONTINUED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		switch {
+		case err != nil:
+			p.release()
+			return processEvent{exited: true, exitCode: 1}
+		case status.Stopped():
+			return processEvent{stopped: true}
+		case status.Continued():
+			return processEvent{}
+		case status.Signaled():
+			p.release()
+			return processEvent{exited: true, exitCode: 128 + int(status.Signal()), signal: status.Signal()}
+		default:
+			p.release()
+			return processEvent{exited: true, exitCode: status.ExitStatus()}
+		}
+	}
+}
+
+// release finishes copying the input and output of the process once it
+// exited. The process was waited for already, so Wait only returns an error.
+func (p *process) release() {
+	_ = p.cmd.Process.Release()
+	_ = p.cmd.Wait()
+}
+
+// signalProcess sends sig to the process pid, or to the process group -pid
+func signalProcess(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
+
+// setForeground makes pgid the foreground process group of terminal
+func setForeground(terminal int, pgid int) error {
+	// The shell would be stopped for taking the terminal back from the
+	// background, unless it ignores SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	return unix.IoctlSetPointerInt(terminal, unix.TIOCSPGRP, pgid)
+}
+
+// parseSignal parses a signal number, or a name such as TERM or SIGTERM
+func parseSignal(s string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return syscall.Signal(n), n >= 0
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	return sig, sig != 0
+}
@@ -0,0 +1,153 @@
+package predict
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const DEFAULT_PREDICTION_CACHE_SIZE = 256
+
+type predictionCacheEntry struct {
+	contextHash  string
+	input        string
+	predictions  []string // Ranked, best first
+	inputContext string
+}
+
+// PredictionCache remembers predictions keyed by input prefix and a hash of the
+// context they were made with. A prediction is reused for any longer input that
+// the prediction still starts with, so continuing to type along a suggestion
+// never needs another LLM call.
+type PredictionCache struct {
+	mu         sync.Mutex
+	entries    []predictionCacheEntry // Least recently used first
+	maxEntries int
+}
+
+func NewPredictionCache(maxEntries int) *PredictionCache {
+	if maxEntries <= 0 {
+		maxEntries = DEFAULT_PREDICTION_CACHE_SIZE
+	}
+	return &PredictionCache{maxEntries: maxEntries}
+}
+
+// Get returns a cached prediction usable for input under the given context
+func (c *PredictionCache) Get(contextHash string, input string) (string, string, bool) {
+	predictions, inputContext, ok := c.GetCandidates(contextHash, input)
+	if !ok {
+		return "", "", false
+	}
+	return predictions[0], inputContext, true
+}
+
+// GetCandidates returns the cached ranked predictions usable for input under the
+// given context, dropping those that input has diverged from
+func (c *PredictionCache) GetCandidates(contextHash string, input string) ([]string, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bestIndex := -1
+	var bestPredictions []string
+	for i, entry := range c.entries {
+		if entry.contextHash != contextHash || !strings.HasPrefix(input, entry.input) {
+			continue
+		}
+
+		var usable []string
+		for _, prediction := range entry.predictions {
+			if entry.input == input || strings.HasPrefix(prediction, input) {
+				usable = append(usable, prediction)
+			}
+		}
+		if len(usable) == 0 {
+			continue
+		}
+
+		// Prefer the entry made with the most specific input
+		if bestIndex == -1 || len(entry.input) > len(c.entries[bestIndex].input) {
+			bestIndex = i
+			bestPredictions = usable
+		}
+	}
+
+	if bestIndex == -1 {
+		return nil, "", false
+	}
+
+	inputContext := c.entries[bestIndex].inputContext
+	c.touch(bestIndex)
+	return bestPredictions, inputContext, true
+}
+
+// Put stores a prediction made for input under the given context
+func (c *PredictionCache) Put(contextHash string, input string, prediction string, inputContext string) {
+	c.PutCandidates(contextHash, input, []string{prediction}, inputContext)
+}
+
+// PutCandidates stores ranked predictions made for input under the given context
+func (c *PredictionCache) PutCandidates(contextHash string, input string, predictions []string, inputContext string) {
+	if len(predictions) == 0 || predictions[0] == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, entry := range c.entries {
+		if entry.contextHash == contextHash && entry.input == input {
+			c.entries[i].predictions = predictions
+			c.entries[i].inputContext = inputContext
+			c.touch(i)
+			return
+		}
+	}
+
+	if len(c.entries) >= c.maxEntries {
+		c.entries = c.entries[1:]
+	}
+	c.entries = append(c.entries, predictionCacheEntry{
+		contextHash:  contextHash,
+		input:        input,
+		predictions:  predictions,
+		inputContext: inputContext,
+	})
+}
+
+// Len returns the number of cached predictions
+func (c *PredictionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// touch moves the entry at index i to the most recently used position
+func (c *PredictionCache) touch(i int) {
+	entry := c.entries[i]
+	c.entries = append(c.entries[:i], c.entries[i+1:]...)
+	c.entries = append(c.entries, entry)
+}
+
+// HashContext returns a stable hash of the RAG context used for a prediction
+func HashContext(context *map[string]string) string {
+	if context == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(*context))
+	for key := range *context {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte((*context)[key]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
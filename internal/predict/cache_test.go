@@ -0,0 +1,111 @@
+package predict
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredictionCache(t *testing.T) {
+	t.Run("exact match", func(t *testing.T) {
+		cache := NewPredictionCache(10)
+		cache.Put("ctx", "git", "git status", "prompt")
+
+		prediction, inputContext, ok := cache.Get("ctx", "git")
+		assert.True(t, ok)
+		assert.Equal(t, "git status", prediction)
+		assert.Equal(t, "prompt", inputContext)
+	})
+
+	t.Run("continuing to type along a prediction reuses it", func(t *testing.T) {
+		cache := NewPredictionCache(10)
+		cache.Put("ctx", "git", "git status", "prompt")
+
+		prediction, _, ok := cache.Get("ctx", "git st")
+		assert.True(t, ok)
+		assert.Equal(t, "git status", prediction)
+
+		_, _, ok = cache.Get("ctx", "git co")
+		assert.False(t, ok, "input diverging from the prediction should miss")
+
+		_, _, ok = cache.Get("ctx", "gi")
+		assert.False(t, ok, "shorter input than the cached prefix should miss")
+	})
+
+	t.Run("context hash must match", func(t *testing.T) {
+		cache := NewPredictionCache(10)
+		cache.Put("ctx1", "git", "git status", "prompt")
+
+		_, _, ok := cache.Get("ctx2", "git")
+		assert.False(t, ok)
+	})
+
+	t.Run("most specific prefix wins", func(t *testing.T) {
+		cache := NewPredictionCache(10)
+		cache.Put("ctx", "git", "git commit -m 'wip'", "a")
+		cache.Put("ctx", "git commit", "git commit --amend", "b")
+
+		prediction, _, ok := cache.Get("ctx", "git commit")
+		assert.True(t, ok)
+		assert.Equal(t, "git commit --amend", prediction)
+
+		prediction, _, ok = cache.Get("ctx", "git commit -")
+		assert.True(t, ok)
+		assert.Equal(t, "git commit --amend", prediction)
+	})
+
+	t.Run("empty predictions are not cached", func(t *testing.T) {
+		cache := NewPredictionCache(10)
+		cache.Put("ctx", "git", "", "prompt")
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		cache := NewPredictionCache(3)
+		for i := 0; i < 3; i++ {
+			cache.Put("ctx", fmt.Sprintf("cmd%d", i), fmt.Sprintf("cmd%d --flag", i), "")
+		}
+
+		// Touch the oldest entry so the next one is evicted instead
+		_, _, ok := cache.Get("ctx", "cmd0")
+		assert.True(t, ok)
+
+		cache.Put("ctx", "cmd3", "cmd3 --flag", "")
+		assert.Equal(t, 3, cache.Len())
+
+		_, _, ok = cache.Get("ctx", "cmd0")
+		assert.True(t, ok)
+		_, _, ok = cache.Get("ctx", "cmd1")
+		assert.False(t, ok)
+	})
+}
+
+func TestHashContext(t *testing.T) {
+	a := map[string]string{"git_status": "clean", "working_directory": "/tmp"}
+	b := map[string]string{"working_directory": "/tmp", "git_status": "clean"}
+	c := map[string]string{"working_directory": "/home", "git_status": "clean"}
+
+	assert.Equal(t, HashContext(&a), HashContext(&b))
+	assert.NotEqual(t, HashContext(&a), HashContext(&c))
+	assert.Equal(t, "", HashContext(nil))
+}
+
+func TestPredictionCacheCandidates(t *testing.T) {
+	cache := NewPredictionCache(10)
+	cache.PutCandidates("ctx", "git", []string{"git status", "git stash", "git log"}, "prompt")
+
+	predictions, inputContext, ok := cache.GetCandidates("ctx", "git")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"git status", "git stash", "git log"}, predictions)
+	assert.Equal(t, "prompt", inputContext)
+
+	predictions, _, ok = cache.GetCandidates("ctx", "git sta")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"git status", "git stash"}, predictions)
+
+	// Typing along an alternative still hits the cache
+	prediction, _, ok := cache.Get("ctx", "git l")
+	assert.True(t, ok)
+	assert.Equal(t, "git log", prediction)
+}
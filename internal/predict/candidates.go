@@ -0,0 +1,197 @@
+package predict
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+const (
+	// Maximum number of ranked predictions offered for cycling
+	MAX_PREDICTION_CANDIDATES = 5
+
+	// Number of history entries considered for history candidates
+	historyCandidateLookback = 50
+)
+
+// Additional candidate sources merged with the primary prediction
+const (
+	PREDICTION_SOURCE_HISTORY    = "history"
+	PREDICTION_SOURCE_COMPLETION = "completion"
+)
+
+// Weight of each source when merging ranked candidates
+var candidateSourceWeights = map[string]float64{
+	PREDICTION_SOURCE_LLM:        3,
+	PREDICTION_SOURCE_CACHE:      3,
+	PREDICTION_SOURCE_PREFETCH:   3,
+	PREDICTION_SOURCE_LOCAL:      2.5,
+	PREDICTION_SOURCE_HISTORY:    2,
+	PREDICTION_SOURCE_COMPLETION: 1,
+}
+
+// Labels shown to the user for each source
+var candidateSourceLabels = map[string]string{
+	PREDICTION_SOURCE_LLM:        "LLM",
+	PREDICTION_SOURCE_CACHE:      "LLM (cached)",
+	PREDICTION_SOURCE_PREFETCH:   "LLM (prefetched)",
+	PREDICTION_SOURCE_LOCAL:      "local model",
+	PREDICTION_SOURCE_HISTORY:    "history",
+	PREDICTION_SOURCE_COMPLETION: "completion",
+}
+
+// CompletionProvider is the subset of the shell completion provider used for
+// predictions. Predictions run in the background, so only completions that
+// don't use the shell's runner are asked for.
+type CompletionProvider interface {
+	GetPredictionCompletions(line string) []shellinput.CompletionCandidate
+}
+
+// rankedList is an ordered list of candidates from a single source, best first
+type rankedList struct {
+	source   string
+	commands []string
+}
+
+// PredictCandidates returns a ranked list of predictions for input, merging the
+// LLM's predictions with recent history entries and completion matches
+func (p *PredictRouter) PredictCandidates(input string) ([]gline.PredictionCandidate, string, error) {
+	if strings.HasPrefix(input, "#") || strings.HasPrefix(input, "@") {
+		// Don't do prediction for agent chat messages
+		return nil, "", nil
+	}
+
+	lists := []rankedList{}
+	predictions, source, inputContext, err := p.predict(input)
+	if err == nil {
+		lists = append(lists, rankedList{source: source, commands: predictions})
+	}
+
+	lists = append(lists,
+		rankedList{source: PREDICTION_SOURCE_HISTORY, commands: p.historyCandidates(input)},
+		rankedList{source: PREDICTION_SOURCE_COMPLETION, commands: p.completionCandidates(input)},
+	)
+
+	candidates := mergeCandidates(input, lists)
+	if err != nil {
+		if len(candidates) == 0 {
+			return nil, inputContext, err
+		}
+		if p.Logger != nil {
+			p.Logger.Debug("prediction failed, offering other candidates", zap.Error(err))
+		}
+	}
+	return candidates, inputContext, nil
+}
+
+// historyCandidates returns distinct recent commands starting with input, most recent first
+func (p *PredictRouter) historyCandidates(input string) []string {
+	if p.HistoryManager == nil {
+		return nil
+	}
+
+	entries, err := p.HistoryManager.GetRecentEntriesByPrefix(input, historyCandidateLookback)
+	if err != nil {
+		if p.Logger != nil {
+			p.Logger.Debug("failed to load history candidates", zap.Error(err))
+		}
+		return nil
+	}
+
+	commands := []string{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		command := strings.TrimSpace(entry.Command)
+		if command == "" || strings.Contains(command, "\n") || seen[command] {
+			continue
+		}
+		seen[command] = true
+		commands = append(commands, command)
+		if len(commands) == MAX_PREDICTION_CANDIDATES {
+			break
+		}
+	}
+	return commands
+}
+
+// completionCandidates returns full command lines built from completions of the last word of input
+func (p *PredictRouter) completionCandidates(input string) []string {
+	if p.CompletionProvider == nil || strings.TrimSpace(input) == "" {
+		return nil
+	}
+
+	wordStart := strings.LastIndexAny(input, " \t") + 1
+	commands := []string{}
+	for _, completion := range p.CompletionProvider.GetPredictionCompletions(input) {
+		// Some completions are full lines, others only replace the word being completed
+		command := completion.Value
+		if !strings.HasPrefix(command, input) {
+			command = input[:wordStart] + completion.Value
+		}
+		if !strings.HasPrefix(command, input) {
+			continue
+		}
+		commands = append(commands, command)
+		if len(commands) == MAX_PREDICTION_CANDIDATES {
+			break
+		}
+	}
+	return commands
+}
+
+// mergeCandidates ranks commands from all lists by a weighted reciprocal rank, so a
+// command suggested by several sources rises above one suggested by a single source
+func mergeCandidates(input string, lists []rankedList) []gline.PredictionCandidate {
+	type scored struct {
+		command string
+		score   float64
+		sources []string
+		order   int
+	}
+
+	byCommand := map[string]*scored{}
+	all := []*scored{}
+	for _, list := range lists {
+		for rank, command := range list.commands {
+			if command == "" || command == input || !strings.HasPrefix(command, input) {
+				continue
+			}
+
+			candidate, ok := byCommand[command]
+			if !ok {
+				candidate = &scored{command: command, order: len(all)}
+				byCommand[command] = candidate
+				all = append(all, candidate)
+			}
+			candidate.score += candidateSourceWeights[list.source] / float64(rank+1)
+
+			label := candidateSourceLabels[list.source]
+			if !lo.Contains(candidate.sources, label) {
+				candidate.sources = append(candidate.sources, label)
+			}
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].order < all[j].order
+	})
+
+	candidates := []gline.PredictionCandidate{}
+	for _, candidate := range all {
+		candidates = append(candidates, gline.PredictionCandidate{
+			Command: candidate.command,
+			Source:  strings.Join(candidate.sources, ", "),
+		})
+		if len(candidates) == MAX_PREDICTION_CANDIDATES {
+			break
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,75 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/atinylittleshell/gsh/internal/history"
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticCompletionProvider struct {
+	completions []string
+}
+
+func (p staticCompletionProvider) GetPredictionCompletions(line string) []shellinput.CompletionCandidate {
+	return shellinput.NewCompletionCandidates(p.completions)
+}
+
+func TestMergeCandidates(t *testing.T) {
+	t.Run("ranks by source weight and agreement", func(t *testing.T) {
+		candidates := mergeCandidates("git ", []rankedList{
+			{source: PREDICTION_SOURCE_LLM, commands: []string{"git status", "git log"}},
+			{source: PREDICTION_SOURCE_HISTORY, commands: []string{"git log", "git push"}},
+			{source: PREDICTION_SOURCE_COMPLETION, commands: []string{"git stash"}},
+		})
+
+		assert.Equal(t, []gline.PredictionCandidate{
+			{Command: "git log", Source: "LLM, history"},
+			{Command: "git status", Source: "LLM"},
+			{Command: "git push", Source: "history"},
+			{Command: "git stash", Source: "completion"},
+		}, candidates)
+	})
+
+	t.Run("drops candidates that don't extend the input", func(t *testing.T) {
+		candidates := mergeCandidates("ls", []rankedList{
+			{source: PREDICTION_SOURCE_LLM, commands: []string{"ls", "cat README.md", "ls -la"}},
+		})
+
+		assert.Equal(t, []gline.PredictionCandidate{{Command: "ls -la", Source: "LLM"}}, candidates)
+	})
+
+	t.Run("caps the number of candidates", func(t *testing.T) {
+		candidates := mergeCandidates("", []rankedList{
+			{source: PREDICTION_SOURCE_HISTORY, commands: []string{"a", "b", "c", "d", "e", "f", "g"}},
+		})
+
+		assert.Len(t, candidates, MAX_PREDICTION_CANDIDATES)
+	})
+}
+
+func TestHistoryCandidates(t *testing.T) {
+	historyManager, err := history.NewHistoryManager(":memory:")
+	require.NoError(t, err)
+	for _, command := range []string{"git push", "git status", "ls", "git status"} {
+		_, err := historyManager.StartCommand(command, "/work")
+		require.NoError(t, err)
+	}
+
+	router := &PredictRouter{HistoryManager: historyManager}
+	commands := router.historyCandidates("git")
+	assert.ElementsMatch(t, []string{"git status", "git push"}, commands)
+}
+
+func TestCompletionCandidates(t *testing.T) {
+	router := &PredictRouter{CompletionProvider: staticCompletionProvider{
+		completions: []string{"checkout", "cherry-pick", "git commit", "status"},
+	}}
+
+	assert.Equal(t, []string{"git checkout", "git cherry-pick"}, router.completionCandidates("git ch"))
+	assert.Equal(t, []string{"git commit"}, router.completionCandidates("git co"))
+	assert.Nil(t, router.completionCandidates(""))
+}
@@ -4,14 +4,31 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/atinylittleshell/gsh/internal/environment"
 	"github.com/atinylittleshell/gsh/internal/utils"
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/samber/lo"
 	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 	"mvdan.cc/sh/v3/interp"
 )
 
+// CommandDocsRetriever provides local documentation for the programs in a command
+// line. typed is the part of the command line the user typed, as opposed to predicted.
+type CommandDocsRetriever interface {
+	Name() string
+
+	// GetContextForCommand returns the documentation of the flags used, for the LLM
+	GetContextForCommand(command string, typed string) (string, error)
+
+	// DescribeFlags returns the documentation of the flags used, as plain text
+	DescribeFlags(command string, typed string) string
+}
+
+var _ gline.RiskExplainer = (*LLMExplainer)(nil)
+
 type LLMExplainer struct {
 	runner      *interp.Runner
 	llmClient   *openai.Client
@@ -19,6 +36,11 @@ type LLMExplainer struct {
 	logger      *zap.Logger
 	modelId     string
 	temperature *float64
+
+	// CommandDocs grounds explanations in man pages and --help output when
+	// its name is listed in GSH_CONTEXT_TYPES_FOR_EXPLANATION
+	CommandDocs    CommandDocsRetriever
+	useCommandDocs bool
 }
 
 func NewLLMExplainer(
@@ -38,17 +60,76 @@ func NewLLMExplainer(
 
 func (p *LLMExplainer) UpdateContext(context *map[string]string) {
 	contextTypes := environment.GetContextTypesForExplanation(p.runner, p.logger)
+
+	// Command docs depend on the command being explained, so they are fetched in Explain
+	p.useCommandDocs = false
+	if p.CommandDocs != nil {
+		p.useCommandDocs = lo.Contains(contextTypes, p.CommandDocs.Name())
+		contextTypes = lo.Without(contextTypes, p.CommandDocs.Name())
+	}
+
 	p.contextText = utils.ComposeContextText(context, contextTypes, p.logger)
 }
 
 func (e *LLMExplainer) Explain(input string) (string, error) {
+	explanation, _, err := e.ExplainWithRisk(input, "")
+	return explanation, err
+}
+
+// CheckRisk rates a command with the deterministic pre-check only
+func (e *LLMExplainer) CheckRisk(command string) gline.RiskAssessment {
+	return toRiskAssessment(PrecheckCommandRisk(command))
+}
+
+// ExplainWithRisk explains a command along with a risk assessment combining the
+// deterministic pre-check with the LLM's view. When the LLM is unreachable, the
+// pre-check findings and local flag documentation are still returned. typed is
+// the part of input the user typed, as opposed to predicted.
+func (e *LLMExplainer) ExplainWithRisk(input string, typed string) (string, gline.RiskAssessment, error) {
 	if input == "" {
-		return "", nil
+		return "", gline.RiskAssessment{}, nil
 	}
 
+	precheck := PrecheckCommandRisk(input)
+
+	explanation, err := e.explain(input, typed)
+	if err != nil {
+		var fallback []string
+		if e.useCommandDocs {
+			if docs := strings.TrimSpace(e.CommandDocs.DescribeFlags(input, typed)); docs != "" {
+				fallback = append(fallback, docs)
+			}
+		}
+		if riskRank(precheck.Level) > riskRank(RISK_LEVEL_LOW) {
+			fallback = append(fallback, formatRisk(precheck))
+		}
+		if len(fallback) > 0 {
+			e.logger.Debug("LLM explanation failed, showing local information only", zap.Error(err))
+			return strings.Join(fallback, "\n\n"), toRiskAssessment(precheck), nil
+		}
+		return "", gline.RiskAssessment{}, err
+	}
+
+	risk := mergeRisk(precheck, explanation)
+	text := explanation.Explanation
+	if riskRank(risk.Level) > riskRank(RISK_LEVEL_LOW) || risk.NetworkAccess {
+		text = strings.TrimSpace(text + "\n\n" + formatRisk(risk))
+	}
+	return text, toRiskAssessment(risk), nil
+}
+
+func (e *LLMExplainer) explain(input string, typed string) (explainedCommand, error) {
 	schema, err := EXPLAINED_COMMAND_SCHEMA.MarshalJSON()
 	if err != nil {
-		return "", err
+		return explainedCommand{}, err
+	}
+
+	commandDocs := ""
+	if e.useCommandDocs {
+		commandDocs, err = e.CommandDocs.GetContextForCommand(input, typed)
+		if err != nil {
+			e.logger.Debug("error getting command documentation", zap.Error(err))
+		}
 	}
 
 	systemMessage := fmt.Sprintf(`You are gsh, an intelligent shell program.
@@ -58,13 +139,21 @@ You will be given a bash command entered by me, enclosed in <command> tags.
 * Give a concise explanation of what the command will do for me
 * If any uncommon arguments are present in the command, 
   format your explanation in markdown and explain arguments in a bullet point list
+* Assess the risk of running the command: high if it can destroy data, weaken security
+  or cannot be undone, medium if it modifies files or remote state, low otherwise
+* List the paths and resources the command modifies, whether its effects are reversible
+  and whether it accesses the network
+* When documentation for the programs is provided, base your explanation of flags on it
+  and don't describe flags it doesn't mention
 
 # Latest Context
 %s
+%s
 
 # Response JSON Schema
 %s`,
 		e.contextText,
+		commandDocs,
 		string(schema),
 	)
 
@@ -102,7 +191,7 @@ You will be given a bash command entered by me, enclosed in <command> tags.
 	chatCompletion, err := e.llmClient.CreateChatCompletion(context.TODO(), request)
 
 	if err != nil {
-		return "", err
+		return explainedCommand{}, err
 	}
 
 	explanation := explainedCommand{}
@@ -113,5 +202,58 @@ You will be given a bash command entered by me, enclosed in <command> tags.
 		zap.Any("response", explanation),
 	)
 
-	return explanation.Explanation, nil
+	return explanation, nil
+}
+
+// mergeRisk combines the pre-check with the LLM's assessment, keeping the more cautious view
+func mergeRisk(precheck CommandRisk, explanation explainedCommand) CommandRisk {
+	risk := precheck
+	level := strings.ToLower(strings.TrimSpace(explanation.RiskLevel))
+	if riskRank(level) > riskRank(risk.Level) {
+		risk.Level = level
+		risk.Reasons = append(risk.Reasons, "assessed by the model")
+	}
+	for _, resource := range explanation.AffectedResources {
+		if resource != "" && !lo.Contains(risk.AffectedResources, resource) {
+			risk.AffectedResources = append(risk.AffectedResources, resource)
+		}
+	}
+	if riskRank(level) > 0 {
+		// Only trust the model's reversibility when it actually answered
+		risk.Reversible = risk.Reversible && explanation.Reversible
+	}
+	risk.NetworkAccess = risk.NetworkAccess || explanation.NetworkAccess
+	return risk
+}
+
+// formatRisk renders a risk assessment for the explanation box
+func formatRisk(risk CommandRisk) string {
+	var text strings.Builder
+	text.WriteString("Risk: " + strings.ToUpper(risk.Level))
+	if len(risk.Reasons) > 0 {
+		text.WriteString(" (" + strings.Join(risk.Reasons, "; ") + ")")
+	}
+	if len(risk.AffectedResources) > 0 {
+		text.WriteString("\nAffects: " + strings.Join(risk.AffectedResources, ", "))
+	}
+	if !risk.Reversible {
+		text.WriteString("\nReversible: no")
+	}
+	if risk.NetworkAccess {
+		text.WriteString("\nNetwork access: yes")
+	}
+	return text.String()
+}
+
+func toRiskAssessment(risk CommandRisk) gline.RiskAssessment {
+	level := gline.RiskUnknown
+	switch risk.Level {
+	case RISK_LEVEL_LOW:
+		level = gline.RiskLow
+	case RISK_LEVEL_MEDIUM:
+		level = gline.RiskMedium
+	case RISK_LEVEL_HIGH:
+		level = gline.RiskHigh
+	}
+	return gline.RiskAssessment{Level: level, Reasons: risk.Reasons}
 }
@@ -0,0 +1,73 @@
+package predict
+
+import (
+	"context"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+type staticDocsRetriever struct {
+	docs string
+}
+
+func (r staticDocsRetriever) Name() string {
+	return "command_docs"
+}
+
+func (r staticDocsRetriever) GetContextForCommand(command string, typed string) (string, error) {
+	return "<command_docs>\n" + r.docs + "</command_docs>", nil
+}
+
+func (r staticDocsRetriever) DescribeFlags(command string, typed string) string {
+	return r.docs
+}
+
+// newOfflineExplainer returns an explainer whose LLM endpoint refuses connections
+func newOfflineExplainer(t *testing.T, contextTypes string) *LLMExplainer {
+	t.Helper()
+
+	runner, err := interp.New(interp.Env(expand.ListEnviron()))
+	require.NoError(t, err)
+	require.NoError(t, runner.Run(context.Background(), &syntax.File{}))
+	runner.Vars["GSH_FAST_MODEL_BASE_URL"] = expand.Variable{Kind: expand.String, Str: "http://127.0.0.1:1/v1/"}
+	runner.Vars["GSH_CONTEXT_TYPES_FOR_EXPLANATION"] = expand.Variable{Kind: expand.String, Str: contextTypes}
+
+	explainer := NewLLMExplainer(runner, zap.NewNop())
+	explainer.CommandDocs = staticDocsRetriever{docs: "rm - remove files or directories\n  -r, -R, --recursive\n"}
+	explainer.UpdateContext(&map[string]string{"working_directory": "<working_dir>/tmp</working_dir>"})
+	return explainer
+}
+
+func TestExplainerOfflineFallback(t *testing.T) {
+	explainer := newOfflineExplainer(t, "working_directory,command_docs")
+
+	explanation, risk, err := explainer.ExplainWithRisk("rm -rf /", "")
+	assert.NoError(t, err)
+	assert.Contains(t, explanation, "-r, -R, --recursive")
+	assert.Contains(t, explanation, "Risk: HIGH")
+	assert.Equal(t, gline.RiskHigh, risk.Level)
+
+	explanation, _, err = explainer.ExplainWithRisk("rm -r build", "")
+	assert.NoError(t, err)
+	assert.Contains(t, explanation, "rm - remove files or directories")
+}
+
+func TestExplainerOfflineWithoutCommandDocs(t *testing.T) {
+	explainer := newOfflineExplainer(t, "working_directory")
+
+	// Without docs or risks to show, the LLM error is surfaced as before
+	_, _, err := explainer.ExplainWithRisk("ls -la", "")
+	assert.Error(t, err)
+
+	explanation, _, err := explainer.ExplainWithRisk("rm -rf /", "")
+	assert.NoError(t, err)
+	assert.NotContains(t, explanation, "--recursive")
+	assert.Contains(t, explanation, "Risk: HIGH")
+}
@@ -0,0 +1,435 @@
+package predict
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/internal/history"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const (
+	// Number of history entries loaded per refresh of the local model
+	LOCAL_PREDICTOR_BATCH_SIZE = 5000
+	// Number of the most recent history entries the local model is built from
+	LOCAL_PREDICTOR_MAX_ENTRIES = 10000
+
+	// Weights of each feature in a candidate's score
+	localWeightDirectory  = 2.0
+	localWeightGlobal     = 1.0
+	localWeightTransition = 4.0
+	localWeightGit        = 1.5
+
+	// Failed commands still say something about intent, just less
+	localFailedCommandWeight = 0.25
+)
+
+// Modes of the local predictor, see GSH_PREDICTION_LOCAL
+const (
+	LOCAL_PREDICTION_BLEND    = "blend"
+	LOCAL_PREDICTION_FALLBACK = "fallback"
+	LOCAL_PREDICTION_OFF      = "off"
+)
+
+// gitState is the repository state relevant to predicting git commands
+type gitState int
+
+const (
+	gitStateUnknown gitState = iota
+	gitStateNotRepo
+	gitStateClean
+	gitStateDirty
+	gitStateStaged
+	gitStateAhead
+)
+
+// LocalPredictor predicts commands from history.db statistics alone, with no LLM.
+// It combines per-directory command frequency, transitions from the previous
+// command and the current git state, over the most recent history entries.
+type LocalPredictor struct {
+	runner         *interp.Runner
+	historyManager *history.HistoryManager
+	logger         *zap.Logger
+	maxEntries     int
+
+	mu              sync.RWMutex
+	lastEntryID     uint
+	learned         []learnedEntry      // oldest first, forgotten beyond maxEntries
+	global          *weights            // command -> weight
+	directory       map[string]*weights // directory -> command -> weight
+	transitions     map[string]*weights // previous command -> command -> weight
+	prefixes        map[string]*weights // previous program -> command -> weight
+	commands        []string            // known commands, sorted to look up those starting with the input
+	lastCommand     string
+	lastDirectory   string
+	currentGitState gitState
+}
+
+// learnedEntry is what a history entry added to the model, to take it out
+// again once the entry is forgotten
+type learnedEntry struct {
+	command   string
+	directory string
+	// previous is the command the entry transitioned from, if any
+	previous string
+	weight   float64
+}
+
+// weights are the weights of commands, along with their total
+type weights struct {
+	commands map[string]float64
+	total    float64
+}
+
+func newWeights() *weights {
+	return &weights{commands: make(map[string]float64)}
+}
+
+// add adds weight to command, removing it once it has none left
+func (w *weights) add(command string, weight float64) {
+	w.total += weight
+	w.commands[command] += weight
+	if w.commands[command] <= 0 {
+		delete(w.commands, command)
+	}
+	if len(w.commands) == 0 {
+		w.total = 0
+	}
+}
+
+func NewLocalPredictor(
+	runner *interp.Runner,
+	historyManager *history.HistoryManager,
+	logger *zap.Logger,
+) *LocalPredictor {
+	return &LocalPredictor{
+		runner:         runner,
+		historyManager: historyManager,
+		logger:         logger,
+		maxEntries:     LOCAL_PREDICTOR_MAX_ENTRIES,
+		global:         newWeights(),
+		directory:      make(map[string]*weights),
+		transitions:    make(map[string]*weights),
+		prefixes:       make(map[string]*weights),
+	}
+}
+
+// mode returns the configured GSH_PREDICTION_LOCAL mode
+func (p *LocalPredictor) mode() string {
+	if p.runner == nil {
+		return LOCAL_PREDICTION_BLEND
+	}
+	return environment.GetPredictionLocalMode(p.runner, p.logger)
+}
+
+// UpdateContext folds new history entries into the model and refreshes the git state
+func (p *LocalPredictor) UpdateContext(context *map[string]string) {
+	p.refresh()
+
+	state := gitStateUnknown
+	if context != nil {
+		state = parseGitState((*context)["git_status"])
+	}
+
+	p.mu.Lock()
+	p.currentGitState = state
+	p.mu.Unlock()
+}
+
+// refresh loads history entries recorded since the last refresh, starting
+// with the most recent ones the model is built from
+func (p *LocalPredictor) refresh() {
+	p.mu.RLock()
+	lastEntryID := p.lastEntryID
+	p.mu.RUnlock()
+
+	if lastEntryID == 0 {
+		entries, err := p.historyManager.GetRecentEntries("", p.maxEntries)
+		if err != nil {
+			p.logger.Warn("error loading history for local predictor", zap.Error(err))
+			return
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+		p.learnEntries(entries)
+	}
+
+	for {
+		p.mu.RLock()
+		lastEntryID := p.lastEntryID
+		p.mu.RUnlock()
+
+		entries, err := p.historyManager.GetEntriesAfter(lastEntryID, LOCAL_PREDICTOR_BATCH_SIZE)
+		if err != nil {
+			p.logger.Warn("error loading history for local predictor", zap.Error(err))
+			return
+		}
+		p.learnEntries(entries)
+
+		if len(entries) < LOCAL_PREDICTOR_BATCH_SIZE {
+			return
+		}
+	}
+}
+
+// learnEntries adds history entries to the model, forgetting those beyond the
+// most recent maxEntries, and indexes the commands known after them
+func (p *LocalPredictor) learnEntries(entries []history.HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range entries {
+		p.learn(entry)
+	}
+	for len(p.learned) > p.maxEntries {
+		p.forget(p.learned[0])
+		p.learned = p.learned[1:]
+	}
+
+	p.commands = p.commands[:0]
+	for command := range p.global.commands {
+		p.commands = append(p.commands, command)
+	}
+	slices.Sort(p.commands)
+}
+
+// learn adds a single history entry to the model. Callers must hold the write lock.
+func (p *LocalPredictor) learn(entry history.HistoryEntry) {
+	p.lastEntryID = entry.ID
+
+	command := strings.TrimSpace(entry.Command)
+	if command == "" || strings.Contains(command, "\n") {
+		return
+	}
+
+	weight := 1.0
+	if entry.ExitCode.Valid && entry.ExitCode.Int32 != 0 {
+		weight = localFailedCommandWeight
+	}
+
+	learned := learnedEntry{command: command, directory: entry.Directory, weight: weight}
+	// Transitions only make sense between commands run in the same directory session
+	if p.lastCommand != "" && p.lastDirectory == entry.Directory {
+		learned.previous = p.lastCommand
+	}
+	p.add(learned, weight)
+	p.learned = append(p.learned, learned)
+
+	p.lastCommand = command
+	p.lastDirectory = entry.Directory
+}
+
+// forget takes an entry learned earlier out of the model. Callers must hold
+// the write lock.
+func (p *LocalPredictor) forget(learned learnedEntry) {
+	p.add(learned, -learned.weight)
+}
+
+// add adds weight to the command of a learned entry. Callers must hold the
+// write lock.
+func (p *LocalPredictor) add(learned learnedEntry, weight float64) {
+	p.global.add(learned.command, weight)
+	addWeight(p.directory, learned.directory, learned.command, weight)
+	if learned.previous != "" {
+		addWeight(p.transitions, learned.previous, learned.command, weight)
+		addWeight(p.prefixes, programName(learned.previous), learned.command, weight)
+	}
+}
+
+// Predict returns the highest scoring known command that starts with input
+func (p *LocalPredictor) Predict(input string) (string, string, error) {
+	if strings.HasPrefix(input, "#") || strings.HasPrefix(input, "@") {
+		// Don't do prediction for agent chat messages
+		return "", "", nil
+	}
+
+	pwd := environment.GetPwd(p.runner)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	candidates := p.score(input, pwd)
+	if len(candidates) == 0 {
+		return "", "", nil
+	}
+
+	best := candidates[0]
+	inputContext := fmt.Sprintf(
+		"local predictor: directory=%.2f global=%.2f transition=%.2f git=%.2f",
+		best.directory, best.global, best.transition, best.git,
+	)
+	return best.command, inputContext, nil
+}
+
+type localCandidate struct {
+	command    string
+	score      float64
+	directory  float64
+	global     float64
+	transition float64
+	git        float64
+}
+
+// score ranks the known commands starting with input. Callers must hold the read lock.
+func (p *LocalPredictor) score(input string, pwd string) []localCandidate {
+	total := p.global.total
+	if total == 0 {
+		return nil
+	}
+
+	var lastCommand string
+	if p.lastDirectory == pwd {
+		lastCommand = p.lastCommand
+	}
+	transitions := p.transitions[lastCommand]
+	prefixTransitions := p.prefixes[programName(lastCommand)]
+
+	var directory map[string]float64
+	if p.directory[pwd] != nil {
+		directory = p.directory[pwd].commands
+	}
+
+	var candidates []localCandidate
+	start, _ := slices.BinarySearch(p.commands, input)
+	for _, command := range p.commands[start:] {
+		if !strings.HasPrefix(command, input) {
+			break
+		}
+		if command == input {
+			continue
+		}
+
+		candidate := localCandidate{
+			command:    command,
+			directory:  math.Log1p(directory[command]),
+			global:     math.Log1p(p.global.commands[command]) / math.Log1p(total),
+			transition: probability(transitions, command),
+			git:        gitAffinity(p.currentGitState, command),
+		}
+		// Back off to transitions from the previous program when the exact command is rare
+		candidate.transition = math.Max(candidate.transition, 0.5*probability(prefixTransitions, command))
+
+		candidate.score = localWeightDirectory*candidate.directory +
+			localWeightGlobal*candidate.global +
+			localWeightTransition*candidate.transition +
+			localWeightGit*candidate.git
+		candidates = append(candidates, candidate)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].command < candidates[j].command
+	})
+	return candidates
+}
+
+// addWeight adds weight to command under key, removing the key once none of
+// its commands have weight left
+func addWeight(counts map[string]*weights, key string, command string, weight float64) {
+	if counts[key] == nil {
+		counts[key] = newWeights()
+	}
+	counts[key].add(command, weight)
+	if len(counts[key].commands) == 0 {
+		delete(counts, key)
+	}
+}
+
+// probability returns the share of weight command has among counts
+func probability(counts *weights, command string) float64 {
+	if counts == nil || counts.total == 0 {
+		return 0
+	}
+	return counts.commands[command] / counts.total
+}
+
+// programName returns the first word of a command line
+func programName(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// parseGitState extracts the repository state from the git_status context
+func parseGitState(gitStatus string) gitState {
+	switch {
+	case gitStatus == "":
+		return gitStateUnknown
+	case strings.Contains(gitStatus, "not in a git repository"):
+		return gitStateNotRepo
+	case strings.Contains(gitStatus, "Changes to be committed"):
+		return gitStateStaged
+	case strings.Contains(gitStatus, "Changes not staged for commit"),
+		strings.Contains(gitStatus, "Untracked files"):
+		return gitStateDirty
+	case strings.Contains(gitStatus, "Your branch is ahead"):
+		return gitStateAhead
+	case strings.Contains(gitStatus, "working tree clean"):
+		return gitStateClean
+	default:
+		return gitStateUnknown
+	}
+}
+
+// gitAffinity returns how well a command fits the current git state, from -1 to 1
+func gitAffinity(state gitState, command string) float64 {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || fields[0] != "git" {
+		return 0
+	}
+	if state == gitStateNotRepo {
+		// Only commands that create a repository make sense outside one
+		if len(fields) > 1 && (fields[1] == "init" || fields[1] == "clone") {
+			return 0
+		}
+		return -1
+	}
+	if len(fields) < 2 {
+		return 0
+	}
+
+	subcommand := fields[1]
+	switch state {
+	case gitStateDirty:
+		switch subcommand {
+		case "add", "diff", "status", "stash", "restore":
+			return 1
+		case "push", "pull":
+			return -0.5
+		}
+	case gitStateStaged:
+		switch subcommand {
+		case "commit":
+			return 1
+		case "diff", "status", "restore":
+			return 0.5
+		}
+	case gitStateAhead:
+		switch subcommand {
+		case "push":
+			return 1
+		case "commit", "add":
+			return -0.5
+		}
+	case gitStateClean:
+		switch subcommand {
+		case "pull", "checkout", "switch", "log", "fetch":
+			return 0.5
+		case "add", "commit":
+			return -0.5
+		}
+	}
+	return 0
+}
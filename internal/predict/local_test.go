@@ -0,0 +1,181 @@
+package predict
+
+import (
+	"context"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/internal/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func newLocalTestPredictor(t *testing.T, pwd string, vars map[string]string) (*LocalPredictor, *history.HistoryManager) {
+	t.Helper()
+
+	historyManager, err := history.NewHistoryManager(":memory:")
+	require.NoError(t, err)
+
+	runner, err := interp.New(interp.Env(expand.ListEnviron()))
+	require.NoError(t, err)
+	// Run an empty program so the runner populates Vars
+	require.NoError(t, runner.Run(context.Background(), &syntax.File{}))
+	runner.Vars["PWD"] = expand.Variable{Kind: expand.String, Str: pwd}
+	for name, value := range vars {
+		runner.Vars[name] = expand.Variable{Kind: expand.String, Str: value}
+	}
+
+	return NewLocalPredictor(runner, historyManager, zap.NewNop()), historyManager
+}
+
+func runCommands(t *testing.T, historyManager *history.HistoryManager, directory string, exitCode int, commands ...string) {
+	t.Helper()
+	for _, command := range commands {
+		entry, err := historyManager.StartCommand(command, directory)
+		require.NoError(t, err)
+		_, err = historyManager.FinishCommand(entry, exitCode)
+		require.NoError(t, err)
+	}
+}
+
+func TestLocalPredictor(t *testing.T) {
+	t.Run("prefers commands run in the current directory", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work/api", nil)
+		runCommands(t, historyManager, "/work/web", 0, "npm test", "ls", "npm test", "ls", "npm test")
+		runCommands(t, historyManager, "/work/api", 0, "npm run build")
+		predictor.UpdateContext(nil)
+
+		prediction, inputContext, err := predictor.Predict("npm")
+		assert.NoError(t, err)
+		assert.Equal(t, "npm run build", prediction)
+		assert.Contains(t, inputContext, "local predictor")
+	})
+
+	t.Run("follows transitions from the previous command", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work", nil)
+		runCommands(t, historyManager, "/work", 0,
+			"make build", "ls", "ls", "ls",
+			"make build", "./bin/app",
+			"make build", "./bin/app",
+			"make build",
+		)
+		predictor.UpdateContext(nil)
+
+		prediction, _, err := predictor.Predict("")
+		assert.NoError(t, err)
+		assert.Equal(t, "./bin/app", prediction)
+	})
+
+	t.Run("failed commands count less", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work", nil)
+		runCommands(t, historyManager, "/work", 1, "go tset ./...", "go tset ./...")
+		runCommands(t, historyManager, "/work", 0, "go test ./...")
+		predictor.UpdateContext(nil)
+
+		prediction, _, err := predictor.Predict("go t")
+		assert.NoError(t, err)
+		assert.Equal(t, "go test ./...", prediction)
+	})
+
+	t.Run("uses git state", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work", nil)
+		runCommands(t, historyManager, "/work", 0, "git add .", "git push", "cd /tmp")
+
+		predictor.UpdateContext(&map[string]string{
+			"git_status": "On branch main\nYour branch is ahead of 'origin/main' by 1 commit.\n\nnothing to commit, working tree clean",
+		})
+		prediction, _, err := predictor.Predict("git ")
+		assert.NoError(t, err)
+		assert.Equal(t, "git push", prediction)
+
+		predictor.UpdateContext(&map[string]string{
+			"git_status": "On branch main\nChanges not staged for commit:\n\tmodified:   main.go",
+		})
+		prediction, _, err = predictor.Predict("git ")
+		assert.NoError(t, err)
+		assert.Equal(t, "git add .", prediction)
+	})
+
+	t.Run("picks up new history incrementally", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work", nil)
+		predictor.UpdateContext(nil)
+
+		prediction, _, err := predictor.Predict("dock")
+		assert.NoError(t, err)
+		assert.Equal(t, "", prediction)
+
+		runCommands(t, historyManager, "/work", 0, "docker compose up")
+		predictor.UpdateContext(nil)
+
+		prediction, _, err = predictor.Predict("dock")
+		assert.NoError(t, err)
+		assert.Equal(t, "docker compose up", prediction)
+	})
+
+	t.Run("forgets entries beyond the most recent ones", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work", nil)
+		predictor.maxEntries = 3
+		runCommands(t, historyManager, "/old", 0, "make deploy", "make deploy")
+		runCommands(t, historyManager, "/work", 0, "make build", "ls", "make test")
+		predictor.UpdateContext(nil)
+
+		prediction, _, err := predictor.Predict("make d")
+		assert.NoError(t, err)
+		assert.Equal(t, "", prediction)
+		assert.Nil(t, predictor.directory["/old"])
+		assert.Nil(t, predictor.transitions["make deploy"])
+		assert.Equal(t, []string{"ls", "make build", "make test"}, predictor.commands)
+
+		runCommands(t, historyManager, "/work", 0, "make lint")
+		predictor.UpdateContext(nil)
+
+		assert.Equal(t, []string{"ls", "make lint", "make test"}, predictor.commands)
+		assert.Equal(t, 3.0, predictor.global.total)
+	})
+
+	t.Run("ignores agent chat and exact matches", func(t *testing.T) {
+		predictor, historyManager := newLocalTestPredictor(t, "/work", nil)
+		runCommands(t, historyManager, "/work", 0, "ls -la")
+		predictor.UpdateContext(nil)
+
+		prediction, _, _ := predictor.Predict("#")
+		assert.Equal(t, "", prediction)
+		prediction, _, _ = predictor.Predict("ls -la")
+		assert.Equal(t, "", prediction)
+	})
+}
+
+func TestPredictRouterLocalModes(t *testing.T) {
+	for _, test := range []struct {
+		mode            string
+		expectInstant   bool
+		expectAvailable bool
+	}{
+		{mode: "blend", expectInstant: true, expectAvailable: true},
+		{mode: "fallback", expectInstant: false, expectAvailable: true},
+		{mode: "off", expectInstant: false, expectAvailable: false},
+	} {
+		t.Run(test.mode, func(t *testing.T) {
+			local, historyManager := newLocalTestPredictor(t, "/work", map[string]string{
+				"GSH_PREDICTION_LOCAL": test.mode,
+			})
+			runCommands(t, historyManager, "/work", 0, "ls -la")
+			router := &PredictRouter{LocalPredictor: local}
+			router.UpdateContext(nil)
+
+			prediction, _, err := router.PredictInstant("ls")
+			assert.NoError(t, err)
+			if test.expectInstant {
+				assert.Equal(t, "ls -la", prediction)
+			} else {
+				assert.Equal(t, "", prediction)
+			}
+
+			_, _, ok := router.predictLocal("ls", LOCAL_PREDICTION_FALLBACK)
+			assert.Equal(t, test.expectAvailable, ok)
+		})
+	}
+}
@@ -47,9 +47,38 @@ func (p *LLMNullStatePredictor) Predict(input string) (string, string, error) {
 		return "", "", nil
 	}
 
+	candidates, userMessage, err := p.predict(p.contextText, "")
+	if err != nil || len(candidates) == 0 {
+		return "", userMessage, err
+	}
+	return candidates[0], userMessage, nil
+}
+
+// PredictCandidates returns the predicted next command followed by the LLM's alternatives
+func (p *LLMNullStatePredictor) PredictCandidates(input string) ([]string, string, error) {
+	if input != "" {
+		// this predictor is only for null state
+		return nil, "", nil
+	}
+
+	return p.predict(p.contextText, "")
+}
+
+// predict asks the LLM for the next command given contextText. When runningCommand
+// is set, the prediction is being prefetched while that command is still executing.
+func (p *LLMNullStatePredictor) predict(contextText string, runningCommand string) ([]string, string, error) {
 	schema, err := PREDICTED_COMMAND_SCHEMA.MarshalJSON()
 	if err != nil {
-		return "", "", err
+		return nil, "", err
+	}
+
+	runningCommandText := ""
+	if runningCommand != "" {
+		runningCommandText = fmt.Sprintf(`
+# Command I Just Ran
+This command is not yet part of the context above.
+%s
+`, runningCommand)
 	}
 
 	userMessage := fmt.Sprintf(`You are gsh, an intelligent shell program.
@@ -58,19 +87,21 @@ You are asked to predict the next command I'm likely to want to run.
 # Instructions
 * Based on the context, analyze the my potential intent
 * Your prediction must be a valid, single-line, complete bash command
+* Also list up to 3 alternative commands I might want instead, most likely first
 
 # Best Practices
 %s
 
 # Latest Context
 %s
-
+%s
 # Response JSON Schema
 %s
 
 Now predict what my next command should be.`,
 		BEST_PRACTICES,
-		p.contextText,
+		contextText,
+		runningCommandText,
 		string(schema),
 	)
 
@@ -98,7 +129,7 @@ Now predict what my next command should be.`,
 	chatCompletion, err := p.llmClient.CreateChatCompletion(context.TODO(), request)
 
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
 	prediction := PredictedCommand{}
@@ -109,5 +140,5 @@ Now predict what my next command should be.`,
 		zap.Any("response", prediction),
 	)
 
-	return prediction.PredictedCommand, userMessage, nil
+	return prediction.Commands(), userMessage, nil
 }
@@ -1,8 +1,47 @@
 package predict
 
+import (
+	"sync"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/history"
+	"go.uber.org/zap"
+)
+
+// Prediction sources recorded in analytics
+const (
+	PREDICTION_SOURCE_LLM      = "llm"
+	PREDICTION_SOURCE_CACHE    = "cache"
+	PREDICTION_SOURCE_PREFETCH = "prefetch"
+	PREDICTION_SOURCE_LOCAL    = "local"
+)
+
+// PredictionRecorder receives latency and cache statistics for each prediction served
+type PredictionRecorder interface {
+	RecordPrediction(source string, hasPrefix bool, latency time.Duration) error
+}
+
 type PredictRouter struct {
 	PrefixPredictor    *LLMPrefixPredictor
 	NullStatePredictor *LLMNullStatePredictor
+	LocalPredictor     *LocalPredictor
+	HistoryManager     *history.HistoryManager
+	CompletionProvider CompletionProvider
+	Cache              *PredictionCache
+	Recorder           PredictionRecorder
+	Logger             *zap.Logger
+
+	mu          sync.Mutex
+	contextHash string
+	prefetch    *prefetchedPrediction
+}
+
+// prefetchedPrediction is a null state prediction started before the prompt was shown
+type prefetchedPrediction struct {
+	done         chan struct{}
+	predictions  []string
+	inputContext string
+	err          error
 }
 
 func (p *PredictRouter) UpdateContext(context *map[string]string) {
@@ -13,11 +52,139 @@ func (p *PredictRouter) UpdateContext(context *map[string]string) {
 	if p.NullStatePredictor != nil {
 		p.NullStatePredictor.UpdateContext(context)
 	}
+
+	if p.LocalPredictor != nil && p.LocalPredictor.mode() != LOCAL_PREDICTION_OFF {
+		p.LocalPredictor.UpdateContext(context)
+	}
+
+	p.mu.Lock()
+	p.contextHash = HashContext(context)
+	p.mu.Unlock()
 }
 
 func (p *PredictRouter) Predict(input string) (string, string, error) {
+	predictions, _, inputContext, err := p.predict(input)
+	if err != nil || len(predictions) == 0 {
+		return "", inputContext, err
+	}
+	return predictions[0], inputContext, nil
+}
+
+// predict returns ranked predictions for input from the prefetch, the cache, the LLM
+// or, when the LLM is unreachable, the local predictor, along with which one served them
+func (p *PredictRouter) predict(input string) ([]string, string, string, error) {
+	startTime := time.Now()
+
+	p.mu.Lock()
+	contextHash := p.contextHash
+	prefetch := p.prefetch
 	if input == "" {
-		return p.NullStatePredictor.Predict(input)
+		// A prefetched prediction is only good for the first prompt after it was started
+		p.prefetch = nil
+	}
+	p.mu.Unlock()
+
+	if input == "" && prefetch != nil {
+		<-prefetch.done
+		if prefetch.err == nil && len(prefetch.predictions) > 0 {
+			p.record(PREDICTION_SOURCE_PREFETCH, input, startTime)
+			if p.Cache != nil {
+				p.Cache.PutCandidates(contextHash, input, prefetch.predictions, prefetch.inputContext)
+			}
+			return prefetch.predictions, PREDICTION_SOURCE_PREFETCH, prefetch.inputContext, nil
+		}
+	}
+
+	if p.Cache != nil {
+		if predictions, inputContext, ok := p.Cache.GetCandidates(contextHash, input); ok {
+			p.record(PREDICTION_SOURCE_CACHE, input, startTime)
+			return predictions, PREDICTION_SOURCE_CACHE, inputContext, nil
+		}
+	}
+
+	var predictions []string
+	var inputContext string
+	var err error
+	if input == "" {
+		predictions, inputContext, err = p.NullStatePredictor.PredictCandidates(input)
+	} else {
+		predictions, inputContext, err = p.PrefixPredictor.PredictCandidates(input)
+	}
+	if err != nil {
+		// Without a reachable LLM, a suggestion from history is better than none
+		if localPrediction, localContext, ok := p.predictLocal(input, LOCAL_PREDICTION_FALLBACK); ok {
+			if p.Logger != nil {
+				p.Logger.Debug("falling back to local prediction", zap.Error(err))
+			}
+			p.record(PREDICTION_SOURCE_LOCAL, input, startTime)
+			return []string{localPrediction}, PREDICTION_SOURCE_LOCAL, localContext, nil
+		}
+		return nil, "", inputContext, err
+	}
+
+	p.record(PREDICTION_SOURCE_LLM, input, startTime)
+	if p.Cache != nil {
+		p.Cache.PutCandidates(contextHash, input, predictions, inputContext)
+	}
+	return predictions, PREDICTION_SOURCE_LLM, inputContext, nil
+}
+
+// PredictInstant returns a local prediction to show right away while Predict waits
+// on the LLM. It only returns a prediction when the local predictor is in blend mode.
+func (p *PredictRouter) PredictInstant(input string) (string, string, error) {
+	prediction, inputContext, _ := p.predictLocal(input, LOCAL_PREDICTION_BLEND)
+	return prediction, inputContext, nil
+}
+
+// predictLocal asks the local predictor for a prediction if it is enabled for the given mode
+func (p *PredictRouter) predictLocal(input string, requiredMode string) (string, string, bool) {
+	if p.LocalPredictor == nil {
+		return "", "", false
+	}
+
+	mode := p.LocalPredictor.mode()
+	if mode == LOCAL_PREDICTION_OFF || (requiredMode == LOCAL_PREDICTION_BLEND && mode != LOCAL_PREDICTION_BLEND) {
+		return "", "", false
+	}
+
+	prediction, inputContext, err := p.LocalPredictor.Predict(input)
+	if err != nil || prediction == "" {
+		return "", "", false
+	}
+	return prediction, inputContext, true
+}
+
+// PrefetchNullState starts predicting the next command in the background while
+// runningCommand executes, so a suggestion is ready as soon as the prompt returns.
+// The result is served to the next null state Predict call.
+func (p *PredictRouter) PrefetchNullState(runningCommand string) {
+	if p.NullStatePredictor == nil {
+		return
+	}
+
+	prefetch := &prefetchedPrediction{done: make(chan struct{})}
+	// Capture the context now; UpdateContext may replace it while the prefetch is running
+	contextText := p.NullStatePredictor.contextText
+
+	go func() {
+		defer close(prefetch.done)
+		prefetch.predictions, prefetch.inputContext, prefetch.err = p.NullStatePredictor.predict(contextText, runningCommand)
+		if prefetch.err != nil && p.Logger != nil {
+			p.Logger.Debug("null state prefetch failed", zap.Error(prefetch.err))
+		}
+	}()
+
+	p.mu.Lock()
+	p.prefetch = prefetch
+	p.mu.Unlock()
+}
+
+func (p *PredictRouter) record(source string, input string, startTime time.Time) {
+	if p.Recorder == nil {
+		return
+	}
+
+	if err := p.Recorder.RecordPrediction(source, input != "", time.Since(startTime)); err != nil && p.Logger != nil {
+		p.Logger.Warn("failed to record prediction metrics", zap.Error(err))
 	}
-	return p.PrefixPredictor.Predict(input)
 }
@@ -49,14 +49,24 @@ func (p *LLMPrefixPredictor) UpdateContext(context *map[string]string) {
 }
 
 func (p *LLMPrefixPredictor) Predict(input string) (string, string, error) {
+	candidates, userMessage, err := p.PredictCandidates(input)
+	if err != nil || len(candidates) == 0 {
+		return "", userMessage, err
+	}
+	return candidates[0], userMessage, nil
+}
+
+// PredictCandidates returns the predicted command followed by the LLM's alternatives,
+// keeping only those that start with input
+func (p *LLMPrefixPredictor) PredictCandidates(input string) ([]string, string, error) {
 	if strings.HasPrefix(input, "#") {
 		// Don't do prediction for agent chat messages
-		return "", "", nil
+		return nil, "", nil
 	}
 
 	schema, err := PREDICTED_COMMAND_SCHEMA.MarshalJSON()
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
 	matchingHistoryEntries, err := p.historyManager.GetRecentEntriesByPrefix(
@@ -81,6 +91,7 @@ You are asked to predict what the complete bash command is.
 * Based on the prefix and other context, analyze the my potential intent
 * Your prediction must start with the partial command as a prefix
 * Your prediction must be a valid, single-line, complete bash command
+* Also list up to 3 alternative commands I might want instead, most likely first, which must also start with the partial command
 
 # Best Practices
 %s
@@ -126,7 +137,7 @@ You are asked to predict what the complete bash command is.
 	chatCompletion, err := p.llmClient.CreateChatCompletion(context.TODO(), request)
 
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
 	prediction := PredictedCommand{}
@@ -137,5 +148,12 @@ You are asked to predict what the complete bash command is.
 		zap.Any("response", prediction),
 	)
 
-	return prediction.PredictedCommand, userMessage, nil
+	candidates := []string{}
+	for i, command := range prediction.Commands() {
+		// The first prediction is always kept, as before; alternatives must honor the prefix
+		if i == 0 || strings.HasPrefix(command, input) {
+			candidates = append(candidates, command)
+		}
+	}
+	return candidates, userMessage, nil
 }
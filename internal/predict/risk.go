@@ -0,0 +1,380 @@
+package predict
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/internal/utils"
+	"github.com/samber/lo"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Risk levels of a command, from least to most dangerous
+const (
+	RISK_LEVEL_LOW    = "low"
+	RISK_LEVEL_MEDIUM = "medium"
+	RISK_LEVEL_HIGH   = "high"
+)
+
+// CommandRisk is a structured assessment of what a command may do to the system
+type CommandRisk struct {
+	Level             string
+	Reasons           []string
+	AffectedResources []string
+	Reversible        bool
+	NetworkAccess     bool
+}
+
+// Paths that are too broad to ever delete or open up recursively
+var broadPaths = map[string]bool{
+	"/": true, "/*": true, "~": true, "~/": true, "~/*": true, "$HOME": true, "$HOME/": true, "$HOME/*": true,
+	".": true, "./": true, "./*": true, "..": true, "../": true, "*": true, ".*": true,
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true, "/lib": true, "/opt": true,
+	"/root": true, "/sbin": true, "/sys": true, "/usr": true, "/var": true, "/System": true, "/Users": true,
+}
+
+var blockDevicePattern = regexp.MustCompile(`^/dev/(sd[a-z]|hd[a-z]|vd[a-z]|xvd[a-z]|nvme\d|mmcblk\d|disk\d|rdisk\d)`)
+
+// Commands that talk to the network on their own
+var networkCommands = map[string]bool{
+	"curl": true, "wget": true, "ssh": true, "scp": true, "sftp": true, "rsync": true, "nc": true,
+	"ncat": true, "telnet": true, "ftp": true, "ping": true, "dig": true, "nslookup": true,
+}
+
+// Subcommands of package managers and VCS tools that talk to the network
+var networkSubcommands = map[string]map[string]bool{
+	"git":     {"push": true, "pull": true, "fetch": true, "clone": true, "ls-remote": true},
+	"npm":     {"install": true, "i": true, "publish": true, "update": true},
+	"yarn":    {"add": true, "install": true, "publish": true},
+	"pnpm":    {"add": true, "install": true, "publish": true},
+	"pip":     {"install": true, "download": true},
+	"pip3":    {"install": true, "download": true},
+	"go":      {"get": true, "install": true},
+	"brew":    {"install": true, "update": true, "upgrade": true},
+	"apt":     {"install": true, "update": true, "upgrade": true},
+	"apt-get": {"install": true, "update": true, "upgrade": true},
+	"docker":  {"pull": true, "push": true},
+}
+
+// Shells that execute whatever is piped into them
+var shellCommands = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "fish": true, "dash": true, "ksh": true, "python": true, "python3": true,
+}
+
+// PrecheckCommandRisk deterministically flags well known destructive patterns in a
+// command without involving an LLM. Commands that fail to parse are rated low.
+func PrecheckCommandRisk(command string) CommandRisk {
+	risk := CommandRisk{Level: RISK_LEVEL_LOW, Reversible: true}
+
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return risk
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			checkCall(&risk, callArgs(n))
+		case *syntax.BinaryCmd:
+			if n.Op == syntax.Pipe || n.Op == syntax.PipeAll {
+				checkPipe(&risk, n)
+			}
+		}
+		return true
+	})
+
+	return risk
+}
+
+// flag raises the risk to at least level and records why
+func (r *CommandRisk) flag(level string, reason string, irreversible bool, resources ...string) {
+	if riskRank(level) > riskRank(r.Level) {
+		r.Level = level
+	}
+	r.Reasons = append(r.Reasons, reason)
+	if irreversible {
+		r.Reversible = false
+	}
+	for _, resource := range resources {
+		if !lo.Contains(r.AffectedResources, resource) {
+			r.AffectedResources = append(r.AffectedResources, resource)
+		}
+	}
+}
+
+func checkCall(risk *CommandRisk, args []string) {
+	args = utils.UnwrapCommand(args)
+	if len(args) == 0 {
+		return
+	}
+
+	name := path.Base(args[0])
+	if name == "git" {
+		args = append([]string{args[0]}, skipGitOptions(args[1:])...)
+	}
+	if networkCommands[name] {
+		risk.NetworkAccess = true
+	}
+	if len(args) > 1 && networkSubcommands[name][args[1]] {
+		risk.NetworkAccess = true
+	}
+
+	switch {
+	case name == "rm":
+		checkRm(risk, args[1:])
+	case name == "dd":
+		checkDd(risk, args[1:])
+	case name == "chmod" || name == "chown":
+		checkPermissions(risk, name, args[1:])
+	case name == "git":
+		checkGit(risk, args[1:])
+	case strings.HasPrefix(name, "mkfs") || name == "wipefs" || name == "shred":
+		risk.flag(RISK_LEVEL_HIGH, fmt.Sprintf("%s destroys data", name), true, operands(args[1:])...)
+	}
+}
+
+func checkRm(risk *CommandRisk, args []string) {
+	recursive, force := false, false
+	for _, arg := range args {
+		switch {
+		case arg == "--recursive":
+			recursive = true
+		case arg == "--force":
+			force = true
+		case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+			recursive = recursive || strings.ContainsAny(arg, "rR")
+			force = force || strings.Contains(arg, "f")
+		}
+	}
+
+	targets := operands(args)
+	if !recursive {
+		if len(targets) > 0 {
+			risk.flag(RISK_LEVEL_MEDIUM, "rm permanently deletes files", true, targets...)
+		}
+		return
+	}
+
+	for _, target := range targets {
+		if isBroadPath(target) {
+			risk.flag(RISK_LEVEL_HIGH, fmt.Sprintf("rm -r on broad path %s", target), true, targets...)
+			return
+		}
+	}
+	if force {
+		risk.flag(RISK_LEVEL_MEDIUM, "rm -rf deletes directories without confirmation", true, targets...)
+	} else {
+		risk.flag(RISK_LEVEL_MEDIUM, "rm -r deletes directories", true, targets...)
+	}
+}
+
+func checkDd(risk *CommandRisk, args []string) {
+	for _, arg := range args {
+		target, ok := strings.CutPrefix(arg, "of=")
+		if !ok {
+			continue
+		}
+		if blockDevicePattern.MatchString(target) {
+			risk.flag(RISK_LEVEL_HIGH, fmt.Sprintf("dd overwrites block device %s", target), true, target)
+		} else {
+			risk.flag(RISK_LEVEL_MEDIUM, fmt.Sprintf("dd overwrites %s", target), true, target)
+		}
+	}
+}
+
+func checkPermissions(risk *CommandRisk, name string, args []string) {
+	recursive := false
+	for _, arg := range args {
+		if arg == "--recursive" || (strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "R")) {
+			recursive = true
+		}
+	}
+
+	targets := operands(args)
+	if len(targets) == 0 {
+		return
+	}
+	mode, targets := targets[0], targets[1:]
+
+	worldWritable := name == "chmod" && (mode == "777" || mode == "0777" || mode == "a+rwx" || mode == "o+w" || mode == "a+w")
+	broad := false
+	for _, target := range targets {
+		broad = broad || isBroadPath(target)
+	}
+
+	switch {
+	case recursive && worldWritable:
+		risk.flag(RISK_LEVEL_HIGH, fmt.Sprintf("chmod -R %s makes everything world-writable", mode), true, targets...)
+	case recursive && broad:
+		risk.flag(RISK_LEVEL_HIGH, fmt.Sprintf("%s -R on a broad path", name), true, targets...)
+	case worldWritable:
+		risk.flag(RISK_LEVEL_MEDIUM, fmt.Sprintf("chmod %s makes files world-writable", mode), false, targets...)
+	case recursive:
+		risk.flag(RISK_LEVEL_MEDIUM, fmt.Sprintf("%s -R changes ownership or permissions recursively", name), false, targets...)
+	}
+}
+
+// Global options of git whose value is the word after them
+var gitOptionValues = map[string]bool{
+	"-C": true, "-c": true, "--git-dir": true, "--work-tree": true, "--namespace": true, "--config-env": true,
+}
+
+// skipGitOptions strips git's global options, which come before its
+// subcommand, from its arguments
+func skipGitOptions(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if gitOptionValues[args[0]] {
+			args = args[min(2, len(args)):]
+		} else {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+func checkGit(risk *CommandRisk, args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	switch args[0] {
+	case "push":
+		for _, arg := range args[1:] {
+			switch {
+			case arg == "--force" || arg == "-f" || (strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "f")):
+				risk.flag(RISK_LEVEL_HIGH, "git push --force can discard commits on the remote", true, "remote repository")
+				return
+			case strings.HasPrefix(arg, "--force-with-lease"):
+				risk.flag(RISK_LEVEL_MEDIUM, "git push --force-with-lease rewrites remote history", true, "remote repository")
+				return
+			case strings.HasPrefix(arg, "+"):
+				risk.flag(RISK_LEVEL_HIGH, "pushing a +refspec forces the update on the remote", true, "remote repository")
+				return
+			}
+		}
+	case "reset":
+		if lo.Contains(args[1:], "--hard") {
+			risk.flag(RISK_LEVEL_MEDIUM, "git reset --hard discards uncommitted changes", true, "working tree")
+		}
+	case "clean":
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "f") {
+				risk.flag(RISK_LEVEL_MEDIUM, "git clean -f deletes untracked files", true, "working tree")
+				return
+			}
+		}
+	}
+}
+
+// checkPipe flags downloads piped straight into a shell, like curl ... | sh
+func checkPipe(risk *CommandRisk, pipe *syntax.BinaryCmd) {
+	left := lastCallArgs(pipe.X)
+	right := firstCallArgs(pipe.Y)
+	if len(left) == 0 || len(right) == 0 {
+		return
+	}
+
+	downloader := path.Base(left[0])
+	interpreter := path.Base(right[0])
+	if (downloader == "curl" || downloader == "wget") && shellCommands[interpreter] {
+		risk.flag(RISK_LEVEL_HIGH, fmt.Sprintf("%s output is executed by %s without review", downloader, interpreter), true)
+		risk.NetworkAccess = true
+	}
+}
+
+// lastCallArgs returns the arguments of the last command of a pipeline
+func lastCallArgs(stmt *syntax.Stmt) []string {
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		return utils.UnwrapCommand(callArgs(cmd))
+	case *syntax.BinaryCmd:
+		return lastCallArgs(cmd.Y)
+	}
+	return nil
+}
+
+// firstCallArgs returns the arguments of the first command of a pipeline
+func firstCallArgs(stmt *syntax.Stmt) []string {
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		return utils.UnwrapCommand(callArgs(cmd))
+	case *syntax.BinaryCmd:
+		return firstCallArgs(cmd.X)
+	}
+	return nil
+}
+
+// callArgs returns the words of a call as they would read unquoted
+func callArgs(call *syntax.CallExpr) []string {
+	args := make([]string, 0, len(call.Args))
+	for _, word := range call.Args {
+		args = append(args, wordText(word))
+	}
+	return args
+}
+
+// wordText renders a word with quotes removed, keeping parameter expansions as $NAME
+func wordText(word *syntax.Word) string {
+	var text strings.Builder
+	var writeParts func(parts []syntax.WordPart)
+	writeParts = func(parts []syntax.WordPart) {
+		for _, part := range parts {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				text.WriteString(p.Value)
+			case *syntax.SglQuoted:
+				text.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				writeParts(p.Parts)
+			case *syntax.ParamExp:
+				if p.Param != nil {
+					text.WriteString("$" + p.Param.Value)
+				}
+			}
+		}
+	}
+	writeParts(word.Parts)
+	return text.String()
+}
+
+// operands returns the arguments that aren't flags
+func operands(args []string) []string {
+	result := []string{}
+	endOfFlags := false
+	for _, arg := range args {
+		if !endOfFlags && arg == "--" {
+			endOfFlags = true
+			continue
+		}
+		if !endOfFlags && strings.HasPrefix(arg, "-") && arg != "-" {
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+func isBroadPath(target string) bool {
+	if broadPaths[target] {
+		return true
+	}
+	trimmed := strings.TrimSuffix(target, "/")
+	if trimmed != "" && broadPaths[trimmed] {
+		return true
+	}
+	return broadPaths[strings.TrimSuffix(target, "/*")]
+}
+
+func riskRank(level string) int {
+	switch level {
+	case RISK_LEVEL_HIGH:
+		return 3
+	case RISK_LEVEL_MEDIUM:
+		return 2
+	case RISK_LEVEL_LOW:
+		return 1
+	}
+	return 0
+}
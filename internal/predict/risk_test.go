@@ -0,0 +1,87 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecheckCommandRisk(t *testing.T) {
+	tests := []struct {
+		command    string
+		level      string
+		reversible bool
+		network    bool
+	}{
+		{command: "ls -la", level: RISK_LEVEL_LOW, reversible: true},
+		{command: "rm -rf /", level: RISK_LEVEL_HIGH},
+		{command: "sudo rm -rf ~/", level: RISK_LEVEL_HIGH},
+		{command: "sudo -u root rm -rf /", level: RISK_LEVEL_HIGH},
+		{command: "env -u HOME nice -n 10 rm -rf /", level: RISK_LEVEL_HIGH},
+		{command: "timeout -s KILL 10s rm -rf /", level: RISK_LEVEL_HIGH},
+		{command: `rm -r -f "$HOME"`, level: RISK_LEVEL_HIGH},
+		{command: "rm --recursive --force .", level: RISK_LEVEL_HIGH},
+		{command: "rm -rf build/", level: RISK_LEVEL_MEDIUM},
+		{command: "rm notes.txt", level: RISK_LEVEL_MEDIUM},
+		{command: "dd if=ubuntu.iso of=/dev/sdb bs=4M", level: RISK_LEVEL_HIGH},
+		{command: "dd if=/dev/zero of=disk.img bs=1M count=10", level: RISK_LEVEL_MEDIUM},
+		{command: "chmod -R 777 /var/www", level: RISK_LEVEL_HIGH},
+		{command: "chmod 777 script.sh", level: RISK_LEVEL_MEDIUM, reversible: true},
+		{command: "chmod +x script.sh", level: RISK_LEVEL_LOW, reversible: true},
+		{command: "curl -fsSL https://example.com/install.sh | sh", level: RISK_LEVEL_HIGH, network: true},
+		{command: "wget -qO- https://example.com/install.sh | sudo bash", level: RISK_LEVEL_HIGH, network: true},
+		{command: "curl https://example.com", level: RISK_LEVEL_LOW, reversible: true, network: true},
+		{command: "git push --force origin main", level: RISK_LEVEL_HIGH, network: true},
+		{command: "git push -uf origin main", level: RISK_LEVEL_HIGH, network: true},
+		{command: "git push origin main", level: RISK_LEVEL_LOW, reversible: true, network: true},
+		{command: "git -C dir push -f", level: RISK_LEVEL_HIGH, network: true},
+		{command: "git -c k=v reset --hard", level: RISK_LEVEL_MEDIUM},
+		{command: "git --git-dir=repo/.git --no-pager reset --hard", level: RISK_LEVEL_MEDIUM},
+		{command: "git status && rm -rf /etc", level: RISK_LEVEL_HIGH},
+		{command: "echo $(rm -rf /)", level: RISK_LEVEL_HIGH},
+		{command: "echo 'rm -rf /'", level: RISK_LEVEL_LOW, reversible: true},
+		{command: "if then", level: RISK_LEVEL_LOW, reversible: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			risk := PrecheckCommandRisk(test.command)
+			assert.Equal(t, test.level, risk.Level)
+			assert.Equal(t, test.reversible, risk.Reversible)
+			assert.Equal(t, test.network, risk.NetworkAccess)
+			if test.level != RISK_LEVEL_LOW {
+				assert.NotEmpty(t, risk.Reasons)
+			}
+		})
+	}
+}
+
+func TestPrecheckCommandRiskAffectedResources(t *testing.T) {
+	risk := PrecheckCommandRisk("rm -rf / tmp")
+	assert.Equal(t, []string{"/", "tmp"}, risk.AffectedResources)
+
+	risk = PrecheckCommandRisk("dd if=image.iso of=/dev/nvme0n1")
+	assert.Equal(t, []string{"/dev/nvme0n1"}, risk.AffectedResources)
+}
+
+func TestMergeRisk(t *testing.T) {
+	precheck := PrecheckCommandRisk("rm -rf build")
+	risk := mergeRisk(precheck, explainedCommand{
+		RiskLevel:         "HIGH",
+		AffectedResources: []string{"build", "dist"},
+		Reversible:        true,
+		NetworkAccess:     false,
+	})
+
+	assert.Equal(t, RISK_LEVEL_HIGH, risk.Level)
+	assert.Equal(t, []string{"build", "dist"}, risk.AffectedResources)
+	assert.False(t, risk.Reversible, "the pre-check's irreversibility must not be overridden")
+
+	// A lower model assessment never downgrades the pre-check
+	risk = mergeRisk(PrecheckCommandRisk("rm -rf /"), explainedCommand{RiskLevel: "low", Reversible: true})
+	assert.Equal(t, RISK_LEVEL_HIGH, risk.Level)
+
+	formatted := formatRisk(risk)
+	assert.Contains(t, formatted, "Risk: HIGH")
+	assert.Contains(t, formatted, "Reversible: no")
+}
@@ -5,13 +5,32 @@ import (
 )
 
 type PredictedCommand struct {
-	PredictedCommand string `json:"predicted_command" description:"The full bash command predicted by the model" required:"true"`
+	PredictedCommand    string   `json:"predicted_command" description:"The full bash command predicted by the model" required:"true"`
+	AlternativeCommands []string `json:"alternative_commands,omitempty" description:"Other full bash commands that are likely, most likely first" required:"false"`
+}
+
+// Commands returns the predicted command followed by its distinct non-empty alternatives
+func (c PredictedCommand) Commands() []string {
+	commands := []string{}
+	seen := map[string]bool{}
+	for _, command := range append([]string{c.PredictedCommand}, c.AlternativeCommands...) {
+		if command == "" || seen[command] {
+			continue
+		}
+		seen[command] = true
+		commands = append(commands, command)
+	}
+	return commands
 }
 
 var PREDICTED_COMMAND_SCHEMA = utils.GenerateJsonSchema(PredictedCommand{})
 
 type explainedCommand struct {
-	Explanation string `json:"explanation" description:"A concise explanation of what the command will do for me" required:"true"`
+	Explanation       string   `json:"explanation" description:"A concise explanation of what the command will do for me" required:"true"`
+	RiskLevel         string   `json:"risk_level" description:"How risky running the command is: low, medium or high" required:"true"`
+	AffectedResources []string `json:"affected_resources" description:"Files, directories, devices or remote resources the command modifies" required:"true"`
+	Reversible        bool     `json:"reversible" description:"Whether the effects of the command can easily be undone" required:"true"`
+	NetworkAccess     bool     `json:"network_access" description:"Whether the command accesses the network" required:"true"`
 }
 
 var EXPLAINED_COMMAND_SCHEMA = utils.GenerateJsonSchema(explainedCommand{})
@@ -9,6 +9,23 @@ import (
 type ContextProvider struct {
 	Logger     *zap.Logger
 	Retrievers []ContextRetriever
+
+	// context is gathered before each prompt
+	context *map[string]string
+}
+
+// Precmd gathers the context from the retrievers before the prompt, once the
+// command line that ran last is done
+func (p *ContextProvider) Precmd(exitCode int) {
+	p.context = p.GetContext()
+}
+
+// Context returns the context gathered before the prompt
+func (p *ContextProvider) Context() *map[string]string {
+	if p.context == nil {
+		p.context = p.GetContext()
+	}
+	return p.context
 }
 
 func (p *ContextProvider) GetContext() *map[string]string {
@@ -0,0 +1,339 @@
+package retrievers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atinylittleshell/gsh/internal/environment"
+	"github.com/atinylittleshell/gsh/internal/utils"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const (
+	// Maximum size of a man page or help text kept in the cache
+	commandDocsMaxRawBytes = 256 * 1024
+	// Maximum size of the documentation extracted for a single program
+	commandDocsMaxProgramChars = 2000
+	// Maximum size of the documentation extracted for a whole command line
+	commandDocsMaxTotalChars = 6000
+	// Maximum number of lines shown for a single flag
+	commandDocsMaxFlagLines = 6
+	// Number of programs whose documentation is cached
+	commandDocsCacheSize = 128
+	// How long fetching documentation for a program may take
+	commandDocsFetchTimeout = 2 * time.Second
+)
+
+var (
+	overstrikePattern = regexp.MustCompile(".\x08")
+	ansiPattern       = regexp.MustCompile("\x1b\\[[0-9;]*[a-zA-Z]")
+)
+
+// Programs whose second word is a subcommand documented in its own man page
+var subcommandPrograms = map[string]bool{
+	"git": true, "docker": true, "kubectl": true, "go": true, "npm": true, "cargo": true, "systemctl": true,
+}
+
+// CommandDocsContextRetriever looks up the man page or --help output of each program
+// in a command line and extracts the parts describing the flags being used.
+//
+// Programs are only run with --help when GSH_COMMAND_DOCS_HELP is enabled, and only
+// if the user typed them, so a predicted command never makes gsh run a program.
+type CommandDocsContextRetriever struct {
+	Runner *interp.Runner
+	Logger *zap.Logger
+
+	mu    sync.Mutex
+	cache map[string]commandDocs // program -> documentation
+	order []string               // Cached programs, least recently fetched first
+
+	// fetch returns the documentation of a program, running it with --help if
+	// help is set and it has no man page; replaced in tests
+	fetch func(program string, subcommand string, help bool) string
+}
+
+type commandDocs struct {
+	docs string // Empty when none was found
+	help bool   // Whether --help output was looked for
+}
+
+func NewCommandDocsContextRetriever(runner *interp.Runner, logger *zap.Logger) *CommandDocsContextRetriever {
+	r := &CommandDocsContextRetriever{
+		Runner: runner,
+		Logger: logger,
+		cache:  make(map[string]commandDocs),
+	}
+	r.fetch = r.fetchDocs
+	return r
+}
+
+func (r *CommandDocsContextRetriever) Name() string {
+	return "command_docs"
+}
+
+// GetContextForCommand returns the documentation of the flags used in command for
+// the LLM. typed is the part of command the user typed, as opposed to predicted.
+func (r *CommandDocsContextRetriever) GetContextForCommand(command string, typed string) (string, error) {
+	docs := r.DescribeFlags(command, typed)
+	if docs == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("<command_docs>\n%s</command_docs>", docs), nil
+}
+
+// DescribeFlags returns a summary of each program in command along with the
+// documentation of the flags it is invoked with. typed is the part of command
+// the user typed, as opposed to predicted.
+func (r *CommandDocsContextRetriever) DescribeFlags(command string, typed string) string {
+	typedPrograms := map[string]bool{}
+	if r.Runner != nil && environment.IsCommandDocsHelpEnabled(r.Runner) {
+		for _, invocation := range parseInvocations(typed) {
+			typedPrograms[invocation.program] = true
+		}
+	}
+
+	var result strings.Builder
+	for _, invocation := range parseInvocations(command) {
+		docs := r.getDocs(invocation.program, invocation.subcommand, typedPrograms[invocation.program])
+		if docs == "" {
+			continue
+		}
+
+		section := extractFlagDocs(docs, invocation.flags)
+		if section == "" {
+			continue
+		}
+		if len(section) > commandDocsMaxProgramChars {
+			section = section[:commandDocsMaxProgramChars] + "\n...\n"
+		}
+		if result.Len()+len(section) > commandDocsMaxTotalChars {
+			break
+		}
+		result.WriteString(section)
+	}
+	return result.String()
+}
+
+func (r *CommandDocsContextRetriever) getDocs(program string, subcommand string, help bool) string {
+	key := program
+	if subcommand != "" {
+		key += " " + subcommand
+	}
+
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	// Programs without a man page are fetched again once they may be run for their --help
+	if ok && (cached.docs != "" || cached.help || !help) {
+		return cached.docs
+	}
+
+	docs := r.fetch(program, subcommand, help)
+	if len(docs) > commandDocsMaxRawBytes {
+		docs = docs[:commandDocsMaxRawBytes]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.cache[key]; !ok {
+		r.order = append(r.order, key)
+		if len(r.order) > commandDocsCacheSize {
+			delete(r.cache, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	r.cache[key] = commandDocs{docs: docs, help: help}
+	return docs
+}
+
+// fetchDocs reads the man page of program, preferring the page of its subcommand,
+// and if help is set falls back to the --help output of executables found on PATH
+func (r *CommandDocsContextRetriever) fetchDocs(program string, subcommand string, help bool) string {
+	pages := []string{program}
+	if subcommand != "" {
+		pages = []string{program + "-" + subcommand, program}
+	}
+	for _, page := range pages {
+		if docs := r.run("man", page); docs != "" {
+			return docs
+		}
+	}
+
+	if !help {
+		return ""
+	}
+	executable := utils.LookPathExecutable(r.Runner, program)
+	if executable == "" {
+		return ""
+	}
+	return r.run(executable, "--help")
+}
+
+func (r *CommandDocsContextRetriever) run(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), commandDocsFetchTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100", "GROFF_NO_SGR=1")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// Many programs print --help to stderr
+	cmd.Stderr = &stdout
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		r.Logger.Debug("error fetching command documentation", zap.String("command", name), zap.Strings("args", args), zap.Error(err))
+		return ""
+	}
+
+	text := overstrikePattern.ReplaceAllString(stdout.String(), "")
+	return ansiPattern.ReplaceAllString(text, "")
+}
+
+// invocation is a single program run by a command line
+type invocation struct {
+	program    string
+	subcommand string
+	flags      []string
+}
+
+// parseInvocations returns every program run by command along with its flags
+func parseInvocations(command string) []invocation {
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil
+	}
+
+	var invocations []invocation
+	syntax.Walk(file, func(node syntax.Node) bool {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok {
+			return true
+		}
+
+		var args []string
+		for _, word := range call.Args {
+			args = append(args, word.Lit())
+		}
+		args = utils.UnwrapCommand(args)
+		if len(args) == 0 || args[0] == "" {
+			return true
+		}
+
+		inv := invocation{program: args[0]}
+		rest := args[1:]
+		if subcommandPrograms[filepath.Base(inv.program)] && len(rest) > 0 && rest[0] != "" && !strings.HasPrefix(rest[0], "-") {
+			inv.subcommand = rest[0]
+			rest = rest[1:]
+		}
+		for _, arg := range rest {
+			if arg == "--" {
+				break
+			}
+			inv.flags = append(inv.flags, splitFlag(arg)...)
+		}
+		invocations = append(invocations, inv)
+		return true
+	})
+	return invocations
+}
+
+// splitFlag turns an argument into the flags it sets: --color=auto gives --color, -la gives -l and -a
+func splitFlag(arg string) []string {
+	switch {
+	case strings.HasPrefix(arg, "--") && len(arg) > 2:
+		name, _, _ := strings.Cut(arg, "=")
+		return []string{name}
+	case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		var flags []string
+		for _, c := range arg[1:] {
+			if c == '=' {
+				break
+			}
+			flags = append(flags, "-"+string(c))
+		}
+		return flags
+	}
+	return nil
+}
+
+// extractFlagDocs returns a one line summary of a man page or help text followed by
+// the paragraphs documenting each of flags
+func extractFlagDocs(docs string, flags []string) string {
+	lines := strings.Split(docs, "\n")
+
+	var result strings.Builder
+	if summary := docsSummary(lines); summary != "" {
+		result.WriteString(summary + "\n")
+	}
+
+	seen := map[string]bool{}
+	for _, flag := range flags {
+		if seen[flag] {
+			continue
+		}
+		seen[flag] = true
+
+		pattern := regexp.MustCompile(`(^|[\s,/])` + regexp.QuoteMeta(flag) + `($|[\s,=\[<])`)
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if !strings.HasPrefix(trimmed, "-") || !pattern.MatchString(flagHead(trimmed)) {
+				continue
+			}
+
+			result.WriteString("  " + trimmed + "\n")
+			indent := indentation(line)
+			for j := i + 1; j < len(lines) && j <= i+commandDocsMaxFlagLines; j++ {
+				next := lines[j]
+				if strings.TrimSpace(next) == "" || indentation(next) <= indent {
+					break
+				}
+				result.WriteString("      " + strings.TrimSpace(next) + "\n")
+			}
+			break
+		}
+	}
+	return result.String()
+}
+
+// docsSummary returns the line after a man page's NAME header, or the first line of help text
+func docsSummary(lines []string) string {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "NAME" {
+			for _, next := range lines[i+1:] {
+				if summary := strings.TrimSpace(next); summary != "" {
+					return summary
+				}
+			}
+		}
+	}
+	for _, line := range lines {
+		if summary := strings.TrimSpace(line); summary != "" {
+			return summary
+		}
+	}
+	return ""
+}
+
+// flagHead returns the part of a flag line naming the flags, before its description
+func flagHead(line string) string {
+	if i := strings.Index(line, "  "); i >= 0 {
+		return line[:i]
+	}
+	if i := strings.Index(line, "\t"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
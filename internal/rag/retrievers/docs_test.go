@@ -0,0 +1,125 @@
+package retrievers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const rmManPage = `RM(1)                            User Commands                           RM(1)
+
+NAME
+       rm - remove files or directories
+
+OPTIONS
+       -f, --force
+              ignore nonexistent files and arguments, never prompt
+
+       -i     prompt before every removal
+
+       -r, -R, --recursive
+              remove directories and their contents recursively
+
+       -v, --verbose
+              explain what is being done
+`
+
+const toolHelp = `Usage: deploy-tool [options] <env>
+  --dry-run          print what would be deployed
+  -t, --tag=TAG      image tag to deploy
+                     defaults to the current commit
+  --force            skip health checks
+`
+
+func newTestDocsRetriever(docs map[string]string) (*CommandDocsContextRetriever, *[]string) {
+	var fetched []string
+	r := NewCommandDocsContextRetriever(nil, zap.NewNop())
+	r.fetch = func(program string, subcommand string, help bool) string {
+		key := strings.TrimSpace(program + " " + subcommand)
+		if help {
+			// Documentation only found with --help is keyed by the command run
+			fetched = append(fetched, key+" --help")
+			if help, ok := docs[key+" --help"]; ok {
+				return help
+			}
+		} else {
+			fetched = append(fetched, key)
+		}
+		return docs[key]
+	}
+	return r, &fetched
+}
+
+func TestCommandDocsDescribeFlags(t *testing.T) {
+	r, _ := newTestDocsRetriever(map[string]string{"rm": rmManPage, "deploy-tool": toolHelp})
+
+	docs := r.DescribeFlags("sudo rm -rf build", "")
+	assert.Contains(t, docs, "rm - remove files or directories")
+	assert.Contains(t, docs, "-r, -R, --recursive")
+	assert.Contains(t, docs, "remove directories and their contents recursively")
+	assert.Contains(t, docs, "-f, --force")
+	assert.NotContains(t, docs, "--verbose", "flags that aren't used should be left out")
+
+	docs = r.DescribeFlags("deploy-tool --tag=v1.2 prod | tee log.txt", "")
+	assert.Contains(t, docs, "Usage: deploy-tool [options] <env>")
+	assert.Contains(t, docs, "-t, --tag=TAG")
+	assert.Contains(t, docs, "defaults to the current commit")
+	assert.NotContains(t, docs, "--force")
+}
+
+func TestCommandDocsContextAndCache(t *testing.T) {
+	r, fetched := newTestDocsRetriever(map[string]string{"rm": rmManPage, "git push": "NAME\n       git-push - Update remote refs\n"})
+
+	context, err := r.GetContextForCommand("rm -i a.txt && rm -v b.txt", "")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(context, "<command_docs>"))
+	assert.Contains(t, context, "-i     prompt before every removal")
+	assert.Contains(t, context, "-v, --verbose")
+	assert.Equal(t, []string{"rm"}, *fetched, "documentation should be fetched once per program")
+
+	context, err = r.GetContextForCommand("git push --force", "")
+	assert.NoError(t, err)
+	assert.Contains(t, context, "git-push - Update remote refs")
+	assert.Equal(t, []string{"rm", "git push"}, *fetched)
+
+	context, err = r.GetContextForCommand("unknown-tool -x", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "", context)
+}
+
+func TestCommandDocsHelpOnlyForTypedPrograms(t *testing.T) {
+	r, fetched := newTestDocsRetriever(map[string]string{"deploy-tool --help": toolHelp})
+
+	// --help is off by default
+	r.DescribeFlags("deploy-tool --force", "deploy-tool")
+	assert.Equal(t, []string{"deploy-tool"}, *fetched)
+
+	runner, err := interp.New()
+	require.NoError(t, err)
+	runner.Vars = map[string]expand.Variable{"GSH_COMMAND_DOCS_HELP": {Kind: expand.String, Str: "1"}}
+	r.Runner = runner
+
+	// Predicted programs are never run
+	r.DescribeFlags("deploy-tool --force", "deploy")
+	assert.Equal(t, []string{"deploy-tool"}, *fetched)
+
+	// Typed programs without a man page are fetched again with --help
+	docs := r.DescribeFlags("deploy-tool --force && other-tool", "deploy-tool --f")
+	assert.Contains(t, docs, "--force            skip health checks")
+	assert.Equal(t, []string{"deploy-tool", "deploy-tool --help", "other-tool"}, *fetched)
+
+	r.DescribeFlags("deploy-tool --dry-run", "deploy-tool --d")
+	assert.Equal(t, []string{"deploy-tool", "deploy-tool --help", "other-tool"}, *fetched, "--help output is cached")
+}
+
+func TestSplitFlag(t *testing.T) {
+	assert.Equal(t, []string{"-l", "-a"}, splitFlag("-la"))
+	assert.Equal(t, []string{"--color"}, splitFlag("--color=auto"))
+	assert.Nil(t, splitFlag("file.txt"))
+	assert.Nil(t, splitFlag("-"))
+}
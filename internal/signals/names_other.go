@@ -0,0 +1,40 @@
+//go:build !unix
+
+package signals
+
+import "syscall"
+
+// Signals the shell acts on besides Ctrl-C: it exits when its terminal goes
+// away, and runs the traps of the others. There's no signal for a resized
+// terminal.
+const (
+	Hangup    = syscall.SIGHUP
+	Terminate = syscall.SIGTERM
+	Quit      = syscall.SIGQUIT
+	Resize    = syscall.Signal(-1)
+)
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// lookupSignal returns the signal with a name such as INT
+func lookupSignal(name string) (syscall.Signal, bool) {
+	sig, ok := signalNames[name]
+	return sig, ok
+}
+
+// signalName returns the name of sig without the SIG prefix, or "" if it has
+// none
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package signals
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Signals the shell acts on besides Ctrl-C: it exits when its terminal goes
+// away, and runs the traps of the others
+const (
+	Hangup    = syscall.SIGHUP
+	Terminate = syscall.SIGTERM
+	Quit      = syscall.SIGQUIT
+	Resize    = syscall.SIGWINCH
+)
+
+// lookupSignal returns the signal with a name such as INT
+func lookupSignal(name string) (syscall.Signal, bool) {
+	sig := unix.SignalNum("SIG" + name)
+	return sig, sig != 0
+}
+
+// signalName returns the name of sig without the SIG prefix, or "" if it has
+// none
+func signalName(sig syscall.Signal) string {
+	name := unix.SignalName(sig)
+	if len(name) <= 3 {
+		return ""
+	}
+	return name[3:]
+}
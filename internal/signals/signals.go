@@ -0,0 +1,109 @@
+// Package signals relays the signals the shell receives to one handler at a
+// time, and keeps the commands set with the trap builtin
+package signals
+
+import (
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+)
+
+type subscription struct {
+	ch   chan<- os.Signal
+	sigs []os.Signal
+}
+
+var (
+	mu            sync.Mutex
+	subscriptions []subscription
+	// relays receive each signal a subscription asked for, on their own
+	// channel so that it can stop being watched without affecting the others
+	relays = make(map[os.Signal]chan os.Signal)
+)
+
+// Notify relays sigs to ch, like signal.Notify. Each signal only goes to the
+// latest channel to start receiving it, so that while the agent chats, Ctrl-C
+// stops the chat instead of reaching the shell. A channel asking for more
+// signals keeps its place.
+func Notify(ch chan<- os.Signal, sigs ...os.Signal) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	i := slices.IndexFunc(subscriptions, func(s subscription) bool { return s.ch == ch })
+	if i < 0 {
+		subscriptions = append(subscriptions, subscription{ch: ch})
+		i = len(subscriptions) - 1
+	}
+	for _, sig := range sigs {
+		if !slices.Contains(subscriptions[i].sigs, sig) {
+			subscriptions[i].sigs = append(subscriptions[i].sigs, sig)
+		}
+		if _, ok := relays[sig]; !ok {
+			relay := make(chan os.Signal, 4)
+			relays[sig] = relay
+			signal.Notify(relay, sig)
+			go forward(relay)
+		}
+	}
+}
+
+// Stop stops relaying sigs, or all signals if none are given, to ch. The
+// signals no other channel asked for get their default behaviour back.
+func Stop(ch chan<- os.Signal, sigs ...os.Signal) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := range subscriptions {
+		if subscriptions[i].ch != ch {
+			continue
+		}
+		if len(sigs) == 0 {
+			subscriptions[i].sigs = nil
+		} else {
+			subscriptions[i].sigs = slices.DeleteFunc(subscriptions[i].sigs, func(sig os.Signal) bool {
+				return slices.Contains(sigs, sig)
+			})
+		}
+	}
+	subscriptions = slices.DeleteFunc(subscriptions, func(s subscription) bool { return len(s.sigs) == 0 })
+
+	for sig, relay := range relays {
+		if subscriber(sig) == nil {
+			signal.Stop(relay)
+			close(relay)
+			delete(relays, sig)
+		}
+	}
+}
+
+// Deliver relays sig as if the shell had received it. The shell acts on a
+// foreground command killed by Ctrl-C as if it was interrupted itself.
+func Deliver(sig os.Signal) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if ch := subscriber(sig); ch != nil {
+		select {
+		case ch <- sig:
+		default:
+		}
+	}
+}
+
+// subscriber returns the channel that last asked for sig. The lock must be
+// held.
+func subscriber(sig os.Signal) chan<- os.Signal {
+	for i := len(subscriptions) - 1; i >= 0; i-- {
+		if slices.Contains(subscriptions[i].sigs, sig) {
+			return subscriptions[i].ch
+		}
+	}
+	return nil
+}
+
+func forward(relay chan os.Signal) {
+	for sig := range relay {
+		Deliver(sig)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package signals
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive returns the signal ch receives, or nil if none arrives soon
+func receive(ch chan os.Signal) os.Signal {
+	select {
+	case sig := <-ch:
+		return sig
+	case <-time.After(500 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestNotify(t *testing.T) {
+	shell := make(chan os.Signal, 1)
+	Notify(shell, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer Stop(shell)
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	assert.Equal(t, syscall.SIGUSR1, receive(shell))
+
+	t.Run("latest channel", func(t *testing.T) {
+		chat := make(chan os.Signal, 1)
+		Notify(chat, syscall.SIGUSR1)
+
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+		assert.Equal(t, syscall.SIGUSR1, receive(chat))
+		assert.Empty(t, shell)
+
+		// Other signals still go to the shell
+		Deliver(syscall.SIGUSR2)
+		assert.Equal(t, syscall.SIGUSR2, receive(shell))
+
+		Stop(chat)
+		Deliver(syscall.SIGUSR1)
+		assert.Equal(t, syscall.SIGUSR1, receive(shell))
+		assert.Empty(t, chat)
+	})
+
+	t.Run("more signals", func(t *testing.T) {
+		chat := make(chan os.Signal, 1)
+		Notify(chat, syscall.SIGUSR1)
+		defer Stop(chat)
+
+		// The shell keeps its place behind the chat
+		Notify(shell, syscall.SIGUSR1, syscall.SIGWINCH)
+		Deliver(syscall.SIGUSR1)
+		assert.Equal(t, syscall.SIGUSR1, receive(chat))
+		Deliver(syscall.SIGWINCH)
+		assert.Equal(t, syscall.SIGWINCH, receive(shell))
+	})
+
+	t.Run("stop some signals", func(t *testing.T) {
+		Stop(shell, syscall.SIGUSR2)
+		Deliver(syscall.SIGUSR2)
+		assert.Nil(t, receive(shell))
+
+		mu.Lock()
+		_, watched := relays[syscall.SIGUSR2]
+		mu.Unlock()
+		assert.False(t, watched)
+
+		Deliver(syscall.SIGUSR1)
+		assert.Equal(t, syscall.SIGUSR1, receive(shell))
+	})
+}
@@ -0,0 +1,319 @@
+package signals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/atinylittleshell/gsh/internal/bash"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Conditions that can be trapped besides signals: EXIT runs when the shell
+// exits, ERR when a command fails and DEBUG before each command line
+const (
+	Exit  = "EXIT"
+	Error = "ERR"
+	Debug = "DEBUG"
+)
+
+// Traps are the commands the trap builtin set to run on signals and
+// conditions, by their names such as INT or EXIT
+type Traps struct {
+	mu      sync.Mutex
+	actions map[string]string
+	// running is set while a trap runs, so that traps don't trigger each other
+	running bool
+}
+
+func NewTraps() *Traps {
+	return &Traps{actions: make(map[string]string)}
+}
+
+// Action returns the command trapped for name. An empty command means the
+// signal is ignored.
+func (t *Traps) Action(name string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	action, ok := t.actions[name]
+	return action, ok
+}
+
+// Signals returns the signals that are trapped or ignored
+func (t *Traps) Signals() []os.Signal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sigs []os.Signal
+	for name := range t.actions {
+		if sig, ok := lookupSignal(name); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// Name returns the name sig is trapped by
+func Name(sig os.Signal) string {
+	if s, ok := sig.(syscall.Signal); ok {
+		return signalName(s)
+	}
+	return ""
+}
+
+func (t *Traps) set(action string, names []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, name := range names {
+		t.actions[name] = action
+	}
+}
+
+func (t *Traps) reset(names []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, name := range names {
+		delete(t.actions, name)
+	}
+}
+
+// Run runs the command trapped for name in runner, unless another trap is
+// running. It reports whether the command exited the shell.
+func (t *Traps) Run(ctx context.Context, runner *interp.Runner, name string) bool {
+	t.mu.Lock()
+	action := t.actions[name]
+	if action == "" || t.running {
+		t.mu.Unlock()
+		return false
+	}
+	t.running = true
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.running = false
+		t.mu.Unlock()
+	}()
+
+	file, err := syntax.NewParser().Parse(strings.NewReader(action), name+" trap")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gsh: %s trap: %v\n", name, err)
+		return false
+	}
+	return bash.RunStatements(ctx, runner, file)
+}
+
+// parseSpec returns the name of a signal or condition given to trap, as a
+// name with or without SIG, or a number
+func parseSpec(spec string) (string, bool) {
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n == 0 {
+			return Exit, true
+		}
+		name = signalName(syscall.Signal(n))
+		return name, name != ""
+	}
+	switch name {
+	case Exit, Error, Debug:
+		return name, true
+	case "KILL", "STOP":
+		// These can't be caught
+		return "", false
+	}
+	_, ok := lookupSignal(name)
+	return name, ok
+}
+
+// order sorts EXIT first, then signals by number, then DEBUG and ERR
+func order(name string) int {
+	switch name {
+	case Exit:
+		return 0
+	case Debug:
+		return 1000
+	case Error:
+		return 1001
+	}
+	sig, _ := lookupSignal(name)
+	return int(sig)
+}
+
+// trapCommand is what a call to trap asks for
+type trapCommand struct {
+	list   bool
+	action string
+	reset  bool
+	specs  []string
+}
+
+func parseTrapArgs(args []string) (trapCommand, error) {
+	var cmd trapCommand
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		switch args[0] {
+		case "-p":
+			cmd.list = true
+		case "-l":
+			return trapCommand{}, errListSignals
+		default:
+			return trapCommand{}, fmt.Errorf("%s: invalid option", args[0])
+		}
+		args = args[1:]
+	}
+
+	switch {
+	case cmd.list || len(args) == 0:
+		cmd.list = true
+		cmd.specs = args
+	case len(args) == 1:
+		// A signal without a command is reset
+		cmd.reset = true
+		cmd.specs = args
+	case args[0] == "-":
+		cmd.reset = true
+		cmd.specs = args[1:]
+	default:
+		cmd.action = args[0]
+		cmd.specs = args[1:]
+	}
+	return cmd, nil
+}
+
+var errListSignals = errors.New("list signals")
+
+// NewTrapCallHandler hands the trap builtin to the trap command handler as
+// gsh_trap, as the interpreter only knows EXIT and ERR and runs EXIT traps
+// whenever it finishes a script. ERR traps are also set in the interpreter,
+// which runs them when a command fails.
+func NewTrapCallHandler(t *Traps) interp.CallHandlerFunc {
+	return func(ctx context.Context, args []string) ([]string, error) {
+		if len(args) == 0 || args[0] != "trap" {
+			return args, nil
+		}
+
+		cmd, err := parseTrapArgs(args[1:])
+		if err == nil && !cmd.list && slices.Contains(cmd.specs, Error) {
+			names := make([]string, 0, len(cmd.specs))
+			for _, spec := range cmd.specs {
+				name, ok := parseSpec(spec)
+				if !ok {
+					// gsh_trap reports the invalid signal
+					return append([]string{"gsh_trap"}, args[1:]...), nil
+				}
+				names = append(names, name)
+			}
+			if cmd.reset {
+				t.reset(names)
+				return []string{"trap", "-", Error}, nil
+			}
+			t.set(cmd.action, names)
+			return []string{"trap", "--", cmd.action, Error}, nil
+		}
+		return append([]string{"gsh_trap"}, args[1:]...), nil
+	}
+}
+
+// NewTrapCommandHandler handles the trap builtin, which sets the commands to
+// run on signals and conditions, and lists them with -p or the signal names
+// with -l
+func NewTrapCommandHandler(t *Traps) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			if len(args) == 0 || args[0] != "gsh_trap" {
+				return next(ctx, args)
+			}
+			return t.trapCommand(interp.HandlerCtx(ctx), args[1:])
+		}
+	}
+}
+
+func (t *Traps) trapCommand(hc interp.HandlerContext, args []string) error {
+	cmd, err := parseTrapArgs(args)
+	if err == errListSignals {
+		printSignals(hc)
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(hc.Stderr, "trap: %v\n", err)
+		fmt.Fprintln(hc.Stderr, "trap: usage: trap [-lp] [[action] signal_spec ...]")
+		return interp.NewExitStatus(2)
+	}
+
+	var status uint8
+	var names []string
+	for _, spec := range cmd.specs {
+		name, ok := parseSpec(spec)
+		if !ok {
+			fmt.Fprintf(hc.Stderr, "trap: %s: invalid signal specification\n", spec)
+			status = 1
+			continue
+		}
+		names = append(names, name)
+	}
+
+	switch {
+	case cmd.list:
+		t.print(hc, names, len(cmd.specs) == 0)
+	case cmd.reset:
+		t.reset(names)
+	default:
+		t.set(cmd.action, names)
+	}
+	return interp.NewExitStatus(status)
+}
+
+// print prints the traps of names, or all of them, as the commands that set
+// them again
+func (t *Traps) print(hc interp.HandlerContext, names []string, all bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if all {
+		names = make([]string, 0, len(t.actions))
+		for name := range t.actions {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return order(names[i]) < order(names[j]) })
+	}
+	for _, name := range names {
+		action, ok := t.actions[name]
+		if !ok {
+			continue
+		}
+		quoted, err := syntax.Quote(action, syntax.LangBash)
+		if err != nil {
+			quoted = strconv.Quote(action)
+		}
+		fmt.Fprintf(hc.Stdout, "trap -- %s %s\n", quoted, name)
+	}
+}
+
+// printSignals lists the signals by number, as trap -l does in bash
+func printSignals(hc interp.HandlerContext) {
+	column := 0
+	for n := 1; n < 65; n++ {
+		name := signalName(syscall.Signal(n))
+		if name == "" {
+			continue
+		}
+		column++
+		separator := "\t"
+		if column%5 == 0 {
+			separator = "\n"
+		}
+		fmt.Fprintf(hc.Stdout, "%2d) SIG%s%s", n, name, separator)
+	}
+	if column%5 != 0 {
+		fmt.Fprintln(hc.Stdout)
+	}
+}
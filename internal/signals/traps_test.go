@@ -0,0 +1,110 @@
+package signals
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// trapShell runs scripts with the trap builtin of the shell
+type trapShell struct {
+	t      *testing.T
+	traps  *Traps
+	runner *interp.Runner
+	out    bytes.Buffer
+}
+
+func newTrapShell(t *testing.T) *trapShell {
+	t.Helper()
+	s := &trapShell{t: t, traps: NewTraps()}
+	runner, err := interp.New(
+		interp.StdIO(nil, &s.out, &s.out),
+		interp.ExecHandlers(NewTrapCommandHandler(s.traps)),
+		interp.CallHandler(NewTrapCallHandler(s.traps)),
+	)
+	require.NoError(t, err)
+	s.runner = runner
+	return s
+}
+
+// run runs script and returns what it printed
+func (s *trapShell) run(script string) string {
+	s.t.Helper()
+	s.out.Reset()
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "test")
+	require.NoError(s.t, err)
+	err = s.runner.Run(context.Background(), file)
+	if _, ok := interp.IsExitStatus(err); !ok {
+		require.NoError(s.t, err)
+	}
+	return s.out.String()
+}
+
+func TestTrap(t *testing.T) {
+	s := newTrapShell(t)
+
+	t.Run("set and list", func(t *testing.T) {
+		assert.Empty(t, s.run(`trap 'echo "bye $USER"' EXIT; trap 'echo int' SIGINT 15; trap '' QUIT; trap : DEBUG`))
+		assert.Equal(t, "trap -- 'echo \"bye $USER\"' EXIT\n"+
+			"trap -- 'echo int' INT\n"+
+			"trap -- '' QUIT\n"+
+			"trap -- 'echo int' TERM\n"+
+			"trap -- : DEBUG\n", s.run("trap -p"))
+		assert.Equal(t, s.run("trap -p"), s.run("trap"))
+		assert.Equal(t, "trap -- 'echo int' INT\n", s.run("trap -p int HUP"))
+		assert.ElementsMatch(t, []any{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM}, s.traps.Signals())
+
+		action, ok := s.traps.Action("QUIT")
+		assert.True(t, ok)
+		assert.Empty(t, action)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		s.run("trap - TERM 3; trap DEBUG")
+		assert.Equal(t, "trap -- 'echo \"bye $USER\"' EXIT\ntrap -- 'echo int' INT\n", s.run("trap -p"))
+		s.run("trap 0")
+		assert.Equal(t, "trap -- 'echo int' INT\n", s.run("trap -p"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.Equal(t, "trap: KILL: invalid signal specification\ntrap: NOPE: invalid signal specification\n1\n",
+			s.run("trap 'echo x' KILL NOPE USR1; echo $?"))
+		assert.Contains(t, s.run("trap -p USR1"), "trap -- 'echo x' USR1\n")
+		assert.Equal(t, "trap: -x: invalid option\ntrap: usage: trap [-lp] [[action] signal_spec ...]\n2\n", s.run("trap -x; echo $?"))
+	})
+
+	t.Run("ERR", func(t *testing.T) {
+		// The interpreter runs ERR traps
+		assert.Equal(t, "failed\n", s.run("trap 'echo failed' ERR; false; true"))
+		assert.Equal(t, "trap -- 'echo failed' ERR\n", s.run("trap -p ERR"))
+		assert.Empty(t, s.run("trap - ERR; false"))
+	})
+
+	t.Run("list signals", func(t *testing.T) {
+		assert.True(t, strings.HasPrefix(s.run("trap -l"), " 1) SIGHUP\t 2) SIGINT\t"))
+	})
+}
+
+func TestRunTrap(t *testing.T) {
+	s := newTrapShell(t)
+	s.run("trap 'echo $((n + 1)); n=2' INT; trap 'echo one; exit 3; echo two' TERM")
+
+	s.out.Reset()
+	assert.False(t, s.traps.Run(context.Background(), s.runner, "INT"))
+	assert.False(t, s.traps.Run(context.Background(), s.runner, "INT"))
+	assert.Equal(t, "1\n3\n", s.out.String())
+
+	s.out.Reset()
+	assert.True(t, s.traps.Run(context.Background(), s.runner, "TERM"))
+	assert.Equal(t, "one\n", s.out.String())
+
+	// Traps that aren't set do nothing
+	assert.False(t, s.traps.Run(context.Background(), s.runner, "HUP"))
+}
@@ -1,28 +1,117 @@
 package styles
 
 import (
-	"os"
+	"strings"
+	"sync/atomic"
 
-	"github.com/muesli/termenv"
+	"github.com/atinylittleshell/gsh/pkg/gline"
+	"github.com/atinylittleshell/gsh/pkg/markdown"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/charmbracelet/lipgloss"
 )
 
-var (
-	stdout = termenv.NewOutput(os.Stdout)
+var current atomic.Pointer[Theme]
+
+func init() {
+	theme, _ := BuiltinTheme("dark")
+	current.Store(theme)
+}
+
+// CurrentTheme returns the theme gsh is drawn with
+func CurrentTheme() *Theme {
+	return current.Load()
+}
+
+// SetTheme changes the theme gsh is drawn with
+func SetTheme(theme *Theme) {
+	current.Store(theme)
+}
 
+// Render applies the named style of the current theme to s, line by line so
+// that lines aren't padded to the same width
+func Render(name string, s string) string {
+	style := CurrentTheme().Style(name)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = style.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
 	ERROR = func(s string) string {
-		return stdout.String(s).
-			Foreground(stdout.Color("9")).
-			String()
+		return Render(Error, s)
 	}
 	AGENT_MESSAGE = func(s string) string {
-		return stdout.String(s).
-			Foreground(stdout.Color("12")).
-			String()
+		return Render(AgentMessage, s)
 	}
 	AGENT_QUESTION = func(s string) string {
-		return stdout.String(s).
-			Foreground(stdout.Color("11")).
-			Bold().
-			String()
+		return Render(AgentQuestion, s)
 	}
 )
+
+// GlineStyles returns the styles of the prompt in the current theme
+func GlineStyles() *gline.Styles {
+	theme := CurrentTheme()
+	return &gline.Styles{
+		Prompt:     theme.Style(Prompt),
+		Prediction: theme.Style(Prediction),
+		Selection:  theme.Style(Selection),
+
+		Explanation:         box(theme.Style(ExplanationBox)),
+		HighRiskExplanation: box(theme.Style(HighRiskBox)),
+		Completion:          box(theme.Style(CompletionBox)),
+	}
+}
+
+// box returns the style of a box with a border of the colour of style, which
+// is thick when style is bold
+func box(style lipgloss.Style) lipgloss.Style {
+	box := gline.BoxStyle(style.GetForeground())
+	if style.GetBold() {
+		box = box.Border(lipgloss.ThickBorder())
+	}
+	return box
+}
+
+// HighlightStyles returns the syntax highlighting styles of the current theme
+func HighlightStyles() shellinput.HighlightStyles {
+	theme := CurrentTheme()
+	return shellinput.HighlightStyles{
+		Builtin:    theme.Style(SyntaxBuiltin),
+		Function:   theme.Style(SyntaxFunction),
+		Alias:      theme.Style(SyntaxAlias),
+		Executable: theme.Style(SyntaxExecutable),
+		Missing:    theme.Style(SyntaxMissing),
+		Keyword:    theme.Style(SyntaxKeyword),
+		String:     theme.Style(SyntaxString),
+		Variable:   theme.Style(SyntaxVariable),
+		Redirect:   theme.Style(SyntaxRedirect),
+		Operator:   theme.Style(SyntaxOperator),
+		Comment:    theme.Style(SyntaxComment),
+		Unbalanced: theme.Style(SyntaxUnbalanced),
+	}
+}
+
+// MarkdownStyles returns the styles of agent responses in the current theme
+func MarkdownStyles() markdown.Styles {
+	theme := CurrentTheme()
+	styles := markdown.DefaultStyles()
+	styles.Text = theme.Style(AgentMessage)
+	styles.Heading = theme.Style(MarkdownHeading)
+	styles.InlineCode = theme.Style(MarkdownCode)
+	styles.Link = theme.Style(MarkdownLink)
+	styles.LinkURL = theme.Style(MarkdownURL)
+	styles.Quote = theme.Style(MarkdownQuote)
+	styles.ListMarker = theme.Style(MarkdownListMarker)
+	styles.Rule = theme.Style(MarkdownRule)
+	styles.TableBorder = theme.Style(MarkdownTable)
+	styles.CodeLabel = theme.Style(CodeLabel)
+	styles.CodeKeyword = theme.Style(CodeKeyword)
+	styles.CodeString = theme.Style(CodeString)
+	styles.CodeComment = theme.Style(CodeComment)
+	styles.CodeNumber = theme.Style(CodeNumber)
+	return styles
+}
@@ -0,0 +1,364 @@
+package styles
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Names of the styles a theme defines
+const (
+	Prompt     = "prompt"
+	Prediction = "prediction"
+	Selection  = "selection"
+
+	PromptExitCode = "prompt.exit"
+	PromptDuration = "prompt.duration"
+	PromptGit      = "prompt.git"
+	PromptGitDirty = "prompt.git.dirty"
+	PromptSubagent = "prompt.subagent"
+
+	ExplanationBox = "explanation"
+	CompletionBox  = "completion"
+	HighRiskBox    = "risk.high"
+
+	Error         = "error"
+	AgentMessage  = "agent.message"
+	AgentQuestion = "agent.question"
+
+	PermissionTitle    = "permission.title"
+	PermissionSelected = "permission.selected"
+	PermissionEnabled  = "permission.enabled"
+	PermissionHint     = "permission.hint"
+
+	DiffHeader  = "diff.header"
+	DiffHunk    = "diff.hunk"
+	DiffAdded   = "diff.added"
+	DiffRemoved = "diff.removed"
+
+	SyntaxBuiltin    = "syntax.builtin"
+	SyntaxFunction   = "syntax.function"
+	SyntaxAlias      = "syntax.alias"
+	SyntaxExecutable = "syntax.executable"
+	SyntaxMissing    = "syntax.missing"
+	SyntaxKeyword    = "syntax.keyword"
+	SyntaxString     = "syntax.string"
+	SyntaxVariable   = "syntax.variable"
+	SyntaxRedirect   = "syntax.redirect"
+	SyntaxOperator   = "syntax.operator"
+	SyntaxComment    = "syntax.comment"
+	SyntaxUnbalanced = "syntax.unbalanced"
+
+	MarkdownHeading    = "markdown.heading"
+	MarkdownCode       = "markdown.code"
+	MarkdownLink       = "markdown.link"
+	MarkdownURL        = "markdown.url"
+	MarkdownQuote      = "markdown.quote"
+	MarkdownListMarker = "markdown.list"
+	MarkdownRule       = "markdown.rule"
+	MarkdownTable      = "markdown.table"
+
+	CodeLabel   = "code.label"
+	CodeKeyword = "code.keyword"
+	CodeString  = "code.string"
+	CodeComment = "code.comment"
+	CodeNumber  = "code.number"
+)
+
+// StyleNames lists the names of the styles a theme defines
+var StyleNames = []string{
+	Prompt, Prediction, Selection,
+	PromptExitCode, PromptDuration, PromptGit, PromptGitDirty, PromptSubagent,
+	ExplanationBox, CompletionBox, HighRiskBox,
+	Error, AgentMessage, AgentQuestion,
+	PermissionTitle, PermissionSelected, PermissionEnabled, PermissionHint,
+	DiffHeader, DiffHunk, DiffAdded, DiffRemoved,
+	SyntaxBuiltin, SyntaxFunction, SyntaxAlias, SyntaxExecutable, SyntaxMissing, SyntaxKeyword,
+	SyntaxString, SyntaxVariable, SyntaxRedirect, SyntaxOperator, SyntaxComment, SyntaxUnbalanced,
+	MarkdownHeading, MarkdownCode, MarkdownLink, MarkdownURL, MarkdownQuote, MarkdownListMarker,
+	MarkdownRule, MarkdownTable,
+	CodeLabel, CodeKeyword, CodeString, CodeComment, CodeNumber,
+}
+
+// Theme maps the names of styles to their specs. A spec is a list of words:
+// a foreground colour, "on" followed by a background colour, and attributes
+// such as bold. Colours are ANSI colour numbers, #rrggbb, or names like red
+// and bright-blue.
+type Theme struct {
+	Name  string
+	specs map[string]string
+}
+
+// Style returns the named style of the theme
+func (t *Theme) Style(name string) lipgloss.Style {
+	style, _ := parseStyle(t.specs[name])
+	return style
+}
+
+// Spec returns the spec of the named style
+func (t *Theme) Spec(name string) string {
+	return t.specs[name]
+}
+
+var builtinThemes = map[string]map[string]string{
+	"dark": {
+		Prompt: "", Prediction: "240", Selection: "reverse",
+		PromptExitCode: "9", PromptDuration: "11", PromptGit: "13", PromptGitDirty: "11", PromptSubagent: "12",
+		ExplanationBox: "12", CompletionBox: "10", HighRiskBox: "9",
+		Error: "9", AgentMessage: "12", AgentQuestion: "11 bold",
+		PermissionTitle: "11 bold", PermissionSelected: "12 bold", PermissionEnabled: "10", PermissionHint: "244",
+		DiffHeader: "bold", DiffHunk: "6", DiffAdded: "2", DiffRemoved: "1",
+		SyntaxBuiltin: "6", SyntaxFunction: "4", SyntaxAlias: "5", SyntaxExecutable: "2", SyntaxMissing: "9",
+		SyntaxKeyword: "13", SyntaxString: "3", SyntaxVariable: "14", SyntaxRedirect: "11", SyntaxOperator: "12",
+		SyntaxComment: "244", SyntaxUnbalanced: "15 on 9",
+		MarkdownHeading: "13 bold", MarkdownCode: "3", MarkdownLink: "14 underline", MarkdownURL: "244",
+		MarkdownQuote: "244", MarkdownListMarker: "6", MarkdownRule: "244", MarkdownTable: "244",
+		CodeLabel: "244", CodeKeyword: "13", CodeString: "3", CodeComment: "244", CodeNumber: "14",
+	},
+	"light": {
+		Prompt: "", Prediction: "247", Selection: "reverse",
+		PromptExitCode: "1", PromptDuration: "130", PromptGit: "90", PromptGitDirty: "130", PromptSubagent: "4",
+		ExplanationBox: "4", CompletionBox: "2", HighRiskBox: "1",
+		Error: "1", AgentMessage: "4", AgentQuestion: "130 bold",
+		PermissionTitle: "130 bold", PermissionSelected: "4 bold", PermissionEnabled: "2", PermissionHint: "244",
+		DiffHeader: "bold", DiffHunk: "6", DiffAdded: "2", DiffRemoved: "1",
+		SyntaxBuiltin: "6", SyntaxFunction: "4", SyntaxAlias: "5", SyntaxExecutable: "2", SyntaxMissing: "1",
+		SyntaxKeyword: "90", SyntaxString: "130", SyntaxVariable: "30", SyntaxRedirect: "94", SyntaxOperator: "4",
+		SyntaxComment: "245", SyntaxUnbalanced: "15 on 1",
+		MarkdownHeading: "90 bold", MarkdownCode: "130", MarkdownLink: "25 underline", MarkdownURL: "245",
+		MarkdownQuote: "245", MarkdownListMarker: "30", MarkdownRule: "250", MarkdownTable: "250",
+		CodeLabel: "245", CodeKeyword: "90", CodeString: "130", CodeComment: "245", CodeNumber: "30",
+	},
+	"solarized-dark":  solarized("#586e75", "#93a1a1"),
+	"solarized-light": solarized("#93a1a1", "#586e75"),
+	"monochrome": {
+		Prompt: "", Prediction: "faint", Selection: "reverse",
+		PromptExitCode: "bold", PromptDuration: "faint", PromptGit: "", PromptGitDirty: "bold", PromptSubagent: "italic",
+		ExplanationBox: "", CompletionBox: "", HighRiskBox: "bold",
+		Error: "bold", AgentMessage: "", AgentQuestion: "bold",
+		PermissionTitle: "bold", PermissionSelected: "reverse", PermissionEnabled: "bold", PermissionHint: "faint",
+		DiffHeader: "bold", DiffHunk: "faint", DiffAdded: "bold", DiffRemoved: "strikethrough",
+		SyntaxBuiltin: "", SyntaxFunction: "", SyntaxAlias: "", SyntaxExecutable: "", SyntaxMissing: "underline",
+		SyntaxKeyword: "bold", SyntaxString: "", SyntaxVariable: "italic", SyntaxRedirect: "", SyntaxOperator: "",
+		SyntaxComment: "faint", SyntaxUnbalanced: "reverse",
+		MarkdownHeading: "bold", MarkdownCode: "italic", MarkdownLink: "underline", MarkdownURL: "faint",
+		MarkdownQuote: "faint", MarkdownListMarker: "", MarkdownRule: "faint", MarkdownTable: "faint",
+		CodeLabel: "faint", CodeKeyword: "bold", CodeString: "", CodeComment: "faint", CodeNumber: "",
+	},
+}
+
+// solarized returns the specs of a solarized theme, which differ between its
+// dark and light variants only in their muted and emphasised greys
+func solarized(muted string, emphasised string) map[string]string {
+	return map[string]string{
+		Prompt: "", Prediction: muted, Selection: "reverse",
+		PromptExitCode: "#dc322f", PromptDuration: "#b58900", PromptGit: "#d33682", PromptGitDirty: "#cb4b16", PromptSubagent: "#268bd2",
+		ExplanationBox: "#268bd2", CompletionBox: "#859900", HighRiskBox: "#dc322f",
+		Error: "#dc322f", AgentMessage: "#268bd2", AgentQuestion: "#b58900 bold",
+		PermissionTitle: "#b58900 bold", PermissionSelected: emphasised + " bold", PermissionEnabled: "#859900", PermissionHint: muted,
+		DiffHeader: emphasised + " bold", DiffHunk: "#2aa198", DiffAdded: "#859900", DiffRemoved: "#dc322f",
+		SyntaxBuiltin: "#2aa198", SyntaxFunction: "#268bd2", SyntaxAlias: "#6c71c4", SyntaxExecutable: "#859900", SyntaxMissing: "#dc322f",
+		SyntaxKeyword: "#d33682", SyntaxString: "#b58900", SyntaxVariable: "#cb4b16", SyntaxRedirect: "#6c71c4", SyntaxOperator: "#268bd2",
+		SyntaxComment: muted, SyntaxUnbalanced: "#fdf6e3 on #dc322f",
+		MarkdownHeading: "#d33682 bold", MarkdownCode: "#b58900", MarkdownLink: "#2aa198 underline", MarkdownURL: muted,
+		MarkdownQuote: muted, MarkdownListMarker: "#2aa198", MarkdownRule: muted, MarkdownTable: muted,
+		CodeLabel: muted, CodeKeyword: "#d33682", CodeString: "#b58900", CodeComment: muted, CodeNumber: "#2aa198",
+	}
+}
+
+// BuiltinThemeNames returns the names of the built-in themes
+func BuiltinThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuiltinTheme returns the built-in theme of the given name
+func BuiltinTheme(name string) (*Theme, bool) {
+	specs, ok := builtinThemes[name]
+	if !ok {
+		return nil, false
+	}
+	theme := &Theme{Name: name, specs: make(map[string]string, len(specs))}
+	for style, spec := range specs {
+		theme.specs[style] = spec
+	}
+	return theme, true
+}
+
+// hasDarkBackground reports whether the terminal has a dark background
+var hasDarkBackground = lipgloss.HasDarkBackground
+
+// AutoTheme returns the dark or the light theme, whichever suits the
+// background of the terminal
+func AutoTheme() *Theme {
+	if hasDarkBackground() {
+		theme, _ := BuiltinTheme("dark")
+		return theme
+	}
+	theme, _ := BuiltinTheme("light")
+	return theme
+}
+
+// LoadTheme returns the theme GSH_THEME is set to: "auto" or empty for the
+// dark or light theme depending on the terminal, the name of a built-in
+// theme, or the path of a theme file
+func LoadTheme(setting string) (*Theme, error) {
+	setting = strings.TrimSpace(setting)
+	if setting == "" || setting == "auto" {
+		return AutoTheme(), nil
+	}
+	if theme, ok := BuiltinTheme(setting); ok {
+		return theme, nil
+	}
+
+	file, err := os.Open(setting)
+	if os.IsNotExist(err) && !strings.ContainsRune(setting, filepath.Separator) && !strings.ContainsRune(setting, '/') {
+		return nil, fmt.Errorf("unknown theme %q, the built-in themes are auto, %s", setting, strings.Join(BuiltinThemeNames(), ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseTheme(setting, file)
+}
+
+var themeLine = regexp.MustCompile(`^([a-z.\-]+)\s*=\s*(.*)$`)
+
+// ParseTheme reads a theme file. Each line sets a style as "name = spec".
+// The styles it doesn't set are those of the theme that suits the terminal,
+// or of the built-in theme named by a first line "base = name". Lines
+// starting with # are comments.
+func ParseTheme(name string, r io.Reader) (*Theme, error) {
+	styleNames := make(map[string]bool, len(StyleNames))
+	for _, style := range StyleNames {
+		styleNames[style] = true
+	}
+
+	var theme *Theme
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := themeLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("%s:%d: expected name = spec", name, lineNumber)
+		}
+		key, spec := match[1], strings.TrimSpace(match[2])
+
+		if key == "base" {
+			if theme != nil {
+				return nil, fmt.Errorf("%s:%d: base must come before the styles", name, lineNumber)
+			}
+			base, ok := BuiltinTheme(spec)
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: unknown base theme %q", name, lineNumber, spec)
+			}
+			theme = base
+			theme.Name = name
+			continue
+		}
+		if theme == nil {
+			theme = AutoTheme()
+			theme.Name = name
+		}
+		if !styleNames[key] {
+			return nil, fmt.Errorf("%s:%d: unknown style %q", name, lineNumber, key)
+		}
+		if _, err := parseStyle(spec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		theme.specs[key] = spec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if theme == nil {
+		theme = AutoTheme()
+		theme.Name = name
+	}
+	return theme, nil
+}
+
+var colourNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// parseColour returns the colour a spec word names
+func parseColour(word string) (lipgloss.Color, bool) {
+	if n, err := strconv.Atoi(word); err == nil && n >= 0 && n <= 255 {
+		return lipgloss.Color(word), true
+	}
+	if strings.HasPrefix(word, "#") {
+		if _, err := strconv.ParseUint(word[1:], 16, 32); err == nil && (len(word) == 4 || len(word) == 7) {
+			return lipgloss.Color(word), true
+		}
+		return "", false
+	}
+	bright := strings.HasPrefix(word, "bright-")
+	for i, name := range colourNames {
+		if strings.TrimPrefix(word, "bright-") == name {
+			if bright {
+				i += 8
+			}
+			return lipgloss.Color(strconv.Itoa(i)), true
+		}
+	}
+	if word == "gray" || word == "grey" {
+		return lipgloss.Color("8"), true
+	}
+	return "", false
+}
+
+// parseStyle returns the style a spec describes
+func parseStyle(spec string) (lipgloss.Style, error) {
+	style := lipgloss.NewStyle()
+	words := strings.Fields(strings.ToLower(spec))
+	for i := 0; i < len(words); i++ {
+		switch word := words[i]; word {
+		case "none", "default":
+		case "bold":
+			style = style.Bold(true)
+		case "faint":
+			style = style.Faint(true)
+		case "italic":
+			style = style.Italic(true)
+		case "underline":
+			style = style.Underline(true)
+		case "reverse":
+			style = style.Reverse(true)
+		case "strikethrough":
+			style = style.Strikethrough(true)
+		case "blink":
+			style = style.Blink(true)
+		case "on":
+			if i+1 == len(words) {
+				return style, fmt.Errorf("expected a background colour after \"on\"")
+			}
+			i++
+			colour, ok := parseColour(words[i])
+			if !ok {
+				return style, fmt.Errorf("invalid colour %q", words[i])
+			}
+			style = style.Background(colour)
+		default:
+			colour, ok := parseColour(word)
+			if !ok {
+				return style, fmt.Errorf("invalid colour or attribute %q", word)
+			}
+			style = style.Foreground(colour)
+		}
+	}
+	return style, nil
+}
@@ -0,0 +1,102 @@
+package styles
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinThemesDefineEveryStyle(t *testing.T) {
+	for _, name := range BuiltinThemeNames() {
+		theme, ok := BuiltinTheme(name)
+		require.True(t, ok)
+		for _, style := range StyleNames {
+			spec, defined := theme.specs[style]
+			assert.True(t, defined, "%s doesn't define %s", name, style)
+			_, err := parseStyle(spec)
+			assert.NoError(t, err, "%s: %s", name, style)
+		}
+		assert.Len(t, theme.specs, len(StyleNames), name)
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	style, err := parseStyle("bright-red on #002b36 bold underline")
+	require.NoError(t, err)
+	assert.Equal(t, lipgloss.Color("9"), style.GetForeground())
+	assert.Equal(t, lipgloss.Color("#002b36"), style.GetBackground())
+	assert.True(t, style.GetBold())
+	assert.True(t, style.GetUnderline())
+
+	style, err = parseStyle("244")
+	require.NoError(t, err)
+	assert.Equal(t, lipgloss.Color("244"), style.GetForeground())
+
+	for _, spec := range []string{"256", "#12345", "purple", "bold on"} {
+		_, err := parseStyle(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	dark := true
+	defer func(f func() bool) { hasDarkBackground = f }(hasDarkBackground)
+	hasDarkBackground = func() bool { return dark }
+
+	theme, err := LoadTheme("")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", theme.Name)
+
+	dark = false
+	theme, err = LoadTheme("auto")
+	require.NoError(t, err)
+	assert.Equal(t, "light", theme.Name, "auto picks the theme that suits the background")
+
+	theme, err = LoadTheme("solarized-dark")
+	require.NoError(t, err)
+	assert.Equal(t, "#268bd2", theme.Spec(AgentMessage))
+
+	_, err = LoadTheme("nope")
+	assert.ErrorContains(t, err, "monochrome", "the error lists the built-in themes")
+
+	path := filepath.Join(t.TempDir(), "my.theme")
+	require.NoError(t, os.WriteFile(path, []byte("# Mine\nbase = monochrome\n\nagent.message = cyan italic\n"), 0644))
+	theme, err = LoadTheme(path)
+	require.NoError(t, err)
+	assert.Equal(t, "cyan italic", theme.Spec(AgentMessage))
+	assert.Equal(t, "faint", theme.Spec(Prediction), "styles the file doesn't set are those of its base")
+
+	_, err = LoadTheme(filepath.Join(t.TempDir(), "missing.theme"))
+	assert.Error(t, err)
+}
+
+func TestParseTheme(t *testing.T) {
+	defer func(f func() bool) { hasDarkBackground = f }(hasDarkBackground)
+	hasDarkBackground = func() bool { return false }
+
+	theme, err := ParseTheme("t", strings.NewReader("error = red bold"))
+	require.NoError(t, err)
+	assert.Equal(t, "red bold", theme.Spec(Error))
+	assert.Equal(t, "4", theme.Spec(AgentMessage), "without a base, the rest is the theme that suits the background")
+
+	tests := map[string]string{
+		"error red":                        "t:1: expected name = spec",
+		"\nnope = red":                     `t:2: unknown style "nope"`,
+		"error = sparkly":                  `t:1: invalid colour or attribute "sparkly"`,
+		"base = nope":                      `t:1: unknown base theme "nope"`,
+		"error = red\nbase = monochrome\n": "t:2: base must come before the styles",
+	}
+	for source, expected := range tests {
+		_, err := ParseTheme("t", strings.NewReader(source))
+		assert.EqualError(t, err, expected, source)
+	}
+}
+
+func TestRenderDoesNotPadLines(t *testing.T) {
+	assert.Equal(t, "a\nlonger line\n", Render(AgentMessage, "a\nlonger line\n"))
+}
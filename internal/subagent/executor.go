@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/signal"
 	"regexp"
 	"strings"
 
 	"github.com/atinylittleshell/gsh/internal/agent/tools"
 	"github.com/atinylittleshell/gsh/internal/history"
+	"github.com/atinylittleshell/gsh/internal/signals"
 	"github.com/atinylittleshell/gsh/internal/styles"
 	"github.com/atinylittleshell/gsh/internal/utils"
 	"github.com/atinylittleshell/gsh/pkg/gline"
@@ -154,22 +154,22 @@ func (e *SubagentExecutor) Chat(prompt string) (<-chan string, error) {
 
 	// Set up signal handling
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
+	signals.Notify(signalChan, os.Interrupt)
 
 	go func() {
 		select {
 		case <-signalChan:
 			cancel()
-			signal.Stop(signalChan)
+			signals.Stop(signalChan)
 		case <-ctx.Done():
-			signal.Stop(signalChan)
+			signals.Stop(signalChan)
 		}
 	}()
 
 	go func() {
 		defer close(responseChannel)
 		defer cancel()
-		defer signal.Stop(signalChan)
+		defer signals.Stop(signalChan)
 
 		continueSession := true
 
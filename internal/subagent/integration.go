@@ -1,10 +1,12 @@
 package subagent
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/atinylittleshell/gsh/internal/completion"
+	"github.com/atinylittleshell/gsh/internal/environment"
 	"github.com/atinylittleshell/gsh/internal/history"
 	"github.com/atinylittleshell/gsh/internal/styles"
 	"github.com/atinylittleshell/gsh/pkg/gline"
@@ -112,9 +114,12 @@ func (si *SubagentIntegration) parseSubagentCommand(chatMessage string) (string,
 	// Use the intelligent selector to find the best subagent for the entire message
 	availableSubagents := si.manager.GetAllSubagents()
 	if len(availableSubagents) > 0 {
-		selectedSubagent, err := si.selector.SelectBestSubagent(chatMessage, availableSubagents)
-		if err == nil && selectedSubagent != nil {
-			return selectedSubagent.ID, chatMessage
+		selection, err := si.selector.SelectBestSubagent(chatMessage, availableSubagents)
+		if selection != nil && environment.ShouldShowSubagentSelectionReason(si.runner) {
+			si.showSelectionReason(selection, err)
+		}
+		if err == nil {
+			return selection.Subagent.ID, chatMessage
 		}
 		// Log the error but continue with fallback
 		si.logger.Debug("Intelligent subagent selection failed, trying fallback", zap.Error(err))
@@ -135,6 +140,24 @@ func (si *SubagentIntegration) parseSubagentCommand(chatMessage string) (string,
 	return "", "" // Not a subagent command
 }
 
+// showSelectionReason prints why a subagent was or wasn't auto-selected for a prompt
+func (si *SubagentIntegration) showSelectionReason(selection *Selection, err error) {
+	var message string
+	switch {
+	case err == nil:
+		message = fmt.Sprintf("gsh: Selected %s (%d%% confidence, %s): %s\n",
+			selection.Subagent.Name, selection.Confidence, selection.Source, selection.Reasoning)
+	case errors.Is(err, ErrLowConfidence):
+		message = fmt.Sprintf("gsh: Best match %s is below the confidence threshold (%d%% < %d%%, %s): %s\n",
+			selection.Subagent.Name, selection.Confidence,
+			environment.GetSubagentMinConfidence(si.runner, si.logger), selection.Source, selection.Reasoning)
+	default:
+		message = fmt.Sprintf("gsh: No subagent selected (%s): %s\n", selection.Source, selection.Reasoning)
+	}
+
+	fmt.Print(gline.RESET_CURSOR_COLUMN + styles.AGENT_MESSAGE(message) + gline.RESET_CURSOR_COLUMN)
+}
+
 // getExecutor gets or creates an executor for a subagent
 func (si *SubagentIntegration) getExecutor(subagent *Subagent) *SubagentExecutor {
 	if executor, exists := si.executors[subagent.ID]; exists {
@@ -163,8 +186,9 @@ func (si *SubagentIntegration) HandleAgentControl(control string) bool {
 		if err := si.manager.Reload(si.logger); err != nil {
 			fmt.Print(gline.RESET_CURSOR_COLUMN + styles.ERROR(fmt.Sprintf("Failed to reload subagents: %s", err)) + "\n")
 		} else {
-			// Clear executor cache to pick up changes
+			// Clear the executor and selection caches to pick up changes
 			si.executors = make(map[string]*SubagentExecutor)
+			si.selector.ClearCache()
 			fmt.Print(gline.RESET_CURSOR_COLUMN + styles.AGENT_MESSAGE("gsh: Subagents reloaded successfully.\n") + gline.RESET_CURSOR_COLUMN)
 		}
 		return true
@@ -211,6 +235,12 @@ func (si *SubagentIntegration) showSubagentInfo(subagentID string) {
 		info.WriteString(fmt.Sprintf("Model: %s\n", subagent.Model))
 	}
 	info.WriteString(fmt.Sprintf("Configuration File: %s\n", subagent.FilePath))
+	if subagent.SourceDir != "" {
+		info.WriteString(fmt.Sprintf("Source Directory: %s\n", subagent.SourceDir))
+	}
+	for _, shadowed := range si.manager.GetShadowedSubagents(subagent.ID) {
+		info.WriteString(fmt.Sprintf("Shadows: %s\n", shadowed.FilePath))
+	}
 
 	fmt.Print(gline.RESET_CURSOR_COLUMN + styles.AGENT_MESSAGE("gsh: "+info.String()) + gline.RESET_CURSOR_COLUMN)
 }
@@ -247,8 +277,9 @@ func (si *SubagentIntegration) ensureSubagentsUpToDate() {
 		if err := si.manager.LoadSubagents(si.logger); err != nil {
 			si.logger.Warn("Failed to reload subagents", zap.Error(err))
 		} else {
-			// Clear executor cache when subagents are reloaded to pick up new configurations
+			// Clear the executor and selection caches when subagents are reloaded to pick up new configurations
 			si.executors = make(map[string]*SubagentExecutor)
+			si.selector.ClearCache()
 			si.logger.Debug("Subagents reloaded successfully")
 		}
 	}
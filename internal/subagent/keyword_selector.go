@@ -0,0 +1,205 @@
+package subagent
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Field weights used when matching prompt keywords against a subagent's configuration
+const (
+	keywordWeightName        = 3.0
+	keywordWeightDescription = 2.0
+	keywordWeightPrompt      = 1.0
+
+	// Only the beginning of a system prompt is indexed; it usually states the role
+	keywordMaxPromptChars = 1000
+
+	// Keyword overlap alone never justifies full certainty
+	keywordMaxConfidence = 90
+)
+
+var keywordStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "can": true, "do": true, "for": true, "from": true, "help": true, "how": true,
+	"i": true, "in": true, "is": true, "it": true, "me": true, "my": true, "of": true,
+	"on": true, "or": true, "please": true, "that": true, "the": true, "this": true,
+	"to": true, "use": true, "we": true, "what": true, "when": true, "with": true,
+	"you": true, "your": true,
+}
+
+// KeywordSelector selects subagents by matching prompt keywords against their names,
+// descriptions and system prompts. It needs no model, so it works fully offline.
+type KeywordSelector struct{}
+
+// NewKeywordSelector creates a new offline keyword-based subagent selector
+func NewKeywordSelector() *KeywordSelector {
+	return &KeywordSelector{}
+}
+
+// Select returns the subagent whose configuration best matches the prompt.
+// The selection's Subagent is nil when no keywords matched at all.
+func (k *KeywordSelector) Select(prompt string, availableSubagents map[string]*Subagent) *Selection {
+	promptTokens := uniqueTokens(tokenize(prompt))
+	if len(promptTokens) == 0 {
+		return &Selection{Reasoning: "prompt has no keywords to match", Source: SelectionSourceKeyword}
+	}
+
+	// Iterate in a stable order so ties resolve deterministically
+	ids := make([]string, 0, len(availableSubagents))
+	for id := range availableSubagents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	weights := make(map[string]map[string]float64, len(ids))
+	documentFrequency := make(map[string]int)
+	for _, id := range ids {
+		weights[id] = subagentKeywordWeights(availableSubagents[id])
+		for token := range weights[id] {
+			documentFrequency[token]++
+		}
+	}
+
+	var bestID, secondID string
+	var bestScore, secondScore float64
+	var bestMatches []string
+	for _, id := range ids {
+		score := 0.0
+		var matches []string
+		for _, token := range promptTokens {
+			weight, ok := weights[id][token]
+			if !ok {
+				continue
+			}
+			// Keywords shared by every subagent don't help tell them apart
+			idf := math.Log(1 + float64(len(ids))/float64(documentFrequency[token]))
+			score += weight * idf
+			matches = append(matches, token)
+		}
+
+		if score > bestScore {
+			secondID, secondScore = bestID, bestScore
+			bestID, bestScore, bestMatches = id, score, matches
+		} else if score > secondScore {
+			secondID, secondScore = id, score
+		}
+	}
+
+	if bestID == "" {
+		return &Selection{Reasoning: "no subagent matched any keyword in the prompt", Source: SelectionSourceKeyword}
+	}
+
+	subagent := availableSubagents[bestID]
+
+	// An explicit mention of the subagent is as strong a signal as we can get offline
+	if mentionsSubagent(promptTokens, subagent) {
+		return &Selection{
+			Subagent:   subagent,
+			Confidence: 95,
+			Reasoning:  fmt.Sprintf("prompt mentions %s by name", subagent.Name),
+			Source:     SelectionSourceKeyword,
+		}
+	}
+
+	// Confidence blends how much of the prompt matched with how clearly the best
+	// candidate beats the runner-up
+	coverage := math.Min(1, 2*float64(len(bestMatches))/float64(len(promptTokens)))
+	margin := (bestScore - secondScore) / bestScore
+	confidence := int(math.Round(keywordMaxConfidence * (0.5*coverage + 0.5*margin)))
+
+	reasoning := fmt.Sprintf("matched keywords: %s", strings.Join(bestMatches, ", "))
+	if secondID != "" {
+		reasoning += fmt.Sprintf(" (runner-up: %s)", availableSubagents[secondID].Name)
+	}
+
+	return &Selection{
+		Subagent:   subagent,
+		Confidence: confidence,
+		Reasoning:  reasoning,
+		Source:     SelectionSourceKeyword,
+	}
+}
+
+// subagentKeywordWeights returns the highest field weight for each keyword in a subagent's configuration
+func subagentKeywordWeights(subagent *Subagent) map[string]float64 {
+	weights := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, token := range tokenize(text) {
+			if weight > weights[token] {
+				weights[token] = weight
+			}
+		}
+	}
+
+	systemPrompt := subagent.SystemPrompt
+	if len(systemPrompt) > keywordMaxPromptChars {
+		systemPrompt = systemPrompt[:keywordMaxPromptChars]
+	}
+
+	add(systemPrompt, keywordWeightPrompt)
+	add(subagent.Description, keywordWeightDescription)
+	add(subagent.ID+" "+subagent.Name, keywordWeightName)
+	return weights
+}
+
+// mentionsSubagent reports whether every keyword of the subagent's ID or name appears in the prompt
+func mentionsSubagent(promptTokens []string, subagent *Subagent) bool {
+	present := make(map[string]bool, len(promptTokens))
+	for _, token := range promptTokens {
+		present[token] = true
+	}
+
+	for _, label := range []string{subagent.ID, subagent.Name} {
+		labelTokens := tokenize(label)
+		if len(labelTokens) < 2 {
+			// Single-word names like "debug" are too common to count as a mention
+			continue
+		}
+		all := true
+		for _, token := range labelTokens {
+			if !present[token] {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits text into lowercase keywords, dropping stop words and plural suffixes
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if len(field) < 2 || keywordStopWords[field] {
+			continue
+		}
+		if len(field) > 3 && strings.HasSuffix(field, "s") && !strings.HasSuffix(field, "ss") {
+			field = field[:len(field)-1]
+		}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+// uniqueTokens removes duplicate tokens while preserving their order
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	result := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			result = append(result, token)
+		}
+	}
+	return result
+}
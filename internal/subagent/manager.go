@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -25,66 +26,129 @@ const (
 
 // NewSubagentManager creates a new SubagentManager with default configuration directories
 func NewSubagentManager(runner *interp.Runner, logger *zap.Logger) *SubagentManager {
-	currentPWD := runner.Vars["PWD"].String()
 	manager := &SubagentManager{
 		subagents:   make(map[string]*Subagent),
+		shadowed:    make(map[string][]*Subagent),
 		directories: getDefaultDirectories(runner),
 		runner:      runner,
-		currentPWD:  currentPWD,
 	}
 	return manager
 }
 
-// getDefaultDirectories returns the default directories to scan for subagent configurations
-func getDefaultDirectories(runner *interp.Runner) []string {
+// searchPath is a configuration path to scan together with the directory it was discovered from
+type searchPath struct {
+	Path string // Configuration directory or file to scan
+	Root string // Directory whose .claude/.roo configuration contains Path
+}
+
+// getDefaultDirectories returns the default directories to scan for subagent configurations.
+// Paths are ordered nearest-first: PWD, each parent up to the discovery root, and finally HOME.
+func getDefaultDirectories(runner *interp.Runner) []searchPath {
 	homeDir := runner.Vars["HOME"].String()
 	pwd := runner.Vars["PWD"].String()
 
-	var directories []string
+	var directories []searchPath
 
-	// Project-level configurations (higher priority)
-	directories = append(directories, filepath.Join(pwd, ".claude", "agents"))
+	// Project-level configurations (higher priority, nearest directory wins)
+	visitedHome := false
+	for _, dir := range getDiscoveryChain(pwd, runner.Vars["GSH_SUBAGENT_ROOT"].String()) {
+		if homeDir != "" && dir == filepath.Clean(homeDir) {
+			visitedHome = true
+		}
+		directories = append(directories, getConfigPaths(dir)...)
+	}
 
-	// Project-level .roomodes file
-	projectRoomodesFile := filepath.Join(pwd, ".roomodes")
-	if _, err := os.Stat(projectRoomodesFile); err == nil {
-		directories = append(directories, projectRoomodesFile)
+	// User-level configurations (lower priority)
+	if homeDir != "" && !visitedHome {
+		directories = append(directories, getConfigPaths(homeDir)...)
 	}
 
-	// Scan for Roo custom mode directories (.roo/rules-{modeSlug}/)
-	rooBaseDir := filepath.Join(pwd, ".roo")
-	if rooModesDirs := getRooModesDirectories(rooBaseDir); len(rooModesDirs) > 0 {
-		directories = append(directories, rooModesDirs...)
+	return directories
+}
+
+// getDiscoveryChain returns the directories from pwd up to the discovery root, nearest first.
+// The root is rootOverride when pwd is inside it, otherwise the enclosing git repository root.
+// When neither applies only pwd itself is searched.
+func getDiscoveryChain(pwd string, rootOverride string) []string {
+	if pwd == "" {
+		return nil
 	}
+	pwd = filepath.Clean(pwd)
 
-	// Scan for Roo YAML mode files (.roo/modes/)
-	rooModesDir := filepath.Join(pwd, ".roo", "modes")
-	if _, err := os.Stat(rooModesDir); err == nil {
-		directories = append(directories, rooModesDir)
+	root := ""
+	if rootOverride != "" {
+		rootOverride = filepath.Clean(rootOverride)
+		if isWithinDirectory(pwd, rootOverride) {
+			root = rootOverride
+		}
+	}
+	if root == "" {
+		root = findGitRoot(pwd)
+	}
+	if root == "" {
+		return []string{pwd}
 	}
 
-	// User-level configurations (lower priority)
-	directories = append(directories, filepath.Join(homeDir, ".claude", "agents"))
+	var chain []string
+	for dir := pwd; ; dir = filepath.Dir(dir) {
+		chain = append(chain, dir)
+		if dir == root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return chain
+}
 
-	// User-level .roomodes file
-	userRoomodesFile := filepath.Join(homeDir, ".roomodes")
-	if _, err := os.Stat(userRoomodesFile); err == nil {
-		directories = append(directories, userRoomodesFile)
+// findGitRoot returns the nearest ancestor of dir (inclusive) containing a .git entry
+func findGitRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
 	}
+}
 
-	// User-level Roo modes
-	userRooBaseDir := filepath.Join(homeDir, ".roo")
-	if userRooModesDirs := getRooModesDirectories(userRooBaseDir); len(userRooModesDirs) > 0 {
-		directories = append(directories, userRooModesDirs...)
+// isWithinDirectory reports whether path is dir or one of its descendants
+func isWithinDirectory(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
 	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// getConfigPaths returns the subagent configuration paths found directly under dir
+func getConfigPaths(dir string) []searchPath {
+	var paths []string
+
+	// Claude-style agents
+	paths = append(paths, filepath.Join(dir, ".claude", "agents"))
 
-	// User-level Roo YAML mode files (.roo/modes/)
-	userRooModesDir := filepath.Join(homeDir, ".roo", "modes")
-	if _, err := os.Stat(userRooModesDir); err == nil {
-		directories = append(directories, userRooModesDir)
+	// .roomodes file
+	roomodesFile := filepath.Join(dir, ".roomodes")
+	if _, err := os.Stat(roomodesFile); err == nil {
+		paths = append(paths, roomodesFile)
 	}
 
-	return directories
+	// Roo custom mode directories (.roo/rules-{modeSlug}/)
+	paths = append(paths, getRooModesDirectories(filepath.Join(dir, ".roo"))...)
+
+	// Roo YAML mode files (.roo/modes/)
+	rooModesDir := filepath.Join(dir, ".roo", "modes")
+	if _, err := os.Stat(rooModesDir); err == nil {
+		paths = append(paths, rooModesDir)
+	}
+
+	result := make([]searchPath, 0, len(paths))
+	for _, path := range paths {
+		result = append(result, searchPath{Path: path, Root: dir})
+	}
+	return result
 }
 
 // getRooModesDirectories scans the .roo directory for rules-{modeSlug} subdirectories
@@ -116,22 +180,26 @@ func getRooModesDirectories(rooBaseDir string) []string {
 // LoadSubagents scans all configured directories and loads subagent configurations
 func (m *SubagentManager) LoadSubagents(logger *zap.Logger) error {
 	// Update directories if PWD has changed
-	if m.hasDirectoryChanged() {
+	if m.directoryChanged {
 		logger.Debug("Directory changed, updating subagent scan paths",
-			zap.String("oldPWD", m.currentPWD),
 			zap.String("newPWD", m.runner.Vars["PWD"].String()))
 		m.updateDirectories()
 	}
 
-	logger.Debug("Loading subagent configurations", zap.Strings("directories", m.directories))
+	paths := make([]string, len(m.directories))
+	for i, dir := range m.directories {
+		paths[i] = dir.Path
+	}
+	logger.Debug("Loading subagent configurations", zap.Strings("directories", paths))
 
 	// Clear existing subagents
 	m.subagents = make(map[string]*Subagent)
+	m.shadowed = make(map[string][]*Subagent)
 
 	for _, dir := range m.directories {
-		if err := m.scanDirectory(dir, logger); err != nil {
+		if err := m.scanDirectory(dir.Path, dir.Root, logger); err != nil {
 			logger.Warn("Failed to scan directory for subagents",
-				zap.String("directory", dir), zap.Error(err))
+				zap.String("directory", dir.Path), zap.Error(err))
 			// Continue with other directories even if one fails
 		}
 	}
@@ -142,8 +210,9 @@ func (m *SubagentManager) LoadSubagents(logger *zap.Logger) error {
 	return nil
 }
 
-// scanDirectory scans a single directory or file for subagent configuration files
-func (m *SubagentManager) scanDirectory(path string, logger *zap.Logger) error {
+// scanDirectory scans a single directory or file for subagent configuration files.
+// root is the directory the path was discovered from and is recorded on each subagent.
+func (m *SubagentManager) scanDirectory(path string, root string, logger *zap.Logger) error {
 	// Check if path exists
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
@@ -156,24 +225,24 @@ func (m *SubagentManager) scanDirectory(path string, logger *zap.Logger) error {
 
 	// Handle .roomodes files directly
 	if !info.IsDir() && strings.HasSuffix(filepath.Base(path), ".roomodes") {
-		return m.scanRoomodesFile(path, logger)
+		return m.scanRoomodesFile(path, root, logger)
 	}
 
 	// Handle directories
 	if info.IsDir() {
 		// Special handling for Roo rules directories
 		if strings.Contains(path, "rules-") {
-			return m.scanRooRulesDirectory(path, logger)
+			return m.scanRooRulesDirectory(path, root, logger)
 		}
-		return m.scanRegularDirectory(path, logger)
+		return m.scanRegularDirectory(path, root, logger)
 	}
 
 	// Handle individual files
-	return m.scanSingleFile(path, logger)
+	return m.scanSingleFile(path, root, logger)
 }
 
 // scanRegularDirectory scans a regular directory for subagent configuration files
-func (m *SubagentManager) scanRegularDirectory(dir string, logger *zap.Logger) error {
+func (m *SubagentManager) scanRegularDirectory(dir string, root string, logger *zap.Logger) error {
 
 	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -204,30 +273,13 @@ func (m *SubagentManager) scanRegularDirectory(dir string, logger *zap.Logger) e
 
 		// Add parsed subagents to manager
 		for _, subagent := range subagents {
-			if err := ValidateSubagent(subagent); err != nil {
-				logger.Warn("Invalid subagent configuration",
-					zap.String("path", path),
-					zap.String("subagent", subagent.ID),
-					zap.Error(err))
-				continue
-			}
-
-			// Check for conflicts (project-level configs override user-level)
-			if existing, exists := m.subagents[subagent.ID]; exists {
-				logger.Debug("Subagent ID conflict, using higher priority configuration",
+			if m.addSubagent(subagent, root, path, logger) {
+				logger.Debug("Loaded subagent",
 					zap.String("id", subagent.ID),
-					zap.String("existing", existing.FilePath),
-					zap.String("new", subagent.FilePath))
-				// Since we scan project directories first, keep the existing one
-				continue
+					zap.String("name", subagent.Name),
+					zap.String("type", string(subagent.Type)),
+					zap.String("path", path))
 			}
-
-			m.subagents[subagent.ID] = subagent
-			logger.Debug("Loaded subagent",
-				zap.String("id", subagent.ID),
-				zap.String("name", subagent.Name),
-				zap.String("type", string(subagent.Type)),
-				zap.String("path", path))
 		}
 
 		return nil
@@ -235,7 +287,7 @@ func (m *SubagentManager) scanRegularDirectory(dir string, logger *zap.Logger) e
 }
 
 // scanRooRulesDirectory scans a Roo rules directory for subagent configurations
-func (m *SubagentManager) scanRooRulesDirectory(dir string, logger *zap.Logger) error {
+func (m *SubagentManager) scanRooRulesDirectory(dir string, root string, logger *zap.Logger) error {
 	logger.Debug("Scanning Roo rules directory", zap.String("directory", dir))
 
 	// Parse the Roo rules directory directly
@@ -248,37 +300,20 @@ func (m *SubagentManager) scanRooRulesDirectory(dir string, logger *zap.Logger)
 
 	// Add parsed subagents to manager
 	for _, subagent := range subagents {
-		if err := ValidateSubagent(subagent); err != nil {
-			logger.Warn("Invalid subagent configuration",
-				zap.String("directory", dir),
-				zap.String("subagent", subagent.ID),
-				zap.Error(err))
-			continue
-		}
-
-		// Check for conflicts (project-level configs override user-level)
-		if existing, exists := m.subagents[subagent.ID]; exists {
-			logger.Debug("Subagent ID conflict, using higher priority configuration",
+		if m.addSubagent(subagent, root, dir, logger) {
+			logger.Debug("Loaded Roo rules subagent",
 				zap.String("id", subagent.ID),
-				zap.String("existing", existing.FilePath),
-				zap.String("new", subagent.FilePath))
-			// Since we scan project directories first, keep the existing one
-			continue
+				zap.String("name", subagent.Name),
+				zap.String("type", string(subagent.Type)),
+				zap.String("directory", dir))
 		}
-
-		m.subagents[subagent.ID] = subagent
-		logger.Debug("Loaded Roo rules subagent",
-			zap.String("id", subagent.ID),
-			zap.String("name", subagent.Name),
-			zap.String("type", string(subagent.Type)),
-			zap.String("directory", dir))
 	}
 
 	return nil
 }
 
 // scanSingleFile scans a single file for subagent configurations
-func (m *SubagentManager) scanSingleFile(path string, logger *zap.Logger) error {
+func (m *SubagentManager) scanSingleFile(path string, root string, logger *zap.Logger) error {
 	// Check for supported file extensions
 	ext := strings.ToLower(filepath.Ext(path))
 	if ext != ".md" && ext != ".yaml" && ext != ".yml" {
@@ -298,37 +333,20 @@ func (m *SubagentManager) scanSingleFile(path string, logger *zap.Logger) error
 
 	// Add parsed subagents to manager
 	for _, subagent := range subagents {
-		if err := ValidateSubagent(subagent); err != nil {
-			logger.Warn("Invalid subagent configuration",
-				zap.String("path", path),
-				zap.String("subagent", subagent.ID),
-				zap.Error(err))
-			continue
-		}
-
-		// Check for conflicts (project-level configs override user-level)
-		if existing, exists := m.subagents[subagent.ID]; exists {
-			logger.Debug("Subagent ID conflict, using higher priority configuration",
+		if m.addSubagent(subagent, root, path, logger) {
+			logger.Debug("Loaded subagent",
 				zap.String("id", subagent.ID),
-				zap.String("existing", existing.FilePath),
-				zap.String("new", subagent.FilePath))
-			// Since we scan project directories first, keep the existing one
-			continue
+				zap.String("name", subagent.Name),
+				zap.String("type", string(subagent.Type)),
+				zap.String("path", path))
 		}
-
-		m.subagents[subagent.ID] = subagent
-		logger.Debug("Loaded subagent",
-			zap.String("id", subagent.ID),
-			zap.String("name", subagent.Name),
-			zap.String("type", string(subagent.Type)),
-			zap.String("path", path))
 	}
 
 	return nil
 }
 
 // scanRoomodesFile scans a .roomodes file for subagent configurations
-func (m *SubagentManager) scanRoomodesFile(path string, logger *zap.Logger) error {
+func (m *SubagentManager) scanRoomodesFile(path string, root string, logger *zap.Logger) error {
 	logger.Debug("Scanning .roomodes file", zap.String("path", path))
 
 	// Parse the .roomodes file
@@ -341,33 +359,43 @@ func (m *SubagentManager) scanRoomodesFile(path string, logger *zap.Logger) erro
 
 	// Add parsed subagents to manager
 	for _, subagent := range subagents {
-		if err := ValidateSubagent(subagent); err != nil {
-			logger.Warn("Invalid subagent configuration",
-				zap.String("path", path),
-				zap.String("subagent", subagent.ID),
-				zap.Error(err))
-			continue
-		}
-
-		// Check for conflicts (project-level configs override user-level)
-		if existing, exists := m.subagents[subagent.ID]; exists {
-			logger.Debug("Subagent ID conflict, using higher priority configuration",
+		if m.addSubagent(subagent, root, path, logger) {
+			logger.Debug("Loaded subagent from .roomodes file",
 				zap.String("id", subagent.ID),
-				zap.String("existing", existing.FilePath),
-				zap.String("new", subagent.FilePath))
-			// Since we scan project directories first, keep the existing one
-			continue
+				zap.String("name", subagent.Name),
+				zap.String("type", string(subagent.Type)),
+				zap.String("path", path))
 		}
+	}
+
+	return nil
+}
+
+// addSubagent validates and registers a parsed subagent, returning true if it was added.
+// Paths are scanned nearest-first, so a subagent whose ID is already registered is
+// recorded as shadowed by the existing, higher priority configuration.
+func (m *SubagentManager) addSubagent(subagent *Subagent, root string, path string, logger *zap.Logger) bool {
+	if err := ValidateSubagent(subagent); err != nil {
+		logger.Warn("Invalid subagent configuration",
+			zap.String("path", path),
+			zap.String("subagent", subagent.ID),
+			zap.Error(err))
+		return false
+	}
 
-		m.subagents[subagent.ID] = subagent
-		logger.Debug("Loaded subagent from .roomodes file",
+	subagent.SourceDir = root
+
+	if existing, exists := m.subagents[subagent.ID]; exists {
+		logger.Debug("Subagent ID conflict, using higher priority configuration",
 			zap.String("id", subagent.ID),
-			zap.String("name", subagent.Name),
-			zap.String("type", string(subagent.Type)),
-			zap.String("path", path))
+			zap.String("existing", existing.FilePath),
+			zap.String("new", subagent.FilePath))
+		m.shadowed[subagent.ID] = append(m.shadowed[subagent.ID], subagent)
+		return false
 	}
 
-	return nil
+	m.subagents[subagent.ID] = subagent
+	return true
 }
 
 // GetSubagent retrieves a subagent by ID
@@ -415,9 +443,7 @@ func (m *SubagentManager) FindSubagentByName(name string) (*Subagent, bool) {
 
 // ShouldReload checks if configurations should be reloaded based on file modifications or directory changes
 func (m *SubagentManager) ShouldReload() bool {
-	// Check if directory has changed
-	currentPWD := m.runner.Vars["PWD"].String()
-	if currentPWD != m.currentPWD {
+	if m.directoryChanged {
 		return true
 	}
 
@@ -425,16 +451,15 @@ func (m *SubagentManager) ShouldReload() bool {
 	return time.Since(m.lastScan) > DefaultScanInterval
 }
 
-// hasDirectoryChanged checks if the current working directory has changed
-func (m *SubagentManager) hasDirectoryChanged() bool {
-	currentPWD := m.runner.Vars["PWD"].String()
-	return currentPWD != m.currentPWD
+// Chpwd is the shell's hook for directory changes, after which the
+// configurations of the new directory are loaded
+func (m *SubagentManager) Chpwd(oldDirectory string, newDirectory string) {
+	m.directoryChanged = true
 }
 
 // updateDirectories refreshes the directory list based on the current PWD
 func (m *SubagentManager) updateDirectories() {
-	currentPWD := m.runner.Vars["PWD"].String()
-	m.currentPWD = currentPWD
+	m.directoryChanged = false
 	m.directories = getDefaultDirectories(m.runner)
 }
 
@@ -444,6 +469,11 @@ func (m *SubagentManager) Reload(logger *zap.Logger) error {
 	return m.LoadSubagents(logger)
 }
 
+// GetShadowedSubagents returns the lower priority configurations hidden by the subagent with the given ID
+func (m *SubagentManager) GetShadowedSubagents(id string) []*Subagent {
+	return m.shadowed[id]
+}
+
 // GetSubagentsSummary returns a formatted summary of all loaded subagents
 func (m *SubagentManager) GetSubagentsSummary() string {
 	if len(m.subagents) == 0 {
@@ -453,7 +483,14 @@ func (m *SubagentManager) GetSubagentsSummary() string {
 	var summary strings.Builder
 	summary.WriteString(fmt.Sprintf("Loaded %d subagent(s):\n", len(m.subagents)))
 
-	for id, subagent := range m.subagents {
+	ids := make([]string, 0, len(m.subagents))
+	for id := range m.subagents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		subagent := m.subagents[id]
 		summary.WriteString(fmt.Sprintf("  • %s (%s): %s\n",
 			subagent.Name, id, subagent.Description))
 		summary.WriteString(fmt.Sprintf("    Type: %s, Tools: %v\n",
@@ -461,6 +498,12 @@ func (m *SubagentManager) GetSubagentsSummary() string {
 		if subagent.FileRegex != "" {
 			summary.WriteString(fmt.Sprintf("    File Access: %s\n", subagent.FileRegex))
 		}
+		if subagent.SourceDir != "" {
+			summary.WriteString(fmt.Sprintf("    Source: %s\n", subagent.SourceDir))
+		}
+		for _, shadowed := range m.shadowed[id] {
+			summary.WriteString(fmt.Sprintf("    Shadows: %s\n", shadowed.FilePath))
+		}
 		summary.WriteString("\n")
 	}
 
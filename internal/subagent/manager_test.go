@@ -0,0 +1,156 @@
+package subagent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func writeClaudeAgent(t *testing.T, dir string, name string, description string) string {
+	t.Helper()
+	agentsDir := filepath.Join(dir, ".claude", "agents")
+	require.NoError(t, os.MkdirAll(agentsDir, 0755))
+
+	path := filepath.Join(agentsDir, name+".md")
+	content := "---\nname: " + name + "\ndescription: " + description + "\ntools: view_file\n---\n\nYou are " + name + ".\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func newTestRunner(t *testing.T, pwd string, home string, vars ...string) *interp.Runner {
+	t.Helper()
+	runner, err := interp.New(interp.Env(expand.ListEnviron()), interp.Dir(pwd))
+	require.NoError(t, err)
+	// Run an empty program so the runner populates Vars from its environment
+	require.NoError(t, runner.Run(context.Background(), &syntax.File{}))
+
+	runner.Vars["HOME"] = expand.Variable{Kind: expand.String, Str: home}
+	for _, v := range vars {
+		name, value, _ := strings.Cut(v, "=")
+		runner.Vars[name] = expand.Variable{Kind: expand.String, Str: value}
+	}
+	return runner
+}
+
+func TestHierarchicalSubagentDiscovery(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0755))
+
+	pkg := filepath.Join(repo, "services", "api")
+	require.NoError(t, os.MkdirAll(pkg, 0755))
+
+	repoReviewer := writeClaudeAgent(t, repo, "reviewer", "Repository reviewer")
+	writeClaudeAgent(t, repo, "docs", "Repository docs writer")
+	pkgReviewer := writeClaudeAgent(t, pkg, "reviewer", "API reviewer")
+	homeDocs := writeClaudeAgent(t, home, "docs", "Personal docs writer")
+	writeClaudeAgent(t, home, "helper", "Personal helper")
+
+	runner := newTestRunner(t, pkg, home)
+	manager := NewSubagentManager(runner, zap.NewNop())
+	require.NoError(t, manager.LoadSubagents(zap.NewNop()))
+
+	subagents := manager.GetAllSubagents()
+	require.Len(t, subagents, 3)
+
+	// Nearest directory wins
+	assert.Equal(t, pkgReviewer, subagents["reviewer"].FilePath)
+	assert.Equal(t, pkg, subagents["reviewer"].SourceDir)
+	assert.Equal(t, repo, subagents["docs"].SourceDir)
+	assert.Equal(t, home, subagents["helper"].SourceDir)
+
+	// Shadowed configurations are tracked
+	shadowed := manager.GetShadowedSubagents("reviewer")
+	require.Len(t, shadowed, 1)
+	assert.Equal(t, repoReviewer, shadowed[0].FilePath)
+	shadowed = manager.GetShadowedSubagents("docs")
+	require.Len(t, shadowed, 1)
+	assert.Equal(t, homeDocs, shadowed[0].FilePath)
+	assert.Empty(t, manager.GetShadowedSubagents("helper"))
+
+	summary := manager.GetSubagentsSummary()
+	assert.Contains(t, summary, "Source: "+pkg)
+	assert.Contains(t, summary, "Shadows: "+repoReviewer)
+	assert.Less(t, strings.Index(summary, "(docs)"), strings.Index(summary, "(reviewer)"))
+}
+
+func TestSubagentDiscoveryStopsAtRoot(t *testing.T) {
+	home := t.TempDir()
+	outer := t.TempDir()
+	root := filepath.Join(outer, "project")
+	pwd := filepath.Join(root, "sub")
+	require.NoError(t, os.MkdirAll(pwd, 0755))
+
+	writeClaudeAgent(t, outer, "outside", "Above the discovery root")
+	writeClaudeAgent(t, root, "inside", "At the discovery root")
+
+	t.Run("without a root only PWD is searched", func(t *testing.T) {
+		manager := NewSubagentManager(newTestRunner(t, pwd, home), zap.NewNop())
+		require.NoError(t, manager.LoadSubagents(zap.NewNop()))
+		assert.Empty(t, manager.GetAllSubagents())
+	})
+
+	t.Run("GSH_SUBAGENT_ROOT bounds the walk", func(t *testing.T) {
+		runner := newTestRunner(t, pwd, home, "GSH_SUBAGENT_ROOT="+root)
+		manager := NewSubagentManager(runner, zap.NewNop())
+		require.NoError(t, manager.LoadSubagents(zap.NewNop()))
+
+		subagents := manager.GetAllSubagents()
+		assert.Contains(t, subagents, "inside")
+		assert.NotContains(t, subagents, "outside")
+	})
+
+	t.Run("GSH_SUBAGENT_ROOT outside PWD is ignored", func(t *testing.T) {
+		runner := newTestRunner(t, pwd, home, "GSH_SUBAGENT_ROOT="+t.TempDir())
+		manager := NewSubagentManager(runner, zap.NewNop())
+		require.NoError(t, manager.LoadSubagents(zap.NewNop()))
+		assert.Empty(t, manager.GetAllSubagents())
+	})
+}
+
+func TestGetDiscoveryChain(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0755))
+	deep := filepath.Join(repo, "a", "b")
+	require.NoError(t, os.MkdirAll(deep, 0755))
+
+	assert.Equal(t, []string{deep, filepath.Join(repo, "a"), repo}, getDiscoveryChain(deep, ""))
+	assert.Equal(t, []string{deep, filepath.Join(repo, "a")}, getDiscoveryChain(deep, filepath.Join(repo, "a")))
+	assert.Equal(t, []string{repo}, getDiscoveryChain(repo, ""))
+	assert.Nil(t, getDiscoveryChain("", ""))
+}
+
+func TestSubagentsReloadAfterChpwd(t *testing.T) {
+	home := t.TempDir()
+	first := t.TempDir()
+	second := t.TempDir()
+	writeClaudeAgent(t, first, "first", "First project")
+	writeClaudeAgent(t, second, "second", "Second project")
+
+	runner := newTestRunner(t, first, home)
+	manager := NewSubagentManager(runner, zap.NewNop())
+	require.NoError(t, manager.LoadSubagents(zap.NewNop()))
+	assert.False(t, manager.ShouldReload())
+
+	// The shell tells the manager about the new directory
+	runner.Vars["PWD"] = expand.Variable{Kind: expand.String, Str: second}
+	assert.False(t, manager.ShouldReload())
+	manager.Chpwd(first, second)
+	assert.True(t, manager.ShouldReload())
+
+	require.NoError(t, manager.LoadSubagents(zap.NewNop()))
+	_, ok := manager.GetSubagent("second")
+	assert.True(t, ok)
+	_, ok = manager.GetSubagent("first")
+	assert.False(t, ok)
+	assert.False(t, manager.ShouldReload())
+}
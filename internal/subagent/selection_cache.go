@@ -0,0 +1,126 @@
+package subagent
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// selectionCacheSimilarity is the minimum keyword overlap (Jaccard index) for two
+	// prompts to share a cached selection
+	selectionCacheSimilarity = 0.8
+	selectionCacheTTL        = 30 * time.Minute
+	selectionCacheSize       = 128
+)
+
+type selectionCacheEntry struct {
+	tokens      map[string]bool
+	subagentKey string
+	selection   *Selection
+	createdAt   time.Time
+}
+
+// selectionCache remembers recent selection decisions, keyed by prompt similarity
+type selectionCache struct {
+	mu      sync.Mutex
+	entries []*selectionCacheEntry // Oldest first
+	now     func() time.Time
+}
+
+func newSelectionCache() *selectionCache {
+	return &selectionCache{now: time.Now}
+}
+
+// get returns the cached selection for the most similar prompt made against the same set of subagents
+func (c *selectionCache) get(prompt string, subagentKey string) (*Selection, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tokens := tokenSet(prompt)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+
+	var best *selectionCacheEntry
+	bestSimilarity := 0.0
+	for _, entry := range c.entries {
+		if entry.subagentKey != subagentKey || c.now().Sub(entry.createdAt) > selectionCacheTTL {
+			continue
+		}
+		similarity := jaccard(tokens, entry.tokens)
+		if similarity >= selectionCacheSimilarity && similarity > bestSimilarity {
+			best, bestSimilarity = entry, similarity
+		}
+	}
+
+	if best == nil {
+		return nil, false
+	}
+
+	cached := *best.selection
+	cached.Source = SelectionSourceCache
+	return &cached, true
+}
+
+// put records a selection decision, evicting the oldest entry when the cache is full
+func (c *selectionCache) put(prompt string, subagentKey string, selection *Selection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tokens := tokenSet(prompt)
+	if len(tokens) == 0 {
+		return
+	}
+
+	if len(c.entries) >= selectionCacheSize {
+		c.entries = c.entries[1:]
+	}
+	c.entries = append(c.entries, &selectionCacheEntry{
+		tokens:      tokens,
+		subagentKey: subagentKey,
+		selection:   selection,
+		createdAt:   c.now(),
+	})
+}
+
+func (c *selectionCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// subagentsCacheKey identifies a set of subagent configurations, so decisions made
+// against one set are never reused after the available subagents change
+func subagentsCacheKey(subagents map[string]*Subagent) string {
+	keys := make([]string, 0, len(subagents))
+	for id, subagent := range subagents {
+		keys = append(keys, id+"@"+subagent.FilePath+"@"+subagent.LastModified.String())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
+
+func tokenSet(text string) map[string]bool {
+	tokens := tokenize(text)
+	set := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		set[token] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	intersection := 0
+	for token := range a {
+		if b[token] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
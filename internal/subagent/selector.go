@@ -3,10 +3,12 @@ package subagent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/atinylittleshell/gsh/internal/environment"
 	"github.com/atinylittleshell/gsh/internal/utils"
 	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
@@ -17,7 +19,10 @@ import (
 type SubagentSelector struct {
 	llmClient      *openai.Client
 	llmModelConfig utils.LLMModelConfig
+	runner         *interp.Runner
 	logger         *zap.Logger
+	cache          *selectionCache
+	keyword        *KeywordSelector
 }
 
 // SelectionResult represents the LLM's subagent selection decision
@@ -27,6 +32,31 @@ type SelectionResult struct {
 	Reasoning  string `json:"reasoning"`
 }
 
+// SelectionSource identifies how a selection decision was made
+type SelectionSource string
+
+const (
+	SelectionSourceLLM     SelectionSource = "llm"
+	SelectionSourceKeyword SelectionSource = "keyword"
+	SelectionSourceCache   SelectionSource = "cache"
+	SelectionSourceSingle  SelectionSource = "single"
+)
+
+// Selection is the outcome of choosing a subagent for a prompt
+type Selection struct {
+	Subagent   *Subagent // Nil when no subagent matched
+	Confidence int       // 0-100
+	Reasoning  string
+	Source     SelectionSource
+}
+
+var (
+	// ErrNoSubagentMatched is returned when the selector found no suitable subagent
+	ErrNoSubagentMatched = errors.New("no subagent matched the prompt")
+	// ErrLowConfidence is returned when the best match is below GSH_SUBAGENT_MIN_CONFIDENCE
+	ErrLowConfidence = errors.New("subagent selection confidence below threshold")
+)
+
 // NewSubagentSelector creates a new intelligent subagent selector
 func NewSubagentSelector(runner *interp.Runner, logger *zap.Logger) *SubagentSelector {
 	llmClient, modelConfig := utils.GetLLMClient(runner, utils.FastModel)
@@ -34,23 +64,77 @@ func NewSubagentSelector(runner *interp.Runner, logger *zap.Logger) *SubagentSel
 	return &SubagentSelector{
 		llmClient:      llmClient,
 		llmModelConfig: modelConfig,
+		runner:         runner,
 		logger:         logger,
+		cache:          newSelectionCache(),
+		keyword:        NewKeywordSelector(),
 	}
 }
 
-// SelectBestSubagent uses LLM to determine the most appropriate subagent for the given prompt
-func (s *SubagentSelector) SelectBestSubagent(prompt string, availableSubagents map[string]*Subagent) (*Subagent, error) {
+// SelectBestSubagent determines the most appropriate subagent for the given prompt.
+// Decisions are cached by prompt similarity, so rephrasing a recent prompt doesn't cost
+// another LLM call. When the fast model is unavailable, or GSH_SUBAGENT_SELECTOR is
+// "offline", the local keyword selector is used instead.
+//
+// The returned Selection is non-nil whenever a decision was made, including when the
+// error is ErrLowConfidence or ErrNoSubagentMatched, so callers can explain it.
+func (s *SubagentSelector) SelectBestSubagent(prompt string, availableSubagents map[string]*Subagent) (*Selection, error) {
 	if len(availableSubagents) == 0 {
 		return nil, fmt.Errorf("no subagents available")
 	}
 
-	// If only one subagent available, return it
+	// If only one subagent is available, return it without asking the LLM
 	if len(availableSubagents) == 1 {
 		for _, subagent := range availableSubagents {
-			return subagent, nil
+			return &Selection{
+				Subagent:   subagent,
+				Confidence: 100,
+				Reasoning:  "only one subagent is available",
+				Source:     SelectionSourceSingle,
+			}, nil
 		}
 	}
 
+	minConfidence := environment.GetSubagentMinConfidence(s.runner, s.logger)
+	mode := environment.GetSubagentSelector(s.runner, s.logger)
+	cacheKey := mode + "\n" + subagentsCacheKey(availableSubagents)
+	selection, cached := s.cache.get(prompt, cacheKey)
+	if cached {
+		s.logger.Debug("Using cached subagent selection",
+			zap.String("prompt", prompt),
+			zap.Int("confidence", selection.Confidence))
+	} else {
+		var err error
+		selection, err = s.selectUncached(prompt, mode, availableSubagents)
+		if err != nil {
+			return nil, err
+		}
+		// A keyword fallback after the LLM failed isn't kept, so the LLM is asked again next time
+		if mode == "offline" || selection.Source == SelectionSourceLLM {
+			s.cache.put(prompt, cacheKey, selection)
+		}
+	}
+
+	if selection.Subagent == nil {
+		return selection, ErrNoSubagentMatched
+	}
+	if selection.Confidence < minConfidence {
+		s.logger.Debug("Subagent selection below confidence threshold",
+			zap.String("subagentID", selection.Subagent.ID),
+			zap.Int("confidence", selection.Confidence),
+			zap.Int("minConfidence", minConfidence))
+		return selection, ErrLowConfidence
+	}
+
+	return selection, nil
+}
+
+// selectUncached makes a fresh selection decision using the given selector mode
+func (s *SubagentSelector) selectUncached(prompt string, mode string, availableSubagents map[string]*Subagent) (*Selection, error) {
+	if mode == "offline" {
+		return s.keyword.Select(prompt, availableSubagents), nil
+	}
+
 	// Build context about available subagents
 	subagentContext := s.buildSubagentContext(availableSubagents)
 
@@ -60,22 +144,36 @@ func (s *SubagentSelector) SelectBestSubagent(prompt string, availableSubagents
 	// Call LLM to make selection
 	result, err := s.callLLMForSelection(systemPrompt, prompt)
 	if err != nil {
-		s.logger.Warn("LLM selection failed, falling back to string matching", zap.Error(err))
-		return nil, err
-	}
-
-	// Find and return the selected subagent
-	if result.SubagentID != "" {
-		if subagent, exists := availableSubagents[result.SubagentID]; exists {
-			s.logger.Debug("LLM selected subagent",
-				zap.String("subagentID", result.SubagentID),
-				zap.Int("confidence", result.Confidence),
-				zap.String("reasoning", result.Reasoning))
-			return subagent, nil
-		}
+		s.logger.Warn("LLM selection failed, falling back to keyword matching", zap.Error(err))
+		return s.keyword.Select(prompt, availableSubagents), nil
+	}
+
+	selection := &Selection{
+		Confidence: max(0, min(100, result.Confidence)),
+		Reasoning:  result.Reasoning,
+		Source:     SelectionSourceLLM,
 	}
 
-	return nil, fmt.Errorf("LLM selected unknown subagent: %s", result.SubagentID)
+	if result.SubagentID == "" || result.SubagentID == "none" {
+		return selection, nil
+	}
+
+	subagent, exists := availableSubagents[result.SubagentID]
+	if !exists {
+		return nil, fmt.Errorf("LLM selected unknown subagent: %s", result.SubagentID)
+	}
+
+	s.logger.Debug("LLM selected subagent",
+		zap.String("subagentID", result.SubagentID),
+		zap.Int("confidence", result.Confidence),
+		zap.String("reasoning", result.Reasoning))
+	selection.Subagent = subagent
+	return selection, nil
+}
+
+// ClearCache discards all cached selection decisions, for when the subagents are reloaded
+func (s *SubagentSelector) ClearCache() {
+	s.cache.clear()
 }
 
 // buildSubagentContext creates a description of available subagents for the LLM
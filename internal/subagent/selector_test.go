@@ -0,0 +1,175 @@
+package subagent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"mvdan.cc/sh/v3/expand"
+)
+
+func testSubagents() map[string]*Subagent {
+	return map[string]*Subagent{
+		"code-reviewer": {
+			ID:           "code-reviewer",
+			Name:         "code-reviewer",
+			Description:  "Reviews code changes for bugs, style issues and security problems",
+			SystemPrompt: "You are an expert code reviewer.",
+		},
+		"docs-writer": {
+			ID:           "docs-writer",
+			Name:         "docs-writer",
+			Description:  "Writes and updates documentation, READMEs and changelogs",
+			SystemPrompt: "You are a technical writer.",
+		},
+		"git-helper": {
+			ID:           "git-helper",
+			Name:         "Git Helper",
+			Description:  "Helps with git branches, rebases and merge conflicts",
+			SystemPrompt: "You are a git expert.",
+		},
+	}
+}
+
+func TestKeywordSelector(t *testing.T) {
+	selector := NewKeywordSelector()
+	subagents := testSubagents()
+
+	t.Run("selects by description keywords", func(t *testing.T) {
+		selection := selector.Select("resolve the merge conflicts in my rebase", subagents)
+		require.NotNil(t, selection.Subagent)
+		assert.Equal(t, "git-helper", selection.Subagent.ID)
+		assert.Equal(t, SelectionSourceKeyword, selection.Source)
+		assert.Contains(t, selection.Reasoning, "merge")
+		assert.Greater(t, selection.Confidence, 50)
+	})
+
+	t.Run("explicit mention gives high confidence", func(t *testing.T) {
+		selection := selector.Select("ask the docs writer to look at this", subagents)
+		require.NotNil(t, selection.Subagent)
+		assert.Equal(t, "docs-writer", selection.Subagent.ID)
+		assert.Equal(t, 95, selection.Confidence)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		selection := selector.Select("what's the weather like", subagents)
+		assert.Nil(t, selection.Subagent)
+		assert.Equal(t, 0, selection.Confidence)
+	})
+
+	t.Run("empty prompt", func(t *testing.T) {
+		selection := selector.Select("   ", subagents)
+		assert.Nil(t, selection.Subagent)
+	})
+}
+
+func TestSelectionCache(t *testing.T) {
+	cache := newSelectionCache()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	selection := &Selection{Subagent: testSubagents()["git-helper"], Confidence: 80, Source: SelectionSourceLLM}
+	cache.put("help me fix merge conflicts in this rebase", "key", selection)
+
+	cached, ok := cache.get("please help me fix merge conflicts in this rebase", "key")
+	require.True(t, ok)
+	assert.Equal(t, SelectionSourceCache, cached.Source)
+	assert.Equal(t, 80, cached.Confidence)
+	assert.Equal(t, SelectionSourceLLM, selection.Source, "cached entry must not be mutated")
+
+	_, ok = cache.get("write a changelog for this release", "key")
+	assert.False(t, ok, "dissimilar prompts should miss")
+
+	_, ok = cache.get("help me fix merge conflicts in this rebase", "other-key")
+	assert.False(t, ok, "a different subagent set should miss")
+
+	now = now.Add(selectionCacheTTL + time.Second)
+	_, ok = cache.get("help me fix merge conflicts in this rebase", "key")
+	assert.False(t, ok, "expired entries should miss")
+}
+
+func TestSelectBestSubagentOffline(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("selection above the confidence floor", func(t *testing.T) {
+		runner := newTestRunner(t, dir, dir, "GSH_SUBAGENT_SELECTOR=offline", "GSH_SUBAGENT_MIN_CONFIDENCE=40")
+		selector := NewSubagentSelector(runner, zap.NewNop())
+
+		selection, err := selector.SelectBestSubagent("resolve the merge conflicts in my rebase", testSubagents())
+		require.NoError(t, err)
+		assert.Equal(t, "git-helper", selection.Subagent.ID)
+
+		// A similar prompt is served from the cache
+		selection, err = selector.SelectBestSubagent("resolve the merge conflicts in my rebase please", testSubagents())
+		require.NoError(t, err)
+		assert.Equal(t, SelectionSourceCache, selection.Source)
+	})
+
+	t.Run("selection below the confidence floor", func(t *testing.T) {
+		runner := newTestRunner(t, dir, dir, "GSH_SUBAGENT_SELECTOR=offline", "GSH_SUBAGENT_MIN_CONFIDENCE=100")
+		selector := NewSubagentSelector(runner, zap.NewNop())
+
+		selection, err := selector.SelectBestSubagent("resolve the merge conflicts in my rebase", testSubagents())
+		assert.ErrorIs(t, err, ErrLowConfidence)
+		require.NotNil(t, selection)
+		assert.Equal(t, "git-helper", selection.Subagent.ID)
+	})
+
+	t.Run("no matching subagent", func(t *testing.T) {
+		runner := newTestRunner(t, dir, dir, "GSH_SUBAGENT_SELECTOR=offline")
+		selector := NewSubagentSelector(runner, zap.NewNop())
+
+		_, err := selector.SelectBestSubagent("what's the weather like", testSubagents())
+		assert.ErrorIs(t, err, ErrNoSubagentMatched)
+	})
+
+	t.Run("single subagent despite the floor", func(t *testing.T) {
+		runner := newTestRunner(t, dir, dir)
+		selector := NewSubagentSelector(runner, zap.NewNop())
+
+		only := map[string]*Subagent{"git-helper": testSubagents()["git-helper"]}
+		selection, err := selector.SelectBestSubagent("anything at all", only)
+		require.NoError(t, err)
+		assert.Equal(t, SelectionSourceSingle, selection.Source)
+	})
+}
+
+func TestSelectBestSubagentLLMFallback(t *testing.T) {
+	dir := t.TempDir()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	runner := newTestRunner(t, dir, dir, "GSH_FAST_MODEL_BASE_URL="+server.URL, "GSH_SUBAGENT_MIN_CONFIDENCE=40")
+	selector := NewSubagentSelector(runner, zap.NewNop())
+
+	t.Run("keyword fallback isn't cached", func(t *testing.T) {
+		for i := 1; i <= 2; i++ {
+			selection, err := selector.SelectBestSubagent("resolve the merge conflicts in my rebase", testSubagents())
+			require.NoError(t, err)
+			assert.Equal(t, SelectionSourceKeyword, selection.Source)
+			assert.Equal(t, int32(i), requests.Load(), "the LLM is asked again")
+		}
+	})
+
+	t.Run("decisions aren't shared between modes", func(t *testing.T) {
+		runner.Vars["GSH_SUBAGENT_SELECTOR"] = expand.Variable{Kind: expand.String, Str: "offline"}
+		selection, err := selector.SelectBestSubagent("resolve the merge conflicts in my rebase", testSubagents())
+		require.NoError(t, err)
+		assert.Equal(t, SelectionSourceKeyword, selection.Source)
+
+		delete(runner.Vars, "GSH_SUBAGENT_SELECTOR")
+		selection, err = selector.SelectBestSubagent("resolve the merge conflicts in my rebase", testSubagents())
+		require.NoError(t, err)
+		assert.Equal(t, SelectionSourceKeyword, selection.Source, "the offline decision isn't used in llm mode")
+		assert.Equal(t, int32(3), requests.Load())
+	})
+}
@@ -22,6 +22,7 @@ type Subagent struct {
 	Description string      `json:"description"` // Description of when to use this subagent
 	Type        SubagentType `json:"type"`       // Configuration format type
 	FilePath    string      `json:"filePath"`   // Path to configuration file
+	SourceDir   string      `json:"sourceDir"`  // Directory the configuration was discovered from
 	LastModified time.Time  `json:"lastModified"` // File modification time for cache invalidation
 
 	// System prompt content
@@ -71,9 +72,11 @@ type RooGroupConfig struct {
 
 // SubagentManager handles loading, parsing, and managing subagent configurations
 type SubagentManager struct {
-	subagents   map[string]*Subagent // Key: subagent ID
-	directories []string             // Directories to scan for configurations
-	lastScan    time.Time            // Last time directories were scanned
-	runner      *interp.Runner       // Shell runner for accessing PWD
-	currentPWD  string               // Current working directory at last scan
+	subagents   map[string]*Subagent   // Key: subagent ID
+	shadowed    map[string][]*Subagent // Key: subagent ID, lower priority configurations with the same ID
+	directories []searchPath           // Directories to scan for configurations, nearest first
+	lastScan    time.Time              // Last time directories were scanned
+	runner      *interp.Runner         // Shell runner for accessing PWD
+	// directoryChanged is set when the shell changed directory since the last scan
+	directoryChanged bool
 }
\ No newline at end of file
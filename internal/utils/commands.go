@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// Wrappers that run the command following them
+var commandWrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "command": true, "nohup": true, "time": true, "nice": true, "exec": true,
+	"timeout": true,
+}
+
+// Options of wrappers whose value is the word after them
+var wrapperOptionValues = map[string]map[string]bool{
+	"sudo":    {"-u": true, "--user": true, "-g": true, "--group": true, "-C": true, "--close-from": true},
+	"doas":    {"-u": true, "-C": true},
+	"env":     {"-u": true, "--unset": true, "-C": true, "--chdir": true},
+	"nice":    {"-n": true, "--adjustment": true},
+	"timeout": {"-s": true, "--signal": true, "-k": true, "--kill-after": true},
+}
+
+// Number of operands wrappers take before the command, like the duration of
+// timeout
+var wrapperOperands = map[string]int{"timeout": 1}
+
+// LookPathExecutable returns the path of the executable named command on the
+// PATH of the shell, or "" if there's none. Paths aren't looked up, so local
+// scripts are never run for their documentation.
+func LookPathExecutable(runner *interp.Runner, command string) string {
+	if strings.Contains(command, "/") {
+		return ""
+	}
+	pathList := os.Getenv("PATH")
+	if runner != nil && runner.Vars != nil {
+		if runnerPath := runner.Vars["PATH"].String(); runnerPath != "" {
+			pathList = runnerPath
+		}
+	}
+	for _, dir := range filepath.SplitList(pathList) {
+		executable := filepath.Join(dir, command)
+		if info, err := os.Stat(executable); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return executable
+		}
+	}
+	return ""
+}
+
+// UnwrapCommand strips wrappers like sudo and env from the words of a command,
+// along with their flags, option values, operands and assignments, returning
+// the command they run
+func UnwrapCommand(args []string) []string {
+	for len(args) > 0 && commandWrappers[path.Base(args[0])] {
+		wrapper := path.Base(args[0])
+		args = args[1:]
+		for len(args) > 0 && (strings.HasPrefix(args[0], "-") || strings.Contains(args[0], "=")) {
+			if wrapperOptionValues[wrapper][args[0]] {
+				args = args[min(2, len(args)):]
+			} else {
+				args = args[1:]
+			}
+		}
+		args = args[min(wrapperOperands[wrapper], len(args)):]
+	}
+	return args
+}
@@ -3,7 +3,9 @@ package gline
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"strings"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/charmbracelet/bubbles/cursor"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
 	"go.uber.org/zap"
 )
 
@@ -28,18 +31,23 @@ type appModel struct {
 	lastPredictionInput string
 	lastPrediction      string
 	predictionStateId   int
+	predictionIsInstant bool
+	candidates          []PredictionCandidate
+	risk                RiskAssessment
+	confirmingRisk      bool
 
 	historyValues []string
 	result        string
 	appState      appState
 	interrupted   bool
 
-	explanationStyle lipgloss.Style
-	completionStyle  lipgloss.Style
+	styles Styles
 
-	// Multiline support
-	multilineState *MultilineState
 	originalPrompt string
+
+	keyBindings *KeyBindings
+	// Keys typed so far of a multi-key binding
+	pendingKeys []string
 }
 
 type attemptPredictionMsg struct {
@@ -50,16 +58,21 @@ type setPredictionMsg struct {
 	stateId      int
 	prediction   string
 	inputContext string
+	instant      bool
+	candidates   []PredictionCandidate
 }
 
 type attemptExplanationMsg struct {
 	stateId    int
 	prediction string
+	typed      string
 }
 
 type setExplanationMsg struct {
 	stateId     int
+	prediction  string
 	explanation string
+	risk        RiskAssessment
 }
 
 // ErrInterrupted is returned when the user presses Ctrl+C
@@ -100,6 +113,25 @@ func initialModel(
 	textInput.Cursor.SetMode(cursor.CursorStatic)
 	textInput.ShowSuggestions = true
 	textInput.CompletionProvider = options.CompletionProvider
+	textInput.Highlighter = options.Highlighter
+
+	styles := DefaultStyles()
+	if options.Styles != nil {
+		styles = *options.Styles
+	}
+	textInput.PromptStyle = styles.Prompt
+	textInput.CompletionStyle = styles.Prediction
+	textInput.SelectionStyle = styles.Selection
+
+	keyBindings := options.KeyBindings
+	if keyBindings == nil {
+		keyBindings = NewKeyBindings()
+	}
+	textInput.KeyMap = keyBindings.KeyMap()
+	if strings.EqualFold(keyBindings.Variable("editing-mode"), "vi") {
+		textInput.EditingMode = shellinput.EditingModeVi
+		textInput.ViInsertModeString, textInput.ViCommandModeString = keyBindings.viModeStrings()
+	}
 	textInput.Focus()
 
 	return appModel{
@@ -120,16 +152,11 @@ func initialModel(
 
 		predictionStateId: 0,
 
-		explanationStyle: lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("12")),
-		completionStyle: lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("10")),
+		styles: styles,
 
-		// Initialize multiline state
-		multilineState: NewMultilineState(),
 		originalPrompt: prompt,
+
+		keyBindings: keyBindings,
 	}
 }
 
@@ -146,8 +173,9 @@ func (m appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tea.WindowSizeMsg:
 		m.textInput.Width = msg.Width
-		m.explanationStyle = m.explanationStyle.Width(max(1, msg.Width-2))
-		m.completionStyle = m.completionStyle.Width(max(1, msg.Width-2))
+		m.styles.Explanation = m.styles.Explanation.Width(max(1, msg.Width-2))
+		m.styles.HighRiskExplanation = m.styles.HighRiskExplanation.Width(max(1, msg.Width-2))
+		m.styles.Completion = m.styles.Completion.Width(max(1, msg.Width-2))
 		return m, nil
 
 	case terminateMsg:
@@ -163,7 +191,7 @@ func (m appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.attemptPrediction(msg)
 
 	case setPredictionMsg:
-		return m.setPrediction(msg.stateId, msg.prediction, msg.inputContext)
+		return m.setPrediction(msg)
 
 	case attemptExplanationMsg:
 		return m.attemptExplanation(msg)
@@ -172,123 +200,284 @@ func (m appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.setExplanation(msg)
 
 	case tea.KeyMsg:
-		switch msg.String() {
-
-		// TODO: replace with custom keybindings
-		case "backspace":
-			// if the input is already empty, we should clear prediction
-			if m.textInput.Value() == "" {
-				m.dirty = true
-				m.predictionStateId++
-				m.clearPrediction()
-				return m, nil
-			}
+		return m.handleKey(msg)
 
-		case "enter":
-			input := m.textInput.Value()
-
-			// Handle multiline input with error handling
-			complete, prompt := m.multilineState.AddLine(input)
-			if !complete {
-				// Need more input, update prompt and continue
-				m.textInput.Prompt = prompt + " "
-				// Clear the text input field but preserve the multiline buffer
-				m.textInput.SetValue("")
-				return m, nil
-			}
+	case shellCommandDoneMsg:
+		return m.shellCommandDone(msg)
 
-			// We have a complete command - add error handling for GetCompleteCommand
-			result := m.multilineState.GetCompleteCommand()
-			if result == "" && input != "" {
-				// Only treat empty result as error if input was not empty
-				// Reset the multiline state and continue
-				m.multilineState.Reset()
-				m.textInput.SetValue("")
-				return m, nil
-			}
+	case editorDoneMsg:
+		return m.editorDone(msg)
+	}
 
-			m.result = result
-			return m, tea.Sequence(terminate, tea.Quit)
+	return m.updateTextInput(msg)
+}
 
-		case "ctrl+c":
-			// Handle Ctrl-C: cancel current line, preserve input with "^C" appended, and present fresh prompt
-			currentInput := m.textInput.Value()
+// handleKey runs the binding of a key, waiting for more keys when it starts a longer sequence
+func (m appModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	keys := append(append([]string{}, m.pendingKeys...), msg.String())
+	binding, result := m.keyBindings.lookup(keys)
+
+	if m.textInput.InViCommandMode() && len(m.pendingKeys) == 0 {
+		// Keys are vi commands, except for the ones that end or clear the line
+		isLineAction := result == lookupMatch && binding.Kind == BindingAction &&
+			(binding.Value == ActionAcceptLine || binding.Value == ActionInterrupt ||
+				binding.Value == ActionEndOfFile || binding.Value == ActionClearScreen)
+		if !isLineAction {
+			return m.updateTextInput(msg)
+		}
+	}
+	switch result {
+	case lookupPrefix:
+		m.pendingKeys = keys
+		return m, nil
+	case lookupNone:
+		if len(m.pendingKeys) > 0 {
+			// The sequence isn't bound, start over from this key
+			m.pendingKeys = nil
+			return m.handleKey(msg)
+		}
+		return m.updateTextInput(msg)
+	}
+	m.pendingKeys = nil
+
+	switch binding.Kind {
+	case BindingMacro:
+		return m.updateTextInputWith(func(textInput shellinput.Model) (shellinput.Model, tea.Cmd) {
+			textInput.InsertText(binding.Value)
+			return textInput, nil
+		})
+	case BindingShellCommand:
+		return m.runShellCommand(binding.Value)
+	case BindingAgentMacro:
+		m.textInput.SetValue("@/" + binding.Value)
+		m.result = m.textInput.Value()
+		return m, tea.Sequence(terminate, tea.Quit)
+	}
 
-			// Reset multiline state on Ctrl+C
-			if m.multilineState.IsActive() {
-				m.multilineState.Reset()
-				m.textInput.Prompt = m.originalPrompt // Reset to original prompt
-			}
+	switch binding.Value {
+	case ActionAcceptLine:
+		return m.acceptLine()
+	case ActionInterrupt:
+		return m.interruptLine()
+	case ActionEndOfFile:
+		return m.endOfFile()
+	case ActionClearScreen:
+		return m.handleClearScreen()
+	case ActionEditAndExecuteCommand:
+		return m.editAndExecuteCommand()
+	case shellinput.ActionBackwardDeleteChar:
+		// if the input is already empty, we should clear prediction
+		if m.textInput.Value() == "" {
+			m.dirty = true
+			m.predictionStateId++
+			m.clearPrediction()
+			return m, nil
+		}
+	}
 
-			// Print the current input with "^C" appended, then move to next line
-			// This works for both empty and non-empty input
-			fmt.Printf("%s^C\n", currentInput)
-
-			// Flush output to ensure it's displayed before framework cleanup
-			os.Stdout.Sync()
-
-			// Set result to empty string so shell doesn't try to execute it
-			m.result = ""
-			// Use interrupt message to indicate Ctrl+C was pressed
-			return m, tea.Sequence(interrupt, tea.Quit)
-		case "ctrl+d":
-			// Handle Ctrl-D: exit shell if on blank line
-			currentInput := m.textInput.Value()
-			if strings.TrimSpace(currentInput) == "" {
-				// On blank line, exit the shell
-				m.result = "exit"
-				return m, tea.Sequence(terminate, tea.Quit)
-			}
-			// If there's content, do nothing (standard behavior)
+	if len(keys) == 1 {
+		// The line editor's key map has the same binding
+		return m.updateTextInput(msg)
+	}
+	return m.updateTextInputWith(func(textInput shellinput.Model) (shellinput.Model, tea.Cmd) {
+		return textInput.PerformAction(binding.Value)
+	})
+}
+
+type shellCommandDoneMsg struct {
+	line  string
+	point int
+	err   error
+}
+
+// shellCommandExec runs a key bound shell command while bubbletea has released the terminal
+type shellCommandExec struct {
+	run func() error
+}
+
+func (e *shellCommandExec) Run() error          { return e.run() }
+func (e *shellCommandExec) SetStdin(io.Reader)  {}
+func (e *shellCommandExec) SetStdout(io.Writer) {}
+func (e *shellCommandExec) SetStderr(io.Writer) {}
+
+func (m appModel) runShellCommand(command string) (tea.Model, tea.Cmd) {
+	if m.options.ShellCommandRunner == nil {
+		m.logger.Debug("gline has no shell command runner", zap.String("command", command))
+		return m, nil
+	}
+
+	line, point := m.textInput.Value(), m.textInput.Position()
+	done := shellCommandDoneMsg{line: line, point: point}
+	exec := &shellCommandExec{run: func() error {
+		done.line, done.point, done.err = m.options.ShellCommandRunner(command, line, point)
+		return done.err
+	}}
+	return m, tea.Exec(exec, func(err error) tea.Msg {
+		done.err = err
+		return done
+	})
+}
+
+func (m appModel) shellCommandDone(msg shellCommandDoneMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.logger.Debug("gline key bound shell command failed", zap.Error(msg.err))
+	}
+	return m.updateTextInputWith(func(textInput shellinput.Model) (shellinput.Model, tea.Cmd) {
+		if msg.line != textInput.Value() {
+			textInput.SetValue(msg.line)
+		}
+		textInput.SetCursor(msg.point)
+		return textInput, nil
+	})
+}
+
+func (m appModel) acceptLine() (tea.Model, tea.Cmd) {
+	if m.textInput.IsMultiline() {
+		// A block closed on the last line is dedented as if a newline followed it
+		m.textInput.CursorEnd()
+		m.textInput.DedentLine()
+	}
+	input := m.textInput.Value()
+
+	if !IsCompleteCommand(input) {
+		// Keep editing the command on a new line
+		return m.updateTextInputWith(func(textInput shellinput.Model) (shellinput.Model, tea.Cmd) {
+			textInput.CursorEnd()
+			textInput.InsertNewline()
+			textInput.ResetViMode()
+			return textInput, nil
+		})
+	}
+
+	if m.options.ConfirmHighRisk && !m.confirmingRisk {
+		// Ask once more before running a high-risk command
+		if risk := m.checkRisk(input); risk.Level == RiskHigh {
+			m.confirmingRisk = true
+			m.risk = risk
 			return m, nil
-		case "ctrl+l":
-			return m.handleClearScreen()
 		}
 	}
+	m.confirmingRisk = false
 
-	return m.updateTextInput(msg)
+	m.result = input
+	return m, tea.Sequence(terminate, tea.Quit)
 }
 
-func (m appModel) View() string {
-	// Once terminated, render nothing
-	if m.appState == Terminated {
-		return ""
+type editorDoneMsg struct {
+	path string
+	err  error
+}
+
+// editAndExecuteCommand opens the input in an editor, and runs the edited
+// command once the editor exits
+func (m appModel) editAndExecuteCommand() (tea.Model, tea.Cmd) {
+	file, err := os.CreateTemp("", "gsh-edit-*.sh")
+	if err != nil {
+		m.logger.Debug("gline failed to create a file to edit the input in", zap.Error(err))
+		return m, nil
+	}
+	_, err = file.WriteString(m.textInput.Value() + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		m.logger.Debug("gline failed to write the input to edit", zap.Error(err))
+		os.Remove(file.Name())
+		return m, nil
 	}
 
-	var s string
+	args := append(strings.Fields(m.editor()), file.Name())
+	path := file.Name()
+	return m, tea.ExecProcess(exec.Command(args[0], args[1:]...), func(err error) tea.Msg {
+		return editorDoneMsg{path: path, err: err}
+	})
+}
 
-	// If we have multiline content, show each line with its original prompt
-	if m.multilineState.IsActive() {
-		lines := m.multilineState.GetLines()
-		for i, line := range lines {
-			if i == 0 {
-				// First line uses the original prompt (textInput already adds the space)
-				s += m.originalPrompt + line + "\n"
-			} else {
-				// Subsequent lines use continuation prompt
-				s += "> " + line + "\n"
-			}
+func (m appModel) editor() string {
+	for _, editor := range []string{m.options.Editor, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if strings.TrimSpace(editor) != "" {
+			return editor
 		}
 	}
+	return "vi"
+}
+
+func (m appModel) editorDone(msg editorDoneMsg) (tea.Model, tea.Cmd) {
+	defer os.Remove(msg.path)
+	if msg.err != nil {
+		// As in bash, the command isn't run when the editor fails
+		m.logger.Debug("gline editor exited with an error", zap.Error(msg.err))
+		return m, nil
+	}
+
+	content, err := os.ReadFile(msg.path)
+	if err != nil {
+		m.logger.Debug("gline failed to read the edited input", zap.Error(err))
+		return m, nil
+	}
+	m, _ = m.updateTextInputWith(func(textInput shellinput.Model) (shellinput.Model, tea.Cmd) {
+		textInput.SetValue(strings.TrimRight(string(content), "\n"))
+		return textInput, nil
+	})
+	return m.acceptLine()
+}
+
+func (m appModel) interruptLine() (tea.Model, tea.Cmd) {
+	// Handle Ctrl-C: cancel current line, preserve input with "^C" appended, and present fresh prompt
+	currentInput := m.textInput.Value()
+
+	// Print the current input with "^C" appended, then move to next line
+	// This works for both empty and non-empty input
+	fmt.Printf("%s^C\n", currentInput)
+
+	// Flush output to ensure it's displayed before framework cleanup
+	os.Stdout.Sync()
+
+	// Set result to empty string so shell doesn't try to execute it
+	m.result = ""
+	// Use interrupt message to indicate Ctrl+C was pressed
+	return m, tea.Sequence(interrupt, tea.Quit)
+}
+
+func (m appModel) endOfFile() (tea.Model, tea.Cmd) {
+	// Handle Ctrl-D: exit shell if on blank line
+	currentInput := m.textInput.Value()
+	if strings.TrimSpace(currentInput) == "" {
+		// On blank line, exit the shell
+		m.result = "exit"
+		return m, tea.Sequence(terminate, tea.Quit)
+	}
+	// If there's content, do nothing (standard behavior)
+	return m, nil
+}
+
+func (m appModel) View() string {
+	// Once terminated, render nothing
+	if m.appState == Terminated {
+		return ""
+	}
 
-	// Add the current input line with appropriate prompt
-	s += m.textInput.View()
+	s := m.withRightPrompt(m.textInput.View())
 
 	// Add completion box if active
 	completionBox := m.textInput.CompletionBoxView()
 	if completionBox != "" {
 		s += "\n"
-		s += m.completionStyle.Render(completionBox)
+		s += m.styles.Completion.Render(completionBox)
 	}
 
 	// Add explanation (either from help box or prediction explanation)
 	helpBox := m.textInput.HelpBoxView()
 	if helpBox != "" {
 		s += "\n"
-		s += m.explanationStyle.Render(helpBox)
-	} else if m.explanation != "" {
+		s += m.styles.Explanation.Render(helpBox)
+	} else if explanation := m.explanationView(); explanation != "" {
+		style := m.styles.Explanation
+		if m.risk.Level == RiskHigh {
+			style = m.styles.HighRiskExplanation
+		}
 		s += "\n"
-		s += m.explanationStyle.Render(m.explanation)
+		s += style.Render(explanation)
 	}
 
 	numLines := strings.Count(s, "\n")
@@ -299,6 +488,60 @@ func (m appModel) View() string {
 	return s
 }
 
+// withRightPrompt puts the right prompt at the right end of the first line of
+// the input view, unless the line leaves no room for it
+func (m appModel) withRightPrompt(view string) string {
+	rightPrompt := m.options.RightPrompt
+	if rightPrompt == "" || m.textInput.Width <= 0 {
+		return view
+	}
+	firstLine, rest, multiline := strings.Cut(view, "\n")
+
+	// The input view pads its last line with spaces to the full width
+	contentWidth := lipgloss.Width(strings.TrimRight(firstLine, " "))
+	rightWidth := lipgloss.Width(rightPrompt)
+	// Leave a column for the cursor and one to separate them
+	if contentWidth+2+rightWidth > m.textInput.Width {
+		return view
+	}
+
+	line := truncate.String(firstLine, uint(m.textInput.Width-rightWidth))
+	line += strings.Repeat(" ", m.textInput.Width-rightWidth-lipgloss.Width(line)) + rightPrompt
+	if multiline {
+		line += "\n" + rest
+	}
+	return line
+}
+
+// explanationView returns the explanation box content, headed by where the shown
+// prediction came from when the predictor reports sources
+func (m appModel) explanationView() string {
+	if m.confirmingRisk {
+		return "High-risk command: " + strings.Join(m.risk.Reasons, "; ") +
+			"\nPress Enter again to run it, or edit the command to cancel."
+	}
+
+	explanation := m.explanation
+	if explanation == "" && m.risk.Level == RiskHigh {
+		// Warn right away, without waiting for the full explanation
+		explanation = "High risk: " + strings.Join(m.risk.Reasons, "; ")
+	}
+
+	candidate, index, ok := m.currentCandidate()
+	if !ok || candidate.Source == "" {
+		return explanation
+	}
+
+	header := "Suggested by " + candidate.Source
+	if len(m.candidates) > 1 {
+		header = fmt.Sprintf("[%d/%d] %s (Alt-] / Alt-[ to cycle)", index+1, len(m.candidates), header)
+	}
+	if explanation == "" {
+		return header
+	}
+	return header + "\n" + explanation
+}
+
 func (m appModel) getFinalOutput() string {
 	m.textInput.SetValue(m.result)
 	m.textInput.SetSuggestions([]string{})
@@ -313,14 +556,35 @@ func (m appModel) getFinalOutput() string {
 }
 
 func (m appModel) updateTextInput(msg tea.Msg) (appModel, tea.Cmd) {
+	return m.updateTextInputWith(func(textInput shellinput.Model) (shellinput.Model, tea.Cmd) {
+		return textInput.Update(msg)
+	})
+}
+
+// updateTextInputWith applies a change to the text input and updates predictions to match
+func (m appModel) updateTextInputWith(update func(shellinput.Model) (shellinput.Model, tea.Cmd)) (appModel, tea.Cmd) {
 	oldVal := m.textInput.Value()
-	updatedTextInput, cmd := m.textInput.Update(msg)
+	updatedTextInput, cmd := update(m.textInput)
 	newVal := updatedTextInput.Value()
 
 	textUpdated := oldVal != newVal
 	m.textInput = updatedTextInput
 
+	// if the user cycled to another candidate, show and explain that one instead
+	if !textUpdated && m.prediction != "" {
+		if current := m.textInput.CurrentSuggestion(); current != "" && current != m.prediction {
+			var explain tea.Cmd
+			m, explain = m.selectPrediction(current)
+			return m, tea.Batch(cmd, explain)
+		}
+	}
+
 	// if the text input has changed, we want to attempt a prediction
+	if textUpdated {
+		// editing the command cancels a pending high-risk confirmation
+		m.confirmingRisk = false
+	}
+
 	if textUpdated && m.predictor != nil {
 		m.predictionStateId++
 
@@ -335,6 +599,13 @@ func (m appModel) updateTextInput(msg tea.Msg) (appModel, tea.Cmd) {
 			// if the model was dirty earlier, but now the user has cleared the input,
 			// we should clear the prediction
 			m.clearPrediction()
+		} else if len(userInput) > 0 && strings.HasPrefix(m.prediction, userInput) && m.predictionIsInstant {
+			// keep showing the instant prediction, but still ask for the full one
+			cmd = tea.Batch(cmd, tea.Tick(200*time.Millisecond, func(t time.Time) tea.Msg {
+				return attemptPredictionMsg{
+					stateId: m.predictionStateId,
+				}
+			}))
 		} else if len(userInput) > 0 && strings.HasPrefix(m.prediction, userInput) {
 			// if the prediction already starts with the user input, we don't need to predict again
 			m.logger.Debug("gline existing predicted input already starts with user input", zap.String("userInput", userInput))
@@ -355,30 +626,86 @@ func (m appModel) updateTextInput(msg tea.Msg) (appModel, tea.Cmd) {
 
 func (m *appModel) clearPrediction() {
 	m.prediction = ""
+	m.predictionIsInstant = false
+	m.candidates = nil
+	m.risk = RiskAssessment{}
 	m.explanation = ""
 	m.textInput.SetSuggestions([]string{})
 }
 
-func (m appModel) setPrediction(stateId int, prediction string, inputContext string) (appModel, tea.Cmd) {
-	if stateId != m.predictionStateId {
+func (m appModel) setPrediction(msg setPredictionMsg) (appModel, tea.Cmd) {
+	if msg.stateId != m.predictionStateId {
 		m.logger.Debug(
 			"gline discarding prediction",
-			zap.Int("startStateId", stateId),
+			zap.Int("startStateId", msg.stateId),
 			zap.Int("newStateId", m.predictionStateId),
 		)
 		return m, nil
 	}
 
+	if msg.instant && m.prediction != "" && !m.predictionIsInstant {
+		// The full prediction already arrived, don't downgrade it
+		return m, nil
+	}
+
+	if !msg.instant && msg.prediction == "" && m.predictionIsInstant {
+		// Keep the instant suggestion when the full predictor has nothing better
+		return m, nil
+	}
+
+	m.candidates = msg.candidates
+	if len(m.candidates) == 0 {
+		m.candidates = []PredictionCandidate{{Command: msg.prediction}}
+	}
+	suggestions := make([]string, len(m.candidates))
+	for i, candidate := range m.candidates {
+		suggestions[i] = candidate.Command
+	}
+
+	m.predictionIsInstant = msg.instant
+	m.lastPredictionInput = msg.inputContext
+	m.textInput.SetSuggestions(suggestions)
+
+	return m.selectPrediction(msg.prediction)
+}
+
+// selectPrediction makes prediction the one currently shown and requests its explanation
+func (m appModel) selectPrediction(prediction string) (appModel, tea.Cmd) {
 	m.prediction = prediction
-	m.lastPredictionInput = inputContext
 	m.lastPrediction = prediction
-	m.textInput.SetSuggestions([]string{prediction})
 	m.explanation = ""
+	m.risk = m.checkRisk(prediction)
+
+	if m.predictionIsInstant || prediction == "" {
+		// Explanations are only worth requesting once the full prediction is in
+		return m, nil
+	}
+
+	typed := m.textInput.Value()
 	return m, tea.Cmd(func() tea.Msg {
-		return attemptExplanationMsg{stateId: m.predictionStateId, prediction: prediction}
+		return attemptExplanationMsg{stateId: m.predictionStateId, prediction: prediction, typed: typed}
 	})
 }
 
+// checkRisk rates command with the explainer's deterministic risk check, if it has one
+func (m appModel) checkRisk(command string) RiskAssessment {
+	checker, ok := m.explainer.(RiskChecker)
+	if !ok || command == "" {
+		return RiskAssessment{}
+	}
+	return checker.CheckRisk(command)
+}
+
+// currentCandidate returns the candidate currently shown as the suggestion
+func (m appModel) currentCandidate() (PredictionCandidate, int, bool) {
+	for i, candidate := range m.candidates {
+		if candidate.Command == m.prediction {
+			return candidate, i, true
+		}
+	}
+	return PredictionCandidate{}, 0, false
+}
+
 func (m appModel) attemptPrediction(msg attemptPredictionMsg) (tea.Model, tea.Cmd) {
 	if m.predictor == nil {
 		return m, nil
@@ -387,8 +714,29 @@ func (m appModel) attemptPrediction(msg attemptPredictionMsg) (tea.Model, tea.Cm
 		return m, nil
 	}
 
-	return m, tea.Cmd(func() tea.Msg {
-		prediction, inputContext, err := m.predictor.Predict(m.textInput.Value())
+	input := m.textInput.Value()
+	predict := tea.Cmd(func() tea.Msg {
+		if candidatePredictor, ok := m.predictor.(CandidatePredictor); ok {
+			candidates, inputContext, err := candidatePredictor.PredictCandidates(input)
+			if err != nil {
+				m.logger.Error("gline prediction failed", zap.Error(err))
+				return nil
+			}
+
+			m.logger.Debug(
+				"gline predicted input candidates",
+				zap.Int("stateId", msg.stateId),
+				zap.Any("candidates", candidates),
+				zap.String("inputContext", inputContext),
+			)
+			var prediction string
+			if len(candidates) > 0 {
+				prediction = candidates[0].Command
+			}
+			return setPredictionMsg{stateId: msg.stateId, prediction: prediction, inputContext: inputContext, candidates: candidates}
+		}
+
+		prediction, inputContext, err := m.predictor.Predict(input)
 		if err != nil {
 			m.logger.Error("gline prediction failed", zap.Error(err))
 			return nil
@@ -402,6 +750,26 @@ func (m appModel) attemptPrediction(msg attemptPredictionMsg) (tea.Model, tea.Cm
 		)
 		return setPredictionMsg{stateId: msg.stateId, prediction: prediction, inputContext: inputContext}
 	})
+
+	instantPredictor, ok := m.predictor.(InstantPredictor)
+	if !ok {
+		return m, predict
+	}
+
+	predictInstant := tea.Cmd(func() tea.Msg {
+		prediction, inputContext, err := instantPredictor.PredictInstant(input)
+		if err != nil || prediction == "" {
+			return nil
+		}
+
+		m.logger.Debug(
+			"gline predicted input instantly",
+			zap.Int("stateId", msg.stateId),
+			zap.String("prediction", prediction),
+		)
+		return setPredictionMsg{stateId: msg.stateId, prediction: prediction, inputContext: inputContext, instant: true}
+	})
+	return m, tea.Batch(predictInstant, predict)
 }
 
 func (m appModel) attemptExplanation(msg attemptExplanationMsg) (tea.Model, tea.Cmd) {
@@ -413,7 +781,14 @@ func (m appModel) attemptExplanation(msg attemptExplanationMsg) (tea.Model, tea.
 	}
 
 	return m, tea.Cmd(func() tea.Msg {
-		explanation, err := m.explainer.Explain(msg.prediction)
+		var explanation string
+		var risk RiskAssessment
+		var err error
+		if riskExplainer, ok := m.explainer.(RiskExplainer); ok {
+			explanation, risk, err = riskExplainer.ExplainWithRisk(msg.prediction, msg.typed)
+		} else {
+			explanation, err = m.explainer.Explain(msg.prediction)
+		}
 		if err != nil {
 			m.logger.Error("gline explanation failed", zap.Error(err))
 			return nil
@@ -424,7 +799,7 @@ func (m appModel) attemptExplanation(msg attemptExplanationMsg) (tea.Model, tea.
 			zap.Int("stateId", msg.stateId),
 			zap.String("explanation", explanation),
 		)
-		return setExplanationMsg{stateId: msg.stateId, explanation: explanation}
+		return setExplanationMsg{stateId: msg.stateId, prediction: msg.prediction, explanation: explanation, risk: risk}
 	})
 }
 
@@ -456,7 +831,15 @@ func (m appModel) setExplanation(msg setExplanationMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	if msg.prediction != m.prediction {
+		// The user cycled to another candidate while this one was being explained
+		return m, nil
+	}
+
 	m.explanation = msg.explanation
+	if msg.risk.Level > m.risk.Level {
+		m.risk = msg.risk
+	}
 	return m, nil
 }
 
@@ -470,12 +853,23 @@ func Gline(
 	logger *zap.Logger,
 	options Options,
 ) (string, error) {
+	programOptions := []tea.ProgramOption{
+		// Signals are left to the shell, which handles them along with traps
+		tea.WithoutSignalHandler(),
+	}
+	if options.Context != nil {
+		programOptions = append(programOptions, tea.WithContext(options.Context))
+	}
 	p := tea.NewProgram(
 		initialModel(prompt, historyValues, explanation, predictor, explainer, analytics, logger, options),
+		programOptions...,
 	)
 
 	m, err := p.Run()
 	if err != nil {
+		if options.Context != nil && options.Context.Err() != nil {
+			return "", options.Context.Err()
+		}
 		return "", err
 	}
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -129,12 +130,12 @@ func newAppCompletionProvider() *appCompletionProvider {
 	}
 }
 
-func (p *appCompletionProvider) GetCompletions(line string, pos int) []string {
+func (p *appCompletionProvider) GetCompletions(line string, pos int) []shellinput.CompletionCandidate {
 	inputLine := line[:pos]
 	if completions, ok := p.completions[inputLine]; ok {
-		return completions
+		return shellinput.NewCompletionCandidates(completions)
 	}
-	return []string{}
+	return []shellinput.CompletionCandidate{}
 }
 
 func (p *appCompletionProvider) GetHelpInfo(line string, pos int) string {
@@ -207,7 +208,7 @@ func TestApp_PredictionFlow_Integration(t *testing.T) {
 			if cmd != nil {
 				msg := cmd()
 				if setPredMsg, ok := msg.(setPredictionMsg); ok {
-					updatedModel, _ := model.setPrediction(setPredMsg.stateId, setPredMsg.prediction, setPredMsg.inputContext)
+					updatedModel, _ := model.setPrediction(setPredMsg)
 					model = updatedModel
 				}
 			}
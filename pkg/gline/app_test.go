@@ -1,10 +1,15 @@
 package gline
 
 import (
+	"errors"
+	"os"
+	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -282,4 +287,180 @@ func TestHandleClearScreen(t *testing.T) {
 	// ClearScreen() returns a clearScreenMsg (unexported), so we can't type assert
 	// We just verify that the command returns something non-nil
 	assert.NotNil(t, msg, "handleClearScreen should return tea.ClearScreen command")
-}
\ No newline at end of file
+}
+
+// Test that an instant prediction is shown first and then upgraded by the full one
+func TestInstantPredictionUpgrade(t *testing.T) {
+	logger := zap.NewNop()
+	model := initialModel("test> ", []string{}, "", nil, nil, nil, logger, NewOptions())
+
+	model, cmd := model.setPrediction(setPredictionMsg{stateId: model.predictionStateId, prediction: "git status", instant: true})
+	assert.Nil(t, cmd, "instant predictions should not be explained")
+	assert.Equal(t, "git status", model.prediction)
+	assert.True(t, model.predictionIsInstant)
+
+	model, cmd = model.setPrediction(setPredictionMsg{stateId: model.predictionStateId, prediction: "git stash pop"})
+	assert.NotNil(t, cmd, "full predictions should be explained")
+	assert.Equal(t, "git stash pop", model.prediction)
+	assert.False(t, model.predictionIsInstant)
+
+	// A late instant prediction must not replace the full one
+	model, _ = model.setPrediction(setPredictionMsg{stateId: model.predictionStateId, prediction: "git status", instant: true})
+	assert.Equal(t, "git stash pop", model.prediction)
+}
+
+// Test cycling through ranked prediction candidates
+func TestCyclePredictionCandidates(t *testing.T) {
+	logger := zap.NewNop()
+	model := initialModel("test> ", []string{}, "", &mockPredictor{}, nil, nil, logger, NewOptions())
+
+	model, _ = model.setPrediction(setPredictionMsg{
+		stateId:    model.predictionStateId,
+		prediction: "git status",
+		candidates: []PredictionCandidate{
+			{Command: "git status", Source: "LLM"},
+			{Command: "git push", Source: "history"},
+		},
+	})
+	assert.Equal(t, "git status", model.prediction)
+	assert.Contains(t, model.explanationView(), "[1/2] Suggested by LLM")
+
+	model, cmd := model.updateTextInput(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}, Alt: true})
+	assert.NotNil(t, cmd, "the newly selected candidate should be explained")
+	assert.Equal(t, "git push", model.prediction)
+	assert.Equal(t, "git push", model.lastPrediction)
+	assert.Contains(t, model.explanationView(), "[2/2] Suggested by history")
+
+	// An explanation of the previous candidate arriving late is discarded
+	updated, _ := model.setExplanation(setExplanationMsg{stateId: model.predictionStateId, prediction: "git status", explanation: "stale"})
+	assert.Equal(t, "", updated.(appModel).explanation)
+}
+
+// riskyExplainer rates any command containing "rm -rf /" as high risk
+type riskyExplainer struct {
+	NoopExplainer
+}
+
+func (e *riskyExplainer) CheckRisk(command string) RiskAssessment {
+	if strings.Contains(command, "rm -rf /") {
+		return RiskAssessment{Level: RiskHigh, Reasons: []string{"deletes everything"}}
+	}
+	return RiskAssessment{Level: RiskLow}
+}
+
+// Test that high-risk predictions are flagged right away
+func TestHighRiskPrediction(t *testing.T) {
+	logger := zap.NewNop()
+	model := initialModel("test> ", []string{}, "", nil, &riskyExplainer{}, nil, logger, NewOptions())
+
+	model, _ = model.setPrediction(setPredictionMsg{stateId: model.predictionStateId, prediction: "rm -rf /"})
+	assert.Equal(t, RiskHigh, model.risk.Level)
+	assert.Contains(t, model.explanationView(), "High risk: deletes everything")
+
+	model, _ = model.setPrediction(setPredictionMsg{stateId: model.predictionStateId, prediction: "ls"})
+	assert.Equal(t, RiskLow, model.risk.Level)
+	assert.Equal(t, "", model.explanationView())
+}
+
+// Test that high-risk commands need a second enter when confirmation is enabled
+func TestConfirmHighRiskCommand(t *testing.T) {
+	logger := zap.NewNop()
+	options := NewOptions()
+	options.ConfirmHighRisk = true
+	model := initialModel("test> ", []string{}, "", nil, &riskyExplainer{}, nil, logger, options)
+	model.textInput.SetValue("rm -rf /")
+
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(appModel)
+	assert.Nil(t, cmd, "the first enter should only ask for confirmation")
+	assert.True(t, model.confirmingRisk)
+	assert.Contains(t, model.explanationView(), "Press Enter again")
+
+	// Editing the command cancels the confirmation
+	model, _ = model.updateTextInput(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	assert.False(t, model.confirmingRisk)
+	model.textInput.SetValue("rm -rf /")
+
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(appModel)
+	assert.True(t, model.confirmingRisk)
+	updated, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(appModel)
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "rm -rf /", model.result)
+}
+
+// Test that enter on an incomplete command continues it on a new line of the same input
+func TestAcceptIncompleteCommand(t *testing.T) {
+	model := initialModel("test> ", []string{}, "", nil, nil, nil, zap.NewNop(), NewOptions())
+	model.textInput.SetValue("for f in *; do")
+
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(appModel)
+	assert.Nil(t, cmd)
+	assert.Equal(t, "for f in *; do\n  ", model.textInput.Value())
+
+	model.textInput.InsertText("echo $f")
+	model.textInput.InsertNewline()
+	model.textInput.InsertText("done")
+
+	// Earlier lines can still be edited
+	model, _ = pressKeys(model, tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeyCtrlE}, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'s'}})
+	assert.Equal(t, "for f in *; do\n  echo $fs\n  done", model.textInput.Value())
+
+	updated, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(appModel)
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "for f in *; do\n  echo $fs\ndone", model.result)
+}
+
+// Test that ctrl+x ctrl+e opens the input in an editor and runs the edited command
+func TestEditAndExecuteCommand(t *testing.T) {
+	options := NewOptions()
+	options.Editor = "true"
+	model := initialModel("test> ", []string{}, "", nil, nil, nil, zap.NewNop(), options)
+	model.textInput.SetValue("echo hi")
+
+	model, cmd := pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlX}, tea.KeyMsg{Type: tea.KeyCtrlE})
+	require.NotNil(t, cmd)
+
+	// Simulate the editor changing the file
+	file, err := os.CreateTemp(t.TempDir(), "gsh-edit-*.sh")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file.Name(), []byte("echo hi\necho bye\n"), 0o600))
+	file.Close()
+
+	updated, cmd := model.Update(editorDoneMsg{path: file.Name()})
+	model = updated.(appModel)
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "echo hi\necho bye", model.result)
+	assert.NoFileExists(t, file.Name(), "the edited file should be removed")
+
+	// The command isn't run when the editor fails
+	model = initialModel("test> ", []string{}, "", nil, nil, nil, zap.NewNop(), options)
+	model.textInput.SetValue("echo hi")
+	updated, cmd = model.Update(editorDoneMsg{path: file.Name(), err: errors.New("exit status 1")})
+	model = updated.(appModel)
+	assert.Nil(t, cmd)
+	assert.Equal(t, "", model.result)
+	assert.Equal(t, "echo hi", model.textInput.Value())
+}
+
+func TestRightPrompt(t *testing.T) {
+	options := NewOptions()
+	options.RightPrompt = "[main]"
+	model := initialModel("> ", []string{}, "", nil, nil, nil, zap.NewNop(), options)
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 20, Height: 10})
+	model = updated.(appModel)
+
+	model.textInput.SetValue("ls")
+	firstLine := strings.Split(model.View(), "\n")[0]
+	assert.True(t, strings.HasPrefix(firstLine, "> ls"))
+	assert.True(t, strings.HasSuffix(firstLine, "[main]"), "the right prompt is at the right end of the line")
+	assert.Equal(t, 20, lipgloss.Width(firstLine))
+
+	// It makes room for the input
+	model.textInput.SetValue("echo long input")
+	firstLine = strings.Split(model.View(), "\n")[0]
+	assert.NotContains(t, firstLine, "[main]")
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/atinylittleshell/gsh/internal/completion"
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
 	"mvdan.cc/sh/v3/interp"
 )
 
@@ -15,11 +16,11 @@ type ShellCompletionProvider struct {
 }
 
 // GetCompletions returns completion suggestions for the current input line
-func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []string {
+func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []shellinput.CompletionCandidate {
 	// Split the line into words
 	words := strings.Fields(line[:pos])
 	if len(words) == 0 {
-		return []string{}
+		return []shellinput.CompletionCandidate{}
 	}
 
 	// Get the command (first word)
@@ -28,15 +29,15 @@ func (p *ShellCompletionProvider) GetCompletions(line string, pos int) []string
 	// Look up completion spec for this command
 	spec, ok := p.CompletionManager.GetSpec(command)
 	if !ok {
-		return []string{}
+		return []shellinput.CompletionCandidate{}
 	}
 
 	// Execute the completion
 	suggestions, err := p.CompletionManager.ExecuteCompletion(context.Background(), p.Runner, spec, words)
 	if err != nil {
-		return []string{}
+		return []shellinput.CompletionCandidate{}
 	}
 
-	return suggestions
+	return shellinput.NewCompletionCandidates(suggestions)
 }
 
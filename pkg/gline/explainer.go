@@ -4,6 +4,34 @@ type Explainer interface {
 	Explain(input string) (string, error)
 }
 
+// RiskLevel rates how dangerous running a command is
+type RiskLevel int
+
+const (
+	RiskUnknown RiskLevel = iota
+	RiskLow
+	RiskMedium
+	RiskHigh
+)
+
+// RiskAssessment summarizes why a command is risky
+type RiskAssessment struct {
+	Level   RiskLevel
+	Reasons []string
+}
+
+// RiskChecker is implemented by explainers that can rate a command's risk quickly
+// and without a model, so it can be checked before every explanation and on enter.
+type RiskChecker interface {
+	CheckRisk(command string) RiskAssessment
+}
+
+// RiskExplainer is implemented by explainers that assess risk as part of explaining.
+// typed is the part of input the user typed, as opposed to predicted.
+type RiskExplainer interface {
+	ExplainWithRisk(input string, typed string) (string, RiskAssessment, error)
+}
+
 type NoopExplainer struct{}
 
 func (e *NoopExplainer) Explain(input string) (string, error) {
@@ -0,0 +1,743 @@
+package gline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// Actions handled by gline itself rather than the line editor
+const (
+	ActionAcceptLine  = "accept-line"
+	ActionInterrupt   = "interrupt"
+	ActionEndOfFile   = "end-of-file"
+	ActionClearScreen = shellinput.ActionClearScreen
+	// ActionEditAndExecuteCommand opens the input in an editor and runs it
+	// when the editor exits, like bash's edit-and-execute-command
+	ActionEditAndExecuteCommand = "edit-and-execute-command"
+)
+
+var glineActions = []string{ActionAcceptLine, ActionInterrupt, ActionEndOfFile, ActionEditAndExecuteCommand}
+
+// BindingKind tells what a key binding does
+type BindingKind int
+
+const (
+	// BindingAction runs a named editing action
+	BindingAction BindingKind = iota
+	// BindingMacro inserts text as if it was typed
+	BindingMacro
+	// BindingShellCommand runs a shell command, like bash's bind -x
+	BindingShellCommand
+	// BindingAgentMacro sends an agent macro as a chat message
+	BindingAgentMacro
+)
+
+// KeyBinding binds a sequence of keys, in bubbletea notation such as "ctrl+x", to something to do
+type KeyBinding struct {
+	Keys  []string
+	Kind  BindingKind
+	Value string
+}
+
+// KeyBindings is the table of key bindings used by gline. It starts with the
+// default bindings and can be changed from an inputrc file or the bind builtin.
+type KeyBindings struct {
+	mu        sync.RWMutex
+	bindings  map[string]KeyBinding // space separated keys -> binding
+	variables map[string]string
+}
+
+// NewKeyBindings returns the default key bindings
+func NewKeyBindings() *KeyBindings {
+	b := &KeyBindings{
+		bindings:  make(map[string]KeyBinding),
+		variables: map[string]string{"editing-mode": "emacs"},
+	}
+
+	defaults := shellinput.DefaultKeyMap
+	for _, action := range shellinput.Actions() {
+		for _, k := range defaults.Binding(action).Keys() {
+			b.bind(KeyBinding{Keys: []string{k}, Kind: BindingAction, Value: action})
+		}
+	}
+	b.bind(KeyBinding{Keys: []string{"enter"}, Kind: BindingAction, Value: ActionAcceptLine})
+	b.bind(KeyBinding{Keys: []string{"ctrl+c"}, Kind: BindingAction, Value: ActionInterrupt})
+	b.bind(KeyBinding{Keys: []string{"ctrl+d"}, Kind: BindingAction, Value: ActionEndOfFile})
+	b.bind(KeyBinding{Keys: []string{"ctrl+x", "ctrl+e"}, Kind: BindingAction, Value: ActionEditAndExecuteCommand})
+	return b
+}
+
+// IsBindableAction reports whether keys can be bound to the named action
+func IsBindableAction(name string) bool {
+	for _, action := range glineActions {
+		if action == name {
+			return true
+		}
+	}
+	return shellinput.IsAction(name)
+}
+
+// BindableActions returns the names of all actions keys can be bound to
+func BindableActions() []string {
+	actions := append([]string{}, glineActions...)
+	actions = append(actions, shellinput.Actions()...)
+	sort.Strings(actions)
+	return actions
+}
+
+func (b *KeyBindings) bind(binding KeyBinding) {
+	if binding.Kind == BindingAction {
+		if action := shellinput.CanonicalAction(binding.Value); action != "" {
+			binding.Value = action
+		}
+	}
+	b.bindings[strings.Join(binding.Keys, " ")] = binding
+}
+
+// Bind adds a binding, replacing any binding of the same keys
+func (b *KeyBindings) Bind(binding KeyBinding) error {
+	if len(binding.Keys) == 0 {
+		return fmt.Errorf("no keys to bind")
+	}
+	if binding.Kind == BindingAction && !IsBindableAction(binding.Value) {
+		return fmt.Errorf("unknown function name: %s", binding.Value)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bind(binding)
+	return nil
+}
+
+// Unbind removes the binding of keys, returning whether there was one
+func (b *KeyBindings) Unbind(keys []string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sequence := strings.Join(keys, " ")
+	_, ok := b.bindings[sequence]
+	delete(b.bindings, sequence)
+	return ok
+}
+
+// UnbindAction removes every binding of the named action
+func (b *KeyBindings) UnbindAction(action string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if canonical := shellinput.CanonicalAction(action); canonical != "" {
+		action = canonical
+	}
+	for sequence, binding := range b.bindings {
+		if binding.Kind == BindingAction && binding.Value == action {
+			delete(b.bindings, sequence)
+		}
+	}
+}
+
+// List returns all bindings ordered by action and keys
+func (b *KeyBindings) List() []KeyBinding {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	bindings := make([]KeyBinding, 0, len(b.bindings))
+	for _, binding := range b.bindings {
+		bindings = append(bindings, binding)
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		if bindings[i].Kind != bindings[j].Kind {
+			return bindings[i].Kind < bindings[j].Kind
+		}
+		if bindings[i].Value != bindings[j].Value {
+			return bindings[i].Value < bindings[j].Value
+		}
+		return strings.Join(bindings[i].Keys, " ") < strings.Join(bindings[j].Keys, " ")
+	})
+	return bindings
+}
+
+// SetVariable sets a readline variable such as editing-mode
+func (b *KeyBindings) SetVariable(name string, value string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.variables[strings.ToLower(name)] = value
+}
+
+// viModeStrings returns the prompt prefixes for vi's insert and command modes
+func (b *KeyBindings) viModeStrings() (string, string) {
+	variables := b.Variables()
+	if strings.EqualFold(variables["show-mode-in-prompt"], "off") {
+		return "", ""
+	}
+
+	insert, command := shellinput.DefaultViInsertModeString, shellinput.DefaultViCommandModeString
+	if value, ok := variables["vi-ins-mode-string"]; ok {
+		insert = value
+	}
+	if value, ok := variables["vi-cmd-mode-string"]; ok {
+		command = value
+	}
+	// Readline marks non-printing characters with \1 and \2, which aren't needed here
+	strip := strings.NewReplacer("\x01", "", "\x02", "")
+	return strip.Replace(insert), strip.Replace(command)
+}
+
+// Variable returns the value of a readline variable, or "" if it isn't set
+func (b *KeyBindings) Variable(name string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.variables[strings.ToLower(name)]
+}
+
+// Variables returns all readline variables that are set
+func (b *KeyBindings) Variables() map[string]string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	variables := make(map[string]string, len(b.variables))
+	for name, value := range b.variables {
+		variables[name] = value
+	}
+	return variables
+}
+
+// bindingLookup is the result of looking up a sequence of keys
+type bindingLookup int
+
+const (
+	lookupNone bindingLookup = iota
+	// lookupPrefix means the keys start a longer binding, so more keys are needed
+	lookupPrefix
+	lookupMatch
+)
+
+func (b *KeyBindings) lookup(keys []string) (KeyBinding, bindingLookup) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	sequence := strings.Join(keys, " ")
+	for other := range b.bindings {
+		if strings.HasPrefix(other, sequence+" ") {
+			return KeyBinding{}, lookupPrefix
+		}
+	}
+	if binding, ok := b.bindings[sequence]; ok {
+		return binding, lookupMatch
+	}
+	return KeyBinding{}, lookupNone
+}
+
+// KeyMap returns the line editor key map for the editing actions bound to single keys.
+// Actions bound to key sequences are run by gline.
+func (b *KeyBindings) KeyMap() shellinput.KeyMap {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	keys := map[string][]string{}
+	for _, binding := range b.bindings {
+		if binding.Kind == BindingAction && len(binding.Keys) == 1 && shellinput.IsAction(binding.Value) {
+			keys[binding.Value] = append(keys[binding.Value], binding.Keys[0])
+		}
+	}
+
+	keyMap := shellinput.EmptyKeyMap()
+	for action, actionKeys := range keys {
+		sort.Strings(actionKeys)
+		*keyMap.Binding(action) = key.NewBinding(key.WithKeys(actionKeys...))
+	}
+	return keyMap
+}
+
+// LoadInputrc reads bindings from an inputrc file. Lines that can't be parsed are
+// skipped and reported in the returned errors.
+func (b *KeyBindings) LoadInputrc(path string) []error {
+	return b.loadInputrc(path, 0)
+}
+
+// Maximum depth of nested $include directives
+const maxInputrcIncludeDepth = 8
+
+func (b *KeyBindings) loadInputrc(path string, depth int) []error {
+	file, err := os.Open(path)
+	if err != nil {
+		return []error{err}
+	}
+	defer file.Close()
+	return b.parseInputrc(file, path, depth)
+}
+
+// ParseInputrc reads bindings in inputrc format from r
+func (b *KeyBindings) ParseInputrc(r io.Reader) []error {
+	return b.parseInputrc(r, "", 0)
+}
+
+func (b *KeyBindings) parseInputrc(r io.Reader, path string, depth int) []error {
+	var errs []error
+	// Whether the lines in each nested $if block apply
+	conditions := []bool{}
+	active := func() bool {
+		for _, condition := range conditions {
+			if !condition {
+				return false
+			}
+		}
+		return true
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "$") {
+			directive, argument, _ := strings.Cut(line[1:], " ")
+			argument = strings.TrimSpace(argument)
+			switch directive {
+			case "if":
+				conditions = append(conditions, b.inputrcCondition(argument))
+			case "else":
+				if len(conditions) > 0 {
+					conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+				}
+			case "endif":
+				if len(conditions) > 0 {
+					conditions = conditions[:len(conditions)-1]
+				}
+			case "include":
+				if !active() {
+					continue
+				}
+				if depth >= maxInputrcIncludeDepth {
+					errs = append(errs, fmt.Errorf("%s:%d: too many nested includes", path, lineNumber))
+					continue
+				}
+				errs = append(errs, b.loadInputrc(expandHome(argument), depth+1)...)
+			default:
+				errs = append(errs, fmt.Errorf("%s:%d: unknown directive $%s", path, lineNumber, directive))
+			}
+			continue
+		}
+
+		if !active() {
+			continue
+		}
+		if err := b.ParseBindingLine(line); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", path, lineNumber, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// inputrcCondition evaluates the argument of an $if directive
+func (b *KeyBindings) inputrcCondition(argument string) bool {
+	name, value, hasValue := strings.Cut(argument, "=")
+	name = strings.TrimSpace(name)
+	if !hasValue {
+		// $if applies to the application named, gsh here
+		return strings.EqualFold(name, "gsh")
+	}
+	switch name {
+	case "mode":
+		return strings.EqualFold(strings.TrimSpace(value), b.Variable("editing-mode"))
+	default:
+		return false
+	}
+}
+
+// ParseBindingLine applies a single inputrc line: either a binding such as
+// "\C-a": beginning-of-line, or a variable such as set editing-mode vi
+func (b *KeyBindings) ParseBindingLine(line string) error {
+	line = strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(line, "set "); ok {
+		name, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" {
+			return fmt.Errorf("invalid variable setting: %s", line)
+		}
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`) {
+			var err error
+			if value, err = unquoteBindingValue(value); err != nil {
+				return err
+			}
+		} else {
+			value = unescapeReadline(value)
+		}
+		b.SetVariable(name, value)
+		return nil
+	}
+
+	keys, value, err := splitBindingLine(line)
+	if err != nil {
+		return err
+	}
+
+	binding := KeyBinding{Keys: keys}
+	switch {
+	case strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`):
+		binding.Kind = BindingMacro
+		binding.Value, err = unquoteBindingValue(value)
+	case strings.HasPrefix(value, "shell-command "):
+		binding.Kind = BindingShellCommand
+		binding.Value, err = unquoteBindingValue(strings.TrimSpace(strings.TrimPrefix(value, "shell-command ")))
+	case strings.HasPrefix(value, "agent-macro "):
+		binding.Kind = BindingAgentMacro
+		binding.Value, err = unquoteBindingValue(strings.TrimSpace(strings.TrimPrefix(value, "agent-macro ")))
+	default:
+		binding.Kind = BindingAction
+		binding.Value = strings.Fields(value)[0]
+	}
+	if err != nil {
+		return err
+	}
+	return b.Bind(binding)
+}
+
+// ParseShellCommandBinding parses the argument of bind -x, such as "\C-t": fzf_widget
+func ParseShellCommandBinding(line string) (KeyBinding, error) {
+	keys, value, err := splitBindingLine(line)
+	if err != nil {
+		return KeyBinding{}, err
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`) {
+		if value, err = unquoteBindingValue(value); err != nil {
+			return KeyBinding{}, err
+		}
+	}
+	return KeyBinding{Keys: keys, Kind: BindingShellCommand, Value: value}, nil
+}
+
+// splitBindingLine splits a binding into its keys and the text after the colon
+func splitBindingLine(line string) ([]string, string, error) {
+	line = strings.TrimSpace(line)
+	var keyText, value string
+	if strings.HasPrefix(line, `"`) {
+		end := closingQuote(line)
+		if end < 0 {
+			return nil, "", fmt.Errorf("missing closing quote: %s", line)
+		}
+		keyText = line[1:end]
+		rest := strings.TrimSpace(line[end+1:])
+		if !strings.HasPrefix(rest, ":") {
+			return nil, "", fmt.Errorf("missing colon after key sequence: %s", line)
+		}
+		value = strings.TrimSpace(rest[1:])
+
+		keys, err := ParseKeySequence(keyText)
+		if err != nil {
+			return nil, "", err
+		}
+		if value == "" {
+			return nil, "", fmt.Errorf("missing binding for %s", line)
+		}
+		return keys, value, nil
+	}
+
+	name, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil, "", fmt.Errorf("missing colon: %s", line)
+	}
+	k, err := parseKeyName(strings.TrimSpace(name))
+	if err != nil {
+		return nil, "", err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, "", fmt.Errorf("missing binding for %s", line)
+	}
+	return []string{k}, value, nil
+}
+
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteBindingValue(value string) (string, error) {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return value, nil
+	}
+	end := closingQuote(value)
+	if end < 0 {
+		return "", fmt.Errorf("missing closing quote: %s", value)
+	}
+	return unescapeReadline(value[1:end]), nil
+}
+
+// unescapeReadline interprets the backslash escapes of readline macros
+func unescapeReadline(text string) string {
+	var result strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			result.WriteByte(text[i])
+			continue
+		}
+		i++
+		switch text[i] {
+		case 'n':
+			result.WriteByte('\n')
+		case 't':
+			result.WriteByte('\t')
+		case 'e':
+			result.WriteByte('\x1b')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to three octal digits, such as \1 or \033
+			code := 0
+			for n := 0; n < 3 && i < len(text) && text[i] >= '0' && text[i] <= '7'; n++ {
+				code = code*8 + int(text[i]-'0')
+				i++
+			}
+			i--
+			result.WriteByte(byte(code))
+		default:
+			result.WriteByte(text[i])
+		}
+	}
+	return result.String()
+}
+
+// Escape sequences sent by terminals for special keys, in bubbletea notation
+var escapeSequenceKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"OA": "up", "OB": "down", "OC": "right", "OD": "left",
+	"[H": "home", "[F": "end", "OH": "home", "OF": "end",
+	"[1~": "home", "[4~": "end", "[2~": "insert", "[3~": "delete",
+	"[5~": "pgup", "[6~": "pgdown", "[Z": "shift+tab",
+	"[1;5A": "ctrl+up", "[1;5B": "ctrl+down", "[1;5C": "ctrl+right", "[1;5D": "ctrl+left",
+	"[1;3A": "alt+up", "[1;3B": "alt+down", "[1;3C": "alt+right", "[1;3D": "alt+left",
+	"[1;2A": "shift+up", "[1;2B": "shift+down", "[1;2C": "shift+right", "[1;2D": "shift+left",
+}
+
+// Control characters that bubbletea reports under their own names
+var controlKeyNames = map[string]string{
+	"ctrl+i": "tab", "ctrl+m": "enter", "ctrl+[": "esc", "ctrl+?": "backspace",
+}
+
+// Key names accepted in the unquoted form of inputrc bindings, such as Control-a or Rubout
+var inputrcKeyNames = map[string]string{
+	"rubout": "backspace", "del": "delete", "escape": "esc", "esc": "esc", "space": " ", "spc": " ",
+	"tab": "tab", "return": "enter", "ret": "enter", "newline": "ctrl+j", "lfd": "ctrl+j",
+}
+
+// ParseKeySequence converts a readline key sequence such as \C-x\C-e to keys in
+// bubbletea notation such as ["ctrl+x", "ctrl+e"]
+func ParseKeySequence(sequence string) ([]string, error) {
+	var keys []string
+	alt := false
+	emit := func(k string) {
+		if named, ok := controlKeyNames[k]; ok {
+			k = named
+		}
+		if alt {
+			k = "alt+" + k
+			alt = false
+		}
+		keys = append(keys, k)
+	}
+
+	for i := 0; i < len(sequence); {
+		c := sequence[i]
+		if c != '\\' || i+1 == len(sequence) {
+			if c == '\x1b' {
+				if k, n := parseEscapeSequence(sequence[i+1:]); n > 0 {
+					emit(k)
+					i += 1 + n
+					continue
+				}
+				alt = true
+				i++
+				continue
+			}
+			emit(string(c))
+			i++
+			continue
+		}
+
+		switch next := sequence[i+1]; next {
+		case 'C', 'M':
+			if i+2 >= len(sequence) || sequence[i+2] != '-' {
+				emit(string(next))
+				i += 2
+				continue
+			}
+			i += 3
+			if next == 'M' {
+				alt = true
+				continue
+			}
+			// \C-\M-x is the same as \M-\C-x
+			if strings.HasPrefix(sequence[i:], `\M-`) {
+				alt = true
+				i += 3
+			}
+			if i >= len(sequence) {
+				return nil, fmt.Errorf("incomplete control sequence in %q", sequence)
+			}
+			emit("ctrl+" + strings.ToLower(string(sequence[i])))
+			i++
+		case 'e':
+			if k, n := parseEscapeSequence(sequence[i+2:]); n > 0 {
+				emit(k)
+				i += 2 + n
+				continue
+			}
+			alt = true
+			i += 2
+		case 't':
+			emit("tab")
+			i += 2
+		case 'r', 'n':
+			emit("enter")
+			i += 2
+		case 'd':
+			emit("delete")
+			i += 2
+		default:
+			emit(string(next))
+			i += 2
+		}
+	}
+
+	if alt {
+		keys = append(keys, "esc")
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	return keys, nil
+}
+
+// parseEscapeSequence matches a special key after an escape character,
+// returning the key and the number of bytes it used
+func parseEscapeSequence(text string) (string, int) {
+	best, length := "", 0
+	for sequence, k := range escapeSequenceKeys {
+		if strings.HasPrefix(text, sequence) && len(sequence) > length {
+			best, length = k, len(sequence)
+		}
+	}
+	return best, length
+}
+
+func parseKeyName(name string) (string, error) {
+	lower := strings.ToLower(name)
+	prefix := ""
+	for {
+		switch {
+		case strings.HasPrefix(lower, "control-"):
+			prefix += "ctrl+"
+			lower = lower[len("control-"):]
+		case strings.HasPrefix(lower, "c-"):
+			prefix += "ctrl+"
+			lower = lower[len("c-"):]
+		case strings.HasPrefix(lower, "meta-"):
+			prefix = "alt+" + prefix
+			lower = lower[len("meta-"):]
+		case strings.HasPrefix(lower, "m-"):
+			prefix = "alt+" + prefix
+			lower = lower[len("m-"):]
+		default:
+			if named, ok := inputrcKeyNames[lower]; ok {
+				lower = named
+			} else if len(lower) != 1 {
+				return "", fmt.Errorf("unknown key name: %s", name)
+			}
+			k := prefix + lower
+			if base, ok := strings.CutPrefix(k, "alt+"); ok {
+				if named, ok := controlKeyNames[base]; ok {
+					k = "alt+" + named
+				}
+			} else if named, ok := controlKeyNames[k]; ok {
+				k = named
+			}
+			return k, nil
+		}
+	}
+}
+
+// FormatKeySequence converts keys in bubbletea notation back to a readline key sequence
+func FormatKeySequence(keys []string) string {
+	var result strings.Builder
+	for _, k := range keys {
+		result.WriteString(formatKey(k))
+	}
+	return result.String()
+}
+
+func formatKey(k string) string {
+	if rest, ok := strings.CutPrefix(k, "alt+"); ok && rest != "" {
+		return `\e` + formatKey(rest)
+	}
+	for sequence, named := range escapeSequenceKeys {
+		// Prefer the [ form, which is what most terminals send
+		if named == k && strings.HasPrefix(sequence, "[") && (len(sequence) == 2 || k == "delete" || k == "insert" || strings.HasPrefix(k, "pg") || strings.Contains(sequence, ";")) {
+			return `\e` + sequence
+		}
+	}
+	switch k {
+	case "tab":
+		return `\C-i`
+	case "enter":
+		return `\C-m`
+	case "backspace":
+		return `\C-?`
+	case "esc":
+		return `\e`
+	case `\`:
+		return `\\`
+	case `"`:
+		return `\"`
+	}
+	if rest, ok := strings.CutPrefix(k, "ctrl+"); ok {
+		return `\C-` + rest
+	}
+	return k
+}
+
+// FormatBinding renders a binding in inputrc format, as printed by bind -p
+func FormatBinding(binding KeyBinding) string {
+	keys := FormatKeySequence(binding.Keys)
+	switch binding.Kind {
+	case BindingMacro:
+		return fmt.Sprintf(`"%s": "%s"`, keys, escapeReadline(binding.Value))
+	case BindingShellCommand:
+		return fmt.Sprintf(`"%s": "%s"`, keys, escapeReadline(binding.Value))
+	case BindingAgentMacro:
+		return fmt.Sprintf(`"%s": agent-macro "%s"`, keys, escapeReadline(binding.Value))
+	default:
+		return fmt.Sprintf(`"%s": %s`, keys, binding.Value)
+	}
+}
+
+func escapeReadline(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\x1b", `\e`)
+	return replacer.Replace(text)
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
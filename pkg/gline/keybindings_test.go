@@ -0,0 +1,282 @@
+package gline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseKeySequence(t *testing.T) {
+	tests := []struct {
+		sequence string
+		expected []string
+	}{
+		{`\C-a`, []string{"ctrl+a"}},
+		{`\C-A`, []string{"ctrl+a"}},
+		{`\C-x\C-e`, []string{"ctrl+x", "ctrl+e"}},
+		{`\M-f`, []string{"alt+f"}},
+		{`\ef`, []string{"alt+f"}},
+		{`\M-\C-h`, []string{"alt+ctrl+h"}},
+		{`\e[A`, []string{"up"}},
+		{`\eOD`, []string{"left"}},
+		{`\e[3~`, []string{"delete"}},
+		{`\e[1;5C`, []string{"ctrl+right"}},
+		{`\e[`, []string{"alt+["}},
+		{`\e]`, []string{"alt+]"}},
+		{`\C-i`, []string{"tab"}},
+		{`\C-m`, []string{"enter"}},
+		{`\C-j`, []string{"ctrl+j"}},
+		{`\C-?`, []string{"backspace"}},
+		{`\C-_`, []string{"ctrl+_"}},
+		{`\e_`, []string{"alt+_"}},
+		{`\e\C-?`, []string{"alt+backspace"}},
+		{`\t`, []string{"tab"}},
+		{`ab`, []string{"a", "b"}},
+		{`\\`, []string{`\`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sequence, func(t *testing.T) {
+			keys, err := ParseKeySequence(test.sequence)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, keys)
+
+			// Formatting the keys gives a sequence that parses back to the same keys
+			reparsed, err := ParseKeySequence(FormatKeySequence(keys))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, reparsed)
+		})
+	}
+
+	_, err := ParseKeySequence(`\C-`)
+	assert.Error(t, err)
+}
+
+func TestParseInputrc(t *testing.T) {
+	bindings := NewKeyBindings()
+	errs := bindings.ParseInputrc(strings.NewReader(`
+# comments and blank lines are ignored
+
+set editing-mode emacs
+set bell-style none
+"\C-xa": beginning-of-line
+Control-t: forward-word
+Meta-Rubout: backward-kill-word
+"\C-xg": "git status"
+"\e[Z": unix-word-rubout
+$if mode=vi
+"\C-b": end-of-line
+$endif
+$if Bash
+"\C-b": end-of-line
+$else
+"\C-b": backward-word
+$endif
+$if gsh
+"\C-o": shell-command "fzf_widget"
+"\C-g": agent-macro "gitdiff"
+$endif
+"\C-q": history-search-backward
+`))
+
+	require.Len(t, errs, 1, "only the unsupported function is reported")
+	assert.Contains(t, errs[0].Error(), "history-search-backward")
+	assert.Equal(t, "none", bindings.Variable("bell-style"))
+
+	expect := func(keys []string, kind BindingKind, value string) {
+		t.Helper()
+		binding, result := bindings.lookup(keys)
+		require.Equal(t, lookupMatch, result, keys)
+		assert.Equal(t, kind, binding.Kind)
+		assert.Equal(t, value, binding.Value)
+	}
+	expect([]string{"ctrl+x", "a"}, BindingAction, shellinput.ActionBeginningOfLine)
+	expect([]string{"ctrl+t"}, BindingAction, shellinput.ActionForwardWord)
+	expect([]string{"alt+backspace"}, BindingAction, shellinput.ActionBackwardKillWord)
+	expect([]string{"ctrl+x", "g"}, BindingMacro, "git status")
+	expect([]string{"shift+tab"}, BindingAction, shellinput.ActionBackwardKillWord)
+	expect([]string{"ctrl+b"}, BindingAction, shellinput.ActionBackwardWord)
+	expect([]string{"ctrl+o"}, BindingShellCommand, "fzf_widget")
+	expect([]string{"ctrl+g"}, BindingAgentMacro, "gitdiff")
+
+	_, result := bindings.lookup([]string{"ctrl+x"})
+	assert.Equal(t, lookupPrefix, result)
+	_, result = bindings.lookup([]string{"ctrl+q"})
+	assert.Equal(t, lookupNone, result)
+}
+
+func TestLoadInputrcInclude(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "included")
+	require.NoError(t, os.WriteFile(included, []byte(`"\C-t": end-of-line`+"\n"), 0644))
+	main := filepath.Join(dir, "inputrc")
+	require.NoError(t, os.WriteFile(main, []byte("$include "+included+"\n"), 0644))
+
+	bindings := NewKeyBindings()
+	assert.Empty(t, bindings.LoadInputrc(main))
+	binding, result := bindings.lookup([]string{"ctrl+t"})
+	assert.Equal(t, lookupMatch, result)
+	assert.Equal(t, shellinput.ActionEndOfLine, binding.Value)
+
+	assert.NotEmpty(t, bindings.LoadInputrc(filepath.Join(dir, "missing")))
+}
+
+func TestKeyBindingsKeyMap(t *testing.T) {
+	// The default bindings reproduce the default key map, except for ctrl+d which gline handles
+	keyMap := NewKeyBindings().KeyMap()
+	for _, action := range shellinput.Actions() {
+		defaults := shellinput.DefaultKeyMap
+		expected := lo.Without(defaults.Binding(action).Keys(), "ctrl+d")
+		assert.ElementsMatch(t, expected, keyMap.Binding(action).Keys(), action)
+	}
+
+	bindings := NewKeyBindings()
+	bindings.UnbindAction(shellinput.ActionBeginningOfLine)
+	require.NoError(t, bindings.ParseBindingLine(`"\C-t": beginning-of-line`))
+	require.NoError(t, bindings.ParseBindingLine(`"\C-x\C-e": end-of-line`))
+	keyMap = bindings.KeyMap()
+
+	assert.Equal(t, []string{"ctrl+t"}, keyMap.Binding(shellinput.ActionBeginningOfLine).Keys())
+	assert.False(t, key.Matches(tea.KeyMsg{Type: tea.KeyCtrlA}, keyMap.LineStart))
+	// Sequences are handled by gline, not the line editor's key map
+	assert.Equal(t, []string{"end", "ctrl+e"}, shellinput.DefaultKeyMap.LineEnd.Keys())
+	assert.ElementsMatch(t, []string{"end", "ctrl+e"}, keyMap.LineEnd.Keys())
+
+	assert.Error(t, bindings.ParseBindingLine(`"\C-t": no-such-function`))
+	assert.Error(t, bindings.ParseBindingLine(`"\C-t" beginning-of-line`))
+}
+
+func TestFormatBinding(t *testing.T) {
+	assert.Equal(t, `"\C-a": beginning-of-line`, FormatBinding(KeyBinding{Keys: []string{"ctrl+a"}, Kind: BindingAction, Value: "beginning-of-line"}))
+	assert.Equal(t, `"\C-xg": "git \"status\""`, FormatBinding(KeyBinding{Keys: []string{"ctrl+x", "g"}, Kind: BindingMacro, Value: `git "status"`}))
+	assert.Equal(t, `"\e[A": previous-history`, FormatBinding(KeyBinding{Keys: []string{"up"}, Kind: BindingAction, Value: "previous-history"}))
+}
+
+func keyBindingTestModel(t *testing.T, lines ...string) appModel {
+	t.Helper()
+	bindings := NewKeyBindings()
+	for _, line := range lines {
+		require.NoError(t, bindings.ParseBindingLine(line))
+	}
+	options := NewOptions()
+	options.KeyBindings = bindings
+	return initialModel("test> ", []string{}, "", nil, nil, nil, zap.NewNop(), options)
+}
+
+func pressKeys(model appModel, msgs ...tea.KeyMsg) (appModel, tea.Cmd) {
+	var cmd tea.Cmd
+	for _, msg := range msgs {
+		var updated tea.Model
+		updated, cmd = model.Update(msg)
+		model = updated.(appModel)
+	}
+	return model, cmd
+}
+
+func TestKeyBindingSequences(t *testing.T) {
+	model := keyBindingTestModel(t, `"\C-xa": beginning-of-line`, `"\C-xg": "git status"`)
+	model.textInput.SetValue("echo")
+
+	ctrlX := tea.KeyMsg{Type: tea.KeyCtrlX}
+	model, _ = pressKeys(model, ctrlX)
+	assert.Equal(t, []string{"ctrl+x"}, model.pendingKeys)
+	assert.Equal(t, "echo", model.textInput.Value())
+
+	model, _ = pressKeys(model, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}})
+	assert.Empty(t, model.pendingKeys)
+	assert.Equal(t, 0, model.textInput.Position())
+	assert.Equal(t, "echo", model.textInput.Value())
+
+	model, _ = pressKeys(model, ctrlX, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'g'}})
+	assert.Equal(t, "git statusecho", model.textInput.Value())
+
+	// An unbound sequence starts over from the last key
+	model, _ = pressKeys(model, ctrlX, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'z'}})
+	assert.Empty(t, model.pendingKeys)
+	assert.Equal(t, "git statuszecho", model.textInput.Value())
+}
+
+func TestKeyBindingRebindGlineActions(t *testing.T) {
+	model := keyBindingTestModel(t, `"\C-j": accept-line`, `"\C-g": agent-macro "gitdiff"`)
+	model.textInput.SetValue("ls")
+
+	// ctrl+l is still bound to clear-screen
+	_, cmd := pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlL})
+	assert.NotNil(t, cmd)
+
+	accepted, cmd := pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlJ})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "ls", accepted.result)
+
+	macro, cmd := pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlG})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "@/gitdiff", macro.result)
+
+	model.keyBindings.UnbindAction(ActionEndOfFile)
+	model.textInput.SetValue("")
+	_, cmd = pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlD})
+	assert.Nil(t, cmd, "ctrl+d no longer exits once unbound")
+}
+
+func TestKeyBindingShellCommand(t *testing.T) {
+	model := keyBindingTestModel(t)
+	require.NoError(t, model.keyBindings.Bind(KeyBinding{Keys: []string{"ctrl+t"}, Kind: BindingShellCommand, Value: "widget"}))
+
+	var ranCommand, ranLine string
+	model.options.ShellCommandRunner = func(command string, line string, point int) (string, int, error) {
+		ranCommand, ranLine = command, line
+		return line + " --verbose", point, nil
+	}
+	model.textInput.SetValue("make")
+	model.textInput.SetCursor(2)
+
+	model, cmd := pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlT})
+	require.NotNil(t, cmd)
+	assert.Empty(t, ranCommand, "the command runs once bubbletea releases the terminal")
+
+	// Simulate bubbletea running the command
+	line, point, err := model.options.ShellCommandRunner("widget", model.textInput.Value(), model.textInput.Position())
+	require.NoError(t, err)
+	updated, _ := model.Update(shellCommandDoneMsg{line: line, point: point})
+	model = updated.(appModel)
+
+	assert.Equal(t, "widget", ranCommand)
+	assert.Equal(t, "make", ranLine)
+	assert.Equal(t, "make --verbose", model.textInput.Value())
+	assert.Equal(t, 2, model.textInput.Position())
+}
+
+func TestKeyBindingsViMode(t *testing.T) {
+	model := keyBindingTestModel(t, "set editing-mode vi", `set vi-cmd-mode-string "\1\e[2 q\2[N] "`)
+	assert.Equal(t, shellinput.EditingModeVi, model.textInput.EditingMode)
+	assert.Equal(t, "\x1b[2 q[N] ", model.textInput.ViCommandModeString)
+	assert.Equal(t, shellinput.DefaultViInsertModeString, model.textInput.ViInsertModeString)
+
+	model.textInput.SetValue("echo hello")
+	model, _ = pressKeys(model, tea.KeyMsg{Type: tea.KeyEscape})
+	assert.True(t, model.textInput.InViCommandMode())
+
+	// Keys are vi commands in normal mode, even when they are bound to an action
+	model.keyBindings.Bind(KeyBinding{Keys: []string{"d"}, Kind: BindingMacro, Value: "oops"})
+	model, _ = pressKeys(model, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'0'}},
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}}, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'w'}})
+	assert.Equal(t, "hello", model.textInput.Value())
+
+	// Enter still accepts the line
+	model, cmd := pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "hello", model.result)
+
+	model = keyBindingTestModel(t, "set editing-mode vi", "set show-mode-in-prompt off")
+	assert.Empty(t, model.textInput.ViInsertModeString)
+	assert.Empty(t, model.textInput.ViCommandModeString)
+}
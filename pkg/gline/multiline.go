@@ -112,7 +112,21 @@ func (m *MultilineState) AddLine(line string) (complete bool, prompt string) {
 	return true, ""
 }
 
+// IsCompleteCommand reports whether input is a complete command that can be run,
+// rather than one that continues on another line. Chat messages to the agent,
+// which start with @, are always complete.
+func IsCompleteCommand(input string) bool {
+	if strings.HasPrefix(strings.TrimSpace(input), "@") {
+		return true
+	}
+	complete, _ := NewMultilineState().AddLine(input)
+	return complete
+}
+
 // GetCompleteCommand returns the complete command and resets the state
+//
+// Deprecated: gline edits a multiline command in a single buffer, so
+// it no longer accumulates lines; use IsCompleteCommand on the buffer instead.
 func (m *MultilineState) GetCompleteCommand() string {
 	// Defer panic recovery to prevent shell crashes
 	defer func() {
@@ -141,16 +155,25 @@ func (m *MultilineState) Reset() {
 }
 
 // IsActive returns true if we're in the middle of a multiline input
+//
+// Deprecated: gline edits a multiline command in a single buffer, so
+// it no longer accumulates lines; use IsCompleteCommand on the buffer instead.
 func (m *MultilineState) IsActive() bool {
 	return m.isContinuation || m.buffer.Len() > 0
 }
 
 // GetAccumulatedLines returns the accumulated lines for display purposes
+//
+// Deprecated: gline edits a multiline command in a single buffer, so
+// it no longer accumulates lines; use IsCompleteCommand on the buffer instead.
 func (m *MultilineState) GetAccumulatedLines() string {
 	return m.buffer.String()
 }
 
 // GetLines returns the individual lines that have been entered
+//
+// Deprecated: gline edits a multiline command in a single buffer, so
+// it no longer accumulates lines; use IsCompleteCommand on the buffer instead.
 func (m *MultilineState) GetLines() []string {
 	content := m.buffer.String()
 	if content == "" {
@@ -304,6 +327,7 @@ func isIncompleteSyntaxError(err error) bool {
 		"unfinished",
 		"incomplete",
 		"EOF",
+		"must be followed by a statement list",
 	}
 
 	for _, pattern := range incompletePatterns {
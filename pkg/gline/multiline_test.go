@@ -674,3 +674,13 @@ func TestCommandSubstitutionEdgeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestIsCompleteCommand(t *testing.T) {
+	assert.True(t, IsCompleteCommand(""))
+	assert.True(t, IsCompleteCommand("echo hello"))
+	assert.True(t, IsCompleteCommand("if true; then\n  echo yes\nfi"))
+	assert.False(t, IsCompleteCommand("if true; then"))
+	assert.False(t, IsCompleteCommand("echo \"hello"))
+	assert.False(t, IsCompleteCommand("echo hello \\"))
+	assert.True(t, IsCompleteCommand("@what's in this directory?"), "chat messages are never continued")
+}
@@ -1,12 +1,48 @@
 package gline
 
-import "github.com/atinylittleshell/gsh/pkg/shellinput"
+import (
+	"context"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+)
 
 type Options struct {
 	MinHeight          int
 	CompletionProvider shellinput.CompletionProvider
+
+	// ConfirmHighRisk requires pressing enter twice to run commands rated high risk
+	ConfirmHighRisk bool
+
+	// Highlighter colours the input as it is typed, nil disables highlighting
+	Highlighter *shellinput.SyntaxHighlighter
+
+	// KeyBindings maps keys to actions, the default bindings are used when nil
+	KeyBindings *KeyBindings
+
+	// ShellCommandRunner runs shell commands bound to keys, see ShellCommandRunner
+	ShellCommandRunner ShellCommandRunner
+
+	// RightPrompt is shown at the right end of the first line of the input while
+	// there is room for it
+	RightPrompt string
+
+	// Styles are the styles of the prompt and the boxes below it, the default
+	// styles are used when nil
+	Styles *Styles
+
+	// Editor is the command that edit-and-execute-command opens the input in.
+	// When empty, $VISUAL or $EDITOR is used, and vi when neither is set.
+	Editor string
+
+	// Context stops reading the input when it's cancelled, and Gline returns
+	// its error. It's never cancelled when nil.
+	Context context.Context
 }
 
+// ShellCommandRunner runs a shell command bound to a key. It receives the current line
+// and cursor position, and returns them as changed by the command.
+type ShellCommandRunner func(command string, line string, point int) (string, int, error)
+
 func NewOptions() Options {
 	return Options{
 		MinHeight: 8,
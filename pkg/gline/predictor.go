@@ -4,6 +4,24 @@ type Predictor interface {
 	Predict(input string) (string, string, error)
 }
 
+// InstantPredictor is implemented by predictors that can return a cheap suggestion
+// right away, to be shown while the full prediction is still being computed.
+type InstantPredictor interface {
+	PredictInstant(input string) (string, string, error)
+}
+
+// PredictionCandidate is one of several ranked predictions, with where it came from
+type PredictionCandidate struct {
+	Command string
+	Source  string
+}
+
+// CandidatePredictor is implemented by predictors that can return a ranked list of
+// predictions, best first, which the user can cycle through.
+type CandidatePredictor interface {
+	PredictCandidates(input string) ([]PredictionCandidate, string, error)
+}
+
 type NoopPredictor struct{}
 
 func (p *NoopPredictor) Predict(input string) (string, string, error) {
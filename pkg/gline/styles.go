@@ -0,0 +1,40 @@
+package gline
+
+import "github.com/charmbracelet/lipgloss"
+
+// Styles are the styles gline draws the prompt and the boxes below it with
+type Styles struct {
+	// Prompt is applied to the prompt and the continuation prompt
+	Prompt lipgloss.Style
+	// Prediction is applied to the predicted rest of the input
+	Prediction lipgloss.Style
+	// Selection is applied to the text selected in vi's visual mode
+	Selection lipgloss.Style
+
+	// Explanation is the box of explanations and help
+	Explanation lipgloss.Style
+	// HighRiskExplanation is the box of explanations of commands rated high risk
+	HighRiskExplanation lipgloss.Style
+	// Completion is the box of completion candidates
+	Completion lipgloss.Style
+}
+
+// DefaultStyles returns the styles used when none are configured
+func DefaultStyles() Styles {
+	return Styles{
+		Prompt:     lipgloss.NewStyle(),
+		Prediction: lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		Selection:  lipgloss.NewStyle().Reverse(true),
+
+		Explanation:         BoxStyle(lipgloss.Color("12")),
+		HighRiskExplanation: BoxStyle(lipgloss.Color("9")),
+		Completion:          BoxStyle(lipgloss.Color("10")),
+	}
+}
+
+// BoxStyle returns the style of a box with a rounded border of the given colour
+func BoxStyle(border lipgloss.TerminalColor) lipgloss.Style {
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(border)
+}
@@ -0,0 +1,237 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// codeLanguage describes the lexical syntax of a language well enough to
+// highlight its keywords, strings, comments and numbers
+type codeLanguage struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComment  [2]string
+	quotes        string
+	caseSensitive bool
+}
+
+// Code block languages highlighted with the shell highlighter
+var shellLanguages = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "shell": true, "console": true, "shellsession": true, "gsh": true,
+}
+
+func words(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(list) {
+		set[word] = true
+	}
+	return set
+}
+
+var cLikeKeywords = "break case const continue default do else enum for goto if return static struct switch typedef union void while true false null"
+
+var codeLanguages = map[string]codeLanguage{
+	"go": {
+		keywords:     words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var true false nil iota"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", caseSensitive: true,
+	},
+	"python": {
+		keywords:     words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield True False None self"),
+		lineComments: []string{"#"}, quotes: "\"'", caseSensitive: true,
+	},
+	"javascript": {
+		keywords:     words("async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new of return static super switch this throw try typeof var void while yield true false null undefined interface type enum implements readonly"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", caseSensitive: true,
+	},
+	"rust": {
+		keywords:     words("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"", caseSensitive: true,
+	},
+	"c": {
+		keywords:     words(cLikeKeywords + " auto char double extern float inline int long register short signed sizeof unsigned volatile class namespace new delete private protected public template this throw try catch using virtual bool nullptr include define"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'", caseSensitive: true,
+	},
+	"java": {
+		keywords:     words(cLikeKeywords + " abstract boolean byte catch char class double extends final finally float implements import instanceof int interface long new package private protected public short super synchronized this throw throws try var"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'", caseSensitive: true,
+	},
+	"ruby": {
+		keywords:     words("alias and begin break case class def defined? do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield require"),
+		lineComments: []string{"#"}, quotes: "\"'", caseSensitive: true,
+	},
+	"sql": {
+		keywords:     words("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit offset as distinct union all null is in like between primary key foreign references default"),
+		lineComments: []string{"--"}, blockComment: [2]string{"/*", "*/"}, quotes: "'\"",
+	},
+	"lua": {
+		keywords:     words("and break do else elseif end false for function goto if in local nil not or repeat return then true until while"),
+		lineComments: []string{"--"}, quotes: "\"'", caseSensitive: true,
+	},
+	"json": {
+		keywords: words("true false null"), quotes: "\"", caseSensitive: true,
+	},
+	"yaml": {
+		keywords: words("true false null yes no on off"), lineComments: []string{"#"}, quotes: "\"'",
+	},
+	"toml": {
+		keywords: words("true false"), lineComments: []string{"#"}, quotes: "\"'", caseSensitive: true,
+	},
+	"dockerfile": {
+		keywords:     words("from run cmd label expose env add copy entrypoint volume user workdir arg onbuild stopsignal healthcheck shell as"),
+		lineComments: []string{"#"}, quotes: "\"'",
+	},
+	"makefile": {
+		keywords:     words("ifeq ifneq ifdef ifndef else endif include define endef export override"),
+		lineComments: []string{"#"}, quotes: "\"'", caseSensitive: true,
+	},
+}
+
+// Other names code blocks use for the languages above
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "python3": "python", "js": "javascript", "jsx": "javascript",
+	"ts": "javascript", "tsx": "javascript", "typescript": "javascript", "node": "javascript",
+	"rs": "rust", "h": "c", "cpp": "c", "c++": "c", "cc": "c", "hpp": "c", "cs": "java", "csharp": "java",
+	"kotlin": "java", "kt": "java", "rb": "ruby", "yml": "yaml", "docker": "dockerfile", "make": "makefile",
+	"jsonc": "json", "postgresql": "sql", "mysql": "sql", "sqlite": "sql",
+}
+
+type codeClass uint8
+
+const (
+	codeNone codeClass = iota
+	codeKeyword
+	codeString
+	codeComment
+	codeNumber
+)
+
+// highlightCode returns the code of a block with syntax highlighting, for the
+// languages it knows
+func (r *Renderer) highlightCode(block CodeBlock) string {
+	language := strings.ToLower(block.Language)
+	if shellLanguages[language] && r.ShellHighlighter != nil {
+		return r.ShellHighlighter.Render(block.Code)
+	}
+	if alias, ok := languageAliases[language]; ok {
+		language = alias
+	}
+	syntax, ok := codeLanguages[language]
+	if !ok {
+		return r.renderCodeClasses([]rune(block.Code), make([]codeClass, len([]rune(block.Code))))
+	}
+	code := []rune(block.Code)
+	return r.renderCodeClasses(code, syntax.classify(code))
+}
+
+// classify returns the class of each rune of code
+func (l codeLanguage) classify(code []rune) []codeClass {
+	classes := make([]codeClass, len(code))
+	mark := func(from, to int, class codeClass) int {
+		to = min(to, len(code))
+		for i := from; i < to; i++ {
+			classes[i] = class
+		}
+		return to
+	}
+	hasPrefix := func(i int, prefix string) bool {
+		return prefix != "" && strings.HasPrefix(string(code[i:min(len(code), i+len(prefix))]), prefix)
+	}
+
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case l.startsLineComment(code, i, hasPrefix):
+			end := i
+			for end < len(code) && code[end] != '\n' {
+				end++
+			}
+			i = mark(i, end, codeComment)
+		case hasPrefix(i, l.blockComment[0]):
+			end := i + len(l.blockComment[0])
+			for end < len(code) && !hasPrefix(end, l.blockComment[1]) {
+				end++
+			}
+			i = mark(i, end+len(l.blockComment[1]), codeComment)
+		case strings.ContainsRune(l.quotes, c):
+			end := i + 1
+			for end < len(code) && code[end] != c && (code[end] != '\n' || c == '`') {
+				if code[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			i = mark(i, end+1, codeString)
+		case unicode.IsDigit(c) && (i == 0 || !isIdentRune(code[i-1])):
+			end := i
+			for end < len(code) && (isIdentRune(code[end]) || code[end] == '.') {
+				end++
+			}
+			i = mark(i, end, codeNumber)
+		case isIdentRune(c):
+			end := i
+			for end < len(code) && (isIdentRune(code[end]) || code[end] == '?') {
+				end++
+			}
+			word := string(code[i:end])
+			if !l.caseSensitive {
+				word = strings.ToLower(word)
+			}
+			if l.keywords[word] || l.keywords[strings.TrimSuffix(word, "?")] {
+				mark(i, end, codeKeyword)
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return classes
+}
+
+func (l codeLanguage) startsLineComment(code []rune, i int, hasPrefix func(int, string) bool) bool {
+	for _, prefix := range l.lineComments {
+		if hasPrefix(i, prefix) {
+			// # only starts a comment at the start of a word, not inside one like a#b
+			return prefix != "#" || i == 0 || unicode.IsSpace(code[i-1])
+		}
+	}
+	return false
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// renderCodeClasses renders code grouping runs of the same class, line by line
+func (r *Renderer) renderCodeClasses(code []rune, classes []codeClass) string {
+	var result strings.Builder
+	for start := 0; start < len(code); {
+		if code[start] == '\n' {
+			result.WriteByte('\n')
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(code) && classes[end] == classes[start] && code[end] != '\n' {
+			end++
+		}
+		result.WriteString(r.codeStyle(classes[start]).Render(string(code[start:end])))
+		start = end
+	}
+	return result.String()
+}
+
+func (r *Renderer) codeStyle(class codeClass) lipgloss.Style {
+	switch class {
+	case codeKeyword:
+		return r.Styles.CodeKeyword.Inherit(r.Styles.CodeBlock)
+	case codeString:
+		return r.Styles.CodeString.Inherit(r.Styles.CodeBlock)
+	case codeComment:
+		return r.Styles.CodeComment.Inherit(r.Styles.CodeBlock)
+	case codeNumber:
+		return r.Styles.CodeNumber.Inherit(r.Styles.CodeBlock)
+	}
+	return r.Styles.CodeBlock
+}
@@ -0,0 +1,195 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// renderInline renders emphasis, code spans and links in text. Each run of
+// text is rendered with its whole style, built on base, since a style nested
+// in another one would end the outer style early.
+func (r *Renderer) renderInline(text string, base lipgloss.Style) string {
+	var out strings.Builder
+	r.renderSpans(&out, text, base)
+	return out.String()
+}
+
+func (r *Renderer) renderSpans(out *strings.Builder, text string, style lipgloss.Style) {
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			out.WriteString(style.Render(plain.String()))
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunctuation(text[i+1]):
+			plain.WriteByte(text[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			run := delimiterRun(text, i, '`')
+			if end := strings.Index(text[i+run:], text[i:i+run]); end >= 0 {
+				flush()
+				code := text[i+run : i+run+end]
+				if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				out.WriteString(r.Styles.InlineCode.Inherit(style).Render(code))
+				i += 2*run + end
+				continue
+			}
+			plain.WriteString(text[i : i+run])
+			i += run
+			continue
+
+		case c == '*' || c == '_' || c == '~':
+			run := delimiterRun(text, i, c)
+			if span, end, ok := emphasisSpan(text, i, c, run); ok {
+				flush()
+				inner := style
+				switch {
+				case c == '~':
+					inner = r.Styles.Strikethrough.Inherit(style)
+				case len(span.delimiter) >= 3:
+					inner = r.Styles.Emphasis.Inherit(r.Styles.Strong.Inherit(style))
+				case len(span.delimiter) == 2:
+					inner = r.Styles.Strong.Inherit(style)
+				default:
+					inner = r.Styles.Emphasis.Inherit(style)
+				}
+				r.renderSpans(out, span.text, inner)
+				i = end
+				continue
+			}
+			plain.WriteString(text[i : i+run])
+			i += run
+			continue
+
+		case c == '[' || (c == '!' && i+1 < len(text) && text[i+1] == '['):
+			start := i
+			if c == '!' {
+				start++
+			}
+			if label, url, end, ok := parseLink(text, start); ok {
+				flush()
+				r.renderSpans(out, label, r.Styles.Link.Inherit(style))
+				if url != "" && url != label {
+					out.WriteString(style.Render(" "))
+					out.WriteString(r.Styles.LinkURL.Render("(" + url + ")"))
+				}
+				i = end
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(text[i:], '>'); end > 0 {
+				target := text[i+1 : i+end]
+				if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+					flush()
+					out.WriteString(r.Styles.Link.Inherit(style).Render(target))
+					i += end + 1
+					continue
+				}
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		plain.WriteString(text[i : i+size])
+		i += size
+	}
+	flush()
+}
+
+type emphasis struct {
+	delimiter string
+	text      string
+}
+
+// emphasisSpan finds the emphasis opened by the run of delimiters at i,
+// returning its text and the position after its closing delimiters
+func emphasisSpan(text string, i int, c byte, run int) (emphasis, int, bool) {
+	if c == '~' && run != 2 {
+		return emphasis{}, 0, false
+	}
+	run = min(run, 3)
+	delimiter := strings.Repeat(string(c), run)
+	open := i + run
+	if open >= len(text) || text[open] == ' ' {
+		// Opening delimiters must be followed by text, so 2 * 3 isn't emphasis
+		return emphasis{}, 0, false
+	}
+	if c == '_' && i > 0 && isWordByte(text[i-1]) {
+		// Underscores inside words, as in snake_case, are not emphasis
+		return emphasis{}, 0, false
+	}
+
+	for j := open + 1; j <= len(text)-run; j++ {
+		if text[j:j+run] != delimiter || text[j-1] == ' ' || text[j-1] == '\\' {
+			continue
+		}
+		if j+run < len(text) && text[j+run] == c {
+			// Part of a longer run
+			continue
+		}
+		if c == '_' && j+run < len(text) && isWordByte(text[j+run]) {
+			continue
+		}
+		return emphasis{delimiter: delimiter, text: text[open:j]}, j + run, true
+	}
+	return emphasis{}, 0, false
+}
+
+// parseLink parses a [label](url) link at i
+func parseLink(text string, i int) (label string, url string, end int, ok bool) {
+	depth := 0
+	for j := i; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if j+1 >= len(text) || text[j+1] != '(' {
+				return "", "", 0, false
+			}
+			closing := strings.IndexByte(text[j+2:], ')')
+			if closing < 0 {
+				return "", "", 0, false
+			}
+			url = strings.TrimSpace(text[j+2 : j+2+closing])
+			if title := strings.Index(url, ` "`); title >= 0 {
+				url = url[:title]
+			}
+			return text[i+1 : j], strings.Trim(url, "<>"), j + 3 + closing, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func delimiterRun(text string, i int, c byte) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func isPunctuation(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= utf8.RuneSelf || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
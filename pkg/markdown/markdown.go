@@ -0,0 +1,610 @@
+// Package markdown renders markdown text, such as LLM responses, for display in a terminal
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/atinylittleshell/gsh/pkg/shellinput"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
+)
+
+// DefaultWidth is the width text is wrapped to when none is set
+const DefaultWidth = 80
+
+// Styles holds the style of each markdown element
+type Styles struct {
+	Text          lipgloss.Style
+	Heading       lipgloss.Style
+	Strong        lipgloss.Style
+	Emphasis      lipgloss.Style
+	Strikethrough lipgloss.Style
+	InlineCode    lipgloss.Style
+	Link          lipgloss.Style
+	LinkURL       lipgloss.Style
+	Quote         lipgloss.Style
+	ListMarker    lipgloss.Style
+	Rule          lipgloss.Style
+	TableBorder   lipgloss.Style
+
+	CodeBlock   lipgloss.Style
+	CodeLabel   lipgloss.Style
+	CodeKeyword lipgloss.Style
+	CodeString  lipgloss.Style
+	CodeComment lipgloss.Style
+	CodeNumber  lipgloss.Style
+}
+
+// DefaultStyles returns the styles used when none are configured
+func DefaultStyles() Styles {
+	return Styles{
+		Text:          lipgloss.NewStyle(),
+		Heading:       lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("13")),
+		Strong:        lipgloss.NewStyle().Bold(true),
+		Emphasis:      lipgloss.NewStyle().Italic(true),
+		Strikethrough: lipgloss.NewStyle().Strikethrough(true),
+		InlineCode:    lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		Link:          lipgloss.NewStyle().Underline(true).Foreground(lipgloss.Color("14")),
+		LinkURL:       lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		Quote:         lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		ListMarker:    lipgloss.NewStyle().Foreground(lipgloss.Color("6")),
+		Rule:          lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		TableBorder:   lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+
+		CodeBlock:   lipgloss.NewStyle(),
+		CodeLabel:   lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		CodeKeyword: lipgloss.NewStyle().Foreground(lipgloss.Color("13")),
+		CodeString:  lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		CodeComment: lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		CodeNumber:  lipgloss.NewStyle().Foreground(lipgloss.Color("14")),
+	}
+}
+
+// CodeBlock is a fenced or indented code block
+type CodeBlock struct {
+	Language string
+	Code     string
+}
+
+// Renderer renders markdown for a terminal
+type Renderer struct {
+	// Width is the width text is wrapped to. Code blocks are not wrapped, so
+	// that they can be copied as they are.
+	Width  int
+	Styles Styles
+
+	// ShellHighlighter highlights code blocks in shell languages
+	ShellHighlighter *shellinput.SyntaxHighlighter
+
+	// CodeBlockLabel returns the line shown above a code block, given its
+	// position among the code blocks of the text starting from 1. The
+	// language of the block is shown when nil.
+	CodeBlockLabel func(index int, block CodeBlock) string
+
+	codeBlocks int
+}
+
+// NewRenderer returns a renderer wrapping text to width
+func NewRenderer(width int) *Renderer {
+	return &Renderer{
+		Width:            width,
+		Styles:           DefaultStyles(),
+		ShellHighlighter: shellinput.NewSyntaxHighlighter(nil),
+	}
+}
+
+// Render returns source rendered for the terminal, without a trailing newline
+func (r *Renderer) Render(source string) string {
+	r.codeBlocks = 0
+	width := r.Width
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	return strings.Join(r.renderBlocks(parseBlocks(splitLines(source)), width, 0, true), "\n")
+}
+
+// CodeBlocks returns the code blocks of source, in order
+func CodeBlocks(source string) []CodeBlock {
+	var blocks []CodeBlock
+	var collect func([]block)
+	collect = func(parsed []block) {
+		for _, b := range parsed {
+			switch b.kind {
+			case blockCode:
+				blocks = append(blocks, b.code)
+			case blockQuote:
+				collect(b.children)
+			case blockList:
+				for _, item := range b.items {
+					collect(item.children)
+				}
+			}
+		}
+	}
+	collect(parseBlocks(splitLines(source)))
+	return blocks
+}
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockList
+	blockTable
+	blockRule
+)
+
+type block struct {
+	kind  blockKind
+	lines []string
+	level int // of a heading
+
+	code CodeBlock
+
+	children []block // of a quote
+
+	items   []listItem
+	ordered bool
+
+	header []string
+	align  []lipgloss.Position
+	rows   [][]string
+}
+
+type listItem struct {
+	marker   string
+	children []block
+	// Whether the item's blocks are separated by blank lines
+	loose bool
+}
+
+var (
+	headingPattern  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	fencePattern    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})\\s*([^`\\s]*)")
+	rulePattern     = regexp.MustCompile(`^ {0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	listItemPattern = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])(\s+|$)`)
+	tableSeparator  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+func splitLines(source string) []string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	return strings.Split(strings.ReplaceAll(source, "\t", "    "), "\n")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// parseBlocks splits lines into blocks
+func parseBlocks(lines []string) []block {
+	var blocks []block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fencePattern.MatchString(line):
+			var b block
+			b, i = parseFence(lines, i)
+			blocks = append(blocks, b)
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			blocks = append(blocks, block{kind: blockHeading, level: len(match[1]), lines: []string{match[2]}})
+			i++
+		case rulePattern.MatchString(line):
+			blocks = append(blocks, block{kind: blockRule})
+			i++
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i], " "), ">"); i++ {
+				text := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quoted = append(quoted, strings.TrimPrefix(text, " "))
+			}
+			blocks = append(blocks, block{kind: blockQuote, children: parseBlocks(quoted)})
+		case listItemPattern.MatchString(line):
+			var b block
+			b, i = parseList(lines, i)
+			blocks = append(blocks, b)
+		case isTableStart(lines, i):
+			var b block
+			b, i = parseTable(lines, i)
+			blocks = append(blocks, b)
+		case indentation(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (indentation(lines[i]) >= 4 || isBlank(lines[i])); i++ {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+			}
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			blocks = append(blocks, block{kind: blockCode, code: CodeBlock{Code: strings.Join(code, "\n")}})
+		default:
+			var paragraph []string
+			for ; i < len(lines) && !isBlank(lines[i]) && (len(paragraph) == 0 || !startsBlock(lines, i)); i++ {
+				paragraph = append(paragraph, lines[i])
+			}
+			blocks = append(blocks, block{kind: blockParagraph, lines: paragraph})
+		}
+	}
+	return blocks
+}
+
+// startsBlock reports whether lines[i] interrupts a paragraph
+func startsBlock(lines []string, i int) bool {
+	line := lines[i]
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) || strings.HasPrefix(strings.TrimLeft(line, " "), ">") ||
+		listItemPattern.MatchString(line) || isTableStart(lines, i)
+}
+
+func parseFence(lines []string, i int) (block, int) {
+	match := fencePattern.FindStringSubmatch(lines[i])
+	indent, fence, language := len(match[1]), match[2], match[3]
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		// Remove the indentation of the opening fence from the content
+		line = line[min(indent, indentation(line)):]
+		code = append(code, line)
+	}
+	return block{kind: blockCode, code: CodeBlock{Language: language, Code: strings.Join(code, "\n")}}, i
+}
+
+func parseList(lines []string, i int) (block, int) {
+	match := listItemPattern.FindStringSubmatch(lines[i])
+	baseIndent := len(match[1])
+	list := block{kind: blockList, ordered: isOrderedMarker(match[2])}
+
+	var content []string
+	var marker string
+	contentIndent := 0
+	finishItem := func() {
+		if marker != "" {
+			loose := false
+			for _, line := range content {
+				loose = loose || isBlank(line)
+			}
+			list.items = append(list.items, listItem{marker: marker, children: parseBlocks(content), loose: loose})
+		}
+	}
+
+	for i < len(lines) {
+		line := lines[i]
+		if match := listItemPattern.FindStringSubmatch(line); match != nil &&
+			len(match[1]) >= baseIndent && len(match[1]) < max(contentIndent, baseIndent+1) &&
+			isOrderedMarker(match[2]) == list.ordered {
+			// A new item of this list
+			finishItem()
+			marker = match[2]
+			contentIndent = len(match[0])
+			if len(match[3]) > 4 {
+				// The content is an indented code block, which keeps the extra spaces
+				contentIndent = len(match[1]) + len(match[2]) + 1
+			}
+			content = []string{line[min(len(line), contentIndent):]}
+			i++
+			continue
+		}
+		if isBlank(line) {
+			// The list goes on after blank lines only if the next line is part of it
+			next := i + 1
+			for next < len(lines) && isBlank(lines[next]) {
+				next++
+			}
+			if next == len(lines) || (indentation(lines[next]) < contentIndent && !isListContinuation(lines[next], baseIndent, list.ordered)) {
+				break
+			}
+			content = append(content, "")
+			i++
+			continue
+		}
+		if indentation(line) >= contentIndent {
+			content = append(content, line[contentIndent:])
+			i++
+			continue
+		}
+		if !isBlank(content[len(content)-1]) && !startsBlock(lines, i) {
+			// A lazy continuation of the item's paragraph
+			content = append(content, strings.TrimLeft(line, " "))
+			i++
+			continue
+		}
+		break
+	}
+	finishItem()
+	return list, i
+}
+
+func isListContinuation(line string, baseIndent int, ordered bool) bool {
+	match := listItemPattern.FindStringSubmatch(line)
+	return match != nil && len(match[1]) >= baseIndent && isOrderedMarker(match[2]) == ordered
+}
+
+func isOrderedMarker(marker string) bool {
+	return marker != "-" && marker != "*" && marker != "+"
+}
+
+func isTableStart(lines []string, i int) bool {
+	return i+1 < len(lines) && strings.Contains(lines[i], "|") &&
+		strings.Contains(lines[i+1], "-") && tableSeparator.MatchString(lines[i+1])
+}
+
+func parseTable(lines []string, i int) (block, int) {
+	table := block{kind: blockTable, header: splitTableRow(lines[i])}
+	for _, cell := range splitTableRow(lines[i+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			table.align = append(table.align, lipgloss.Center)
+		case strings.HasSuffix(cell, ":"):
+			table.align = append(table.align, lipgloss.Right)
+		default:
+			table.align = append(table.align, lipgloss.Left)
+		}
+	}
+	for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && !isBlank(lines[i]); i++ {
+		table.rows = append(table.rows, splitTableRow(lines[i]))
+	}
+	return table, i
+}
+
+// splitTableRow returns the cells of a table row, split at unescaped pipes
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '`':
+			inCode = !inCode
+			cell.WriteByte('`')
+		case line[i] == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// renderBlocks renders blocks to lines, with a blank line between loose blocks.
+// depth is how deeply the blocks are nested in lists.
+func (r *Renderer) renderBlocks(blocks []block, width int, depth int, loose bool) []string {
+	var lines []string
+	for i, b := range blocks {
+		if i > 0 && loose {
+			lines = append(lines, "")
+		}
+		lines = append(lines, r.renderBlock(b, width, depth)...)
+	}
+	return lines
+}
+
+func (r *Renderer) renderBlock(b block, width int, depth int) []string {
+	switch b.kind {
+	case blockHeading:
+		text := r.renderInline(b.lines[0], r.Styles.Heading.Inherit(r.Styles.Text))
+		if b.level > 1 {
+			text = r.Styles.Heading.Render(strings.Repeat("#", b.level)+" ") + text
+		}
+		return wrapText(text, width)
+	case blockCode:
+		return r.renderCode(b.code)
+	case blockQuote:
+		bar := r.Styles.Quote.Render("│ ")
+		quoted := r.renderBlocks(b.children, max(1, width-2), depth, true)
+		for i, line := range quoted {
+			quoted[i] = bar + line
+		}
+		return quoted
+	case blockList:
+		return r.renderList(b, width, depth)
+	case blockTable:
+		return r.renderTable(b, width)
+	case blockRule:
+		return []string{r.Styles.Rule.Render(strings.Repeat("─", width))}
+	}
+	return r.renderParagraph(b.lines, width)
+}
+
+func (r *Renderer) renderParagraph(lines []string, width int) []string {
+	// Lines ending with two spaces or a backslash are hard line breaks
+	var broken []string
+	var current []string
+	for _, line := range lines {
+		hardBreak := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, `\`)
+		current = append(current, strings.TrimSpace(strings.TrimSuffix(line, `\`)))
+		if hardBreak {
+			broken = append(broken, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		broken = append(broken, strings.Join(current, " "))
+	}
+
+	var rendered []string
+	for _, line := range broken {
+		rendered = append(rendered, wrapText(r.renderInline(line, r.Styles.Text), width)...)
+	}
+	return rendered
+}
+
+var bulletMarkers = []string{"•", "◦", "▪"}
+
+func (r *Renderer) renderList(list block, width int, depth int) []string {
+	var markers []string
+	markerWidth := 0
+	for i, item := range list.items {
+		marker := bulletMarkers[depth%len(bulletMarkers)]
+		if list.ordered {
+			number := strings.TrimRight(item.marker, ".)")
+			if i > 0 {
+				// Items are numbered from the first one, as in markdown
+				first, _ := strconv.Atoi(strings.TrimRight(list.items[0].marker, ".)"))
+				number = strconv.Itoa(first + i)
+			}
+			marker = number + "."
+		}
+		markers = append(markers, marker)
+		markerWidth = max(markerWidth, lipgloss.Width(marker))
+	}
+
+	var lines []string
+	for i, item := range list.items {
+		marker := markers[i]
+		if list.ordered {
+			marker = strings.Repeat(" ", markerWidth-lipgloss.Width(marker)) + marker
+		}
+		indent := strings.Repeat(" ", markerWidth+1)
+		content := r.renderBlocks(item.children, max(1, width-len(indent)), depth+1, item.loose)
+		if len(content) == 0 {
+			content = []string{""}
+		}
+		for j, line := range content {
+			prefix := indent
+			if j == 0 {
+				prefix = r.Styles.ListMarker.Render(marker) + " "
+			}
+			if line == "" {
+				prefix = ""
+			}
+			lines = append(lines, prefix+line)
+		}
+	}
+	return lines
+}
+
+func (r *Renderer) renderTable(table block, width int) []string {
+	columns := len(table.header)
+	render := func(cells []string) []string {
+		rendered := make([]string, columns)
+		for i := 0; i < columns && i < len(cells); i++ {
+			rendered[i] = r.renderInline(cells[i], r.Styles.Text)
+		}
+		return rendered
+	}
+
+	header := render(table.header)
+	for i, cell := range header {
+		header[i] = r.Styles.Strong.Render(cell)
+	}
+	rows := [][]string{header}
+	for _, row := range table.rows {
+		rows = append(rows, render(row))
+	}
+
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], lipgloss.Width(cell))
+		}
+	}
+	// Narrow the widest columns until the table fits, wrapping their cells
+	available := width - 3*(columns-1)
+	for total(widths) > available {
+		widest := 0
+		for i := range widths {
+			if widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= 8 {
+			break
+		}
+		widths[widest]--
+	}
+
+	border := r.Styles.TableBorder
+	separator := border.Render(" │ ")
+	var lines []string
+	for n, row := range rows {
+		cells := make([][]string, columns)
+		height := 1
+		for i, cell := range row {
+			cells[i] = wrapText(cell, widths[i])
+			height = max(height, len(cells[i]))
+		}
+		for l := 0; l < height; l++ {
+			parts := make([]string, columns)
+			for i := range cells {
+				text := ""
+				if l < len(cells[i]) {
+					text = cells[i][l]
+				}
+				align := lipgloss.Left
+				if i < len(table.align) {
+					align = table.align[i]
+				}
+				parts[i] = lipgloss.PlaceHorizontal(widths[i], align, text)
+			}
+			lines = append(lines, strings.TrimRight(strings.Join(parts, separator), " "))
+		}
+		if n == 0 {
+			rules := make([]string, columns)
+			for i, w := range widths {
+				rules[i] = strings.Repeat("─", w)
+			}
+			lines = append(lines, border.Render(strings.Join(rules, "─┼─")))
+		}
+	}
+	return lines
+}
+
+func total(widths []int) int {
+	sum := 0
+	for _, w := range widths {
+		sum += w
+	}
+	return sum
+}
+
+func (r *Renderer) renderCode(code CodeBlock) []string {
+	r.codeBlocks++
+	label := code.Language
+	if r.CodeBlockLabel != nil {
+		label = r.CodeBlockLabel(r.codeBlocks, code)
+	}
+
+	var lines []string
+	if label != "" {
+		lines = append(lines, r.Styles.CodeLabel.Render(label))
+	}
+	for _, line := range strings.Split(r.highlightCode(code), "\n") {
+		lines = append(lines, "  "+line)
+	}
+	return lines
+}
+
+// wrapText wraps styled text to width, breaking words longer than a line
+func wrapText(text string, width int) []string {
+	if lipgloss.Width(text) <= width {
+		return []string{text}
+	}
+	return strings.Split(wrap.String(wordwrap.String(text, width), width), "\n")
+}
@@ -0,0 +1,101 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"paragraph", "Some *emphasised* and **strong** text\nwith `code`.", "Some emphasised and strong text with code."},
+		{"hard break", "first line  \nsecond line", "first line\nsecond line"},
+		{"headings", "# Title\n\n## Section ##", "Title\n\n## Section"},
+		{"bullet list", "- one\n- two\n  - nested\n- three", "• one\n• two\n  ◦ nested\n• three"},
+		{"ordered list", "1. one\n2. two\n3. three", "1. one\n2. two\n3. three"},
+		{"ordered list renumbered", "3. one\n1. two", "3. one\n4. two"},
+		{"list continuation", "- one\n  continued\n- two", "• one continued\n• two"},
+		{"quote", "> quoted\n> text", "│ quoted text"},
+		{"rule", "above\n\n---\n\nbelow", "above\n\n" + strings.Repeat("─", 80) + "\n\nbelow"},
+		{"fenced code", "```go\nfunc main() {\n\tprintln(\"hi\")\n}\n```", "go\n  func main() {\n      println(\"hi\")\n  }"},
+		{"tilde fence", "~~~\nls -la\n~~~", "  ls -la"},
+		{"indented code", "text\n\n    make build", "text\n\n  make build"},
+		{"unclosed fence", "```\nls", "  ls"},
+		{"links", "See [the docs](https://example.com) or <https://example.org>.", "See the docs (https://example.com) or https://example.org."},
+		{"escapes", `Not \*emphasis\* and 2 * 3 * 4 and snake_case_name`, "Not *emphasis* and 2 * 3 * 4 and snake_case_name"},
+		{"strikethrough", "~~gone~~ here", "gone here"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, NewRenderer(80).Render(test.source))
+		})
+	}
+}
+
+func TestRenderWrapsToWidth(t *testing.T) {
+	rendered := NewRenderer(20).Render("The quick brown fox jumps over the lazy dog.\n\n- a list item that is too long to fit")
+	assert.Equal(t, "The quick brown fox\njumps over the lazy\ndog.\n\n• a list item that\n  is too long to fit", rendered)
+
+	// Code isn't wrapped, so that it can be copied as it is
+	rendered = NewRenderer(10).Render("```\necho a long command line\n```")
+	assert.Equal(t, "  echo a long command line", rendered)
+}
+
+func TestRenderTable(t *testing.T) {
+	source := "| Name | Size |\n|:-----|-----:|\n| a.txt | 10 |\n| long-name.txt | 2048 |"
+	expected := strings.Join([]string{
+		"Name          │ Size",
+		"──────────────┼─────",
+		"a.txt         │   10",
+		"long-name.txt │ 2048",
+	}, "\n")
+	assert.Equal(t, expected, NewRenderer(80).Render(source))
+
+	// Columns are narrowed and wrapped to fit the width
+	source = "| Command | Description |\n|---|---|\n| ls | lists the files in a directory |"
+	rendered := NewRenderer(30).Render(source)
+	for _, line := range strings.Split(rendered, "\n") {
+		assert.LessOrEqual(t, len([]rune(line)), 30, line)
+	}
+	assert.Contains(t, rendered, "lists the files")
+}
+
+func TestCodeBlocks(t *testing.T) {
+	source := "Run this:\n\n```bash\nmake build\n```\n\n1. Then\n\n   ```\n   make test\n   ```\n\n> ```go\n> fmt.Println()\n> ```"
+	assert.Equal(t, []CodeBlock{
+		{Language: "bash", Code: "make build"},
+		{Code: "make test"},
+		{Language: "go", Code: "fmt.Println()"},
+	}, CodeBlocks(source))
+
+	r := NewRenderer(40)
+	r.CodeBlockLabel = func(index int, block CodeBlock) string {
+		return fmt.Sprintf("[%d] %s", index, block.Language)
+	}
+	rendered := r.Render(source)
+	assert.Contains(t, rendered, "[1] bash\n  make build")
+	assert.Contains(t, rendered, "[2] \n")
+	assert.Contains(t, rendered, "[3] go")
+}
+
+func TestClassifyCode(t *testing.T) {
+	classesOf := func(language, code string) string {
+		var out strings.Builder
+		for _, class := range codeLanguages[language].classify([]rune(code)) {
+			out.WriteString(string(" ksc0"[class]))
+		}
+		return out.String()
+	}
+
+	assert.Equal(t, "kkkk         ssssss cccccc", classesOf("go", `func main(n) "a\"b" // end`))
+	assert.Equal(t, "kkk   00   ccccccccc", classesOf("python", `def f(12): # comment`))
+	assert.Equal(t, "kkkkkk   kkkk   ccccccc", classesOf("sql", "SELECT * FROM t /* c */"))
+	assert.Equal(t, "    c", classesOf("python", "a#b #"), "# inside a word doesn't start a comment")
+}
@@ -0,0 +1,136 @@
+package shellinput
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Names of the editing actions keys can be bound to. They follow readline's
+// function names where readline has an equivalent.
+const (
+	ActionForwardChar          = "forward-char"
+	ActionBackwardChar         = "backward-char"
+	ActionForwardWord          = "forward-word"
+	ActionBackwardWord         = "backward-word"
+	ActionBackwardKillWord     = "backward-kill-word"
+	ActionKillWord             = "kill-word"
+	ActionKillLine             = "kill-line"
+	ActionUnixLineDiscard      = "unix-line-discard"
+	ActionBackwardDeleteChar   = "backward-delete-char"
+	ActionDeleteChar           = "delete-char"
+	ActionBeginningOfLine      = "beginning-of-line"
+	ActionEndOfLine            = "end-of-line"
+	ActionPasteFromClipboard   = "paste-from-clipboard"
+	ActionNextHistory          = "next-history"
+	ActionPreviousHistory      = "previous-history"
+	ActionComplete             = "complete"
+	ActionMenuCompleteBackward = "menu-complete-backward"
+	ActionNextSuggestion       = "next-suggestion"
+	ActionPreviousSuggestion   = "previous-suggestion"
+	ActionClearScreen          = "clear-screen"
+	ActionUndo                 = "undo"
+	ActionRedo                 = "redo"
+	ActionYank                 = "yank"
+	ActionYankPop              = "yank-pop"
+	ActionInsertNewline        = "insert-newline"
+)
+
+// actionAliases maps other readline names to the action implementing them
+var actionAliases = map[string]string{
+	"unix-word-rubout": ActionBackwardKillWord,
+}
+
+// keyMapActions lists the actions of a KeyMap in the order keys are matched
+func (k *KeyMap) keyMapActions() []struct {
+	name    string
+	binding *key.Binding
+} {
+	return []struct {
+		name    string
+		binding *key.Binding
+	}{
+		{ActionComplete, &k.Complete},
+		{ActionMenuCompleteBackward, &k.PrevSuggestion},
+		{ActionNextSuggestion, &k.CycleSuggestionForward},
+		{ActionPreviousSuggestion, &k.CycleSuggestionBackward},
+		{ActionBackwardKillWord, &k.DeleteWordBackward},
+		{ActionBackwardDeleteChar, &k.DeleteCharacterBackward},
+		{ActionBackwardWord, &k.WordBackward},
+		{ActionBackwardChar, &k.CharacterBackward},
+		{ActionForwardWord, &k.WordForward},
+		{ActionForwardChar, &k.CharacterForward},
+		{ActionBeginningOfLine, &k.LineStart},
+		{ActionDeleteChar, &k.DeleteCharacterForward},
+		{ActionEndOfLine, &k.LineEnd},
+		{ActionKillLine, &k.DeleteAfterCursor},
+		{ActionUnixLineDiscard, &k.DeleteBeforeCursor},
+		{ActionPasteFromClipboard, &k.Paste},
+		{ActionKillWord, &k.DeleteWordForward},
+		{ActionNextHistory, &k.NextValue},
+		{ActionPreviousHistory, &k.PrevValue},
+		{ActionClearScreen, &k.ClearScreen},
+		{ActionUndo, &k.Undo},
+		{ActionRedo, &k.Redo},
+		{ActionYank, &k.Yank},
+		{ActionYankPop, &k.YankPop},
+		{ActionInsertNewline, &k.InsertNewline},
+	}
+}
+
+// Actions returns the names of all editing actions
+func Actions() []string {
+	var k KeyMap
+	var names []string
+	for _, action := range k.keyMapActions() {
+		names = append(names, action.name)
+	}
+	return names
+}
+
+// IsAction reports whether name is an editing action, or an alias of one
+func IsAction(name string) bool {
+	return CanonicalAction(name) != ""
+}
+
+// CanonicalAction returns the action name refers to, or "" if it refers to none
+func CanonicalAction(name string) string {
+	if alias, ok := actionAliases[name]; ok {
+		return alias
+	}
+	for _, action := range Actions() {
+		if action == name {
+			return name
+		}
+	}
+	return ""
+}
+
+// Binding returns the key binding of an action, or nil for unknown actions
+func (k *KeyMap) Binding(action string) *key.Binding {
+	action = CanonicalAction(action)
+	for _, a := range k.keyMapActions() {
+		if a.name == action {
+			return a.binding
+		}
+	}
+	return nil
+}
+
+// ActionFor returns the action bound to a key, or "" if the key is not bound
+func (k KeyMap) ActionFor(msg tea.KeyMsg) string {
+	for _, action := range k.keyMapActions() {
+		if key.Matches(msg, *action.binding) {
+			return action.name
+		}
+	}
+	return ""
+}
+
+// EmptyKeyMap returns a KeyMap where no key is bound to any action
+func EmptyKeyMap() KeyMap {
+	var k KeyMap
+	for _, action := range k.keyMapActions() {
+		*action.binding = key.NewBinding(key.WithDisabled())
+	}
+	return k
+}
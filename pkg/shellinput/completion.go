@@ -1,20 +1,108 @@
 package shellinput
 
+// CompletionKind describes what a completion candidate is
+type CompletionKind int
+
+const (
+	CompletionOther CompletionKind = iota
+	CompletionFile
+	CompletionDirectory
+	CompletionCommand
+	CompletionFlag
+	CompletionVariable
+	CompletionSubagent
+	CompletionMacro
+)
+
+// Icons shown next to candidates of each kind in the completion box
+var completionKindIcons = map[CompletionKind]string{
+	CompletionFile:      "◦",
+	CompletionDirectory: "▸",
+	CompletionCommand:   "λ",
+	CompletionFlag:      "-",
+	CompletionVariable:  "$",
+	CompletionSubagent:  "@",
+	CompletionMacro:     "/",
+}
+
+// Icon shown next to candidates suggested by a language model
+const aiCompletionIcon = "✦"
+
+// CompletionCandidate is a completion suggestion
+type CompletionCandidate struct {
+	// Value is the text the word being completed is replaced with
+	Value string
+	// Display is shown in the completion box instead of Value, if set
+	Display string
+	// Description is shown next to the candidate in the completion box
+	Description string
+	Kind        CompletionKind
+	// Score ranks the candidate, higher first
+	Score float64
+	// AI is set on candidates suggested by a language model, which are marked
+	// as such in the completion box
+	AI bool
+}
+
+// DisplayText returns the text the candidate is shown as
+func (c CompletionCandidate) DisplayText() string {
+	if c.Display != "" {
+		return c.Display
+	}
+	return c.Value
+}
+
+// NewCompletionCandidates creates candidates of no particular kind from values
+func NewCompletionCandidates(values []string) []CompletionCandidate {
+	candidates := make([]CompletionCandidate, len(values))
+	for i, value := range values {
+		candidates[i] = CompletionCandidate{Value: value}
+	}
+	return candidates
+}
+
+// CompletionValues returns the values of candidates
+func CompletionValues(candidates []CompletionCandidate) []string {
+	values := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		values[i] = candidate.Value
+	}
+	return values
+}
+
 // CompletionProvider is the interface that provides completion suggestions
 type CompletionProvider interface {
-	// GetCompletions returns a list of completion suggestions for the current input
-	// line and cursor position
-	GetCompletions(line string, pos int) []string
+	// GetCompletions returns the completion candidates for the current input
+	// line and cursor position, best first
+	GetCompletions(line string, pos int) []CompletionCandidate
 
 	// GetHelpInfo returns help information for special commands like #! and #/
 	// Returns empty string if no help is available
 	GetHelpInfo(line string, pos int) string
 }
 
+// AsyncCompletionProvider is a CompletionProvider with candidates that take
+// a while to produce, like those suggested by a language model. They are
+// added below the other candidates when they arrive.
+type AsyncCompletionProvider interface {
+	CompletionProvider
+
+	// GetAsyncCompletions returns the slow candidates for the input line and
+	// cursor position. It's called outside of the update loop.
+	GetAsyncCompletions(line string, pos int) []CompletionCandidate
+}
+
+// asyncCompletionMsg carries the candidates of an AsyncCompletionProvider
+type asyncCompletionMsg struct {
+	id         int
+	line       string // the input when completion started
+	candidates []CompletionCandidate
+}
+
 // completionState tracks the state of completion suggestions
 type completionState struct {
 	active       bool
-	suggestions  []string
+	suggestions  []CompletionCandidate
 	selected     int
 	prefix       string // the part of the word being completed
 	startPos     int    // where in the input the completion should be inserted
@@ -43,7 +131,7 @@ func (cs *completionState) nextSuggestion() string {
 		return ""
 	}
 	cs.selected = (cs.selected + 1) % len(cs.suggestions)
-	return cs.suggestions[cs.selected]
+	return cs.suggestions[cs.selected].Value
 }
 
 func (cs *completionState) prevSuggestion() string {
@@ -54,14 +142,14 @@ func (cs *completionState) prevSuggestion() string {
 	if cs.selected < 0 {
 		cs.selected = len(cs.suggestions) - 1
 	}
-	return cs.suggestions[cs.selected]
+	return cs.suggestions[cs.selected].Value
 }
 
 func (cs *completionState) currentSuggestion() string {
 	if !cs.active || cs.selected < 0 || cs.selected >= len(cs.suggestions) {
 		return ""
 	}
-	return cs.suggestions[cs.selected]
+	return cs.suggestions[cs.selected].Value
 }
 
 // hasMultipleCompletions returns true if there are multiple completion options
@@ -69,9 +157,24 @@ func (cs *completionState) hasMultipleCompletions() bool {
 	return len(cs.suggestions) > 1
 }
 
-// shouldShowInfoBox returns true if the info box should be displayed
+// shouldShowInfoBox returns true if the info box should be displayed. A single
+// candidate is shown when it arrived late and hasn't been inserted yet.
 func (cs *completionState) shouldShowInfoBox() bool {
-	return cs.active && cs.showInfoBox && cs.hasMultipleCompletions()
+	return cs.active && cs.showInfoBox && (cs.hasMultipleCompletions() || cs.selected < 0)
+}
+
+// addSuggestions appends the candidates that aren't suggested already
+func (cs *completionState) addSuggestions(candidates []CompletionCandidate) {
+	seen := make(map[string]bool, len(cs.suggestions))
+	for _, suggestion := range cs.suggestions {
+		seen[suggestion.Value] = true
+	}
+	for _, candidate := range candidates {
+		if !seen[candidate.Value] {
+			seen[candidate.Value] = true
+			cs.suggestions = append(cs.suggestions, candidate)
+		}
+	}
 }
 
 // shouldShowHelpBox returns true if the help box should be displayed
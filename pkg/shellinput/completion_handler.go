@@ -3,6 +3,8 @@ package shellinput
 import (
 	"strings"
 	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 // getWordBoundary returns the start and end position of the word at the cursor
@@ -30,20 +32,23 @@ func (m *Model) getWordBoundary() (start, end int) {
 	return start, end
 }
 
-// handleCompletion handles the TAB key press for completion
-func (m *Model) handleCompletion() {
+// handleCompletion handles the TAB key press for completion. It returns a
+// command producing the slow candidates of the completion it starts, if any.
+func (m *Model) handleCompletion() tea.Cmd {
 	if m.CompletionProvider == nil {
-		return
+		return nil
 	}
 
+	var cmd tea.Cmd
 	if !m.completion.active {
 		// Start a new completion
 		start, end := m.getWordBoundary()
 		suggestions := m.CompletionProvider.GetCompletions(m.Value(), m.Position())
 		if len(suggestions) == 0 {
 			m.resetCompletion() // Ensure completion state is reset
-			return
+			return m.requestAsyncCompletions()
 		}
+		cmd = m.requestAsyncCompletions()
 
 		// Check for context-sensitive completions (#/ and #! prefixes)
 		value := m.Value()
@@ -58,7 +63,7 @@ func (m *Model) handleCompletion() {
 		// If suggestions contain spaces, it might be a full phrase completion
 		isMultiWord := false
 		for _, suggestion := range suggestions {
-			if strings.Contains(suggestion, " ") {
+			if strings.Contains(suggestion.Value, " ") {
 				isMultiWord = true
 				break
 			}
@@ -84,7 +89,7 @@ func (m *Model) handleCompletion() {
 					prevWordStart--
 				}
 				// If the suggestion starts with the same prefix as the current command, use the full command
-				if len(suggestions) > 0 && strings.HasPrefix(suggestions[0], line[prevWordStart:commandStart]) {
+				if len(suggestions) > 0 && strings.HasPrefix(suggestions[0].Value, line[prevWordStart:commandStart]) {
 					start = prevWordStart
 				}
 			}
@@ -106,7 +111,7 @@ func (m *Model) handleCompletion() {
 	// Get next suggestion (this works for both initial and subsequent TAB presses)
 	suggestion := m.completion.nextSuggestion()
 	if suggestion == "" {
-		return
+		return cmd
 	}
 
 	// For subsequent completions, we need to recalculate the boundaries
@@ -126,7 +131,7 @@ func (m *Model) handleCompletion() {
 		// Check if this is a multi-word completion by examining the suggestions
 		isMultiWord := false
 		for _, suggestion := range m.completion.suggestions {
-			if strings.Contains(suggestion, " ") {
+			if strings.Contains(suggestion.Value, " ") {
 				isMultiWord = true
 				break
 			}
@@ -152,7 +157,7 @@ func (m *Model) handleCompletion() {
 					prevWordStart--
 				}
 				// If the suggestion starts with the same prefix as the current command, use the full command
-				if len(m.completion.suggestions) > 0 && strings.HasPrefix(m.completion.suggestions[m.completion.selected], line[prevWordStart:commandStart]) {
+				if len(m.completion.suggestions) > 0 && strings.HasPrefix(m.completion.suggestions[m.completion.selected].Value, line[prevWordStart:commandStart]) {
 					start = prevWordStart
 				}
 			}
@@ -168,6 +173,43 @@ func (m *Model) handleCompletion() {
 
 	// Update help info for the selected completion
 	m.updateHelpInfo()
+	return cmd
+}
+
+// requestAsyncCompletions returns a command producing the slow candidates of
+// the input, if the completion provider has any
+func (m *Model) requestAsyncCompletions() tea.Cmd {
+	provider, ok := m.CompletionProvider.(AsyncCompletionProvider)
+	if !ok {
+		return nil
+	}
+	id, line, pos := m.asyncCompletionID, m.Value(), m.Position()
+	return func() tea.Msg {
+		return asyncCompletionMsg{id: id, line: line, candidates: provider.GetAsyncCompletions(line, pos)}
+	}
+}
+
+// addAsyncCompletions adds slow candidates below the others, if the completion
+// they were produced for is still going on
+func (m *Model) addAsyncCompletions(msg asyncCompletionMsg) {
+	if msg.id != m.asyncCompletionID || len(msg.candidates) == 0 {
+		return
+	}
+
+	if !m.completion.active {
+		// Nothing else was found, and the input hasn't changed since
+		if m.Value() != msg.line {
+			return
+		}
+		m.completion.active = true
+		m.completion.selected = -1
+		m.completion.startPos, m.completion.endPos = m.getWordBoundary()
+		m.completion.prefix = m.Value()[m.completion.startPos:m.Position()]
+	}
+	if !m.completion.showInfoBox {
+		m.completion.activateInfoBox(msg.line)
+	}
+	m.completion.addSuggestions(msg.candidates)
 }
 
 // handleBackwardCompletion handles the Shift+TAB key press for completion
@@ -218,6 +260,7 @@ func (m *Model) applySuggestion(suggestion string) {
 // resetCompletion resets the completion state
 func (m *Model) resetCompletion() {
 	m.completion.reset()
+	m.asyncCompletionID++
 }
 
 // updateHelpInfo updates the help information based on current input
@@ -230,10 +273,15 @@ func (m *Model) updateHelpInfo() {
 
 	// If completion is active and a suggestion is selected, show help for the selected suggestion
 	if m.completion.active && m.completion.selected >= 0 && m.completion.selected < len(m.completion.suggestions) {
-		selectedSuggestion := m.completion.suggestions[m.completion.selected]
+		selectedSuggestion := m.completion.suggestions[m.completion.selected].Value
 		// For help purposes, we want to get help for the selected suggestion
 		// We'll use the length of the suggestion as the position to ensure we get the full command
 		helpInfo = m.CompletionProvider.GetHelpInfo(selectedSuggestion, len(selectedSuggestion))
+		if helpInfo == "" {
+			// Subcommands and options are described in the context of the
+			// line they're completed into
+			helpInfo = m.CompletionProvider.GetHelpInfo(m.Value(), m.Position())
+		}
 	} else {
 		// Normal case: use current input
 		helpInfo = m.CompletionProvider.GetHelpInfo(m.Value(), m.Position())
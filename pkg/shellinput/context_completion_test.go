@@ -13,7 +13,11 @@ type mockContextCompletionProvider struct{}
 // mockShortLongCompletionProvider tests completions of different lengths
 type mockShortLongCompletionProvider struct{}
 
-func (m *mockShortLongCompletionProvider) GetCompletions(line string, pos int) []string {
+func (m *mockShortLongCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return NewCompletionCandidates(m.completionValues(line, pos))
+}
+
+func (m *mockShortLongCompletionProvider) completionValues(line string, pos int) []string {
 	if line == "@!" {
 		return []string{"@!short", "@!longer_completion"}
 	}
@@ -24,7 +28,11 @@ func (m *mockShortLongCompletionProvider) GetHelpInfo(line string, pos int) stri
 	return ""
 }
 
-func (m *mockContextCompletionProvider) GetCompletions(line string, pos int) []string {
+func (m *mockContextCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return NewCompletionCandidates(m.completionValues(line, pos))
+}
+
+func (m *mockContextCompletionProvider) completionValues(line string, pos int) []string {
 	// Handle exact matches first
 	switch line {
 	case "@/":
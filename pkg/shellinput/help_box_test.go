@@ -11,7 +11,11 @@ import (
 // mockHelpCompletionProvider implements CompletionProvider for testing help box functionality
 type mockHelpCompletionProvider struct{}
 
-func (m *mockHelpCompletionProvider) GetCompletions(line string, pos int) []string {
+func (m *mockHelpCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return NewCompletionCandidates(m.completionValues(line, pos))
+}
+
+func (m *mockHelpCompletionProvider) completionValues(line string, pos int) []string {
 	switch line {
 	case "@!":
 		return []string{"@!new", "@!tokens"}
@@ -0,0 +1,582 @@
+package shellinput
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// CommandKind describes what a command name resolves to
+type CommandKind int
+
+const (
+	CommandUnknown CommandKind = iota
+	CommandBuiltin
+	CommandFunction
+	CommandAlias
+	CommandExecutable
+	CommandMissing
+)
+
+// CommandResolver tells the highlighter what a command name refers to
+type CommandResolver interface {
+	ResolveCommand(name string) CommandKind
+}
+
+// HighlightStyles holds the style of each kind of token in highlighted input
+type HighlightStyles struct {
+	Builtin    lipgloss.Style
+	Function   lipgloss.Style
+	Alias      lipgloss.Style
+	Executable lipgloss.Style
+	Missing    lipgloss.Style
+	Keyword    lipgloss.Style
+	String     lipgloss.Style
+	Variable   lipgloss.Style
+	Redirect   lipgloss.Style
+	Operator   lipgloss.Style
+	Comment    lipgloss.Style
+	Unbalanced lipgloss.Style
+}
+
+// DefaultHighlightStyles returns the styles used when none are configured
+func DefaultHighlightStyles() HighlightStyles {
+	return HighlightStyles{
+		Builtin:    lipgloss.NewStyle().Foreground(lipgloss.Color("6")),
+		Function:   lipgloss.NewStyle().Foreground(lipgloss.Color("4")),
+		Alias:      lipgloss.NewStyle().Foreground(lipgloss.Color("5")),
+		Executable: lipgloss.NewStyle().Foreground(lipgloss.Color("2")),
+		Missing:    lipgloss.NewStyle().Foreground(lipgloss.Color("9")),
+		Keyword:    lipgloss.NewStyle().Foreground(lipgloss.Color("13")),
+		String:     lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		Variable:   lipgloss.NewStyle().Foreground(lipgloss.Color("14")),
+		Redirect:   lipgloss.NewStyle().Foreground(lipgloss.Color("11")),
+		Operator:   lipgloss.NewStyle().Foreground(lipgloss.Color("12")),
+		Comment:    lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		Unbalanced: lipgloss.NewStyle().Foreground(lipgloss.Color("15")).Background(lipgloss.Color("9")),
+	}
+}
+
+// highlightClass is the kind of token a character of the input belongs to
+type highlightClass uint8
+
+const (
+	classNone highlightClass = iota
+	classBuiltin
+	classFunction
+	classAlias
+	classExecutable
+	classMissing
+	classKeyword
+	classString
+	classVariable
+	classRedirect
+	classOperator
+	classComment
+	classUnbalanced
+)
+
+// Reserved words that start a new command, so the next word is a command name
+var commandKeywords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "while": true, "until": true,
+	"do": true, "!": true, "{": true, "time": true, "coproc": true,
+}
+
+// Reserved words after which the next word is an argument
+var otherKeywords = map[string]bool{
+	"fi": true, "done": true, "}": true, "esac": true, "for": true, "select": true,
+	"case": true, "in": true, "function": true,
+}
+
+// SyntaxHighlighter colours shell input using the shell parser. Input that does not
+// parse yet, such as a half typed quote, is highlighted with a lexical scan instead.
+type SyntaxHighlighter struct {
+	Styles   HighlightStyles
+	Resolver CommandResolver
+
+	// Input starting with any of these prefixes is shown without highlighting
+	IgnorePrefixes []string
+
+	// The last highlighted text and its classes, since the view is
+	// re-rendered far more often than the input changes
+	lastText    string
+	lastClasses []highlightClass
+}
+
+func NewSyntaxHighlighter(resolver CommandResolver) *SyntaxHighlighter {
+	return &SyntaxHighlighter{
+		Styles:   DefaultHighlightStyles(),
+		Resolver: resolver,
+	}
+}
+
+// Render returns text with highlighting applied
+func (h *SyntaxHighlighter) Render(text string) string {
+	runes := []rune(text)
+	return h.renderRunes(runes, h.runeClasses(runes), 0, len(runes))
+}
+
+// runeClasses returns the class of each rune of value
+func (h *SyntaxHighlighter) runeClasses(value []rune) []highlightClass {
+	text := string(value)
+	for _, prefix := range h.IgnorePrefixes {
+		if strings.HasPrefix(strings.TrimLeft(text, " \t"), prefix) {
+			return make([]highlightClass, len(value))
+		}
+	}
+
+	if text != h.lastText || h.lastClasses == nil {
+		h.lastText = text
+		h.lastClasses = h.classify(text)
+	}
+
+	// Map the byte classes of the text back to its runes
+	classes := make([]highlightClass, len(value))
+	offset := 0
+	for i, r := range value {
+		classes[i] = h.lastClasses[offset]
+		offset += utf8.RuneLen(r)
+	}
+	return classes
+}
+
+// renderRunes renders value[from:to] grouping runs of the same class into a single style
+func (h *SyntaxHighlighter) renderRunes(value []rune, classes []highlightClass, from int, to int) string {
+	var result strings.Builder
+	for start := from; start < to; {
+		end := start + 1
+		for end < to && classes[end] == classes[start] && value[end] != '\n' && value[end-1] != '\n' {
+			end++
+		}
+		chunk := string(value[start:end])
+		if style, ok := h.style(classes[start]); ok && chunk != "\n" {
+			chunk = style.Inline(true).Render(chunk)
+		}
+		result.WriteString(chunk)
+		start = end
+	}
+	return result.String()
+}
+
+func (h *SyntaxHighlighter) style(class highlightClass) (lipgloss.Style, bool) {
+	switch class {
+	case classBuiltin:
+		return h.Styles.Builtin, true
+	case classFunction:
+		return h.Styles.Function, true
+	case classAlias:
+		return h.Styles.Alias, true
+	case classExecutable:
+		return h.Styles.Executable, true
+	case classMissing:
+		return h.Styles.Missing, true
+	case classKeyword:
+		return h.Styles.Keyword, true
+	case classString:
+		return h.Styles.String, true
+	case classVariable:
+		return h.Styles.Variable, true
+	case classRedirect:
+		return h.Styles.Redirect, true
+	case classOperator:
+		return h.Styles.Operator, true
+	case classComment:
+		return h.Styles.Comment, true
+	case classUnbalanced:
+		return h.Styles.Unbalanced, true
+	}
+	return lipgloss.Style{}, false
+}
+
+// classify returns the class of each byte of text
+func (h *SyntaxHighlighter) classify(text string) []highlightClass {
+	classes := make([]highlightClass, len(text))
+	file, err := syntax.NewParser(syntax.KeepComments(true)).Parse(strings.NewReader(text), "")
+	if err != nil {
+		h.classifyLexical(text, classes)
+		return classes
+	}
+	h.classifyTree(text, file, classes)
+	return classes
+}
+
+func (h *SyntaxHighlighter) commandClass(name string) highlightClass {
+	if h.Resolver == nil {
+		return classNone
+	}
+	switch h.Resolver.ResolveCommand(name) {
+	case CommandBuiltin:
+		return classBuiltin
+	case CommandFunction:
+		return classFunction
+	case CommandAlias:
+		return classAlias
+	case CommandExecutable:
+		return classExecutable
+	case CommandMissing:
+		return classMissing
+	}
+	return classNone
+}
+
+// classifyTree classifies text from its syntax tree. Nodes are visited parent
+// first, so nested nodes such as variables inside strings override their parents.
+func (h *SyntaxHighlighter) classifyTree(text string, file *syntax.File, classes []highlightClass) {
+	mark := func(from, to syntax.Pos, class highlightClass) {
+		if from.IsValid() && to.IsValid() {
+			fill(classes, int(from.Offset()), int(to.Offset()), class)
+		}
+	}
+	markLen := func(pos syntax.Pos, length int, class highlightClass) {
+		if pos.IsValid() {
+			fill(classes, int(pos.Offset()), int(pos.Offset())+length, class)
+		}
+	}
+	keyword := func(pos syntax.Pos) {
+		if pos.IsValid() {
+			markLen(pos, wordLength(text, int(pos.Offset())), classKeyword)
+		}
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.Comment:
+			mark(node.Pos(), node.End(), classComment)
+		case *syntax.Stmt:
+			if node.Negated {
+				markLen(node.Position, 1, classOperator)
+			}
+			if node.Semicolon.IsValid() {
+				length := 1
+				if strings.HasPrefix(text[node.Semicolon.Offset():], "|&") {
+					length = 2
+				}
+				markLen(node.Semicolon, length, classOperator)
+			}
+		case *syntax.CallExpr:
+			if len(node.Args) > 0 {
+				if name := node.Args[0].Lit(); name != "" {
+					mark(node.Args[0].Pos(), node.Args[0].End(), h.commandClass(name))
+				}
+			}
+		case *syntax.Assign:
+			if node.Name != nil {
+				mark(node.Name.Pos(), node.Name.End(), classVariable)
+			}
+		case *syntax.DeclClause:
+			mark(node.Variant.Pos(), node.Variant.End(), classBuiltin)
+		case *syntax.SglQuoted:
+			mark(node.Pos(), node.End(), classString)
+		case *syntax.DblQuoted:
+			mark(node.Pos(), node.End(), classString)
+		case *syntax.ParamExp:
+			mark(node.Pos(), node.End(), classVariable)
+		case *syntax.CmdSubst:
+			// $( or a backtick opens the substitution, ) or a backtick closes it
+			if strings.HasPrefix(text[node.Left.Offset():], "$(") {
+				markLen(node.Left, 2, classOperator)
+			} else {
+				markLen(node.Left, 1, classOperator)
+			}
+			markLen(node.Right, 1, classOperator)
+		case *syntax.ProcSubst:
+			markLen(node.OpPos, 2, classOperator)
+			markLen(node.Rparen, 1, classOperator)
+		case *syntax.ArithmExp:
+			mark(node.Pos(), node.End(), classVariable)
+		case *syntax.Redirect:
+			fill(classes, int(node.Pos().Offset()), int(node.OpPos.Offset())+len(node.Op.String()), classRedirect)
+		case *syntax.BinaryCmd:
+			markLen(node.OpPos, len(node.Op.String()), classOperator)
+		case *syntax.Subshell:
+			markLen(node.Lparen, 1, classOperator)
+			markLen(node.Rparen, 1, classOperator)
+		case *syntax.Block:
+			keyword(node.Lbrace)
+			keyword(node.Rbrace)
+		case *syntax.IfClause:
+			keyword(node.Position)
+			keyword(node.ThenPos)
+			keyword(node.FiPos)
+		case *syntax.WhileClause:
+			keyword(node.WhilePos)
+			keyword(node.DoPos)
+			keyword(node.DonePos)
+		case *syntax.ForClause:
+			keyword(node.ForPos)
+			keyword(node.DoPos)
+			keyword(node.DonePos)
+		case *syntax.WordIter:
+			keyword(node.InPos)
+		case *syntax.CaseClause:
+			keyword(node.Case)
+			keyword(node.In)
+			keyword(node.Esac)
+		case *syntax.TestClause:
+			markLen(node.Left, 2, classKeyword)
+			markLen(node.Right, 2, classKeyword)
+		case *syntax.TimeClause:
+			keyword(node.Time)
+		case *syntax.FuncDecl:
+			if node.RsrvWord {
+				keyword(node.Position)
+			}
+			mark(node.Name.Pos(), node.Name.End(), classFunction)
+		}
+		return true
+	})
+}
+
+// lexicalOpener is a quote or bracket waiting for its closing counterpart
+type lexicalOpener struct {
+	kind byte // one of ' " ` ( $ {, where $ stands for $(
+	pos  int
+}
+
+// classifyLexical classifies text that does not parse, typically because the user
+// is still typing it. Openers left without a closing counterpart, and closers
+// without an opener, are marked as unbalanced.
+func (h *SyntaxHighlighter) classifyLexical(text string, classes []highlightClass) {
+	var stack []lexicalOpener
+	top := func() byte {
+		if len(stack) == 0 {
+			return 0
+		}
+		return stack[len(stack)-1].kind
+	}
+
+	commandPosition := true
+	wordStart := -1
+	wordPlain := true
+
+	endWord := func(end int) {
+		if wordStart < 0 {
+			return
+		}
+		word := text[wordStart:end]
+		switch {
+		case !commandPosition:
+		case commandKeywords[word]:
+			fill(classes, wordStart, end, classKeyword)
+			commandPosition = true
+			wordStart = -1
+			return
+		case otherKeywords[word]:
+			fill(classes, wordStart, end, classKeyword)
+		case isAssignment(word):
+			name, _, _ := strings.Cut(word, "=")
+			fill(classes, wordStart, wordStart+len(name), classVariable)
+			wordStart = -1
+			return
+		case wordPlain:
+			fill(classes, wordStart, end, h.commandClass(word))
+		}
+		commandPosition = false
+		wordStart = -1
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch top() {
+		case '\'':
+			classes[i] = classString
+			if c == '\'' {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		case '"':
+			switch c {
+			case '\\':
+				fill(classes, i, i+2, classString)
+				i++
+				continue
+			case '"':
+				classes[i] = classString
+				stack = stack[:len(stack)-1]
+				continue
+			case '$', '`':
+				// Substitutions inside strings are handled below
+			default:
+				classes[i] = classString
+				continue
+			}
+		case '`':
+			if c == '`' {
+				endWord(i)
+				classes[i] = classOperator
+				stack = stack[:len(stack)-1]
+				continue
+			}
+		}
+
+		switch {
+		case c == '\\':
+			if wordStart < 0 {
+				wordStart = i
+			}
+			wordPlain = false
+			i++
+		case c == ' ' || c == '\t':
+			endWord(i)
+		case c == '\n':
+			endWord(i)
+			commandPosition = true
+		case c == '#' && wordStart < 0:
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			fill(classes, i, i+end, classComment)
+			i += end - 1
+		case c == '\'' || c == '"':
+			if wordStart < 0 {
+				wordStart = i
+			}
+			wordPlain = false
+			classes[i] = classString
+			stack = append(stack, lexicalOpener{kind: c, pos: i})
+		case c == '`':
+			endWord(i)
+			classes[i] = classOperator
+			stack = append(stack, lexicalOpener{kind: c, pos: i})
+			commandPosition = true
+		case c == '$' && strings.HasPrefix(text[i:], "$("):
+			endWord(i)
+			fill(classes, i, i+2, classOperator)
+			stack = append(stack, lexicalOpener{kind: '$', pos: i})
+			commandPosition = true
+			i++
+		case c == '$' && strings.HasPrefix(text[i:], "${"):
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				fill(classes, i, i+2, classUnbalanced)
+				fill(classes, i+2, len(text), classVariable)
+				i = len(text)
+				continue
+			}
+			fill(classes, i, i+end+1, classVariable)
+			i += end
+		case c == '$':
+			end := i + 1
+			for end < len(text) && isNameByte(text[end]) {
+				end++
+			}
+			if end == i+1 && end < len(text) && strings.IndexByte("?!#$@*-0123456789", text[end]) >= 0 {
+				end++
+			}
+			fill(classes, i, end, classVariable)
+			if wordStart < 0 {
+				wordStart = i
+			}
+			wordPlain = false
+			i = end - 1
+		case c == '(':
+			endWord(i)
+			classes[i] = classOperator
+			stack = append(stack, lexicalOpener{kind: '(', pos: i})
+			commandPosition = true
+		case c == ')':
+			endWord(i)
+			if top() == '(' || top() == '$' {
+				classes[i] = classOperator
+				stack = stack[:len(stack)-1]
+			} else {
+				classes[i] = classUnbalanced
+			}
+			commandPosition = false
+		case c == '|' || c == '&' || c == ';':
+			endWord(i)
+			end := i + 1
+			for end < len(text) && strings.IndexByte("|&;", text[end]) >= 0 {
+				end++
+			}
+			if c == '&' && end < len(text) && text[end] == '>' {
+				// &> redirects both stdout and stderr
+				fill(classes, i, end+1, classRedirect)
+				i = end
+				continue
+			}
+			fill(classes, i, end, classOperator)
+			commandPosition = true
+			i = end - 1
+		case c == '<' || c == '>':
+			start := i
+			if wordStart >= 0 && isDigits(text[wordStart:i]) {
+				start = wordStart
+				wordStart = -1
+			} else {
+				endWord(i)
+			}
+			end := i + 1
+			for end < len(text) && strings.IndexByte("<>&|", text[end]) >= 0 {
+				end++
+			}
+			fill(classes, start, end, classRedirect)
+			i = end - 1
+		default:
+			if wordStart < 0 {
+				wordStart = i
+				wordPlain = true
+			}
+		}
+	}
+	endWord(len(text))
+
+	for _, opener := range stack {
+		length := 1
+		if opener.kind == '$' {
+			length = 2
+		}
+		fill(classes, opener.pos, opener.pos+length, classUnbalanced)
+	}
+}
+
+func fill(classes []highlightClass, from int, to int, class highlightClass) {
+	for i := max(from, 0); i < to && i < len(classes); i++ {
+		classes[i] = class
+	}
+}
+
+// wordLength returns the length of the reserved word or operator starting at offset
+func wordLength(text string, offset int) int {
+	end := offset
+	for end < len(text) && !strings.ContainsRune(" \t\n;&|()<>", rune(text[end])) {
+		end++
+	}
+	if end == offset {
+		return 1
+	}
+	return end - offset
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
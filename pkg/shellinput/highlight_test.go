@@ -0,0 +1,126 @@
+package shellinput
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCommandResolver map[string]CommandKind
+
+func (r mockCommandResolver) ResolveCommand(name string) CommandKind {
+	if kind, ok := r[name]; ok {
+		return kind
+	}
+	return CommandMissing
+}
+
+var testResolver = mockCommandResolver{
+	"echo": CommandBuiltin,
+	"cd":   CommandBuiltin,
+	"ls":   CommandExecutable,
+	"grep": CommandExecutable,
+	"gs":   CommandAlias,
+	"mkcd": CommandFunction,
+}
+
+// describeClasses renders the class of each rune as a letter, so expectations line up with the input
+func describeClasses(h *SyntaxHighlighter, value string) string {
+	letters := map[highlightClass]byte{
+		classNone: '.', classBuiltin: 'B', classFunction: 'F', classAlias: 'A', classExecutable: 'X',
+		classMissing: 'M', classKeyword: 'K', classString: 'S', classVariable: 'V', classRedirect: 'R',
+		classOperator: 'O', classComment: 'C', classUnbalanced: 'U',
+	}
+	var result strings.Builder
+	for _, class := range h.runeClasses([]rune(value)) {
+		result.WriteByte(letters[class])
+	}
+	return result.String()
+}
+
+func TestSyntaxHighlighterClasses(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"resolved commands", "ls -la", "XX...."},
+		{"missing command", "nope x", "MMMM.."},
+		{"alias and function", "gs; mkcd d", "AAO.FFFF.."},
+		{"pipeline and list", "ls | grep a && echo", "XX.O.XXXX...OO.BBBB"},
+		{"strings and variables", `echo "hi $USER" 'x'`, `BBBB.SSSSVVVVVS.SSS`},
+		{"redirections", "ls 2>/dev/null >out", "XX.RR..........R..."},
+		{"comments", "ls # list", "XX.CCCCCC"},
+		{"assignment", "A=1 ls", "V...XX"},
+		{"keywords", "if ls; then echo; fi", "KK.XXO.KKKK.BBBBO.KK"},
+		{"command substitution", "echo $(ls)", "BBBB.OOXXO"},
+		{"unclosed quote", `echo "abc`, `BBBB.USSS`},
+		{"unclosed single quote", `ls 'a b`, `XX.USSS`},
+		{"unclosed parenthesis", "(ls", "UXX"},
+		{"unclosed substitution", "echo $(ls", "BBBB.UUXX"},
+		{"unmatched closing parenthesis", "ls )", "XX.U"},
+		{"incomplete pipeline", "ls |", "XX.O"},
+		{"incomplete keyword", "if ls", "KK.XX"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewSyntaxHighlighter(testResolver)
+			assert.Equal(t, test.expected, describeClasses(h, test.input))
+		})
+	}
+}
+
+func TestSyntaxHighlighterMultiline(t *testing.T) {
+	h := NewSyntaxHighlighter(testResolver)
+
+	// The quote opened on the first line is closed on the second one
+	assert.Equal(t, "BBBB.SSSSSO.XX", describeClasses(h, "echo \"a\nb\"; ls"))
+	assert.Equal(t, "BBBB.US", describeClasses(h, `echo "a`))
+}
+
+func TestSyntaxHighlighterIgnorePrefixes(t *testing.T) {
+	h := NewSyntaxHighlighter(testResolver)
+	h.IgnorePrefixes = []string{"@"}
+	assert.Equal(t, "......", describeClasses(h, "@ls -a"))
+}
+
+func TestSyntaxHighlighterView(t *testing.T) {
+	m := New()
+	m.Highlighter = NewSyntaxHighlighter(testResolver)
+	m.Highlighter.Styles.Missing = m.Highlighter.Styles.Missing.Bold(true)
+	m.Focus()
+	m.SetValue("nope é")
+
+	view := m.View()
+	assert.Contains(t, view, "nope")
+	assert.Contains(t, view, "é")
+
+	m.Highlighter = nil
+	assert.Contains(t, m.View(), "> nope é")
+}
+
+func TestSyntaxHighlighterLongInput(t *testing.T) {
+	h := NewSyntaxHighlighter(testResolver)
+	input := func(lines int) string {
+		var input strings.Builder
+		for i := 0; i < lines; i++ {
+			input.WriteString("ls -la | grep \"$HOME\" > /tmp/out 2>&1 && echo done\n")
+		}
+		input.WriteString(`echo "unclosed`)
+		return input.String()
+	}
+	allocs := func(text string) float64 {
+		keystroke := 0
+		return testing.AllocsPerRun(10, func() {
+			// Each keystroke changes the text, so nothing is served from the cache
+			keystroke++
+			describeClasses(h, text+strings.Repeat("x", keystroke))
+		})
+	}
+
+	// Highlighting grows linearly with the input, not with its square
+	short, long := allocs(input(100)), allocs(input(200))
+	assert.Less(t, long, 3*short)
+}
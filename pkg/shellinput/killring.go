@@ -0,0 +1,108 @@
+package shellinput
+
+// How many killed texts are kept for yanking
+const killRingSize = 30
+
+// killRing keeps text removed by kill actions, most recent last, so that it
+// can be yanked back like in emacs
+type killRing struct {
+	entries [][]rune
+	// Whether the previous action was a kill, in which case the next kill is
+	// joined with it
+	lastWasKill bool
+
+	// The text inserted by the previous yank, which yank-pop replaces
+	yanked      bool
+	yankStart   int
+	yankEnd     int
+	yankedIndex int
+}
+
+// isKillAction reports whether an action removes text into the kill ring
+func isKillAction(action string) bool {
+	switch action {
+	case ActionBackwardKillWord, ActionKillWord, ActionKillLine, ActionUnixLineDiscard:
+		return true
+	}
+	return false
+}
+
+// kill adds text removed by a kill action to the kill ring. Text killed
+// backwards goes in front of the text of a kill just before it.
+func (m *Model) kill(text []rune, backward bool) {
+	if len(text) == 0 {
+		return
+	}
+	ring := &m.kills
+	if ring.lastWasKill && len(ring.entries) > 0 {
+		last := ring.entries[len(ring.entries)-1]
+		if backward {
+			ring.entries[len(ring.entries)-1] = cloneConcatRunes(text, last)
+		} else {
+			ring.entries[len(ring.entries)-1] = cloneConcatRunes(last, text)
+		}
+		return
+	}
+	m.pushKill(text)
+}
+
+func (m *Model) pushKill(text []rune) {
+	m.kills.entries = append(m.kills.entries, cloneRunes(text))
+	if len(m.kills.entries) > killRingSize {
+		m.kills.entries = m.kills.entries[1:]
+	}
+}
+
+// killWith runs a deletion and adds the deleted text to the kill ring
+func (m *Model) killWith(deletion func(), backward bool) {
+	before := m.values[m.selectedValueIndex]
+	deletion()
+	removed := len(before) - len(m.values[m.selectedValueIndex])
+	if removed > 0 && m.pos+removed <= len(before) {
+		m.kill(before[m.pos:m.pos+removed], backward)
+	}
+}
+
+// yank inserts the most recently killed text at the cursor
+func (m *Model) yank() {
+	if len(m.kills.entries) == 0 {
+		return
+	}
+	m.insertYank(len(m.kills.entries) - 1)
+}
+
+// yankPop replaces the text just yanked with the kill before it, rotating
+// through the kill ring
+func (m *Model) yankPop() {
+	if !m.kills.yanked || len(m.kills.entries) == 0 {
+		return
+	}
+	value := m.values[m.selectedValueIndex]
+	if m.kills.yankEnd > len(value) {
+		return
+	}
+	m.setValue(cloneConcatRunes(value[:m.kills.yankStart], value[m.kills.yankEnd:]))
+	m.SetCursor(m.kills.yankStart)
+
+	index := m.kills.yankedIndex - 1
+	if index < 0 {
+		index = len(m.kills.entries) - 1
+	}
+	m.insertYank(index)
+}
+
+func (m *Model) insertYank(index int) {
+	start := m.pos
+	m.insertRunesFromUserInput(m.kills.entries[index])
+	m.kills.yanked = true
+	m.kills.yankStart = start
+	m.kills.yankEnd = m.pos
+	m.kills.yankedIndex = index
+}
+
+// setValue replaces the value being edited
+func (m *Model) setValue(value []rune) {
+	m.Err = m.validate(value)
+	m.values[0] = value
+	m.selectedValueIndex = 0
+}
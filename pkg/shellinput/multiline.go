@@ -0,0 +1,150 @@
+package shellinput
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultContinuationPrompt is shown before the second and later lines of the input
+const DefaultContinuationPrompt = "> "
+
+// DefaultIndent is added to the indentation of lines inside a block
+const DefaultIndent = "  "
+
+// Words that end a line opening a block, after which lines are indented
+var blockOpeners = []string{"then", "do", "else", "{", "(", "in"}
+
+// Words that start a line closing a block, which is dedented to match its opener
+var blockClosers = []string{"fi", "done", "esac", "}", ")", "else", "elif"}
+
+// lineBounds returns the start and end of the line of value containing pos.
+// The end is the position of the newline ending the line, or len(value).
+func lineBounds(value []rune, pos int) (int, int) {
+	start, end := pos, pos
+	for start > 0 && value[start-1] != '\n' {
+		start--
+	}
+	for end < len(value) && value[end] != '\n' {
+		end++
+	}
+	return start, end
+}
+
+// IsMultiline reports whether the input has more than one line
+func (m Model) IsMultiline() bool {
+	return strings.ContainsRune(m.Value(), '\n')
+}
+
+// cursorLineUp moves the cursor to the same column of the previous line. It
+// returns false when the cursor is on the first line.
+func (m *Model) cursorLineUp() bool {
+	value := m.values[m.selectedValueIndex]
+	start, _ := lineBounds(value, m.pos)
+	if start == 0 {
+		return false
+	}
+	prevStart, prevEnd := lineBounds(value, start-1)
+	m.SetCursor(prevStart + min(m.pos-start, prevEnd-prevStart))
+	return true
+}
+
+// cursorLineDown moves the cursor to the same column of the next line. It
+// returns false when the cursor is on the last line.
+func (m *Model) cursorLineDown() bool {
+	value := m.values[m.selectedValueIndex]
+	start, end := lineBounds(value, m.pos)
+	if end == len(value) {
+		return false
+	}
+	nextStart, nextEnd := lineBounds(value, end+1)
+	m.SetCursor(nextStart + min(m.pos-start, nextEnd-nextStart))
+	return true
+}
+
+// InsertNewline breaks the line at the cursor. The new line keeps the
+// indentation of the current one, indented once more after a line opening a
+// block such as if ...; then, and a line closing a block is dedented first.
+func (m *Model) InsertNewline() {
+	m.resetCompletion()
+	before := m.snapshot()
+
+	m.dedentLine()
+	value := m.values[m.selectedValueIndex]
+	start, _ := lineBounds(value, m.pos)
+	line := string(value[start:m.pos])
+	indent := line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))]
+	if opensBlock(strings.TrimSpace(line)) {
+		indent += m.Indent
+	}
+
+	// Inserted directly, as the sanitizer would turn indentation tabs into spaces
+	text := []rune("\n" + indent)
+	m.setValue(cloneConcatRunes(cloneConcatRunes(value[:m.pos], text), value[m.pos:]))
+	m.SetCursor(m.pos + len(text))
+
+	if m.recordsEdits() {
+		m.recordEdit(before, false)
+	}
+	m.updateSuggestions()
+	m.updateHelpInfo()
+}
+
+// DedentLine dedents the line of the cursor to the level of its block when it
+// closes one, as is done when a newline is inserted after it. It is meant for
+// the last line of a command about to be run.
+func (m *Model) DedentLine() {
+	before := m.snapshot()
+	m.dedentLine()
+	if m.recordsEdits() {
+		m.recordEdit(before, false)
+	}
+}
+
+func (m *Model) dedentLine() {
+	value := m.values[m.selectedValueIndex]
+	start, end := lineBounds(value, m.pos)
+	line := string(value[start:end])
+	indent := line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))]
+	if m.Indent == "" || !strings.HasSuffix(indent, m.Indent) || !startsWithWord(line[len(indent):], blockClosers) {
+		return
+	}
+	m.setValue(cloneConcatRunes(value[:start], value[start+len([]rune(m.Indent)):]))
+	m.SetCursor(max(start, m.pos-len([]rune(m.Indent))))
+}
+
+// startsWithWord reports whether line starts with one of words, as a whole word
+func startsWithWord(line string, words []string) bool {
+	for _, word := range words {
+		if rest, ok := strings.CutPrefix(line, word); ok && (rest == "" || !isWordRune(rune(rest[0]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// opensBlock reports whether line ends with a word opening a block. Keywords
+// only count in command position, so that echo do doesn't open a block.
+func opensBlock(line string) bool {
+	if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] == ' ') {
+		// Ignore a trailing comment
+		line = strings.TrimSpace(line[:i])
+	}
+	for _, word := range blockOpeners {
+		rest, ok := strings.CutSuffix(line, word)
+		if !ok {
+			continue
+		}
+		if !isWordRune(rune(word[0])) {
+			return true
+		}
+		rest = strings.TrimSpace(rest)
+		if rest == "" || strings.HasSuffix(rest, ";") || (word == "in" && startsWithWord(rest, []string{"case"})) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,149 @@
+package shellinput
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+var altEnter = tea.KeyMsg{Type: tea.KeyEnter, Alt: true}
+
+func TestInsertNewline(t *testing.T) {
+	model := New()
+	model.Focus()
+
+	model = typeText(model, "echo a")
+	model, _ = model.Update(altEnter)
+	model = typeText(model, "echo b")
+	assert.Equal(t, "echo a\necho b", model.Value())
+	assert.True(t, model.IsMultiline())
+
+	// Undo removes the typing, then the newline
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlUnderscore})
+	assert.Equal(t, "echo a\n", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlUnderscore})
+	assert.Equal(t, "echo a", model.Value())
+	assert.False(t, model.IsMultiline())
+}
+
+func TestAutoIndent(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{"if", []string{"if true; then", "echo yes", "fi"}, "if true; then\n  echo yes\nfi"},
+		{"for", []string{"for f in *; do", "echo $f", "done"}, "for f in *; do\n  echo $f\ndone"},
+		{"function", []string{"greet() {", "echo hi", "}"}, "greet() {\n  echo hi\n}"},
+		{"else", []string{"if true; then", "echo yes", "else", "echo no", "fi"}, "if true; then\n  echo yes\nelse\n  echo no\nfi"},
+		{"nested", []string{"for f in *; do", "if true; then", "echo $f", "fi", "done"}, "for f in *; do\n  if true; then\n    echo $f\n  fi\ndone"},
+		{"comment", []string{"while true; do # forever", "sleep 1"}, "while true; do # forever\n  sleep 1"},
+		{"case", []string{"case $x in", "a) echo a ;;"}, "case $x in\n  a) echo a ;;"},
+		{"no block", []string{"echo do", "echo done"}, "echo do\necho done"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := New()
+			model.Focus()
+			for i, line := range test.lines {
+				if i > 0 {
+					model, _ = model.Update(altEnter)
+				}
+				model = typeText(model, line)
+			}
+			// Closing lines are dedented when the line is broken after them
+			if strings.HasSuffix(test.expected, "fi") || strings.HasSuffix(test.expected, "done") || strings.HasSuffix(test.expected, "}") {
+				model, _ = model.Update(altEnter)
+				model, _ = model.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+			}
+			assert.Equal(t, test.expected, model.Value())
+		})
+	}
+}
+
+func TestMultilineCursorMovement(t *testing.T) {
+	model := New()
+	model.Focus()
+	model.SetHistoryValues([]string{"ls"})
+	model.SetValue("echo first\nls\necho third")
+	model.SetCursor(8)
+
+	// Up and Down move between lines, keeping the column when they can
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, 13, model.Position(), "Down should stop at the end of a shorter line")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, 16, model.Position())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyUp})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, 2, model.Position())
+
+	// Up on the first line goes to history
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, "ls", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, "echo first\nls\necho third", model.Value())
+
+	// Line editing keys work on the line of the cursor
+	model.SetCursor(12)
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+	assert.Equal(t, 11, model.Position())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlE})
+	assert.Equal(t, 13, model.Position())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlU})
+	assert.Equal(t, "echo first\n\necho third", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlK})
+	assert.Equal(t, "echo first\necho third", model.Value(), "Ctrl+K at the end of a line should join the next line")
+}
+
+func TestMultilineView(t *testing.T) {
+	model := New()
+	model.Focus()
+	model.Prompt = "$ "
+	model.SetValue("if true; then\n  echo yes\nfi")
+
+	lines := strings.Split(model.View(), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "$ if true; then"))
+	assert.True(t, strings.HasPrefix(lines[1], "> "+"  echo yes"))
+	assert.True(t, strings.HasPrefix(lines[2], "> "))
+	assert.Contains(t, lines[2], "i")
+
+	// The cursor can rest at the end of a line
+	model.SetCursor(13)
+	lines = strings.Split(model.View(), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "$ if true; then"))
+}
+
+func TestViMultiline(t *testing.T) {
+	tests := []struct {
+		value    string
+		pos      int
+		keys     string
+		expected string
+		pos2     int
+	}{
+		{"echo a\necho b", 9, "0", "echo a\necho b", 7},
+		{"echo a\necho b", 7, "$", "echo a\necho b", 12},
+		{"echo a\necho b", 7, "h", "echo a\necho b", 7},
+		{"echo a\necho b", 5, "l", "echo a\necho b", 5},
+		{"echo a\necho b", 2, "j", "echo a\necho b", 9},
+		{"echo a\necho b", 9, "k", "echo a\necho b", 2},
+		{"echo a\necho b", 2, "dd", "echo b", 0},
+		{"echo a\necho b", 9, "dd", "echo a", 5},
+		{"echo a\necho b", 9, "D", "echo a\nec", 8},
+		{"echo a\necho b", 2, "Aa<esc>", "echo aa\necho b", 6},
+		{"echo a\n  echo b", 10, "Ix<esc>", "echo a\n  xecho b", 9},
+	}
+
+	for _, test := range tests {
+		t.Run(test.keys, func(t *testing.T) {
+			model := typeKeys(newViModel(test.value, test.pos), test.keys)
+			assert.Equal(t, test.expected, model.Value())
+			assert.Equal(t, test.pos2, model.Position())
+		})
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/charmbracelet/bubbles/runeutil"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
 	"github.com/muesli/reflow/wrap"
 	"github.com/rivo/uniseg"
 )
@@ -87,7 +88,14 @@ type KeyMap struct {
 	PrevValue               key.Binding
 	Complete                key.Binding
 	PrevSuggestion          key.Binding
+	CycleSuggestionForward  key.Binding
+	CycleSuggestionBackward key.Binding
 	ClearScreen             key.Binding
+	Undo                    key.Binding
+	Redo                    key.Binding
+	Yank                    key.Binding
+	YankPop                 key.Binding
+	InsertNewline           key.Binding
 }
 
 // DefaultKeyMap is the default set of key bindings for navigating and acting
@@ -104,6 +112,8 @@ var DefaultKeyMap = KeyMap{
 	DeleteCharacterBackward: key.NewBinding(key.WithKeys("backspace", "ctrl+h")),
 	Complete:                key.NewBinding(key.WithKeys("tab")),
 	PrevSuggestion:          key.NewBinding(key.WithKeys("shift+tab")),
+	CycleSuggestionForward:  key.NewBinding(key.WithKeys("alt+]")),
+	CycleSuggestionBackward: key.NewBinding(key.WithKeys("alt+[")),
 	DeleteCharacterForward:  key.NewBinding(key.WithKeys("delete", "ctrl+d")),
 	LineStart:               key.NewBinding(key.WithKeys("home", "ctrl+a")),
 	LineEnd:                 key.NewBinding(key.WithKeys("end", "ctrl+e")),
@@ -111,6 +121,11 @@ var DefaultKeyMap = KeyMap{
 	NextValue:               key.NewBinding(key.WithKeys("down", "ctrl+n")),
 	PrevValue:               key.NewBinding(key.WithKeys("up", "ctrl+p")),
 	ClearScreen:             key.NewBinding(key.WithKeys("ctrl+l")),
+	Undo:                    key.NewBinding(key.WithKeys("ctrl+_")),
+	Redo:                    key.NewBinding(key.WithKeys("alt+_")),
+	Yank:                    key.NewBinding(key.WithKeys("ctrl+y")),
+	YankPop:                 key.NewBinding(key.WithKeys("alt+y")),
+	InsertNewline:           key.NewBinding(key.WithKeys("alt+enter")),
 }
 
 // Model is the Bubble Tea model for this text input element.
@@ -126,6 +141,9 @@ type Model struct {
 	// Completion settings
 	CompletionProvider CompletionProvider
 	completion         completionState
+	// Identifies the completion slow candidates are awaited for, so those of
+	// an earlier one are ignored
+	asyncCompletionID int
 
 	// Deprecated: use [cursor.BlinkSpeed] instead.
 	BlinkSpeed time.Duration
@@ -141,6 +159,14 @@ type Model struct {
 	// Deprecated: use Cursor.Style instead.
 	CursorStyle lipgloss.Style
 
+	// ContinuationPrompt is shown before the second and later lines of the input
+	ContinuationPrompt string
+	// Indent is added to the indentation of a new line inside a block
+	Indent string
+
+	// Highlighter colours the input as it is typed. Highlighting is disabled when nil.
+	Highlighter *SyntaxHighlighter
+
 	// CharLimit is the maximum amount of characters this input element will
 	// accept. If 0 or less, there's no limit.
 	CharLimit int
@@ -153,6 +179,20 @@ type Model struct {
 	// KeyMap encodes the keybindings recognized by the widget.
 	KeyMap KeyMap
 
+	// EditingMode selects emacs or vi style editing. In vi mode the KeyMap
+	// applies to insert mode.
+	EditingMode EditingMode
+	// Prompt prefixes that show whether vi mode is inserting or taking commands
+	ViInsertModeString  string
+	ViCommandModeString string
+	// SelectionStyle is applied to the text selected in vi's visual mode
+	SelectionStyle lipgloss.Style
+	vi             viState
+
+	// Undo and redo steps, and text removed by kill actions
+	edits editHistory
+	kills killRing
+
 	// focus indicates whether user input focus should be on this input
 	// component. When false, ignore keyboard input and hide the cursor.
 	focus bool
@@ -195,6 +235,12 @@ func New() Model {
 		Cursor:          cursor.New(),
 		KeyMap:          DefaultKeyMap,
 
+		ContinuationPrompt:  DefaultContinuationPrompt,
+		Indent:              DefaultIndent,
+		ViInsertModeString:  DefaultViInsertModeString,
+		ViCommandModeString: DefaultViCommandModeString,
+		SelectionStyle:      lipgloss.NewStyle().Reverse(true),
+
 		suggestions: [][]rune{},
 		focus:       false,
 		pos:         0,
@@ -287,6 +333,7 @@ func (m *Model) SetSuggestions(suggestions []string) {
 	for i, s := range suggestions {
 		m.suggestions[i] = []rune(s)
 	}
+	m.currentSuggestionIndex = 0
 
 	m.updateSuggestions()
 }
@@ -308,10 +355,9 @@ func (m *Model) SetHistoryValues(historyValues []string) {
 // rsan initializes or retrieves the rune sanitizer.
 func (m *Model) san() runeutil.Sanitizer {
 	if m.rsan == nil {
-		// Textinput has all its input on a single line so collapse
-		// newlines/tabs to single spaces.
-		m.rsan = runeutil.NewSanitizer(
-			runeutil.ReplaceTabs(" "), runeutil.ReplaceNewlines(" "))
+		// The input can span several lines, so only tabs are collapsed
+		// to single spaces.
+		m.rsan = runeutil.NewSanitizer(runeutil.ReplaceTabs(" "))
 	}
 	return m.rsan
 }
@@ -349,24 +395,32 @@ func (m *Model) insertRunesFromUserInput(v []rune) {
 	m.setValueInternal(result, inputErr)
 }
 
-// deleteBeforeCursor deletes all text before the cursor.
+// deleteBeforeCursor deletes all text before the cursor on its line.
 func (m *Model) deleteBeforeCursor() {
-	newValue := cloneRunes(m.values[m.selectedValueIndex][m.pos:])
+	value := m.values[m.selectedValueIndex]
+	start, _ := lineBounds(value, m.pos)
+	newValue := cloneConcatRunes(value[:start], value[m.pos:])
 	m.Err = m.validate(newValue)
 	m.values[0] = newValue
 	m.selectedValueIndex = 0
-	m.SetCursor(0)
+	m.SetCursor(start)
 }
 
-// deleteAfterCursor deletes all text after the cursor. If input is masked
-// delete everything after the cursor so as not to reveal word breaks in the
-// masked input.
+// deleteAfterCursor deletes all text after the cursor on its line, or the
+// newline ending the line when the cursor is already at its end. If input is
+// masked delete everything after the cursor so as not to reveal word breaks
+// in the masked input.
 func (m *Model) deleteAfterCursor() {
-	newValue := cloneRunes(m.values[m.selectedValueIndex][:m.pos])
+	value := m.values[m.selectedValueIndex]
+	_, end := lineBounds(value, m.pos)
+	if end == m.pos && end < len(value) {
+		end++
+	}
+	newValue := cloneConcatRunes(value[:m.pos], value[end:])
 	m.Err = m.validate(newValue)
 	m.values[0] = newValue
 	m.selectedValueIndex = 0
-	m.SetCursor(len(m.values[0]))
+	m.SetCursor(m.pos)
 }
 
 // deleteWordBackward deletes the word left to the cursor.
@@ -575,78 +629,16 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 			m.resetCompletion()
 		}
 
-		switch {
-		case key.Matches(msg, m.KeyMap.Complete):
-			m.handleCompletion()
-			return m, nil
-		case key.Matches(msg, m.KeyMap.PrevSuggestion) && m.completion.active:
-			m.handleBackwardCompletion()
-			return m, nil
-		case key.Matches(msg, m.KeyMap.DeleteWordBackward):
-			m.deleteWordBackward()
-		case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
-			m.Err = nil
-			if len(m.values[m.selectedValueIndex]) > 0 {
-				newValue := cloneConcatRunes(m.values[m.selectedValueIndex][:max(0, m.pos-1)], m.values[m.selectedValueIndex][m.pos:])
-				m.Err = m.validate(newValue)
-				m.values[0] = newValue
-				m.selectedValueIndex = 0
-				if m.pos > 0 {
-					m.SetCursor(m.pos - 1)
-				}
-			}
-		case key.Matches(msg, m.KeyMap.WordBackward):
-			m.wordBackward()
-		case key.Matches(msg, m.KeyMap.CharacterBackward):
-			if m.pos > 0 {
-				m.SetCursor(m.pos - 1)
-			}
-		case key.Matches(msg, m.KeyMap.WordForward):
-			m.wordForward()
-		case key.Matches(msg, m.KeyMap.CharacterForward):
-			if m.pos < len(m.values[m.selectedValueIndex]) {
-				m.SetCursor(m.pos + 1)
-			} else if m.canAcceptSuggestion() {
-				newValue := cloneConcatRunes(
-					m.values[m.selectedValueIndex],
-					m.matchedSuggestions[m.currentSuggestionIndex][len(m.values[m.selectedValueIndex]):],
-				)
-				m.Err = m.validate(newValue)
-				m.values[0] = newValue
-				m.selectedValueIndex = 0
-				m.CursorEnd()
+		if m.EditingMode == EditingModeVi {
+			if handled, cmd := m.handleViKey(msg); handled {
+				m.updateSuggestions()
+				m.updateHelpInfo()
+				return m, cmd
 			}
-		case key.Matches(msg, m.KeyMap.LineStart):
-			m.CursorStart()
-		case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
-			if len(m.values[m.selectedValueIndex]) > 0 && m.pos < len(m.values[m.selectedValueIndex]) {
-				newValue := cloneConcatRunes(m.values[m.selectedValueIndex][:m.pos], m.values[m.selectedValueIndex][m.pos+1:])
-				m.Err = m.validate(newValue)
-				m.values[0] = newValue
-				m.selectedValueIndex = 0
-			}
-		case key.Matches(msg, m.KeyMap.LineEnd):
-			m.CursorEnd()
-		case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
-			m.deleteAfterCursor()
-		case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
-			m.deleteBeforeCursor()
-		case key.Matches(msg, m.KeyMap.Paste):
-			return m, Paste
-		case key.Matches(msg, m.KeyMap.DeleteWordForward):
-			m.deleteWordForward()
-		case key.Matches(msg, m.KeyMap.NextValue):
-			m.nextValue()
-		case key.Matches(msg, m.KeyMap.PrevValue):
-			m.previousValue()
-		case key.Matches(msg, m.KeyMap.ClearScreen):
-			// Clear screen functionality will be handled by the gline package
-			// Return the model unchanged to prevent default character input
-			// The gline package will handle the actual screen clearing
-			return m, nil
-		default:
-			// Input one or more regular characters.
-			m.insertRunesFromUserInput(msg.Runes)
+		}
+
+		if done, cmd := m.handleKey(msg); done {
+			return m, cmd
 		}
 
 		// Check again if can be completed
@@ -657,10 +649,23 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		m.updateHelpInfo()
 
 	case pasteMsg:
+		// Pasted text is undone in one step, and can be rotated with yank-pop
+		before := m.snapshot()
+		start := m.pos
 		m.insertRunesFromUserInput([]rune(msg))
+		if m.pos > start {
+			m.pushKill(m.values[m.selectedValueIndex][start:m.pos])
+			m.kills.yanked = true
+			m.kills.yankStart, m.kills.yankEnd = start, m.pos
+			m.kills.yankedIndex = len(m.kills.entries) - 1
+		}
+		m.recordEdit(before, false)
 
 	case pasteErrMsg:
 		m.Err = msg
+
+	case asyncCompletionMsg:
+		m.addAsyncCompletions(msg)
 	}
 
 	var cmds []tea.Cmd
@@ -677,20 +682,240 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// handleKey runs the action bound to a key, or inserts the typed characters.
+// It returns true when the input doesn't need to be re-examined for suggestions.
+func (m *Model) handleKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	if action := m.KeyMap.ActionFor(msg); action != "" {
+		return m.performAction(action)
+	}
+
+	// Input one or more regular characters.
+	before := m.snapshot()
+	m.insertRunesFromUserInput(msg.Runes)
+	m.kills.lastWasKill = false
+	m.kills.yanked = false
+	if m.recordsEdits() {
+		m.recordEdit(before, true)
+	}
+	return false, nil
+}
+
+// recordsEdits reports whether edits are recorded for undo as they are made.
+// In vi's insert mode, everything typed until Esc is a single edit.
+func (m *Model) recordsEdits() bool {
+	return m.EditingMode != EditingModeVi || m.vi.mode != viInsert
+}
+
+// performAction runs an editing action. It returns true when the action is
+// complete and the input doesn't need to be re-examined for suggestions.
+func (m *Model) performAction(action string) (bool, tea.Cmd) {
+	before := m.snapshot()
+	done, cmd := m.runAction(action)
+
+	m.kills.lastWasKill = isKillAction(action)
+	if action != ActionYank && action != ActionYankPop {
+		m.kills.yanked = false
+	}
+	switch action {
+	case ActionUndo, ActionRedo, ActionNextHistory, ActionPreviousHistory:
+		// Browsing history isn't an edit, even though the value changes
+		m.edits.typing = false
+	case ActionYankPop:
+		// Rotating the yanked text belongs to the yank, so one undo removes it
+	default:
+		if m.recordsEdits() {
+			m.recordEdit(before, false)
+		}
+	}
+	return done, cmd
+}
+
+func (m *Model) runAction(action string) (bool, tea.Cmd) {
+	switch action {
+	case ActionComplete:
+		return true, m.handleCompletion()
+	case ActionMenuCompleteBackward:
+		if m.completion.active {
+			m.handleBackwardCompletion()
+		}
+		return true, nil
+	case ActionNextSuggestion:
+		m.cycleSuggestion(1)
+		return true, nil
+	case ActionPreviousSuggestion:
+		m.cycleSuggestion(-1)
+		return true, nil
+	case ActionBackwardKillWord:
+		m.killWith(m.deleteWordBackward, true)
+	case ActionBackwardDeleteChar:
+		m.Err = nil
+		if len(m.values[m.selectedValueIndex]) > 0 {
+			newValue := cloneConcatRunes(m.values[m.selectedValueIndex][:max(0, m.pos-1)], m.values[m.selectedValueIndex][m.pos:])
+			m.Err = m.validate(newValue)
+			m.values[0] = newValue
+			m.selectedValueIndex = 0
+			if m.pos > 0 {
+				m.SetCursor(m.pos - 1)
+			}
+		}
+	case ActionBackwardWord:
+		m.wordBackward()
+	case ActionBackwardChar:
+		if m.pos > 0 {
+			m.SetCursor(m.pos - 1)
+		}
+	case ActionForwardWord:
+		m.wordForward()
+	case ActionForwardChar:
+		if m.pos < len(m.values[m.selectedValueIndex]) {
+			m.SetCursor(m.pos + 1)
+		} else if m.canAcceptSuggestion() {
+			newValue := cloneConcatRunes(
+				m.values[m.selectedValueIndex],
+				m.matchedSuggestions[m.currentSuggestionIndex][len(m.values[m.selectedValueIndex]):],
+			)
+			m.Err = m.validate(newValue)
+			m.values[0] = newValue
+			m.selectedValueIndex = 0
+			m.CursorEnd()
+		}
+	case ActionBeginningOfLine:
+		start, _ := lineBounds(m.values[m.selectedValueIndex], m.pos)
+		m.SetCursor(start)
+	case ActionDeleteChar:
+		if len(m.values[m.selectedValueIndex]) > 0 && m.pos < len(m.values[m.selectedValueIndex]) {
+			newValue := cloneConcatRunes(m.values[m.selectedValueIndex][:m.pos], m.values[m.selectedValueIndex][m.pos+1:])
+			m.Err = m.validate(newValue)
+			m.values[0] = newValue
+			m.selectedValueIndex = 0
+		}
+	case ActionEndOfLine:
+		_, end := lineBounds(m.values[m.selectedValueIndex], m.pos)
+		m.SetCursor(end)
+	case ActionKillLine:
+		m.killWith(m.deleteAfterCursor, false)
+	case ActionUnixLineDiscard:
+		m.killWith(m.deleteBeforeCursor, true)
+	case ActionPasteFromClipboard:
+		return true, Paste
+	case ActionKillWord:
+		m.killWith(m.deleteWordForward, false)
+	case ActionUndo:
+		m.undo()
+	case ActionRedo:
+		m.redo()
+	case ActionYank:
+		m.yank()
+	case ActionYankPop:
+		m.yankPop()
+	case ActionNextHistory:
+		// Within a multiline input, move between its lines first
+		if !m.cursorLineDown() {
+			m.nextValue()
+		}
+	case ActionPreviousHistory:
+		if !m.cursorLineUp() {
+			m.previousValue()
+		}
+	case ActionInsertNewline:
+		m.InsertNewline()
+		return true, nil
+	case ActionClearScreen:
+		// Clear screen functionality will be handled by the gline package
+		// Return the model unchanged to prevent default character input
+		// The gline package will handle the actual screen clearing
+		return true, nil
+	}
+	return false, nil
+}
+
+// PerformAction runs an editing action as if a key bound to it was pressed
+func (m Model) PerformAction(action string) (Model, tea.Cmd) {
+	action = CanonicalAction(action)
+	if action == "" || !m.focus {
+		return m, nil
+	}
+
+	if action != ActionComplete && action != ActionMenuCompleteBackward {
+		m.resetCompletion()
+	}
+	if done, cmd := m.performAction(action); done {
+		return m, cmd
+	}
+	m.updateSuggestions()
+	m.updateHelpInfo()
+	return m, nil
+}
+
+// InsertText inserts text at the cursor as if it was typed
+func (m *Model) InsertText(text string) {
+	m.resetCompletion()
+	before := m.snapshot()
+	m.insertRunesFromUserInput([]rune(text))
+	if m.recordsEdits() {
+		m.recordEdit(before, false)
+	}
+	m.updateSuggestions()
+	m.updateHelpInfo()
+}
+
 // View renders the textinput in its current state.
 func (m Model) View() string {
 	styleText := m.TextStyle.Inline(true).Render
 
 	value := m.values[m.selectedValueIndex]
 	pos := max(0, m.pos)
-	v := m.PromptStyle.Render(m.Prompt) + styleText(m.echoTransform(string(value[:pos])))
 
-	if pos < len(value) { //nolint:nestif
+	renderText := func(from, to int) string {
+		return styleText(m.echoTransform(string(value[from:to])))
+	}
+	if m.Highlighter != nil && m.EchoMode == EchoNormal {
+		classes := m.Highlighter.runeClasses(value)
+		renderText = func(from, to int) string {
+			return m.Highlighter.renderRunes(value, classes, from, to)
+		}
+	}
+
+	// Lines after the first start with the continuation prompt
+	renderLines := func(from, to int) string {
+		var lines strings.Builder
+		start := from
+		for i := from; i < to; i++ {
+			if value[i] == '\n' {
+				lines.WriteString(renderText(start, i))
+				lines.WriteString("\n" + m.PromptStyle.Render(m.ContinuationPrompt))
+				start = i + 1
+			}
+		}
+		lines.WriteString(renderText(start, to))
+		return lines.String()
+	}
+
+	if from, to, ok := m.viSelection(); ok {
+		// Render the selected text in the selection style instead of highlighting it
+		renderUnselected := renderText
+		renderText = func(start, end int) string {
+			selectedFrom, selectedTo := clamp(from, start, end), clamp(to, start, end)
+			return renderUnselected(start, selectedFrom) +
+				m.SelectionStyle.Inline(true).Render(m.echoTransform(string(value[selectedFrom:selectedTo]))) +
+				renderUnselected(selectedTo, end)
+		}
+	}
+
+	v := m.PromptStyle.Render(m.viModeIndicator()+m.Prompt) + renderLines(0, pos)
+
+	if pos < len(value) && value[pos] == '\n' {
+		// The cursor is at the end of a line that isn't the last one
+		m.Cursor.SetChar(" ")
+		v += m.Cursor.View()
+		v += renderLines(pos, len(value))
+		v += m.completionView(0)
+	} else if pos < len(value) { //nolint:nestif
 		char := m.echoTransform(string(value[pos]))
 		m.Cursor.SetChar(char)
-		v += m.Cursor.View()                                   // cursor and text under it
-		v += styleText(m.echoTransform(string(value[pos+1:]))) // text after cursor
-		v += m.completionView(0)                               // suggested completion
+		v += m.Cursor.View()                // cursor and text under it
+		v += renderLines(pos+1, len(value)) // text after cursor
+		v += m.completionView(0)            // suggested completion
 	} else {
 		if m.canAcceptSuggestion() {
 			suggestion := m.matchedSuggestions[m.currentSuggestionIndex]
@@ -709,7 +934,8 @@ func (m Model) View() string {
 		}
 	}
 
-	totalWidth := uniseg.StringWidth(v)
+	// Only the last line is padded
+	totalWidth := uniseg.StringWidth(v[strings.LastIndex(v, "\n")+1:])
 
 	// If a max width is set, we need to respect the horizontal boundary
 	if m.Width > 0 {
@@ -861,13 +1087,33 @@ func (m Model) CompletionBoxView() string {
 		}
 	}
 
+	// Descriptions are lined up in a column after the widest visible candidate,
+	// and icons are shown if any visible candidate has a kind or was suggested
+	// by a language model
+	visible := m.completion.suggestions[startIdx:endIdx]
+	showIcons, displayWidth := false, 0
+	for _, candidate := range visible {
+		showIcons = showIcons || candidate.Kind != CompletionOther || candidate.AI
+		displayWidth = max(displayWidth, uniseg.StringWidth(candidate.DisplayText()))
+	}
+
 	// Add visible items with scroll indicators as prefixes
 	for idx, i := range []int{startIdx, startIdx + 1, startIdx + 2, startIdx + 3} {
 		if i >= endIdx {
 			break
 		}
 
-		suggestion := m.completion.suggestions[i]
+		candidate := m.completion.suggestions[i]
+		suggestion := candidate.DisplayText()
+		if showIcons {
+			icon, ok := completionKindIcons[candidate.Kind]
+			if candidate.AI {
+				icon = aiCompletionIcon
+			} else if !ok {
+				icon = " "
+			}
+			suggestion = icon + " " + suggestion
+		}
 		var prefix string
 
 		// Determine prefix based on position and scroll state
@@ -889,7 +1135,16 @@ func (m Model) CompletionBoxView() string {
 			prefix += "  "
 		}
 
-		content.WriteString(prefix + suggestion)
+		line := prefix + suggestion
+		if candidate.Description != "" {
+			line += strings.Repeat(" ", displayWidth-uniseg.StringWidth(candidate.DisplayText())) + "  "
+			description := candidate.Description
+			if m.Width > 0 {
+				description = truncate.StringWithTail(description, uint(max(m.Width-uniseg.StringWidth(line), 0)), "…")
+			}
+			line = strings.TrimRight(line+description, " ")
+		}
+		content.WriteString(line)
 
 		// Add newline except for the last item
 		if idx < 3 && i < endIdx-1 {
@@ -941,6 +1196,15 @@ func (m *Model) CurrentSuggestion() string {
 	return string(m.matchedSuggestions[m.currentSuggestionIndex])
 }
 
+// cycleSuggestion moves the current suggestion by delta, wrapping around the matched suggestions
+func (m *Model) cycleSuggestion(delta int) {
+	if len(m.matchedSuggestions) < 2 {
+		return
+	}
+	n := len(m.matchedSuggestions)
+	m.currentSuggestionIndex = ((m.currentSuggestionIndex+delta)%n + n) % n
+}
+
 // canAcceptSuggestion returns whether there is an acceptable suggestion to
 // autocomplete the current value.
 func (m *Model) canAcceptSuggestion() bool {
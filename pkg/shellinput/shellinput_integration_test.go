@@ -43,7 +43,11 @@ func newRealCompletionProvider() *realCompletionProvider {
 	}
 }
 
-func (r *realCompletionProvider) GetCompletions(line string, pos int) []string {
+func (r *realCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return NewCompletionCandidates(r.completionValues(line, pos))
+}
+
+func (r *realCompletionProvider) completionValues(line string, pos int) []string {
 	// Extract the part of the line up to the cursor
 	inputLine := line[:pos]
 
@@ -88,7 +92,11 @@ func (f *fileSystemCompletionProvider) GetHelpInfo(line string, pos int) string
 	return f.baseProvider.GetHelpInfo(line, pos)
 }
 
-func (f *fileSystemCompletionProvider) GetCompletions(line string, pos int) []string {
+func (f *fileSystemCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return NewCompletionCandidates(f.completionValues(line, pos))
+}
+
+func (f *fileSystemCompletionProvider) completionValues(line string, pos int) []string {
 	inputLine := line[:pos]
 
 	// Handle cd commands with real directory listing
@@ -150,7 +158,7 @@ func (f *fileSystemCompletionProvider) GetCompletions(line string, pos int) []st
 	}
 
 	// Fall back to base provider for non-file completions
-	return f.baseProvider.GetCompletions(line, pos)
+	return f.baseProvider.completionValues(line, pos)
 }
 
 func TestModel_RealCompletion_Integration(t *testing.T) {
@@ -6,6 +6,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // mockCompletionProvider implements CompletionProvider for testing
@@ -13,7 +14,11 @@ type mockCompletionProvider struct {
 	suggestions []string
 }
 
-func (m *mockCompletionProvider) GetCompletions(line string, pos int) []string {
+func (m *mockCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return NewCompletionCandidates(m.completionValues(line, pos))
+}
+
+func (m *mockCompletionProvider) completionValues(line string, pos int) []string {
 	// Check for exact prefix matches first
 	if strings.HasPrefix(line, "git ch") {
 		return []string{"git checkout", "git cherry-pick"}
@@ -207,3 +212,283 @@ func TestUpdate(t *testing.T) {
 	updatedModel, _ = updatedModel.Update(msg)
 	assert.Equal(t, len(updatedModel.Value()), updatedModel.Position(), "End key should move the cursor to the end of the line")
 }
+
+func TestCycleSuggestions(t *testing.T) {
+	model := New()
+	model.Focus()
+	model.ShowSuggestions = true
+	model.SetSuggestions([]string{"git status", "git stash", "ls -la"})
+	model.SetValue("git st")
+	model.updateSuggestions()
+
+	assert.Equal(t, []string{"git status", "git stash"}, model.MatchedSuggestions())
+	assert.Equal(t, "git status", model.CurrentSuggestion())
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}, Alt: true})
+	assert.Equal(t, "git stash", model.CurrentSuggestion())
+	assert.Equal(t, "git st", model.Value(), "cycling should not change the input")
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{']'}, Alt: true})
+	assert.Equal(t, "git status", model.CurrentSuggestion(), "cycling should wrap around")
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'['}, Alt: true})
+	assert.Equal(t, "git stash", model.CurrentSuggestion())
+}
+
+func typeText(model Model, text string) Model {
+	for _, r := range text {
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return model
+}
+
+func TestUndoRedo(t *testing.T) {
+	model := New()
+	model.Focus()
+
+	undo := tea.KeyMsg{Type: tea.KeyCtrlUnderscore}
+	redo := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'_'}, Alt: true}
+
+	model = typeText(model, "git commit -m fix")
+
+	// A mistaken Ctrl+U can be undone
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlU})
+	assert.Equal(t, "", model.Value())
+	model, _ = model.Update(undo)
+	assert.Equal(t, "git commit -m fix", model.Value(), "Undo should restore the deleted text")
+	assert.Equal(t, 17, model.Position(), "Undo should restore the cursor position")
+
+	// Consecutive typing is undone at once
+	model, _ = model.Update(undo)
+	assert.Equal(t, "", model.Value(), "Undo should remove all typed text at once")
+	model, _ = model.Update(undo)
+	assert.Equal(t, "", model.Value(), "Undo with nothing to undo should do nothing")
+
+	model, _ = model.Update(redo)
+	assert.Equal(t, "git commit -m fix", model.Value(), "Redo should bring back the typed text")
+	model, _ = model.Update(redo)
+	assert.Equal(t, "", model.Value(), "Redo should apply the Ctrl+U again")
+	model, _ = model.Update(undo)
+	assert.Equal(t, "git commit -m fix", model.Value())
+
+	// Each deletion is a separate step, and moving the cursor ends a run of typing
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	assert.Equal(t, "git commit -m ", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+	model = typeText(model, "echo ")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlE})
+	model = typeText(model, "wip")
+	assert.Equal(t, "echo git commit -m wip", model.Value())
+
+	model, _ = model.Update(undo)
+	assert.Equal(t, "echo git commit -m ", model.Value())
+	model, _ = model.Update(undo)
+	assert.Equal(t, "git commit -m ", model.Value())
+	model, _ = model.Update(undo)
+	assert.Equal(t, "git commit -m fix", model.Value())
+
+	// A new edit forgets what was undone
+	model = typeText(model, "!")
+	model, _ = model.Update(redo)
+	assert.Equal(t, "git commit -m fix!", model.Value(), "Redo after a new edit should do nothing")
+
+	// Browsing history is not undone
+	model.SetHistoryValues([]string{"ls"})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, "ls", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	model, _ = model.Update(undo)
+	assert.Equal(t, "git commit -m fix", model.Value())
+}
+
+func TestKillRing(t *testing.T) {
+	model := New()
+	model.Focus()
+
+	yank := tea.KeyMsg{Type: tea.KeyCtrlY}
+	yankPop := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}, Alt: true}
+
+	// Yank-pop does nothing unless it follows a yank
+	model.SetValue("echo hello world")
+	model, _ = model.Update(yankPop)
+	assert.Equal(t, "echo hello world", model.Value())
+
+	// Consecutive kills are yanked back together
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	assert.Equal(t, "echo ", model.Value())
+	model, _ = model.Update(yank)
+	assert.Equal(t, "echo hello world", model.Value(), "Ctrl+Y should yank both killed words")
+
+	// A separate kill starts a new entry
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}, Alt: true})
+	assert.Equal(t, " hello world", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlK})
+	assert.Equal(t, "", model.Value(), "Ctrl+K should kill the rest of the line")
+
+	model, _ = model.Update(yank)
+	assert.Equal(t, "echo hello world", model.Value(), "Forward kills should be joined in order")
+	model, _ = model.Update(yankPop)
+	assert.Equal(t, "hello world", model.Value(), "Alt+Y should replace the yank with the previous kill")
+	model, _ = model.Update(yankPop)
+	assert.Equal(t, "echo hello world", model.Value(), "Alt+Y should rotate back to the newest kill")
+
+	// Yanking is undone in one step, and yank-pop stops working after other keys
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlUnderscore})
+	assert.Equal(t, "", model.Value())
+	model = typeText(model, "ls ")
+	model, _ = model.Update(yankPop)
+	assert.Equal(t, "ls ", model.Value())
+}
+
+func TestPasteKillRing(t *testing.T) {
+	model := New()
+	model.Focus()
+
+	model.SetValue("make build")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlW})
+	assert.Equal(t, "make ", model.Value())
+
+	// Pasted text can be rotated through the kill ring like a yank
+	model, _ = model.Update(pasteMsg("test"))
+	assert.Equal(t, "make test", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}, Alt: true})
+	assert.Equal(t, "make build", model.Value(), "Alt+Y after a paste should yank the previous kill")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}, Alt: true})
+	assert.Equal(t, "make test", model.Value(), "The pasted text should be in the kill ring")
+
+	// The paste is undone in one step
+	model.SetValue("make ")
+	model, _ = model.Update(pasteMsg("install clean"))
+	assert.Equal(t, "make install clean", model.Value())
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlUnderscore})
+	assert.Equal(t, "make ", model.Value())
+}
+
+// candidateCompletionProvider returns the same candidates for any input
+type candidateCompletionProvider struct {
+	candidates []CompletionCandidate
+}
+
+func (c *candidateCompletionProvider) GetCompletions(line string, pos int) []CompletionCandidate {
+	return c.candidates
+}
+
+func (c *candidateCompletionProvider) GetHelpInfo(line string, pos int) string {
+	return ""
+}
+
+func TestCompletionBoxView(t *testing.T) {
+	model := New()
+	model.Focus()
+	model.CompletionProvider = &candidateCompletionProvider{candidates: []CompletionCandidate{
+		{Value: "status", Description: "Show the working tree status", Kind: CompletionCommand},
+		{Value: "src/", Kind: CompletionDirectory},
+		{Value: "--verbose", Display: "-v, --verbose", Description: "Be verbose", Kind: CompletionFlag},
+	}}
+	model.SetValue("git s")
+	model.SetCursor(5)
+
+	updatedModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyTab})
+	assert.Equal(t, "git status", updatedModel.Value())
+	assert.Equal(t, strings.Join([]string{
+		"     > λ status         Show the working tree status",
+		"       ▸ src/",
+		"       - -v, --verbose  Be verbose",
+	}, "\n"), updatedModel.CompletionBoxView())
+
+	t.Run("long descriptions are cut to the width", func(t *testing.T) {
+		updatedModel.Width = 30
+		assert.Equal(t, "     > λ status         Show …", strings.Split(updatedModel.CompletionBoxView(), "\n")[0])
+	})
+
+	t.Run("candidates without kinds or descriptions", func(t *testing.T) {
+		model := New()
+		model.Focus()
+		model.CompletionProvider = &mockCompletionProvider{}
+		model.SetValue("gi")
+		model.SetCursor(2)
+		updatedModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyTab})
+		assert.Equal(t, "     > git\n       gist\n       give", updatedModel.CompletionBoxView())
+	})
+}
+
+// asyncCompletionProvider also has slow candidates for any input
+type asyncCompletionProvider struct {
+	candidateCompletionProvider
+	async []CompletionCandidate
+}
+
+func (c *asyncCompletionProvider) GetAsyncCompletions(line string, pos int) []CompletionCandidate {
+	return c.async
+}
+
+func TestAsyncCompletions(t *testing.T) {
+	aiCandidates := []CompletionCandidate{
+		{Value: "--all", Description: "Show everything", AI: true},
+		{Value: "--short", Description: "Give the output in the short format", AI: true},
+	}
+
+	t.Run("added below the other candidates", func(t *testing.T) {
+		model := New()
+		model.Focus()
+		model.CompletionProvider = &asyncCompletionProvider{
+			candidateCompletionProvider: candidateCompletionProvider{candidates: []CompletionCandidate{{Value: "--short", Kind: CompletionFlag}}},
+			async:                       aiCandidates,
+		}
+		model.SetValue("tool -")
+		model.SetCursor(6)
+
+		model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyTab})
+		assert.Equal(t, "tool --short", model.Value())
+		assert.Empty(t, model.CompletionBoxView())
+		require.NotNil(t, cmd)
+
+		model, _ = model.Update(cmd())
+		assert.Equal(t, "tool --short", model.Value())
+		assert.Equal(t, strings.Join([]string{
+			"     > - --short",
+			"       ✦ --all    Show everything",
+		}, "\n"), model.CompletionBoxView())
+
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyTab})
+		assert.Equal(t, "tool --all", model.Value())
+
+		// Cancelling goes back to the input before completion
+		model.cancelCompletion()
+		assert.Equal(t, "tool -", model.Value())
+	})
+
+	t.Run("shown when nothing else was found", func(t *testing.T) {
+		model := New()
+		model.Focus()
+		model.CompletionProvider = &asyncCompletionProvider{async: aiCandidates[:1]}
+		model.SetValue("tool -")
+		model.SetCursor(6)
+
+		model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyTab})
+		require.NotNil(t, cmd)
+		model, _ = model.Update(cmd())
+		assert.Equal(t, "tool -", model.Value())
+		assert.Equal(t, "       ✦ --all  Show everything", model.CompletionBoxView())
+
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyTab})
+		assert.Equal(t, "tool --all", model.Value())
+	})
+
+	t.Run("ignored once the input changed", func(t *testing.T) {
+		model := New()
+		model.Focus()
+		model.CompletionProvider = &asyncCompletionProvider{async: aiCandidates}
+		model.SetValue("tool -")
+		model.SetCursor(6)
+
+		model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyTab})
+		require.NotNil(t, cmd)
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+		model, _ = model.Update(cmd())
+		assert.Equal(t, "tool -x", model.Value())
+		assert.Empty(t, model.CompletionBoxView())
+	})
+}
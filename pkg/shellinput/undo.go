@@ -0,0 +1,76 @@
+package shellinput
+
+// How many edits can be undone
+const undoLimit = 100
+
+// editSnapshot is the input as it was before an edit
+type editSnapshot struct {
+	value []rune
+	pos   int
+}
+
+type editHistory struct {
+	undo []editSnapshot
+	redo []editSnapshot
+	// Whether typed characters join the last edit instead of starting a new
+	// one, so that undo removes a run of typing at once
+	typing bool
+}
+
+func (m *Model) snapshot() editSnapshot {
+	return editSnapshot{value: cloneRunes(m.values[m.selectedValueIndex]), pos: m.pos}
+}
+
+// recordEdit adds an undo step for a change made since before was taken.
+// Consecutive typing is recorded as a single step.
+func (m *Model) recordEdit(before editSnapshot, typing bool) {
+	if string(before.value) == string(m.values[m.selectedValueIndex]) {
+		if !typing {
+			m.edits.typing = false
+		}
+		return
+	}
+	if !typing || !m.edits.typing {
+		m.pushUndo(before)
+	}
+	m.edits.typing = typing
+}
+
+// pushUndo adds an undo step that restores snapshot, and forgets undone edits
+func (m *Model) pushUndo(snapshot editSnapshot) {
+	m.edits.undo = append(m.edits.undo, snapshot)
+	if len(m.edits.undo) > undoLimit {
+		m.edits.undo = m.edits.undo[1:]
+	}
+	m.edits.redo = nil
+}
+
+// undo reverts the last edit. It returns false when there is nothing to undo.
+func (m *Model) undo() bool {
+	if len(m.edits.undo) == 0 {
+		return false
+	}
+	m.edits.redo = append(m.edits.redo, m.snapshot())
+	m.restore(m.edits.undo[len(m.edits.undo)-1])
+	m.edits.undo = m.edits.undo[:len(m.edits.undo)-1]
+	return true
+}
+
+// redo applies the last undone edit again
+func (m *Model) redo() bool {
+	if len(m.edits.redo) == 0 {
+		return false
+	}
+	m.edits.undo = append(m.edits.undo, m.snapshot())
+	m.restore(m.edits.redo[len(m.edits.redo)-1])
+	m.edits.redo = m.edits.redo[:len(m.edits.redo)-1]
+	return true
+}
+
+func (m *Model) restore(snapshot editSnapshot) {
+	m.edits.typing = false
+	m.Err = m.validate(snapshot.value)
+	m.values[0] = cloneRunes(snapshot.value)
+	m.selectedValueIndex = 0
+	m.SetCursor(snapshot.pos)
+}
@@ -0,0 +1,706 @@
+package shellinput
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// EditingMode selects how keys edit the input, like readline's editing-mode
+type EditingMode int
+
+const (
+	// EditingModeEmacs inserts typed characters and edits through the key map
+	EditingModeEmacs EditingMode = iota
+	// EditingModeVi adds vi's normal and visual modes on top of insert mode
+	EditingModeVi
+)
+
+// Default prompt prefixes that show the current vi mode
+const (
+	DefaultViInsertModeString  = "(ins) "
+	DefaultViCommandModeString = "(cmd) "
+)
+
+type viMode int
+
+const (
+	viInsert viMode = iota
+	viNormal
+	viVisual
+)
+
+// viFind is the last f, F, t or T motion, repeated by ; and ,
+type viFind struct {
+	motion rune
+	target rune
+}
+
+type viState struct {
+	mode viMode
+
+	// Keys typed so far of a normal mode command
+	pending []tea.KeyMsg
+	// Keys of the last change, replayed by .
+	lastChange []tea.KeyMsg
+	// Keys of a change that is still being typed in insert mode
+	recording      []tea.KeyMsg
+	recordingInput bool
+	replaying      bool
+
+	visualStart int
+	register    []rune
+	lastFind    viFind
+
+	// The input before the current insert mode session, pushed to undo on Esc
+	insertStart *editSnapshot
+}
+
+// viCommand is a parsed normal mode command, such as 3dw or fx
+type viCommand struct {
+	count    int
+	operator rune
+	command  rune
+	arg      rune
+}
+
+// InViCommandMode reports whether keys are interpreted as vi commands
+// rather than inserted, i.e. the input is in vi's normal or visual mode
+func (m Model) InViCommandMode() bool {
+	return m.EditingMode == EditingModeVi && m.vi.mode != viInsert
+}
+
+// viModeIndicator returns the prompt prefix for the current vi mode
+func (m Model) viModeIndicator() string {
+	if m.EditingMode != EditingModeVi {
+		return ""
+	}
+	if m.vi.mode == viInsert {
+		return m.ViInsertModeString
+	}
+	return m.ViCommandModeString
+}
+
+// viSelection returns the range selected in visual mode
+func (m Model) viSelection() (int, int, bool) {
+	if m.EditingMode != EditingModeVi || m.vi.mode != viVisual {
+		return 0, 0, false
+	}
+	from, to := min(m.vi.visualStart, m.pos), max(m.vi.visualStart, m.pos)+1
+	return from, min(to, len(m.values[m.selectedValueIndex])), true
+}
+
+// handleViKey handles a key in vi mode. It returns false for keys that are
+// handled the same way as in emacs mode, which is most keys in insert mode.
+func (m *Model) handleViKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch m.vi.mode {
+	case viNormal:
+		return true, m.handleViNormalKey(msg)
+	case viVisual:
+		return true, m.handleViVisualKey(msg)
+	}
+
+	if msg.Type == tea.KeyEscape {
+		m.leaveViInsert(msg)
+		return true, nil
+	}
+	if msg.Alt && msg.Type == tea.KeyRunes && len(msg.Runes) == 1 {
+		// Escape quickly followed by a key arrives as a single alt key
+		m.leaveViInsert(tea.KeyMsg{Type: tea.KeyEscape})
+		return true, m.handleViNormalKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: msg.Runes})
+	}
+
+	if m.vi.insertStart == nil && !m.vi.replaying {
+		start := m.snapshot()
+		m.vi.insertStart = &start
+	}
+	if m.vi.recordingInput && !m.vi.replaying {
+		m.vi.recording = append(m.vi.recording, msg)
+	}
+	return false, nil
+}
+
+// enterViInsert switches to insert mode. Keys typed until Esc belong to the
+// change that started insert mode.
+func (m *Model) enterViInsert(before editSnapshot) {
+	m.vi.mode = viInsert
+	if !m.vi.replaying {
+		m.vi.insertStart = &before
+	}
+}
+
+func (m *Model) leaveViInsert(esc tea.KeyMsg) {
+	m.vi.mode = viNormal
+	if m.pos > 0 {
+		m.SetCursor(m.pos - 1)
+	}
+	if m.vi.replaying {
+		return
+	}
+
+	if m.vi.insertStart != nil && string(m.vi.insertStart.value) != string(m.values[m.selectedValueIndex]) {
+		m.pushUndo(*m.vi.insertStart)
+	}
+	m.vi.insertStart = nil
+	if m.vi.recordingInput {
+		m.vi.lastChange = append(m.vi.recording, esc)
+		m.vi.recording = nil
+		m.vi.recordingInput = false
+	}
+}
+
+func (m *Model) handleViNormalKey(msg tea.KeyMsg) tea.Cmd {
+	if msg.Type == tea.KeyBackspace && len(m.vi.pending) == 0 {
+		msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'h'}}
+	}
+	if msg.Type == tea.KeyEscape {
+		m.vi.pending = nil
+		return nil
+	}
+	if msg.Type == tea.KeyCtrlR {
+		m.vi.pending = nil
+		m.redo()
+		m.clampViCursor()
+		return nil
+	}
+	if _, ok := viKeyRune(msg); !ok {
+		// Keys such as arrows and control keys work as in insert mode
+		m.vi.pending = nil
+		_, cmd := m.handleKey(msg)
+		m.clampViCursor()
+		return cmd
+	}
+
+	m.vi.pending = append(m.vi.pending, msg)
+	command, complete, valid := parseViCommand(m.vi.pending)
+	if !valid {
+		m.vi.pending = nil
+		return nil
+	}
+	if !complete {
+		return nil
+	}
+	keys := m.vi.pending
+	m.vi.pending = nil
+
+	if command.command == '.' && command.operator == 0 {
+		m.repeatViChange(command.count)
+		return nil
+	}
+
+	before := m.snapshot()
+	m.executeViCommand(command)
+	if !isViChange(command) || m.vi.replaying {
+		m.clampViCursor()
+		return nil
+	}
+
+	if m.vi.mode == viInsert {
+		m.vi.recording = keys
+		m.vi.recordingInput = true
+		return nil
+	}
+	m.vi.lastChange = keys
+	if string(before.value) != string(m.values[m.selectedValueIndex]) {
+		m.pushUndo(before)
+	}
+	m.clampViCursor()
+	return nil
+}
+
+func (m *Model) handleViVisualKey(msg tea.KeyMsg) tea.Cmd {
+	if msg.Type == tea.KeyEscape {
+		m.vi.pending = nil
+		m.vi.mode = viNormal
+		return nil
+	}
+	r, ok := viKeyRune(msg)
+	if !ok {
+		m.vi.pending = nil
+		_, cmd := m.handleKey(msg)
+		m.clampViCursor()
+		return cmd
+	}
+
+	if len(m.vi.pending) == 0 {
+		from, to, _ := m.viSelection()
+		before := m.snapshot()
+		switch r {
+		case 'v':
+			m.vi.mode = viNormal
+			return nil
+		case 'o':
+			m.vi.visualStart, m.pos = m.pos, m.vi.visualStart
+			return nil
+		case 'y':
+			m.vi.mode = viNormal
+			m.applyViOperator('y', from, to, before)
+			return nil
+		case 'd', 'x':
+			m.vi.mode = viNormal
+			m.applyViOperator('d', from, to, before)
+			m.pushUndo(before)
+			m.clampViCursor()
+			return nil
+		case 'c', 's':
+			m.applyViOperator('c', from, to, before)
+			return nil
+		case '~':
+			m.vi.mode = viNormal
+			m.toggleViCase(from, to)
+			m.SetCursor(from)
+			m.pushUndo(before)
+			return nil
+		}
+	}
+
+	// Anything else is a motion that extends the selection
+	m.vi.pending = append(m.vi.pending, msg)
+	command, complete, valid := parseViCommand(m.vi.pending)
+	if valid && !complete {
+		return nil
+	}
+	m.vi.pending = nil
+	if !valid || command.operator != 0 || !isViMotion(command.command) {
+		return nil
+	}
+	if target, _, ok := m.viMotion(command.command, command.arg, max(1, command.count)); ok {
+		m.SetCursor(target)
+	}
+	m.clampViCursor()
+	return nil
+}
+
+// repeatViChange replays the keys of the last change, count times
+func (m *Model) repeatViChange(count int) {
+	if len(m.vi.lastChange) == 0 {
+		return
+	}
+
+	before := m.snapshot()
+	m.vi.replaying = true
+	for i := 0; i < max(1, count); i++ {
+		for _, msg := range m.vi.lastChange {
+			if handled, _ := m.handleViKey(msg); !handled {
+				m.handleKey(msg)
+			}
+		}
+	}
+	m.vi.replaying = false
+
+	if string(before.value) != string(m.values[m.selectedValueIndex]) {
+		m.pushUndo(before)
+	}
+	m.clampViCursor()
+}
+
+func (m *Model) executeViCommand(command viCommand) {
+	count := max(1, command.count)
+	value := m.values[m.selectedValueIndex]
+	before := m.snapshot()
+	start, end := lineBounds(value, m.pos)
+
+	if command.operator != 0 {
+		from, to := m.viLines(command.operator, count)
+		if command.command != command.operator {
+			target, inclusive, ok := m.viOperatorMotion(command, count)
+			if !ok {
+				return
+			}
+			from, to = min(m.pos, target), max(m.pos, target)
+			if inclusive {
+				to++
+			}
+			to = min(to, len(value))
+		}
+		m.applyViOperator(command.operator, from, to, before)
+		return
+	}
+
+	switch command.command {
+	case 'i':
+		m.enterViInsert(before)
+	case 'a':
+		if m.pos < end {
+			m.SetCursor(m.pos + 1)
+		}
+		m.enterViInsert(before)
+	case 'I':
+		m.SetCursor(start + viFirstNonBlank(value[start:end]))
+		m.enterViInsert(before)
+	case 'A':
+		m.SetCursor(end)
+		m.enterViInsert(before)
+	case 'x':
+		m.applyViOperator('d', m.pos, min(m.pos+count, end), before)
+	case 'X':
+		m.applyViOperator('d', max(start, m.pos-count), m.pos, before)
+	case 's':
+		m.applyViOperator('c', m.pos, min(m.pos+count, end), before)
+	case 'S':
+		m.applyViOperator('c', start, end, before)
+	case 'C':
+		m.applyViOperator('c', m.pos, end, before)
+	case 'D':
+		m.applyViOperator('d', m.pos, end, before)
+	case 'Y':
+		m.vi.register = cloneRunes(value[start:end])
+	case 'r':
+		if m.pos+count > end {
+			return
+		}
+		newValue := cloneRunes(value)
+		for i := m.pos; i < m.pos+count; i++ {
+			newValue[i] = command.arg
+		}
+		m.setValue(newValue)
+		m.SetCursor(m.pos + count - 1)
+	case '~':
+		to := min(m.pos+count, end)
+		m.toggleViCase(m.pos, to)
+		m.SetCursor(to)
+	case 'p', 'P':
+		if len(m.vi.register) == 0 {
+			return
+		}
+		at := m.pos
+		if command.command == 'p' && len(value) > 0 {
+			at++
+		}
+		text := []rune(strings.Repeat(string(m.vi.register), count))
+		m.setValue(cloneConcatRunes(cloneConcatRunes(value[:at], text), value[at:]))
+		m.SetCursor(at + len(text) - 1)
+	case 'u':
+		m.undo()
+	case 'v':
+		m.vi.mode = viVisual
+		m.vi.visualStart = m.pos
+	case 'j':
+		for i := 0; i < count; i++ {
+			if !m.cursorLineDown() {
+				m.nextValue()
+			}
+		}
+	case 'k':
+		for i := 0; i < count; i++ {
+			if !m.cursorLineUp() {
+				m.previousValue()
+			}
+		}
+	default:
+		if target, _, ok := m.viMotion(command.command, command.arg, count); ok {
+			m.SetCursor(target)
+		}
+	}
+}
+
+// viOperatorMotion returns where the motion of an operator ends
+func (m *Model) viOperatorMotion(command viCommand, count int) (int, bool, bool) {
+	value := m.values[m.selectedValueIndex]
+	bigWord := command.command == 'W'
+	if command.operator == 'c' && (command.command == 'w' || bigWord) &&
+		m.pos < len(value) && !unicode.IsSpace(value[m.pos]) {
+		// cw changes to the end of the word, leaving the following space alone
+		target := m.pos
+		for i := 0; i < count; i++ {
+			if i > 0 || (target+1 < len(value) && viCharClass(value[target+1], bigWord) == viCharClass(value[target], bigWord)) {
+				target = viWordEnd(value, target, bigWord)
+			}
+		}
+		return target, true, true
+	}
+	return m.viMotion(command.command, command.arg, count)
+}
+
+// viLines returns the range of count lines from the cursor's for dd, cc and yy.
+// For dd, which removes whole lines, the range includes a newline.
+func (m *Model) viLines(operator rune, count int) (int, int) {
+	value := m.values[m.selectedValueIndex]
+	from, to := lineBounds(value, m.pos)
+	for i := 1; i < count && to < len(value); i++ {
+		_, to = lineBounds(value, to+1)
+	}
+	if operator == 'd' {
+		if to < len(value) {
+			to++
+		} else if from > 0 {
+			from--
+		}
+	}
+	return from, to
+}
+
+// applyViOperator deletes, changes or yanks the text between from and to
+func (m *Model) applyViOperator(operator rune, from int, to int, before editSnapshot) {
+	value := m.values[m.selectedValueIndex]
+	m.vi.register = cloneRunes(value[from:to])
+	if operator != 'y' {
+		m.setValue(cloneConcatRunes(value[:from], value[to:]))
+	}
+	m.SetCursor(from)
+	if operator == 'c' {
+		m.enterViInsert(before)
+	}
+}
+
+// viMotion returns where a motion moves the cursor, and whether the character
+// there is included when an operator is applied to the motion
+func (m *Model) viMotion(motion rune, arg rune, count int) (int, bool, bool) {
+	value := m.values[m.selectedValueIndex]
+	pos := m.pos
+	start, end := lineBounds(value, pos)
+
+	switch motion {
+	case 'h':
+		return max(start, pos-count), false, pos > start
+	case 'l', ' ':
+		return min(end, pos+count), false, pos < end
+	case 'w', 'W':
+		for i := 0; i < count; i++ {
+			pos = viWordForward(value, pos, motion == 'W')
+		}
+		return pos, false, true
+	case 'b', 'B':
+		for i := 0; i < count; i++ {
+			pos = viWordBackward(value, pos, motion == 'B')
+		}
+		return pos, false, true
+	case 'e', 'E':
+		for i := 0; i < count; i++ {
+			pos = viWordEnd(value, pos, motion == 'E')
+		}
+		return pos, true, len(value) > 0
+	case '0':
+		return start, false, true
+	case '^':
+		return start + viFirstNonBlank(value[start:end]), false, true
+	case '$':
+		return max(start, end-1), end > start, true
+	case 'f', 'F', 't', 'T':
+		m.vi.lastFind = viFind{motion: motion, target: arg}
+		target, inclusive, ok := viFindChar(value[start:end], pos-start, motion, arg, count)
+		return start + target, inclusive, ok
+	case ';', ',':
+		find := m.vi.lastFind
+		if find.motion == 0 {
+			return pos, false, false
+		}
+		if motion == ',' {
+			find.motion = map[rune]rune{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[find.motion]
+		}
+		target, inclusive, ok := viFindChar(value[start:end], pos-start, find.motion, find.target, count)
+		return start + target, inclusive, ok
+	}
+	return pos, false, false
+}
+
+func (m *Model) toggleViCase(from int, to int) {
+	newValue := cloneRunes(m.values[m.selectedValueIndex])
+	for i := from; i < to; i++ {
+		if unicode.IsUpper(newValue[i]) {
+			newValue[i] = unicode.ToLower(newValue[i])
+		} else {
+			newValue[i] = unicode.ToUpper(newValue[i])
+		}
+	}
+	m.setValue(newValue)
+}
+
+// clampViCursor keeps the cursor on a character, as normal mode has no
+// position after the end of a line
+func (m *Model) clampViCursor() {
+	if m.vi.mode == viInsert {
+		return
+	}
+	if start, end := lineBounds(m.values[m.selectedValueIndex], m.pos); m.pos >= end && end > start {
+		m.SetCursor(end - 1)
+	}
+}
+
+// parseViCommand parses the keys of a normal mode command. complete is false
+// while more keys are needed, and valid is false for keys that form no command.
+func parseViCommand(keys []tea.KeyMsg) (command viCommand, complete bool, valid bool) {
+	runes := make([]rune, 0, len(keys))
+	for _, msg := range keys {
+		r, ok := viKeyRune(msg)
+		if !ok {
+			return command, false, false
+		}
+		runes = append(runes, r)
+	}
+
+	i := 0
+	readCount := func() int {
+		count := 0
+		for i < len(runes) && unicode.IsDigit(runes[i]) && (runes[i] != '0' || count > 0) {
+			count = count*10 + int(runes[i]-'0')
+			i++
+		}
+		return count
+	}
+	next := func() (rune, bool) {
+		if i == len(runes) {
+			return 0, false
+		}
+		i++
+		return runes[i-1], true
+	}
+
+	command.count = readCount()
+	r, ok := next()
+	if !ok {
+		return command, false, true
+	}
+	if r == 'd' || r == 'c' || r == 'y' {
+		command.operator = r
+		if count := readCount(); count > 0 {
+			command.count = max(1, command.count) * count
+		}
+		if r, ok = next(); !ok {
+			return command, false, true
+		}
+		if r != command.operator && !isViMotion(r) {
+			return command, false, false
+		}
+	} else if !isViMotion(r) && !strings.ContainsRune("iaIAxXsSCDYr~pPu.vjk", r) {
+		return command, false, false
+	}
+	command.command = r
+
+	if strings.ContainsRune("fFtTr", r) {
+		if command.arg, ok = next(); !ok {
+			return command, false, true
+		}
+	}
+	return command, i == len(runes), true
+}
+
+func isViMotion(r rune) bool {
+	return strings.ContainsRune("hl wWbBeE0^$fFtT;,", r)
+}
+
+// isViChange reports whether a command changes the input, so that it can be repeated with .
+func isViChange(command viCommand) bool {
+	if command.operator != 0 {
+		return command.operator != 'y'
+	}
+	return strings.ContainsRune("iaIAxXsSCDr~pP", command.command)
+}
+
+// viKeyRune returns the character of a key typed in normal mode
+func viKeyRune(msg tea.KeyMsg) (rune, bool) {
+	switch {
+	case msg.Type == tea.KeySpace:
+		return ' ', true
+	case msg.Type == tea.KeyRunes && len(msg.Runes) == 1 && !msg.Alt:
+		return msg.Runes[0], true
+	}
+	return 0, false
+}
+
+// viCharClass tells apart blanks, word characters and punctuation. Big words
+// only tell apart blanks from everything else.
+func viCharClass(r rune, bigWord bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case bigWord || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func viWordForward(value []rune, pos int, bigWord bool) int {
+	if pos >= len(value) {
+		return len(value)
+	}
+	class := viCharClass(value[pos], bigWord)
+	for pos < len(value) && class != 0 && viCharClass(value[pos], bigWord) == class {
+		pos++
+	}
+	for pos < len(value) && viCharClass(value[pos], bigWord) == 0 {
+		pos++
+	}
+	return pos
+}
+
+func viWordBackward(value []rune, pos int, bigWord bool) int {
+	pos--
+	for pos > 0 && viCharClass(value[pos], bigWord) == 0 {
+		pos--
+	}
+	if pos <= 0 {
+		return 0
+	}
+	class := viCharClass(value[pos], bigWord)
+	for pos > 0 && viCharClass(value[pos-1], bigWord) == class {
+		pos--
+	}
+	return pos
+}
+
+func viWordEnd(value []rune, pos int, bigWord bool) int {
+	pos++
+	for pos < len(value) && viCharClass(value[pos], bigWord) == 0 {
+		pos++
+	}
+	if pos >= len(value) {
+		return max(0, len(value)-1)
+	}
+	class := viCharClass(value[pos], bigWord)
+	for pos+1 < len(value) && viCharClass(value[pos+1], bigWord) == class {
+		pos++
+	}
+	return pos
+}
+
+func viFirstNonBlank(value []rune) int {
+	for i, r := range value {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return max(0, len(value)-1)
+}
+
+// viFindChar finds the count-th target character for an f, F, t or T motion
+func viFindChar(value []rune, pos int, motion rune, target rune, count int) (int, bool, bool) {
+	switch motion {
+	case 'f', 't':
+		for i := pos + 1; i < len(value); i++ {
+			if value[i] != target {
+				continue
+			}
+			if count--; count == 0 {
+				if motion == 't' {
+					return i - 1, true, true
+				}
+				return i, true, true
+			}
+		}
+	case 'F', 'T':
+		for i := pos - 1; i >= 0; i-- {
+			if value[i] != target {
+				continue
+			}
+			if count--; count == 0 {
+				if motion == 'T' {
+					return i + 1, false, true
+				}
+				return i, false, true
+			}
+		}
+	}
+	return pos, false, false
+}
+
+// ResetViMode returns to insert mode, as at the start of a new line
+func (m *Model) ResetViMode() {
+	m.vi.mode = viInsert
+	m.vi.pending = nil
+	m.vi.insertStart = nil
+	m.vi.recording = nil
+	m.vi.recordingInput = false
+}
@@ -0,0 +1,241 @@
+package shellinput
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+// viKeys converts typed keys to messages, with <esc>, <bs> and <c-r> for Escape, Backspace and Ctrl+R
+func viKeys(keys string) []tea.KeyMsg {
+	var msgs []tea.KeyMsg
+	for keys != "" {
+		switch {
+		case strings.HasPrefix(keys, "<esc>"):
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyEscape})
+			keys = keys[len("<esc>"):]
+			continue
+		case strings.HasPrefix(keys, "<c-r>"):
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyCtrlR})
+			keys = keys[len("<c-r>"):]
+			continue
+		case strings.HasPrefix(keys, "<bs>"):
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyBackspace})
+			keys = keys[len("<bs>"):]
+			continue
+		case keys[0] == ' ':
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+		default:
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{rune(keys[0])}})
+		}
+		keys = keys[1:]
+	}
+	return msgs
+}
+
+func typeKeys(model Model, keys string) Model {
+	for _, msg := range viKeys(keys) {
+		model, _ = model.Update(msg)
+	}
+	return model
+}
+
+// newViModel returns a model in vi normal mode with the cursor at pos
+func newViModel(value string, pos int) Model {
+	model := New()
+	model.Focus()
+	model.EditingMode = EditingModeVi
+	model.SetValue(value)
+	model = typeKeys(model, "<esc>")
+	model.SetCursor(pos)
+	return model
+}
+
+func TestViMotions(t *testing.T) {
+	tests := []struct {
+		value    string
+		pos      int
+		keys     string
+		expected int
+	}{
+		{"echo hello world", 0, "w", 5},
+		{"echo hello world", 0, "2w", 11},
+		{"echo hello world", 0, "3w", 15},
+		{"echo hello world", 0, "e", 3},
+		{"echo hello world", 0, "ee", 9},
+		{"echo hello world", 11, "b", 5},
+		{"echo hello world", 11, "2b", 0},
+		{"echo hello world", 0, "$", 15},
+		{"echo hello world", 8, "0", 0},
+		{"   ls", 4, "^", 3},
+		{"echo hello world", 0, "l", 1},
+		{"echo hello world", 0, "3l", 3},
+		{"echo hello world", 0, "  ", 2},
+		{"echo hello world", 4, "h", 3},
+		{"echo hello world", 4, "<bs>", 3},
+		{"echo hello world", 0, "fo", 3},
+		{"echo hello world", 0, "2fo", 9},
+		{"echo hello world", 0, "tl", 6},
+		{"echo hello world", 0, "fl;", 8},
+		{"echo hello world", 0, "fl;,", 7},
+		{"echo hello world", 15, "Fo", 12},
+		{"echo hello world", 15, "To", 13},
+		{"echo hello world", 0, "fz", 0},
+		{"a.b-c d", 0, "w", 1},
+		{"a.b-c d", 0, "W", 6},
+		{"a.b-c d", 6, "B", 0},
+		{"a.b-c d", 0, "E", 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value+"/"+test.keys, func(t *testing.T) {
+			model := typeKeys(newViModel(test.value, test.pos), test.keys)
+			assert.Equal(t, test.value, model.Value())
+			assert.Equal(t, test.expected, model.Position())
+			assert.True(t, model.InViCommandMode())
+		})
+	}
+}
+
+func TestViEditing(t *testing.T) {
+	tests := []struct {
+		value       string
+		pos         int
+		keys        string
+		expected    string
+		expectedPos int
+	}{
+		{"echo hello world", 0, "dw", "hello world", 0},
+		{"echo hello world", 0, "d2w", "world", 0},
+		{"echo hello world", 0, "2dw", "world", 0},
+		{"echo hello world", 0, "de", " hello world", 0},
+		{"echo hello world", 11, "db", "echo world", 5},
+		{"echo hello world", 5, "dfl", "echo lo world", 5},
+		{"echo hello world", 5, "dtl", "echo llo world", 5},
+		{"echo hello world", 5, "d$", "echo ", 4},
+		{"echo hello world", 5, "D", "echo ", 4},
+		{"echo hello world", 5, "dd", "", 0},
+		{"echo hello world", 0, "x", "cho hello world", 0},
+		{"echo hello world", 0, "3x", "o hello world", 0},
+		{"echo hello world", 5, "X", "echohello world", 4},
+		{"echo hello world", 15, "x", "echo hello worl", 14},
+		{"echo hello world", 0, "cwbye<esc>", "bye hello world", 2},
+		{"echo hello world", 0, "c2wbye<esc>", "bye world", 2},
+		{"a b", 0, "cwx<esc>", "x b", 0},
+		{"echo hello world", 5, "Cthere<esc>", "echo there", 9},
+		{"echo hello world", 5, "ccls<esc>", "ls", 1},
+		{"echo hello world", 5, "Sls<esc>", "ls", 1},
+		{"echo hello world", 0, "sE<esc>", "Echo hello world", 0},
+		{"echo hello world", 0, "rX", "Xcho hello world", 0},
+		{"echo hello world", 0, "3rX", "XXXo hello world", 2},
+		{"echo hello world", 0, "3~", "ECHo hello world", 3},
+		{"echo hello world", 0, "ywP", "echo echo hello world", 4},
+		{"echo hello world", 0, "xp", "ceho hello world", 1},
+		{"echo hello world", 0, "yw$p", "echo hello worldecho ", 20},
+		{"echo hello world", 0, "A!<esc>", "echo hello world!", 16},
+		{"echo hello world", 5, "I# <esc>", "# echo hello world", 1},
+		{"echo hello world", 0, "aX<esc>", "eXcho hello world", 1},
+		{"echo hello world", 4, "i-n<esc>", "echo-n hello world", 5},
+		{"echo hello world", 0, "vlld", "o hello world", 0},
+		{"echo hello world", 5, "vecbye<esc>", "echo bye world", 7},
+		{"echo hello world", 0, "v$~", "ECHO HELLO WORLD", 0},
+		{"echo hello world", 0, "vey$p", "echo hello worldecho", 19},
+		{"echo hello world", 5, "veohd", "echo world", 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value+"/"+test.keys, func(t *testing.T) {
+			model := typeKeys(newViModel(test.value, test.pos), test.keys)
+			assert.Equal(t, test.expected, model.Value())
+			assert.Equal(t, test.expectedPos, model.Position())
+		})
+	}
+}
+
+func TestViRepeatAndUndo(t *testing.T) {
+	tests := []struct {
+		value    string
+		pos      int
+		keys     string
+		expected string
+	}{
+		{"echo hello world", 0, "dw.", "world"},
+		{"echo hello world", 0, "x..", "o hello world"},
+		{"echo hello world", 0, "x3.", " hello world"},
+		{"echo hello world", 0, "cwbye<esc>w.", "bye bye world"},
+		{"echo hello world", 0, "A!<esc>.", "echo hello world!!"},
+		{"echo hello world", 0, "dwu", "echo hello world"},
+		{"echo hello world", 0, "dwdwuu", "echo hello world"},
+		{"echo hello world", 0, "dwdwu", "hello world"},
+		{"echo hello world", 0, "dwdwuu<c-r>", "hello world"},
+		{"echo hello world", 0, "dwu<c-r><c-r>", "hello world"},
+		{"echo hello world", 0, "dwux<c-r>", "cho hello world"},
+		{"echo hello world", 0, "cwbye<esc>u", "echo hello world"},
+		{"echo hello world", 0, "dw.u", "hello world"},
+		{"echo hello world", 0, "ywu", "echo hello world"},
+		{"echo hello world", 0, "i<esc>u", "echo hello world"},
+		{"echo hello world", 0, "vd", "cho hello world"},
+		{"echo hello world", 0, "vdu", "echo hello world"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value+"/"+test.keys, func(t *testing.T) {
+			model := typeKeys(newViModel(test.value, test.pos), test.keys)
+			assert.Equal(t, test.expected, model.Value())
+		})
+	}
+}
+
+func TestViInsertMode(t *testing.T) {
+	model := New()
+	model.Focus()
+	model.EditingMode = EditingModeVi
+	assert.False(t, model.InViCommandMode(), "vi mode starts in insert mode")
+	assert.Contains(t, model.View(), DefaultViInsertModeString+model.Prompt)
+
+	model = typeKeys(model, "ls -la")
+	assert.Equal(t, "ls -la", model.Value())
+
+	model = typeKeys(model, "<esc>")
+	assert.True(t, model.InViCommandMode())
+	assert.Equal(t, 5, model.Position(), "Esc moves the cursor onto the last character")
+	assert.Contains(t, model.View(), DefaultViCommandModeString+model.Prompt)
+
+	// Undo removes everything typed in insert mode at once
+	model = typeKeys(model, "u")
+	assert.Equal(t, "", model.Value())
+
+	// Escape quickly followed by a key arrives as an alt key
+	model = typeKeys(model, "iecho hi")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'b'}, Alt: true})
+	assert.True(t, model.InViCommandMode())
+	assert.Equal(t, 5, model.Position())
+
+	model.ResetViMode()
+	assert.False(t, model.InViCommandMode())
+}
+
+func TestViHistory(t *testing.T) {
+	model := newViModel("", 0)
+	model.SetHistoryValues([]string{"git status", "make"})
+
+	model = typeKeys(model, "k")
+	assert.Equal(t, "git status", model.Value())
+	assert.Equal(t, 9, model.Position())
+	model = typeKeys(model, "k")
+	assert.Equal(t, "make", model.Value())
+	model = typeKeys(model, "2j")
+	assert.Equal(t, "", model.Value())
+}
+
+func TestEmacsModeIgnoresViKeys(t *testing.T) {
+	model := New()
+	model.Focus()
+	model.SetValue("echo")
+	model = typeKeys(model, "<esc>dw")
+	assert.Equal(t, "echodw", model.Value())
+	assert.False(t, model.InViCommandMode())
+	assert.NotContains(t, model.View(), DefaultViInsertModeString)
+}